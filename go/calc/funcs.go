@@ -3,6 +3,7 @@ package calc
 import (
 	"fmt"
 	"math"
+	"sort"
 	"strconv"
 
 	"go.skia.org/infra/go/vec32"
@@ -393,3 +394,382 @@ func (LogFunc) Describe() string {
 }
 
 var logFunc = LogFunc{}
+
+// numArg returns the value of the argument at index i of the node, which
+// must be a number.
+func numArg(name string, node *Node, i int) (float64, error) {
+	if node.Args[i].Typ != NodeNum {
+		return 0, fmt.Errorf("%s() takes a number as argument %d.", name, i+1)
+	}
+	f, err := strconv.ParseFloat(node.Args[i].Val, 32)
+	if err != nil {
+		return 0, fmt.Errorf("%s() argument %d not a valid number %s : %s", name, i+1, node.Args[i].Val, err)
+	}
+	return f, nil
+}
+
+// foldRows returns a single row where each value is f() applied to the
+// non-missing values of all the rows at that index. If all the values at an
+// index are vec32.MISSING_DATA_SENTINEL then the value will be
+// vec32.MISSING_DATA_SENTINEL.
+func foldRows(rows Rows, f func([]float32) float32) []float32 {
+	ret := newRow(rows)
+	values := make([]float32, 0, len(rows))
+	for i, _ := range ret {
+		values = values[:0]
+		for _, r := range rows {
+			if v := r[i]; v != vec32.MISSING_DATA_SENTINEL {
+				values = append(values, v)
+			}
+		}
+		if len(values) > 0 {
+			ret[i] = f(values)
+		}
+	}
+	return ret
+}
+
+// percentile returns the p-th percentile of the values, interpolating
+// linearly between the closest ranks. The values are sorted in place.
+func percentile(values []float32, p float64) float32 {
+	sort.Sort(float32Slice(values))
+	rank := p / 100 * float64(len(values)-1)
+	lo := int(math.Floor(rank))
+	hi := int(math.Ceil(rank))
+	frac := float32(rank - float64(lo))
+	return values[lo] + frac*(values[hi]-values[lo])
+}
+
+type float32Slice []float32
+
+func (p float32Slice) Len() int           { return len(p) }
+func (p float32Slice) Less(i, j int) bool { return p[i] < p[j] }
+func (p float32Slice) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
+
+// foldFunc implements Func for functions that fold the values of all
+// argument rows into a single row, such as min() or max().
+type foldFunc struct {
+	name     string
+	fold     func([]float32) float32
+	describe string
+}
+
+func (f foldFunc) Eval(ctx *Context, node *Node) (Rows, error) {
+	if len(node.Args) != 1 {
+		return nil, fmt.Errorf("%s() takes a single argument.", f.name)
+	}
+	if node.Args[0].Typ != NodeFunc {
+		return nil, fmt.Errorf("%s() takes a function argument.", f.name)
+	}
+	rows, err := node.Args[0].Eval(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%s() argument failed to evaluate: %s", f.name, err)
+	}
+
+	if len(rows) == 0 {
+		return rows, nil
+	}
+	return Rows{ctx.formula: foldRows(rows, f.fold)}, nil
+}
+
+func (f foldFunc) Describe() string {
+	return f.describe
+}
+
+var medianFunc = foldFunc{
+	name: "median",
+	fold: func(values []float32) float32 {
+		return percentile(values, 50)
+	},
+	describe: `median() folds the values of all argument rows into a single trace of their median.`,
+}
+
+var minFunc = foldFunc{
+	name: "min",
+	fold: func(values []float32) float32 {
+		ret := values[0]
+		for _, v := range values {
+			if v < ret {
+				ret = v
+			}
+		}
+		return ret
+	},
+	describe: `min() folds the values of all argument rows into a single trace of their minimum.`,
+}
+
+var maxFunc = foldFunc{
+	name: "max",
+	fold: func(values []float32) float32 {
+		ret := values[0]
+		for _, v := range values {
+			if v > ret {
+				ret = v
+			}
+		}
+		return ret
+	},
+	describe: `max() folds the values of all argument rows into a single trace of their maximum.`,
+}
+
+var stddevFunc = foldFunc{
+	name: "stddev",
+	fold: func(values []float32) float32 {
+		_, stddev, _ := vec32.MeanAndStdDev(values)
+		return stddev
+	},
+	describe: `stddev() folds the values of all argument rows into a single trace of their standard deviation.`,
+}
+
+type PercentileFunc struct{}
+
+// PercentileFunc implements Func and folds the values of all argument rows
+// into a single trace of their p-th percentile.
+//
+// vec32.MISSING_DATA_SENTINEL values are not included in the percentile.
+func (PercentileFunc) Eval(ctx *Context, node *Node) (Rows, error) {
+	if len(node.Args) != 2 {
+		return nil, fmt.Errorf("percentile() takes two arguments.")
+	}
+	if node.Args[0].Typ != NodeFunc {
+		return nil, fmt.Errorf("percentile() takes a function as its first argument.")
+	}
+	p, err := numArg("percentile", node, 1)
+	if err != nil {
+		return nil, err
+	}
+	if p < 0 || p > 100 {
+		return nil, fmt.Errorf("percentile() must be between 0 and 100, got %f.", p)
+	}
+	rows, err := node.Args[0].Eval(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("percentile() argument failed to evaluate: %s", err)
+	}
+
+	if len(rows) == 0 {
+		return rows, nil
+	}
+	ret := foldRows(rows, func(values []float32) float32 {
+		return percentile(values, p)
+	})
+	return Rows{ctx.formula: ret}, nil
+}
+
+func (PercentileFunc) Describe() string {
+	return `percentile(x, p) folds the values of all argument rows into a single trace of their p-th percentile.
+
+  The percentile p must be between 0 and 100.`
+}
+
+var percentileFunc = PercentileFunc{}
+
+type MovingAveFunc struct{}
+
+// MovingAveFunc implements Func and replaces each value in the rows with the
+// average of the trailing window of values that ends at that value.
+//
+// vec32.MISSING_DATA_SENTINEL values are not included in the average. If all
+// the values in a window are vec32.MISSING_DATA_SENTINEL then the average will
+// be vec32.MISSING_DATA_SENTINEL.
+func (MovingAveFunc) Eval(ctx *Context, node *Node) (Rows, error) {
+	if len(node.Args) != 2 {
+		return nil, fmt.Errorf("moving_ave() takes two arguments.")
+	}
+	if node.Args[0].Typ != NodeFunc {
+		return nil, fmt.Errorf("moving_ave() takes a function as its first argument.")
+	}
+	window, err := numArg("moving_ave", node, 1)
+	if err != nil {
+		return nil, err
+	}
+	if window < 1 || window != math.Floor(window) {
+		return nil, fmt.Errorf("moving_ave() window must be a positive integer, got %s.", node.Args[1].Val)
+	}
+	rows, err := node.Args[0].Eval(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("moving_ave() failed evaluating argument: %s", err)
+	}
+
+	n := int(window)
+	ret := Rows{}
+	for key, r := range rows {
+		row := make([]float32, len(r))
+		for i, _ := range r {
+			begin := i - n + 1
+			if begin < 0 {
+				begin = 0
+			}
+			row[i] = vec32.MISSING_DATA_SENTINEL
+			if mean, _, err := vec32.MeanAndStdDev(r[begin : i+1]); err == nil {
+				row[i] = mean
+			}
+		}
+		ret[fmt.Sprintf("moving_ave(%s,%d)", key, n)] = row
+	}
+	return ret, nil
+}
+
+func (MovingAveFunc) Describe() string {
+	return `moving_ave(x, n) replaces each value with the average of the window of n values that ends at that value.`
+}
+
+var movingAveFunc = MovingAveFunc{}
+
+type ShiftFunc struct{}
+
+// ShiftFunc implements Func and shifts all the values in the rows one commit
+// later, so that each value is the value at the previous commit.
+//
+// The first value of each row will be vec32.MISSING_DATA_SENTINEL.
+func (ShiftFunc) Eval(ctx *Context, node *Node) (Rows, error) {
+	if len(node.Args) != 1 {
+		return nil, fmt.Errorf("shift() takes a single argument.")
+	}
+	if node.Args[0].Typ != NodeFunc {
+		return nil, fmt.Errorf("shift() takes a function argument.")
+	}
+	rows, err := node.Args[0].Eval(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("shift() failed evaluating argument: %s", err)
+	}
+
+	ret := Rows{}
+	for key, r := range rows {
+		row := make([]float32, len(r))
+		for i, _ := range r {
+			if i == 0 {
+				row[i] = vec32.MISSING_DATA_SENTINEL
+			} else {
+				row[i] = r[i-1]
+			}
+		}
+		ret["shift("+key+")"] = row
+	}
+	return ret, nil
+}
+
+func (ShiftFunc) Describe() string {
+	return `shift() shifts the values one commit later, i.e. each value is the value at the previous commit.`
+}
+
+var shiftFunc = ShiftFunc{}
+
+type DeltaFunc struct{}
+
+// DeltaFunc implements Func and replaces each value in the rows with the
+// difference to the value at the previous commit.
+//
+// If either value is vec32.MISSING_DATA_SENTINEL then the difference will be
+// vec32.MISSING_DATA_SENTINEL. Use fill() first to compare against the last
+// value present.
+func (DeltaFunc) Eval(ctx *Context, node *Node) (Rows, error) {
+	if len(node.Args) != 1 {
+		return nil, fmt.Errorf("delta() takes a single argument.")
+	}
+	if node.Args[0].Typ != NodeFunc {
+		return nil, fmt.Errorf("delta() takes a function argument.")
+	}
+	rows, err := node.Args[0].Eval(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("delta() failed evaluating argument: %s", err)
+	}
+
+	ret := Rows{}
+	for key, r := range rows {
+		row := make([]float32, len(r))
+		for i, v := range r {
+			if i == 0 || v == vec32.MISSING_DATA_SENTINEL || r[i-1] == vec32.MISSING_DATA_SENTINEL {
+				row[i] = vec32.MISSING_DATA_SENTINEL
+			} else {
+				row[i] = v - r[i-1]
+			}
+		}
+		ret["delta("+key+")"] = row
+	}
+	return ret, nil
+}
+
+func (DeltaFunc) Describe() string {
+	return `delta() replaces each value with the difference to the value at the previous commit.`
+}
+
+var deltaFunc = DeltaFunc{}
+
+type ScaleFunc struct{}
+
+// ScaleFunc implements Func and multiplies all the values in the rows by a
+// constant.
+//
+// vec32.MISSING_DATA_SENTINEL values are left untouched.
+func (ScaleFunc) Eval(ctx *Context, node *Node) (Rows, error) {
+	if len(node.Args) != 2 {
+		return nil, fmt.Errorf("scale() takes two arguments.")
+	}
+	if node.Args[0].Typ != NodeFunc {
+		return nil, fmt.Errorf("scale() takes a function as its first argument.")
+	}
+	k, err := numArg("scale", node, 1)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := node.Args[0].Eval(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("scale() failed evaluating argument: %s", err)
+	}
+
+	ret := Rows{}
+	for key, r := range rows {
+		row := vec32.Dup(r)
+		for i, v := range row {
+			if v != vec32.MISSING_DATA_SENTINEL {
+				row[i] = v * float32(k)
+			}
+		}
+		ret[fmt.Sprintf("scale(%s,%s)", key, node.Args[1].Val)] = row
+	}
+	return ret, nil
+}
+
+func (ScaleFunc) Describe() string {
+	return `scale(x, k) multiplies all the values by the number k.`
+}
+
+var scaleFunc = ScaleFunc{}
+
+type TraceAveFunc struct{}
+
+// TraceAveFunc implements Func and replaces all the values in each row with
+// the average of that row.
+//
+// vec32.MISSING_DATA_SENTINEL values are not included in the average. A row
+// with all vec32.MISSING_DATA_SENTINEL values is left untouched.
+func (TraceAveFunc) Eval(ctx *Context, node *Node) (Rows, error) {
+	if len(node.Args) != 1 {
+		return nil, fmt.Errorf("trace_ave() takes a single argument.")
+	}
+	if node.Args[0].Typ != NodeFunc {
+		return nil, fmt.Errorf("trace_ave() takes a function argument.")
+	}
+	rows, err := node.Args[0].Eval(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("trace_ave() failed evaluating argument: %s", err)
+	}
+
+	ret := Rows{}
+	for key, r := range rows {
+		row := vec32.Dup(r)
+		if mean, _, err := vec32.MeanAndStdDev(r); err == nil {
+			for i, _ := range row {
+				row[i] = mean
+			}
+		}
+		ret["trace_ave("+key+")"] = row
+	}
+	return ret, nil
+}
+
+func (TraceAveFunc) Describe() string {
+	return `trace_ave() replaces all the values of each trace with the average of that trace.`
+}
+
+var traceAveFunc = TraceAveFunc{}
@@ -21,6 +21,16 @@ func TestLex(t *testing.T) {
 				item{itemEOF, ""},
 			},
 		},
+		{
+			input: "trace_ave(a1)",
+			items: []item{
+				item{itemIdentifier, "trace_ave"},
+				item{itemLParen, "("},
+				item{itemIdentifier, "a1"},
+				item{itemRParen, ")"},
+				item{itemEOF, ""},
+			},
+		},
 		{
 			input: "foo(a, b) ",
 			items: []item{
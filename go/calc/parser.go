@@ -87,16 +87,26 @@ func NewContext(rowsFromQuery RowsFromQuery) *Context {
 	return &Context{
 		RowsFromQuery: rowsFromQuery,
 		Funcs: map[string]Func{
-			"filter": filterFunc,
-			"norm":   normFunc,
-			"fill":   fillFunc,
-			"ave":    aveFunc,
-			"avg":    aveFunc,
-			"count":  countFunc,
-			"ratio":  ratioFunc,
-			"sum":    sumFunc,
-			"geo":    geoFunc,
-			"log":    logFunc,
+			"filter":     filterFunc,
+			"norm":       normFunc,
+			"fill":       fillFunc,
+			"ave":        aveFunc,
+			"avg":        aveFunc,
+			"count":      countFunc,
+			"ratio":      ratioFunc,
+			"sum":        sumFunc,
+			"geo":        geoFunc,
+			"log":        logFunc,
+			"median":     medianFunc,
+			"min":        minFunc,
+			"max":        maxFunc,
+			"stddev":     stddevFunc,
+			"percentile": percentileFunc,
+			"moving_ave": movingAveFunc,
+			"shift":      shiftFunc,
+			"delta":      deltaFunc,
+			"scale":      scaleFunc,
+			"trace_ave":  traceAveFunc,
 		},
 	}
 }
@@ -312,3 +312,107 @@ func TestLog(t *testing.T) {
 		}
 	}
 }
+
+func TestFolds(t *testing.T) {
+	testutils.SmallTest(t)
+	ctx := newTestContext(Rows{
+		",name=t1,": []float32{1.0, -1.0, e, e},
+		",name=t2,": []float32{e, 2.0, -2.0, e},
+		",name=t3,": []float32{3.0, 5.0, e, e},
+	})
+	testCases := []struct {
+		formula string
+		want    []float32
+	}{
+		{`median(filter(""))`, []float32{2.0, 2.0, -2.0, e}},
+		{`min(filter(""))`, []float32{1.0, -1.0, -2.0, e}},
+		{`max(filter(""))`, []float32{3.0, 5.0, -2.0, e}},
+		{`stddev(filter(""))`, []float32{1.0, 2.4495, 0.0, e}},
+		{`percentile(filter(""), 0)`, []float32{1.0, -1.0, -2.0, e}},
+		{`percentile(filter(""), 75)`, []float32{2.5, 3.5, -2.0, e}},
+		{`percentile(filter(""), 100)`, []float32{3.0, 5.0, -2.0, e}},
+	}
+	for _, tc := range testCases {
+		rows, err := ctx.Eval(tc.formula)
+		if err != nil {
+			t.Fatalf("Failed to eval %q: %s", tc.formula, err)
+		}
+		if got, want := len(rows), 1; got != want {
+			t.Errorf("%q returned wrong length: Got %v Want %v", tc.formula, got, want)
+		}
+		for i, want := range tc.want {
+			if got := rows[tc.formula][i]; !near(got, want) {
+				t.Errorf("%q mismatch at %d: Got %v Want %v", tc.formula, i, got, want)
+			}
+		}
+	}
+}
+
+func TestTraceTransforms(t *testing.T) {
+	testutils.SmallTest(t)
+	ctx := newTestContext(Rows{
+		",name=t1,": []float32{1, 3, e, 5, 7},
+	})
+	testCases := []struct {
+		formula string
+		key     string
+		want    []float32
+	}{
+		{`moving_ave(filter(""), 2)`, "moving_ave(,name=t1,,2)", []float32{1, 2, 3, 5, 6}},
+		{`moving_ave(filter(""), 1)`, "moving_ave(,name=t1,,1)", []float32{1, 3, e, 5, 7}},
+		{`shift(filter(""))`, "shift(,name=t1,)", []float32{e, 1, 3, e, 5}},
+		{`delta(filter(""))`, "delta(,name=t1,)", []float32{e, 2, e, e, 2}},
+		{`delta(fill(filter("")))`, "delta(fill(,name=t1,))", []float32{e, 2, 2, 0, 2}},
+		{`scale(filter(""), 0.5)`, "scale(,name=t1,,0.5)", []float32{0.5, 1.5, e, 2.5, 3.5}},
+		{`trace_ave(filter(""))`, "trace_ave(,name=t1,)", []float32{4, 4, 4, 4, 4}},
+	}
+	for _, tc := range testCases {
+		rows, err := ctx.Eval(tc.formula)
+		if err != nil {
+			t.Fatalf("Failed to eval %q: %s", tc.formula, err)
+		}
+		row, ok := rows[tc.key]
+		if !ok {
+			t.Fatalf("%q didn't return %q: %#v", tc.formula, tc.key, rows)
+		}
+		for i, want := range tc.want {
+			if got := row[i]; !near(got, want) {
+				t.Errorf("%q mismatch at %d: Got %v Want %v", tc.formula, i, got, want)
+			}
+		}
+	}
+	// Make sure the rows weren't modified.
+	if got, want := testRows[",config=8888,os=Ubuntu12,"][1], float32(1.234); got != want {
+		t.Errorf("Rows incorrectly modified: Got %v Want %v", got, want)
+	}
+}
+
+func TestNewFuncErrors(t *testing.T) {
+	testutils.SmallTest(t)
+	ctx := newTestContext(nil)
+
+	testCases := []string{
+		`median(2)`,
+		`min()`,
+		`max("foo")`,
+		`stddev(filter(""), 2)`,
+		`percentile(filter(""))`,
+		`percentile(filter(""), "foo")`,
+		`percentile(filter(""), 101)`,
+		`percentile(filter(""), -1)`,
+		`moving_ave(filter(""))`,
+		`moving_ave(filter(""), 0)`,
+		`moving_ave(filter(""), 1.5)`,
+		`shift(2)`,
+		`delta()`,
+		`scale(filter(""))`,
+		`scale(2, filter(""))`,
+		`trace_ave("foo")`,
+	}
+	for _, tc := range testCases {
+		_, err := ctx.Eval(tc)
+		if err == nil {
+			t.Fatalf("Expected %q to fail:", tc)
+		}
+	}
+}
@@ -42,6 +42,11 @@ func init() {
 	emailTemplateParsed = template.Must(template.New("email").Parse(emailTemplate))
 }
 
+// Emailer sends emails. It is implemented by GMail.
+type Emailer interface {
+	Send(senderDisplayName string, to []string, subject string, body string) error
+}
+
 // GMail is an object used for authenticating to the GMail API server.
 type GMail struct {
 	service *gmail.Service
@@ -357,3 +357,20 @@ func (c *Client) IsolateTasks(tasks []*Task) ([]string, error) {
 	}
 	return rv, nil
 }
+
+// DownloadIsolated downloads the files referenced by the given isolated hash
+// into targetDir.
+func (c *Client) DownloadIsolated(hash, targetDir string) error {
+	cmd := []string{
+		c.isolateserver, "download", "--verbose",
+		"--isolate-server", c.ServerUrl,
+		"--namespace", DEFAULT_NAMESPACE,
+		"--isolated", hash,
+		"--target", targetDir,
+	}
+	output, err := exec.RunCwd(c.workdir, cmd...)
+	if err != nil {
+		return fmt.Errorf("Failed to run isolateserver: %s\nOutput:\n%s", err, output)
+	}
+	return nil
+}
@@ -9,10 +9,6 @@ import (
 	ttlcache "github.com/robfig/go-cache"
 )
 
-// TODO(stephana): Add the ability to purge items from the cache and
-// expunge item from the error cache. Remove DEFAULT_CACHESIZE when
-// we have a way to expung items from the cache.
-
 const (
 	// Duration to cache an error response.
 	DEFAULT_ERRCACHE_EXPIRATION_TIME = time.Minute * 30
@@ -226,6 +222,16 @@ func (m *MemReadThroughCache) Contains(id string) bool {
 	return ok
 }
 
+// Remove implements the ReadThroughCache interface.
+func (m *MemReadThroughCache) Remove(ids []string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for _, id := range ids {
+		m.cache.Remove(id)
+		m.errCache.Delete(id)
+	}
+}
+
 // workItem is used to control calls to workerFn when an item is not
 // in memory. The priority field defines it's position in the priority
 // queueu.
@@ -144,3 +144,41 @@ func TestErrHandling(t *testing.T) {
 	assert.Error(t, errThree)
 	assert.NotEqual(t, err, errThree)
 }
+
+func TestRemove(t *testing.T) {
+	testutils.SmallTest(t)
+	var mutex sync.Mutex
+	calls := map[string]int{}
+	worker := func(priority int64, id string) (interface{}, error) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		calls[id]++
+		if id == "bad" {
+			return nil, fmt.Errorf("bad: %d", calls[id])
+		}
+		return fmt.Sprintf("%s: %d", id, calls[id]), nil
+	}
+
+	q := New(worker, 10, 2)
+	defer q.(*MemReadThroughCache).shutdown()
+	val, err := q.Get(1, "good")
+	assert.NoError(t, err)
+	assert.Equal(t, "good: 1", val)
+	_, err = q.Get(1, "bad")
+	assert.EqualError(t, err, "bad: 1")
+
+	// Cached values and errors are returned until they are removed.
+	val, err = q.Get(1, "good")
+	assert.NoError(t, err)
+	assert.Equal(t, "good: 1", val)
+	_, err = q.Get(1, "bad")
+	assert.EqualError(t, err, "bad: 1")
+
+	q.Remove([]string{"good", "bad", "unknown"})
+	assert.False(t, q.Contains("good"))
+	val, err = q.Get(1, "good")
+	assert.NoError(t, err)
+	assert.Equal(t, "good: 2", val)
+	_, err = q.Get(1, "bad")
+	assert.EqualError(t, err, "bad: 2")
+}
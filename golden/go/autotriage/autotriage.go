@@ -0,0 +1,266 @@
+// autotriage automatically marks new untriaged digests as positive if they
+// are very similar to an existing positive digest of the same test.
+package autotriage
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/skia-dev/glog"
+	"go.skia.org/infra/go/timer"
+	"go.skia.org/infra/go/util"
+	"go.skia.org/infra/golden/go/diff"
+	"go.skia.org/infra/golden/go/digesttools"
+	"go.skia.org/infra/golden/go/indexer"
+	"go.skia.org/infra/golden/go/storage"
+	"go.skia.org/infra/golden/go/summary"
+	"go.skia.org/infra/golden/go/tally"
+	"go.skia.org/infra/golden/go/types"
+)
+
+const (
+	// AUTO_TRIAGE_USER is the user under which automatic triage operations
+	// are recorded in the triage log. They can be undone like any other
+	// change.
+	AUTO_TRIAGE_USER = "auto-triage@skia.org"
+
+	// HISTORY_ENTRIES is the number of most recent triage log entries which
+	// are searched for earlier auto-triage operations on startup.
+	HISTORY_ENTRIES = 5000
+
+	// historyPageSize is the number of triage log entries retrieved at once.
+	historyPageSize = 100
+)
+
+// Rule defines when an untriaged digest of a test is close enough to a
+// positive digest of the same test to be marked positive automatically.
+// A digest is triaged if all of the thresholds are met. All thresholds must
+// be set.
+type Rule struct {
+	// Test restricts the rule to the test with this name. Either Test or
+	// Corpus must be set.
+	Test string `json:"test"`
+
+	// Corpus restricts the rule to tests in this corpus.
+	Corpus string `json:"corpus"`
+
+	// MaxNumDiffPixels is the maximum number of pixels that may differ.
+	MaxNumDiffPixels int `json:"maxNumDiffPixels"`
+
+	// MaxPixelDiffPercent is the maximum percentage of pixels that may
+	// differ.
+	MaxPixelDiffPercent float32 `json:"maxPixelDiffPercent"`
+
+	// MaxRGBADiff is the maximum difference in any channel of any pixel.
+	MaxRGBADiff int `json:"maxRGBADiff"`
+
+	// Metric is the diff metric, e.g. diff.METRIC_PERCEPTUAL, used to find
+	// the closest positive digest. If empty the combined metric is used.
+	Metric string `json:"metric"`
+}
+
+// Validate returns an error if the rule is not valid.
+func (r *Rule) Validate() error {
+	if r.Test == "" && r.Corpus == "" {
+		return fmt.Errorf("Auto-triage rule must specify a test or a corpus.")
+	}
+	// Any digest that differs has at least one differing pixel and channel,
+	// so a rule with a threshold of zero, e.g. because it was omitted, would
+	// never triage anything.
+	if r.MaxNumDiffPixels <= 0 || r.MaxPixelDiffPercent <= 0 || r.MaxRGBADiff <= 0 {
+		return fmt.Errorf("Auto-triage rule for test %q corpus %q must have positive maxNumDiffPixels, maxPixelDiffPercent and maxRGBADiff thresholds.", r.Test, r.Corpus)
+	}
+	if r.Metric != "" && !util.In(r.Metric, diff.GetDiffMetricIDs()) {
+		return fmt.Errorf("Auto-triage rule for test %q corpus %q has unknown metric %q.", r.Test, r.Corpus, r.Metric)
+	}
+	return nil
+}
+
+// Matches returns true if the rule applies to the given test.
+func (r *Rule) Matches(test, corpus string) bool {
+	return (r.Test == "" || r.Test == test) && (r.Corpus == "" || r.Corpus == corpus)
+}
+
+// Accepts returns true if the given diff between an untriaged digest and a
+// positive digest is within the thresholds of the rule.
+func (r *Rule) Accepts(m *diff.DiffMetrics) bool {
+	if m.DimDiffer || m.NumDiffPixels > r.MaxNumDiffPixels || m.PixelDiffPercent > r.MaxPixelDiffPercent {
+		return false
+	}
+	for _, d := range m.MaxRGBADiffs {
+		if d > r.MaxRGBADiff {
+			return false
+		}
+	}
+	return true
+}
+
+// ReadRules reads a JSON array of rules from the given reader and validates
+// them.
+func ReadRules(r io.Reader) ([]*Rule, error) {
+	var rules []*Rule
+	if err := json.NewDecoder(r).Decode(&rules); err != nil {
+		return nil, fmt.Errorf("Failed to decode auto-triage rules: %s", err)
+	}
+	for _, rule := range rules {
+		if err := rule.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	return rules, nil
+}
+
+// LoadRules reads the rules from the given JSON file. See ReadRules.
+func LoadRules(path string) ([]*Rule, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer util.Close(f)
+	return ReadRules(f)
+}
+
+// AutoTriager triages untriaged digests according to a set of rules whenever
+// the search index is updated.
+// Each digest is triaged automatically at most once, so that an auto-triage
+// which is undone via ExpectationsStore.UndoChange is not repeated.
+type AutoTriager struct {
+	storages *storage.Storage
+	rules    []*Rule
+
+	// triaged contains the digests that have been auto-triaged, keyed by
+	// test name.
+	triaged map[string]util.StringSet
+
+	// mutex makes sure that only one triage pass runs at a time, so that
+	// the same digest is not triaged twice.
+	mutex sync.Mutex
+}
+
+// New returns a new AutoTriager and subscribes it to index updates if the
+// given storages have an event bus. It reads the most recent entries of the
+// triage log to find digests which were auto-triaged before.
+func New(storages *storage.Storage, rules []*Rule) (*AutoTriager, error) {
+	ret := &AutoTriager{
+		storages: storages,
+		rules:    rules,
+		triaged:  map[string]util.StringSet{},
+	}
+	if err := ret.loadHistory(); err != nil {
+		return nil, err
+	}
+	if storages.EventBus != nil {
+		storages.EventBus.SubscribeAsync(indexer.EV_INDEX_UPDATED, func(state interface{}) {
+			idx := state.(*indexer.SearchIndex)
+			if _, err := ret.Run(idx.GetSummaries(), idx.TalliesByTest()); err != nil {
+				glog.Errorf("Failed to auto-triage digests: %s", err)
+			}
+		})
+	}
+	return ret, nil
+}
+
+// loadHistory adds the digests of earlier auto-triage operations in the most
+// recent HISTORY_ENTRIES triage log entries to triaged.
+func (a *AutoTriager) loadHistory() error {
+	for offset := 0; offset < HISTORY_ENTRIES; offset += historyPageSize {
+		entries, total, err := a.storages.ExpectationsStore.QueryLog(offset, historyPageSize, true)
+		if err != nil {
+			return fmt.Errorf("Unable to read the triage log: %s", err)
+		}
+		for _, e := range entries {
+			if e.Name != AUTO_TRIAGE_USER {
+				continue
+			}
+			for _, d := range e.Details {
+				a.addTriaged(d.TestName, d.Digest)
+			}
+		}
+		if offset+len(entries) >= total || len(entries) == 0 {
+			break
+		}
+	}
+	return nil
+}
+
+// addTriaged records that the given digest has been auto-triaged.
+func (a *AutoTriager) addTriaged(test, digest string) {
+	if _, ok := a.triaged[test]; !ok {
+		a.triaged[test] = util.StringSet{}
+	}
+	a.triaged[test][digest] = true
+}
+
+// ruleFor returns the rule that applies to the given test or nil if there is
+// none. Rules for a specific test take precedence over rules for a corpus.
+func (a *AutoTriager) ruleFor(test, corpus string) *Rule {
+	var ret *Rule
+	for _, r := range a.rules {
+		if r.Matches(test, corpus) && (ret == nil || (ret.Test == "" && r.Test != "")) {
+			ret = r
+		}
+	}
+	return ret
+}
+
+// Run compares the untriaged digests in the given summaries to the closest
+// positive digest of their test and marks them as positive if they are
+// accepted by the rule for the test. It returns the digests that were
+// triaged.
+func (a *AutoTriager) Run(summaries map[string]*summary.Summary, talliesByTest map[string]tally.Tally) (map[string]types.TestClassification, error) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	defer timer.New("auto-triage").Stop()
+
+	exp, err := a.storages.ExpectationsStore.Get()
+	if err != nil {
+		return nil, fmt.Errorf("Unable to get expectations: %s", err)
+	}
+
+	changes := map[string]types.TestClassification{}
+	for test, sum := range summaries {
+		rule := a.ruleFor(test, sum.Corpus)
+		tallies := talliesByTest[test]
+		if rule == nil || tallies == nil {
+			continue
+		}
+		for _, digest := range sum.UntHashes {
+			// The summaries might be older than the expectations.
+			if exp.Classification(test, digest) != types.UNTRIAGED || a.triaged[test][digest] {
+				continue
+			}
+			closest := digesttools.ClosestDigestByMetric(test, digest, exp, tallies, a.storages.DiffStore, types.POSITIVE, rule.Metric)
+			if closest.Digest == "" {
+				continue
+			}
+			metrics, err := a.storages.DiffStore.Get(diff.PRIORITY_NOW, digest, []string{closest.Digest})
+			if err != nil {
+				glog.Errorf("Unable to diff %s against %s: %s", digest, closest.Digest, err)
+				continue
+			}
+			if m, ok := metrics[closest.Digest]; ok && rule.Accepts(m) {
+				if _, ok := changes[test]; !ok {
+					changes[test] = types.TestClassification{}
+				}
+				changes[test][digest] = types.POSITIVE
+				glog.Infof("Auto-triaging %s of %s as positive; closest positive is %s.", digest, test, closest.Digest)
+			}
+		}
+	}
+
+	if len(changes) == 0 {
+		return changes, nil
+	}
+	if err := a.storages.ExpectationsStore.AddChange(changes, AUTO_TRIAGE_USER); err != nil {
+		return nil, fmt.Errorf("Unable to store auto-triaged digests: %s", err)
+	}
+	for test, digests := range changes {
+		for digest := range digests {
+			a.addTriaged(test, digest)
+		}
+	}
+	return changes, nil
+}
@@ -0,0 +1,179 @@
+package autotriage
+
+import (
+	"strings"
+	"testing"
+
+	assert "github.com/stretchr/testify/require"
+	"go.skia.org/infra/go/testutils"
+	"go.skia.org/infra/golden/go/diff"
+	"go.skia.org/infra/golden/go/expstorage"
+	"go.skia.org/infra/golden/go/mocks"
+	"go.skia.org/infra/golden/go/storage"
+	"go.skia.org/infra/golden/go/summary"
+	"go.skia.org/infra/golden/go/tally"
+	"go.skia.org/infra/golden/go/types"
+)
+
+// logExpectationsStore is an in-memory ExpectationsStore which keeps a triage
+// log.
+type logExpectationsStore struct {
+	expstorage.ExpectationsStore
+	log []*expstorage.TriageLogEntry
+}
+
+func (s *logExpectationsStore) AddChange(changes map[string]types.TestClassification, userId string) error {
+	entry := &expstorage.TriageLogEntry{
+		ID:   len(s.log) + 1,
+		Name: userId,
+	}
+	for test, digests := range changes {
+		for digest, label := range digests {
+			entry.Details = append(entry.Details, &expstorage.TriageDetail{
+				TestName: test,
+				Digest:   digest,
+				Label:    label.String(),
+			})
+		}
+	}
+	entry.ChangeCount = len(entry.Details)
+	s.log = append([]*expstorage.TriageLogEntry{entry}, s.log...)
+	return s.ExpectationsStore.AddChange(changes, userId)
+}
+
+func (s *logExpectationsStore) QueryLog(offset, size int, details bool) ([]*expstorage.TriageLogEntry, int, error) {
+	if offset >= len(s.log) {
+		return []*expstorage.TriageLogEntry{}, len(s.log), nil
+	}
+	end := offset + size
+	if end > len(s.log) {
+		end = len(s.log)
+	}
+	return s.log[offset:end], len(s.log), nil
+}
+
+// metricsDiffStore returns fixed DiffMetrics for pairs of digests.
+type metricsDiffStore struct {
+	mocks.MockDiffStore
+	metrics map[string]*diff.DiffMetrics
+}
+
+func (m *metricsDiffStore) Get(priority int64, mainDigest string, rightDigests []string) (map[string]*diff.DiffMetrics, error) {
+	ret := map[string]*diff.DiffMetrics{}
+	for _, d := range rightDigests {
+		if dm, ok := m.metrics[mainDigest+"-"+d]; ok {
+			ret[d] = dm
+		}
+	}
+	return ret, nil
+}
+
+func (m *metricsDiffStore) UnavailableDigests() map[string]*diff.DigestFailure {
+	return map[string]*diff.DigestFailure{}
+}
+
+func TestReadRules(t *testing.T) {
+	testutils.SmallTest(t)
+	rules, err := ReadRules(strings.NewReader(`[
+		{"corpus": "gm", "maxNumDiffPixels": 10, "maxPixelDiffPercent": 0.5, "maxRGBADiff": 2},
+		{"test": "blur", "maxNumDiffPixels": 100, "maxPixelDiffPercent": 5, "maxRGBADiff": 8}
+	]`))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(rules))
+	assert.Equal(t, &Rule{Test: "blur", MaxNumDiffPixels: 100, MaxPixelDiffPercent: 5, MaxRGBADiff: 8}, rules[1])
+
+	_, err = ReadRules(strings.NewReader(`[{"maxNumDiffPixels": 10}]`))
+	assert.EqualError(t, err, "Auto-triage rule must specify a test or a corpus.")
+	_, err = ReadRules(strings.NewReader(`[{"test": "blur", "maxNumDiffPixels": 10, "maxPixelDiffPercent": 0.5, "maxRGBADiff": -1}]`))
+	assert.EqualError(t, err, "Auto-triage rule for test \"blur\" corpus \"\" must have positive maxNumDiffPixels, maxPixelDiffPercent and maxRGBADiff thresholds.")
+	_, err = ReadRules(strings.NewReader(`[{"test": "blur", "maxNumDiffPixels": 10}]`))
+	assert.EqualError(t, err, "Auto-triage rule for test \"blur\" corpus \"\" must have positive maxNumDiffPixels, maxPixelDiffPercent and maxRGBADiff thresholds.")
+	_, err = ReadRules(strings.NewReader(`[{"test": "blur", "maxNumDiffPixels": 10, "maxPixelDiffPercent": 0.5, "maxRGBADiff": 2, "metric": "bogus"}]`))
+	assert.EqualError(t, err, "Auto-triage rule for test \"blur\" corpus \"\" has unknown metric \"bogus\".")
+	rules, err = ReadRules(strings.NewReader(`[{"test": "blur", "maxNumDiffPixels": 10, "maxPixelDiffPercent": 0.5, "maxRGBADiff": 2, "metric": "perceptual"}]`))
+	assert.NoError(t, err)
+	assert.Equal(t, diff.METRIC_PERCEPTUAL, rules[0].Metric)
+}
+
+func TestRuleAccepts(t *testing.T) {
+	testutils.SmallTest(t)
+	r := &Rule{Corpus: "gm", MaxNumDiffPixels: 10, MaxPixelDiffPercent: 0.5, MaxRGBADiff: 2}
+	assert.True(t, r.Accepts(&diff.DiffMetrics{NumDiffPixels: 10, PixelDiffPercent: 0.5, MaxRGBADiffs: []int{2, 2, 0, 1}}))
+	assert.False(t, r.Accepts(&diff.DiffMetrics{NumDiffPixels: 11, PixelDiffPercent: 0.5, MaxRGBADiffs: []int{2, 2, 0, 1}}))
+	assert.False(t, r.Accepts(&diff.DiffMetrics{NumDiffPixels: 10, PixelDiffPercent: 0.6, MaxRGBADiffs: []int{2, 2, 0, 1}}))
+	assert.False(t, r.Accepts(&diff.DiffMetrics{NumDiffPixels: 10, PixelDiffPercent: 0.5, MaxRGBADiffs: []int{2, 3, 0, 1}}))
+	assert.False(t, r.Accepts(&diff.DiffMetrics{NumDiffPixels: 1, PixelDiffPercent: 0.1, MaxRGBADiffs: []int{1, 1, 1, 1}, DimDiffer: true}))
+}
+
+func TestAutoTriage(t *testing.T) {
+	testutils.SmallTest(t)
+	expStore := &logExpectationsStore{
+		ExpectationsStore: expstorage.NewMemExpectationsStore(nil),
+	}
+	assert.NoError(t, expStore.AddChange(map[string]types.TestClassification{
+		"blur":   {"pos1": types.POSITIVE},
+		"circle": {"pos2": types.POSITIVE},
+		"text":   {"pos3": types.POSITIVE},
+	}, "user@example.com"))
+
+	near := &diff.DiffMetrics{NumDiffPixels: 5, PixelDiffPercent: 0.1, MaxRGBADiffs: []int{1, 1, 1, 0}}
+	far := &diff.DiffMetrics{NumDiffPixels: 500, PixelDiffPercent: 10, MaxRGBADiffs: []int{100, 1, 1, 0}}
+	storages := &storage.Storage{
+		ExpectationsStore: expStore,
+		DiffStore: &metricsDiffStore{
+			metrics: map[string]*diff.DiffMetrics{
+				"unt1-pos1": near,
+				"unt2-pos1": far,
+				"unt3-pos2": near,
+				"unt4-pos3": near,
+			},
+		},
+	}
+	// The stricter rule for "circle" overrides the corpus rule. "text" is in a
+	// different corpus.
+	rules := []*Rule{
+		{Corpus: "gm", MaxNumDiffPixels: 10, MaxPixelDiffPercent: 1, MaxRGBADiff: 2},
+		{Test: "circle", MaxNumDiffPixels: 1, MaxPixelDiffPercent: 1, MaxRGBADiff: 2},
+	}
+	summaries := map[string]*summary.Summary{
+		"blur":   {Name: "blur", Corpus: "gm", UntHashes: []string{"unt1", "unt2"}},
+		"circle": {Name: "circle", Corpus: "gm", UntHashes: []string{"unt3"}},
+		"text":   {Name: "text", Corpus: "svg", UntHashes: []string{"unt4"}},
+	}
+	tallies := map[string]tally.Tally{
+		"blur":   {"pos1": 1, "unt1": 1, "unt2": 1},
+		"circle": {"pos2": 1, "unt3": 1},
+		"text":   {"pos3": 1, "unt4": 1},
+	}
+
+	at, err := New(storages, rules)
+	assert.NoError(t, err)
+	changes, err := at.Run(summaries, tallies)
+	assert.NoError(t, err)
+	expected := map[string]types.TestClassification{"blur": {"unt1": types.POSITIVE}}
+	assert.Equal(t, expected, changes)
+	exp, err := expStore.Get()
+	assert.NoError(t, err)
+	assert.Equal(t, types.POSITIVE, exp.Classification("blur", "unt1"))
+	assert.Equal(t, types.UNTRIAGED, exp.Classification("blur", "unt2"))
+	assert.Equal(t, types.UNTRIAGED, exp.Classification("circle", "unt3"))
+	assert.Equal(t, types.UNTRIAGED, exp.Classification("text", "unt4"))
+
+	// The change is recorded in the triage log under the auto-triage user.
+	assert.Equal(t, 2, len(expStore.log))
+	assert.Equal(t, AUTO_TRIAGE_USER, expStore.log[0].Name)
+	assert.Equal(t, []*expstorage.TriageDetail{{TestName: "blur", Digest: "unt1", Label: types.POSITIVE.String()}}, expStore.log[0].Details)
+
+	// If the change is undone, the digest isn't triaged again, even after a
+	// restart.
+	assert.NoError(t, expStore.AddChange(map[string]types.TestClassification{"blur": {"unt1": types.UNTRIAGED}}, "user@example.com"))
+	changes, err = at.Run(summaries, tallies)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(changes))
+	at, err = New(storages, rules)
+	assert.NoError(t, err)
+	changes, err = at.Run(summaries, tallies)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(changes))
+	assert.Equal(t, 3, len(expStore.log))
+}
@@ -3,6 +3,10 @@ package main
 // Executes database migrations to the latest target version. In production this
 // requires the root password for MySQL. The user will be prompted for that so
 // it is not entered via the command line.
+//
+// When switching from the Bolt digest store to the database, run it once with
+// --import_bolt_digests set to the --storage_dir of skiacorrectness to copy
+// the digests into the database.
 
 import (
 	"flag"
@@ -12,11 +16,13 @@ import (
 	"go.skia.org/infra/go/database"
 	"go.skia.org/infra/go/skiaversion"
 	"go.skia.org/infra/golden/go/db"
+	"go.skia.org/infra/golden/go/digeststore"
 )
 
 var (
-	local          = flag.Bool("local", false, "Running locally if true. As opposed to in production.")
-	promptPassword = flag.Bool("password", false, "Prompt for root password.")
+	importBoltDigests = flag.String("import_bolt_digests", "", "Storage directory of skiacorrectness whose Bolt digest store is imported into the database after the migration.")
+	local             = flag.Bool("local", false, "Running locally if true. As opposed to in production.")
+	promptPassword    = flag.Bool("password", false, "Prompt for root password.")
 )
 
 func main() {
@@ -62,4 +68,12 @@ func main() {
 	}
 
 	glog.Infoln("Database migration finished.")
+
+	if *importBoltDigests != "" {
+		n, err := digeststore.NewSQLDigestStore(vdb).ImportBolt(*importBoltDigests)
+		if err != nil {
+			glog.Fatalf("Failed to import the Bolt digest store: %s", err)
+		}
+		glog.Infof("Imported %d digests from the Bolt digest store in %s.", n, *importBoltDigests)
+	}
 }
@@ -169,6 +169,70 @@ var migrationSteps = []database.MigrationStep{
 		},
 	},
 
+	// Add a table to store the expectations of trybot issues.
+	// version 11
+	{
+		MySQLUp: []string{
+			`CREATE TABLE exp_issue_change (
+				issue         VARCHAR(255)  NOT NULL,
+				name          VARCHAR(255)  NOT NULL,
+				digest        VARCHAR(255)  NOT NULL,
+				label         VARCHAR(255)  NOT NULL,
+				userid        VARCHAR(255)  NOT NULL,
+				ts            BIGINT        NOT NULL,
+				PRIMARY KEY (issue, name, digest)
+			)`,
+		},
+		MySQLDown: []string{
+			`DROP TABLE IF EXISTS exp_issue_change`,
+		},
+	},
+
+	// Add ownership and expiry actions to ignore rules.
+	// version 12
+	{
+		MySQLUp: []string{
+			`ALTER TABLE ignorerule ADD owner TEXT NOT NULL`,
+			`ALTER TABLE ignorerule ADD bug TEXT NOT NULL`,
+			`ALTER TABLE ignorerule ADD expiry_action VARCHAR(32) NOT NULL DEFAULT 'delete'`,
+			`ALTER TABLE ignorerule ADD notified TINYINT(1) NOT NULL DEFAULT 0`,
+			`UPDATE ignorerule SET owner = userid`,
+		},
+		MySQLDown: []string{
+			`ALTER TABLE ignorerule DROP notified`,
+			`ALTER TABLE ignorerule DROP expiry_action`,
+			`ALTER TABLE ignorerule DROP bug`,
+			`ALTER TABLE ignorerule DROP owner`,
+		},
+	},
+
+	// Move the digest and issue stores from local boltdb files to SQL.
+	// version 13
+	{
+		MySQLUp: []string{
+			`CREATE TABLE digestinfo (
+				name          VARCHAR(255)  NOT NULL,
+				digest        VARCHAR(255)  NOT NULL,
+				first         BIGINT        NOT NULL,
+				last          BIGINT        NOT NULL,
+				exception     TEXT          NOT NULL,
+				issue_ids     TEXT          NOT NULL,
+				PRIMARY KEY (name, digest)
+			)`,
+			`CREATE TABLE issue_annotation (
+				issue         VARCHAR(255)  NOT NULL,
+				kind          VARCHAR(16)   NOT NULL,
+				item          VARCHAR(255)  NOT NULL,
+				PRIMARY KEY (issue, kind, item),
+				INDEX kind_item_idx (kind, item)
+			)`,
+		},
+		MySQLDown: []string{
+			`DROP TABLE IF EXISTS issue_annotation`,
+			`DROP TABLE IF EXISTS digestinfo`,
+		},
+	},
+
 	// Use this is a template for more migration steps.
 	// version x
 	// {
@@ -3,6 +3,8 @@ package diff
 import (
 	"bytes"
 	"image"
+	"image/color"
+	"image/draw"
 	"path/filepath"
 	"reflect"
 	"strings"
@@ -342,3 +344,46 @@ func BenchmarkDiff(b *testing.B) {
 		Diff(img1, img2)
 	}
 }
+
+func TestPerceptualDiffMetric(t *testing.T) {
+	testutils.SmallTest(t)
+	fill := func(w, h int, c color.NRGBA) *image.NRGBA {
+		img := image.NewNRGBA(image.Rect(0, 0, w, h))
+		draw.Draw(img, img.Bounds(), &image.Uniform{c}, image.ZP, draw.Src)
+		return img
+	}
+	gray := fill(2, 2, color.NRGBA{R: 128, G: 128, B: 128, A: 255})
+
+	// Identical images.
+	dm, _ := CalcDiff(gray, gray)
+	assert.Equal(t, float32(0), dm.Diffs[METRIC_PERCEPTUAL])
+	assert.True(t, dm.HasAllMetrics())
+
+	// A difference of one level in one channel is not visible.
+	almostGray := fill(2, 2, color.NRGBA{R: 129, G: 128, B: 128, A: 255})
+	dm, _ = CalcDiff(gray, almostGray)
+	assert.Equal(t, float32(100), dm.PixelDiffPercent)
+	assert.Equal(t, float32(0), dm.Diffs[METRIC_PERCEPTUAL])
+
+	// One of four pixels changes color visibly.
+	oneRed := fill(2, 2, color.NRGBA{R: 128, G: 128, B: 128, A: 255})
+	oneRed.SetNRGBA(1, 1, color.NRGBA{R: 255, G: 0, B: 0, A: 255})
+	dm, _ = CalcDiff(gray, oneRed)
+	assert.Equal(t, float32(25), dm.Diffs[METRIC_PERCEPTUAL])
+
+	// Pixels which differ only in their color channels are invisible if they
+	// are fully transparent.
+	clear1 := fill(2, 2, color.NRGBA{R: 255, G: 0, B: 0, A: 0})
+	clear2 := fill(2, 2, color.NRGBA{R: 0, G: 0, B: 255, A: 0})
+	dm, _ = CalcDiff(clear1, clear2)
+	assert.Equal(t, float32(0), dm.Diffs[METRIC_PERCEPTUAL])
+
+	// Pixels outside of the common area count as different.
+	dm, _ = CalcDiff(gray, fill(2, 1, color.NRGBA{R: 128, G: 128, B: 128, A: 255}))
+	assert.Equal(t, float32(50), dm.Diffs[METRIC_PERCEPTUAL])
+
+	// Diff metrics without the perceptual metric, e.g. cached before it was
+	// added, are incomplete.
+	delete(dm.Diffs, METRIC_PERCEPTUAL)
+	assert.False(t, dm.HasAllMetrics())
+}
@@ -3,11 +3,22 @@ package diff
 import (
 	"image"
 	"math"
+
+	"go.skia.org/infra/go/util"
+	"go.skia.org/infra/perdiff/go/colorspace"
 )
 
 const (
-	METRIC_COMBINED = "combined"
-	METRIC_PERCENT  = "percent"
+	METRIC_COMBINED   = "combined"
+	METRIC_PERCENT    = "percent"
+	METRIC_PERCEPTUAL = "perceptual"
+
+	// PERCEPTUAL_THRESHOLD is the CIE76 color difference above which two
+	// pixels are considered visibly different by the perceptual metric.
+	PERCEPTUAL_THRESHOLD = 2.3
+
+	// displayGamma is used to convert 8 bit channel values to linear light.
+	displayGamma = 2.2
 )
 
 // MetricsFn is the signature a custom diff metric has to implmente.
@@ -15,14 +26,22 @@ type MetricFn func(*DiffMetrics, *image.NRGBA, *image.NRGBA) float32
 
 // metrics contains the custom diff metrics.
 var metrics = map[string]MetricFn{
-	METRIC_COMBINED: combinedDiffMetric,
-	METRIC_PERCENT:  percentDiffMetric,
+	METRIC_COMBINED:   combinedDiffMetric,
+	METRIC_PERCENT:    percentDiffMetric,
+	METRIC_PERCEPTUAL: perceptualDiffMetric,
 }
 
 // diffMetricIds contains the ids of all diff metrics.
 var diffMetricIds []string
 
+// linearChannel maps 8 bit channel values to linear light in [0, 1].
+var linearChannel [256]float64
+
 func init() {
+	for i := range linearChannel {
+		linearChannel[i] = math.Pow(float64(i)/255.0, displayGamma)
+	}
+
 	// Extract the ids of the diffmetrics once.
 	diffMetricIds = make([]string, 0, len(metrics))
 	for k := range metrics {
@@ -35,6 +54,17 @@ func GetDiffMetricIDs() []string {
 	return diffMetricIds
 }
 
+// HasAllMetrics returns true if the custom diff metrics contain a value for
+// every available diff metric.
+func (dm *DiffMetrics) HasAllMetrics() bool {
+	for _, id := range diffMetricIds {
+		if _, ok := dm.Diffs[id]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
 // CalcDiff calculates the basic difference and then then custom diff metrics.
 func CalcDiff(leftImg *image.NRGBA, rightImg *image.NRGBA) (*DiffMetrics, *image.NRGBA) {
 	ret, diffImg := Diff(leftImg, rightImg)
@@ -73,3 +103,45 @@ func combinedDiffMetric(basic *DiffMetrics, one *image.NRGBA, two *image.NRGBA)
 func percentDiffMetric(basic *DiffMetrics, one *image.NRGBA, two *image.NRGBA) float32 {
 	return basic.PixelDiffPercent
 }
+
+// perceptualDiffMetric returns the percentage of pixels whose colors differ
+// visibly, i.e. their CIE L*a*b* difference exceeds PERCEPTUAL_THRESHOLD.
+// Pixels are composited over black before they are compared. As in Diff,
+// pixels outside of the common area of the images count as different.
+// Implements the MetricFn signature.
+func perceptualDiffMetric(basic *DiffMetrics, one *image.NRGBA, two *image.NRGBA) float32 {
+	if basic.NumDiffPixels == 0 {
+		return 0
+	}
+	b1 := one.Bounds()
+	b2 := two.Bounds()
+	cmpWidth := util.MinInt(b1.Dx(), b2.Dx())
+	cmpHeight := util.MinInt(b1.Dy(), b2.Dy())
+	totalPixels := util.MaxInt(b1.Dx(), b2.Dx()) * util.MaxInt(b1.Dy(), b2.Dy())
+	numDiffPixels := totalPixels - cmpWidth*cmpHeight
+
+	for y := 0; y < cmpHeight; y++ {
+		for x := 0; x < cmpWidth; x++ {
+			i := one.PixOffset(b1.Min.X+x, b1.Min.Y+y)
+			j := two.PixOffset(b2.Min.X+x, b2.Min.Y+y)
+			p1 := one.Pix[i : i+4 : i+4]
+			p2 := two.Pix[j : j+4 : j+4]
+			if p1[0] == p2[0] && p1[1] == p2[1] && p1[2] == p2[2] && p1[3] == p2[3] {
+				continue
+			}
+			L1, A1, B1 := pixelToLAB(p1)
+			L2, A2, B2 := pixelToLAB(p2)
+			if colorspace.DeltaE(L1, A1, B1, L2, A2, B2) > PERCEPTUAL_THRESHOLD {
+				numDiffPixels++
+			}
+		}
+	}
+	return getPixelDiffPercent(numDiffPixels, totalPixels)
+}
+
+// pixelToLAB converts a non-premultiplied RGBA pixel to CIE L*a*b* after
+// compositing it over black.
+func pixelToLAB(p []uint8) (float64, float64, float64) {
+	a := float64(p[3]) / 255.0
+	return colorspace.ConvertRGBToLAB(linearChannel[p[0]]*a, linearChannel[p[1]]*a, linearChannel[p[2]]*a)
+}
@@ -48,7 +48,7 @@ func BenchmarkMemDiffStore(b *testing.B) {
 		}
 	}
 
-	diffStore, err := New(client, baseDir, []string{TEST_GS_BUCKET_NAME}, TEST_GS_IMAGE_DIR, 10)
+	diffStore, err := New(getGSImageSource(b, client, TEST_GS_BUCKET_NAME), baseDir, 10)
 	allDigests := make([][]string, 0, PROCESS_N_TESTS)
 	processed := 0
 	var wg sync.WaitGroup
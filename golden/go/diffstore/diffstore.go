@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"math"
 	"net/http"
+	"os"
 	"path/filepath"
 	"runtime"
 	"strings"
@@ -75,13 +76,14 @@ type MemDiffStore struct {
 // 'gigs' is the approximate number of gigs to use for caching. This is not the
 // exact amount memory that will be used, but a tuning parameter to increase
 // or decrease memory used. If 'gigs' is 0 nothing will be cached in memory.
-func New(client *http.Client, baseDir string, gsBucketNames []string, gsImageBaseDir string, gigs int) (diff.DiffStore, error) {
+// Images that are not cached on disk are retrieved from imgSource.
+func New(imgSource ImageSource, baseDir string, gigs int) (diff.DiffStore, error) {
 	imageCacheCount, diffCacheCount := getCacheCounts(gigs)
 
 	// Set up image retrieval, caching and serving.
 	imgDir := fileutil.Must(fileutil.EnsureDirExists(filepath.Join(baseDir, DEFAULT_IMG_DIR_NAME)))
-	imgLoader, err := newImgLoader(client, imgDir, gsBucketNames, gsImageBaseDir, imageCacheCount)
-	if err != err {
+	imgLoader, err := newImgLoader(imgSource, imgDir, imageCacheCount)
+	if err != nil {
 		return nil, err
 	}
 
@@ -169,16 +171,63 @@ func (d *MemDiffStore) Get(priority int64, mainDigest string, rightDigests []str
 	return diffMap, nil
 }
 
-// TODO(stephana): Implement UnavailableDigests and PurgeDigests when/if we
-// re-add the endpoints to deal with image errors.
+// TODO(stephana): Implement UnavailableDigests when/if we re-add the
+// endpoints to deal with image errors.
 
 // UnavailableDigests implements the DiffStore interface.
 func (m *MemDiffStore) UnavailableDigests() map[string]*diff.DigestFailure {
 	return nil
 }
 
-// PurgeDigests implements the DiffStore interface.
+// PurgeDigests implements the DiffStore interface. If purgeGS is true the
+// images are deleted from the image source.
 func (m *MemDiffStore) PurgeDigests(digests []string, purgeGS bool) error {
+	if err := m.imgLoader.purge(digests, purgeGS); err != nil {
+		return err
+	}
+
+	// Remove all diff metrics and diff images that involve the purged digests.
+	purged := util.NewStringSet(digests)
+	diffIDs := []string{}
+	updateFn := func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(METRICS_BUCKET))
+		if bucket == nil {
+			return nil
+		}
+
+		// Collect the ids first, since the bucket must not be modified while
+		// iterating over it.
+		err := bucket.ForEach(func(k, v []byte) error {
+			left, right := splitDigests(string(k))
+			if purged[left] || purged[right] {
+				diffIDs = append(diffIDs, string(k))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, id := range diffIDs {
+			if err := bucket.Delete([]byte(id)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if err := m.metricsDB.Update(updateFn); err != nil {
+		return fmt.Errorf("Unable to purge diff metrics: %s", err)
+	}
+	m.diffMetricsCache.Remove(diffIDs)
+
+	for _, id := range diffIDs {
+		left, right := splitDigests(id)
+		diffPath := fileutil.TwoLevelRadixPath(m.localDiffDir, getDiffImgFileName(left, right))
+		if err := os.Remove(diffPath); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("Unable to remove %s: %s", diffPath, err)
+		}
+	}
 	return nil
 }
 
@@ -240,10 +289,11 @@ func (m *MemDiffStore) ImageHandler(urlPrefix string) (http.Handler, error) {
 func (d *MemDiffStore) diffMetricsWorker(priority int64, id string) (interface{}, error) {
 	leftDigest, rightDigest := splitDigests(id)
 
-	// Load it from disk cache if necessary.
+	// Load it from disk cache if necessary. Diff metrics which were cached
+	// before a metric was added are recalculated.
 	if dm, err := d.loadDiffMetric(id); err != nil {
 		glog.Errorf("Error trying to load diff metric: %s", err)
-	} else if dm != nil {
+	} else if dm != nil && dm.HasAllMetrics() {
 		return dm, nil
 	}
 
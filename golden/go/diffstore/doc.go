@@ -2,7 +2,8 @@
 //
 // It consists of multiple components:
 //
-// - ImageLoader: Downloads images from Google storage and caches them on local
+// - ImageLoader: Downloads images from an ImageSource (Google storage, a local
+//                directory or an HTTP server) and caches them on local
 //                disk and RAM. It aims that proactively fetching images
 //                so that they are always in RAM when they are needed for
 //                calculating diffs. Making real time diffs fast, because we
@@ -2,22 +2,15 @@ package diffstore
 
 import (
 	"bytes"
-	"crypto/md5"
 	"errors"
 	"fmt"
 	"image"
-	"io"
-	"net/http"
-	"path/filepath"
+	"os"
 	"sync"
 
-	"cloud.google.com/go/storage"
 	"github.com/skia-dev/glog"
 	"go.skia.org/infra/go/fileutil"
 	"go.skia.org/infra/go/rtcache"
-	"go.skia.org/infra/go/util"
-	"golang.org/x/net/context"
-	"google.golang.org/api/option"
 )
 
 const (
@@ -30,18 +23,12 @@ const (
 
 // ImageLoader facilitates to continously download images and cache them in RAM.
 type ImageLoader struct {
-	// client is the Google storage client to local content form GS.
-	storageClient *storage.Client
+	// source is where images are retrieved from if they are not on disk.
+	source ImageSource
 
 	// localImgDir is the local directory where images should be written to.
 	localImgDir string
 
-	// gsBucketNames is the list of GS bucket where images are stored.
-	gsBucketNames []string
-
-	// gsImageBaseDir is the GS directory (prefix) where images are stored.
-	gsImageBaseDir string
-
 	// imageCache caches and calculates images.
 	imageCache rtcache.ReadThroughCache
 
@@ -52,17 +39,10 @@ type ImageLoader struct {
 }
 
 // Creates a new instance of ImageLoader.
-func newImgLoader(client *http.Client, imgDir string, gsBucketNames []string, gsImageBaseDir string, maxCacheSize int) (*ImageLoader, error) {
-	storageClient, err := storage.NewClient(context.Background(), option.WithHTTPClient(client))
-	if err != nil {
-		return nil, err
-	}
-
+func newImgLoader(source ImageSource, imgDir string, maxCacheSize int) (*ImageLoader, error) {
 	ret := &ImageLoader{
-		storageClient:  storageClient,
-		localImgDir:    imgDir,
-		gsBucketNames:  gsBucketNames,
-		gsImageBaseDir: gsImageBaseDir,
+		source:      source,
+		localImgDir: imgDir,
 	}
 
 	// Set up the work queues that balance the load.
@@ -140,7 +120,7 @@ func (il *ImageLoader) IsOnDisk(digest string) bool {
 }
 
 // imageLoadWorker implements the rtcache.ReadThroughFunc signature.
-// It loads an image file either from disk or from Google storage.
+// It loads an image file either from disk or from the image source.
 func (il *ImageLoader) imageLoadWorker(priority int64, digest string) (interface{}, error) {
 	// Check if the image is in the disk cache.
 	imageFileName := getDigestImageFileName(digest)
@@ -174,69 +154,27 @@ func (il *ImageLoader) saveImgInfoAsync(imageFileName string, imgBytes []byte) {
 	}()
 }
 
-// downloadImg retrieves the given image from Google storage.
+// downloadImg retrieves the given image from the image source.
 func (il *ImageLoader) downloadImg(digest string) ([]byte, error) {
 	glog.Infof("Starting download for for: %s", digest)
-	var err error
-	var imgData []byte
-	for _, bucketName := range il.gsBucketNames {
-		imgData, err = il.downloadImgFromBucket(digest, bucketName)
-		if err == nil {
-			return imgData, nil
-		}
-	}
-	return nil, fmt.Errorf("Failed finding image %s in buckets %v. Last error: %s", digest, il.gsBucketNames, err)
+	return il.source.GetImage(digest)
 }
 
-// downloadImgFromBucket retrieves the given image from the given Google storage bucket.
-// It returns storage.ErrObjectNotExist if the given image does not exist in the bucket.
-func (il *ImageLoader) downloadImgFromBucket(digest, bucketName string) ([]byte, error) {
-	objLocation := filepath.Join(il.gsImageBaseDir, getDigestImageFileName(digest))
-	ctx := context.Background()
-
-	// Retrieve the attributes.
-	attrs, err := il.storageClient.Bucket(bucketName).Object(objLocation).Attrs(ctx)
-	if err != nil {
-		return nil, fmt.Errorf("Unable to retrieve attributes for %s/%s: %s", bucketName, objLocation, err)
-	}
-
-	var buf *bytes.Buffer
-	for i := 0; i < MAX_URI_GET_TRIES; i++ {
-		err = func() error {
-			reader, err := il.storageClient.Bucket(bucketName).Object(objLocation).NewReader(ctx)
-			if err != nil {
-				return fmt.Errorf("New reader failed for %s/%s: %s", bucketName, objLocation, err)
-			}
-			defer util.Close(reader)
-
-			size := reader.Size()
-			buf = bytes.NewBuffer(make([]byte, 0, size))
-			md5Hash := md5.New()
-			multiOut := io.MultiWriter(md5Hash, buf)
+// purge removes the given digests from the RAM and disk cache. If purgeSource
+// is true the images are also deleted from the image source.
+func (il *ImageLoader) purge(digests []string, purgeSource bool) error {
+	il.imageCache.Remove(digests)
+	for _, digest := range digests {
+		imagePath := fileutil.TwoLevelRadixPath(il.localImgDir, getDigestImageFileName(digest))
+		if err := os.Remove(imagePath); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("Unable to remove %s: %s", imagePath, err)
+		}
 
-			if _, err = io.Copy(multiOut, reader); err != nil {
+		if purgeSource {
+			if err := il.source.DeleteImage(digest); err != nil {
 				return err
 			}
-
-			// Check the MD5.
-			if !bytes.Equal(md5Hash.Sum(nil), attrs.MD5) {
-				return fmt.Errorf("MD5 hash for digest %s incorrect.", digest)
-			}
-
-			return nil
-		}()
-
-		if err == nil {
-			break
 		}
-		glog.Errorf("Error fetching file for digest %s: %s", digest, err)
-	}
-
-	if err != nil {
-		glog.Errorf("Failed fetching file after %d attempts", MAX_URI_GET_TRIES)
-		return nil, err
 	}
-
-	glog.Infof("Done downloading image for: %s. Length: %d", digest, buf.Len())
-	return buf.Bytes(), err
+	return nil
 }
@@ -67,8 +67,8 @@ func getImageLoaderAndTile(t assert.TestingT) (string, string, *tiling.Tile, *Im
 	assert.Nil(t, os.Mkdir(workingDir, 0777))
 
 	imgCacheCount, _ := getCacheCounts(10)
-	gsBuckets := []string{TEST_GS_BUCKET_NAME, TEST_GS_SECONDARY_BUCKET}
-	imgLoader, err := newImgLoader(client, workingDir, gsBuckets, TEST_GS_IMAGE_DIR, imgCacheCount)
+	imgSource := getGSImageSource(t, client, TEST_GS_BUCKET_NAME, TEST_GS_SECONDARY_BUCKET)
+	imgLoader, err := newImgLoader(imgSource, workingDir, imgCacheCount)
 	assert.NoError(t, err)
 	return baseDir, workingDir, tile, imgLoader
 }
@@ -0,0 +1,211 @@
+package diffstore
+
+import (
+	"bytes"
+	"crypto/md5"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"cloud.google.com/go/storage"
+	"github.com/skia-dev/glog"
+	"go.skia.org/infra/go/util"
+	"golang.org/x/net/context"
+	"google.golang.org/api/option"
+)
+
+// ImageSource is where ImageLoader retrieves images that are not in its local
+// disk cache. Images are PNG files named after their digest.
+type ImageSource interface {
+	// GetImage returns the encoded image with the given digest.
+	GetImage(digest string) ([]byte, error)
+
+	// DeleteImage removes the image with the given digest from the source,
+	// which forces the bots to upload it again.
+	DeleteImage(digest string) error
+}
+
+// GSImageSource implements ImageSource for images stored in Google Storage.
+type GSImageSource struct {
+	// client is the Google storage client to local content form GS.
+	storageClient *storage.Client
+
+	// bucketNames is the list of GS bucket where images are stored. They are
+	// searched in order.
+	bucketNames []string
+
+	// imageBaseDir is the GS directory (prefix) where images are stored.
+	imageBaseDir string
+}
+
+// NewGSImageSource returns an ImageSource for images in the given directory of
+// the given Google Storage buckets.
+func NewGSImageSource(client *http.Client, bucketNames []string, imageBaseDir string) (ImageSource, error) {
+	storageClient, err := storage.NewClient(context.Background(), option.WithHTTPClient(client))
+	if err != nil {
+		return nil, err
+	}
+	return &GSImageSource{
+		storageClient: storageClient,
+		bucketNames:   bucketNames,
+		imageBaseDir:  imageBaseDir,
+	}, nil
+}
+
+// GetImage implements the ImageSource interface.
+func (g *GSImageSource) GetImage(digest string) ([]byte, error) {
+	var err error
+	var imgData []byte
+	for _, bucketName := range g.bucketNames {
+		imgData, err = g.downloadImgFromBucket(digest, bucketName)
+		if err == nil {
+			return imgData, nil
+		}
+	}
+	return nil, fmt.Errorf("Failed finding image %s in buckets %v. Last error: %s", digest, g.bucketNames, err)
+}
+
+// DeleteImage implements the ImageSource interface. It deletes the image from
+// all buckets that contain it.
+func (g *GSImageSource) DeleteImage(digest string) error {
+	objLocation := filepath.Join(g.imageBaseDir, getDigestImageFileName(digest))
+	ctx := context.Background()
+	for _, bucketName := range g.bucketNames {
+		err := g.storageClient.Bucket(bucketName).Object(objLocation).Delete(ctx)
+		if err != nil && err != storage.ErrObjectNotExist {
+			return fmt.Errorf("Unable to delete %s/%s: %s", bucketName, objLocation, err)
+		}
+	}
+	return nil
+}
+
+// downloadImgFromBucket retrieves the given image from the given Google storage bucket.
+// It returns storage.ErrObjectNotExist if the given image does not exist in the bucket.
+func (g *GSImageSource) downloadImgFromBucket(digest, bucketName string) ([]byte, error) {
+	objLocation := filepath.Join(g.imageBaseDir, getDigestImageFileName(digest))
+	ctx := context.Background()
+
+	// Retrieve the attributes.
+	attrs, err := g.storageClient.Bucket(bucketName).Object(objLocation).Attrs(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to retrieve attributes for %s/%s: %s", bucketName, objLocation, err)
+	}
+
+	var buf *bytes.Buffer
+	for i := 0; i < MAX_URI_GET_TRIES; i++ {
+		err = func() error {
+			reader, err := g.storageClient.Bucket(bucketName).Object(objLocation).NewReader(ctx)
+			if err != nil {
+				return fmt.Errorf("New reader failed for %s/%s: %s", bucketName, objLocation, err)
+			}
+			defer util.Close(reader)
+
+			size := reader.Size()
+			buf = bytes.NewBuffer(make([]byte, 0, size))
+			md5Hash := md5.New()
+			multiOut := io.MultiWriter(md5Hash, buf)
+
+			if _, err = io.Copy(multiOut, reader); err != nil {
+				return err
+			}
+
+			// Check the MD5.
+			if !bytes.Equal(md5Hash.Sum(nil), attrs.MD5) {
+				return fmt.Errorf("MD5 hash for digest %s incorrect.", digest)
+			}
+
+			return nil
+		}()
+
+		if err == nil {
+			break
+		}
+		glog.Errorf("Error fetching file for digest %s: %s", digest, err)
+	}
+
+	if err != nil {
+		glog.Errorf("Failed fetching file after %d attempts", MAX_URI_GET_TRIES)
+		return nil, err
+	}
+
+	glog.Infof("Done downloading image for: %s. Length: %d", digest, buf.Len())
+	return buf.Bytes(), err
+}
+
+// LocalImageSource implements ImageSource for images in a local directory,
+// e.g. the output directory of DM.
+type LocalImageSource struct {
+	dir string
+}
+
+// NewLocalImageSource returns an ImageSource for the images in the given
+// directory.
+func NewLocalImageSource(dir string) ImageSource {
+	return &LocalImageSource{dir: dir}
+}
+
+// GetImage implements the ImageSource interface.
+func (l *LocalImageSource) GetImage(digest string) ([]byte, error) {
+	return ioutil.ReadFile(filepath.Join(l.dir, getDigestImageFileName(digest)))
+}
+
+// DeleteImage implements the ImageSource interface.
+func (l *LocalImageSource) DeleteImage(digest string) error {
+	if err := os.Remove(filepath.Join(l.dir, getDigestImageFileName(digest))); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// HTTPImageSource implements ImageSource for images served by an HTTP server.
+// Images are retrieved from <baseURL>/<digest>.png.
+type HTTPImageSource struct {
+	client  *http.Client
+	baseURL string
+}
+
+// NewHTTPImageSource returns an ImageSource for the images served at the
+// given URL.
+func NewHTTPImageSource(client *http.Client, baseURL string) ImageSource {
+	return &HTTPImageSource{
+		client:  client,
+		baseURL: strings.TrimRight(baseURL, "/"),
+	}
+}
+
+// GetImage implements the ImageSource interface.
+func (h *HTTPImageSource) GetImage(digest string) ([]byte, error) {
+	url := h.baseURL + "/" + getDigestImageFileName(digest)
+	var err error
+	for i := 0; i < MAX_URI_GET_TRIES; i++ {
+		var imgData []byte
+		if imgData, err = h.get(url); err == nil {
+			return imgData, nil
+		}
+		glog.Errorf("Error fetching %s: %s", url, err)
+	}
+	return nil, err
+}
+
+// get retrieves the body of the given URL.
+func (h *HTTPImageSource) get(url string) ([]byte, error) {
+	resp, err := h.client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer util.Close(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Unable to retrieve %s. Got status: %s", url, resp.Status)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+// DeleteImage implements the ImageSource interface. Images can not be deleted
+// from an HTTP server.
+func (h *HTTPImageSource) DeleteImage(digest string) error {
+	return fmt.Errorf("Unable to delete %s: images can not be deleted from %s.", digest, h.baseURL)
+}
@@ -0,0 +1,142 @@
+package diffstore
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	assert "github.com/stretchr/testify/require"
+
+	"go.skia.org/infra/go/fileutil"
+	"go.skia.org/infra/go/testutils"
+	"go.skia.org/infra/golden/go/diff"
+)
+
+const (
+	TEST_DIGEST_1 = "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
+	TEST_DIGEST_2 = "bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb"
+	TEST_DIGEST_3 = "cccccccccccccccccccccccccccccccc"
+)
+
+func TestLocalImageSource(t *testing.T) {
+	testutils.SmallTest(t)
+
+	srcDir, imgs := writeTestImages(t)
+	defer testutils.RemoveAll(t, srcDir)
+
+	imgSource := NewLocalImageSource(srcDir)
+	found, err := imgSource.GetImage(TEST_DIGEST_1)
+	assert.NoError(t, err)
+	assert.Equal(t, imgs[TEST_DIGEST_1], found)
+
+	_, err = imgSource.GetImage("some-digest-that-does-not-exist")
+	assert.Error(t, err)
+
+	assert.NoError(t, imgSource.DeleteImage(TEST_DIGEST_1))
+	_, err = imgSource.GetImage(TEST_DIGEST_1)
+	assert.Error(t, err)
+
+	// Deleting a missing image is not an error.
+	assert.NoError(t, imgSource.DeleteImage(TEST_DIGEST_1))
+}
+
+func TestHTTPImageSource(t *testing.T) {
+	testutils.SmallTest(t)
+
+	srcDir, imgs := writeTestImages(t)
+	defer testutils.RemoveAll(t, srcDir)
+
+	server := httptest.NewServer(http.FileServer(http.Dir(srcDir)))
+	defer server.Close()
+
+	imgSource := NewHTTPImageSource(http.DefaultClient, server.URL+"/")
+	found, err := imgSource.GetImage(TEST_DIGEST_2)
+	assert.NoError(t, err)
+	assert.Equal(t, imgs[TEST_DIGEST_2], found)
+
+	_, err = imgSource.GetImage("some-digest-that-does-not-exist")
+	assert.Error(t, err)
+	assert.Error(t, imgSource.DeleteImage(TEST_DIGEST_2))
+}
+
+func TestPurgeDigests(t *testing.T) {
+	testutils.SmallTest(t)
+
+	srcDir, _ := writeTestImages(t)
+	defer testutils.RemoveAll(t, srcDir)
+	baseDir, err := ioutil.TempDir("", "diffstore-purge")
+	assert.NoError(t, err)
+	defer testutils.RemoveAll(t, baseDir)
+
+	diffStore, err := New(NewLocalImageSource(srcDir), baseDir, 1)
+	assert.NoError(t, err)
+	memDiffStore := diffStore.(*MemDiffStore)
+
+	digests := []string{TEST_DIGEST_1, TEST_DIGEST_2, TEST_DIGEST_3}
+	diffStore.WarmDigests(diff.PRIORITY_NOW, digests)
+	memDiffStore.imgLoader.sync()
+	diffStore.WarmDiffs(diff.PRIORITY_NOW, digests, digests)
+	memDiffStore.sync()
+
+	found, err := diffStore.Get(diff.PRIORITY_NOW, TEST_DIGEST_1, digests)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(found))
+	memDiffStore.sync()
+
+	diffID := combineDigests(TEST_DIGEST_1, TEST_DIGEST_2)
+	otherDiffID := combineDigests(TEST_DIGEST_2, TEST_DIGEST_3)
+	diffPath := fileutil.TwoLevelRadixPath(memDiffStore.localDiffDir, getDiffImgFileName(TEST_DIGEST_1, TEST_DIGEST_2))
+	assert.True(t, memDiffStore.imgLoader.IsOnDisk(TEST_DIGEST_1))
+	assert.True(t, memDiffStore.diffMetricsCache.Contains(diffID))
+	assert.True(t, fileutil.FileExists(diffPath))
+
+	// Purge the first digest from the local caches only.
+	assert.NoError(t, diffStore.PurgeDigests([]string{TEST_DIGEST_1}, false))
+	assert.False(t, memDiffStore.imgLoader.IsOnDisk(TEST_DIGEST_1))
+	assert.False(t, memDiffStore.diffMetricsCache.Contains(diffID))
+	assert.False(t, fileutil.FileExists(diffPath))
+	dm, err := memDiffStore.loadDiffMetric(diffID)
+	assert.NoError(t, err)
+	assert.Nil(t, dm)
+
+	// Diffs that don't involve the purged digest are retained.
+	assert.True(t, memDiffStore.diffMetricsCache.Contains(otherDiffID))
+	dm, err = memDiffStore.loadDiffMetric(otherDiffID)
+	assert.NoError(t, err)
+	assert.NotNil(t, dm)
+
+	// The image is fetched from the source again.
+	_, err = memDiffStore.imgLoader.Get(diff.PRIORITY_NOW, []string{TEST_DIGEST_1})
+	assert.NoError(t, err)
+	memDiffStore.imgLoader.sync()
+	assert.True(t, memDiffStore.imgLoader.IsOnDisk(TEST_DIGEST_1))
+
+	// Purge the digest from the image source as well.
+	assert.NoError(t, diffStore.PurgeDigests([]string{TEST_DIGEST_1}, true))
+	assert.False(t, fileutil.FileExists(filepath.Join(srcDir, getDigestImageFileName(TEST_DIGEST_1))))
+	_, err = memDiffStore.imgLoader.Get(diff.PRIORITY_NOW, []string{TEST_DIGEST_1})
+	assert.Error(t, err)
+}
+
+// writeTestImages writes a small PNG image for each test digest to a
+// temporary directory and returns the directory and the encoded images.
+func writeTestImages(t *testing.T) (string, map[string][]byte) {
+	dir, err := ioutil.TempDir("", "diffstore-imgsource")
+	assert.NoError(t, err)
+
+	ret := map[string][]byte{}
+	for i, digest := range []string{TEST_DIGEST_1, TEST_DIGEST_2, TEST_DIGEST_3} {
+		img := image.NewNRGBA(image.Rect(0, 0, 4, 4))
+		img.Set(i, i, color.NRGBA{R: 255, A: 255})
+		var buf bytes.Buffer
+		assert.NoError(t, encodeImg(&buf, img))
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, getDigestImageFileName(digest)), buf.Bytes(), 0644))
+		ret[digest] = buf.Bytes()
+	}
+	return dir, ret
+}
@@ -49,3 +49,9 @@ func getClient(t assert.TestingT) *http.Client {
 	assert.NoError(t, err)
 	return client
 }
+
+func getGSImageSource(t assert.TestingT, client *http.Client, bucketNames ...string) ImageSource {
+	imgSource, err := NewGSImageSource(client, bucketNames, TEST_GS_IMAGE_DIR)
+	assert.NoError(t, err)
+	return imgSource
+}
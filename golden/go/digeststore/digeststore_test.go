@@ -6,7 +6,9 @@ import (
 	"time"
 
 	assert "github.com/stretchr/testify/require"
+	"go.skia.org/infra/go/database/testutil"
 	"go.skia.org/infra/go/testutils"
+	"go.skia.org/infra/golden/go/db"
 )
 
 const TEST_DATA_DIR = "testdata"
@@ -21,6 +23,81 @@ func TestDigestStore(t *testing.T) {
 	testDigestStore(t, digestStore)
 }
 
+func TestSQLDigestStore(t *testing.T) {
+	testutils.MediumTest(t)
+
+	// Set up the test database.
+	testDb := testutil.SetupMySQLTestDatabase(t, db.MigrationSteps())
+	defer testDb.Close(t)
+
+	conf := testutil.LocalTestDatabaseConfig(db.MigrationSteps())
+	vdb, err := conf.NewVersionedDB()
+	assert.NoError(t, err)
+	testDigestStore(t, NewSQLDigestStore(vdb))
+}
+
+func TestSQLDigestStoreImportBolt(t *testing.T) {
+	testutils.MediumTest(t)
+	assert.NoError(t, os.MkdirAll(TEST_DATA_DIR, 0755))
+	defer testutils.RemoveAll(t, TEST_DATA_DIR)
+
+	testDb := testutil.SetupMySQLTestDatabase(t, db.MigrationSteps())
+	defer testDb.Close(t)
+
+	conf := testutil.LocalTestDatabaseConfig(db.MigrationSteps())
+	vdb, err := conf.NewVersionedDB()
+	assert.NoError(t, err)
+	sqlStore := NewSQLDigestStore(vdb)
+
+	// Nothing is imported if there is no Bolt store.
+	n, err := sqlStore.ImportBolt(TEST_DATA_DIR)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, n)
+
+	boltStore, err := New(TEST_DATA_DIR)
+	assert.NoError(t, err)
+	assert.NoError(t, boltStore.Update([]*DigestInfo{
+		&DigestInfo{TestName: "test_1", Digest: "digest_1", First: 10, Last: 20, IssueIDs: []int{1, 2}},
+		&DigestInfo{TestName: "test_1", Digest: "digest_2", First: 10, Last: 10, Exception: "bad png"},
+		&DigestInfo{TestName: "test_2", Digest: "digest_1", First: 30, Last: 40},
+	}))
+	assert.NoError(t, boltStore.(*BoltDigestStore).digestDB.Close())
+
+	// The database already has newer values for one of the digests.
+	assert.NoError(t, sqlStore.Update([]*DigestInfo{
+		&DigestInfo{TestName: "test_1", Digest: "digest_1", First: 15, Last: 50, IssueIDs: []int{3}},
+	}))
+
+	n, err = sqlStore.ImportBolt(TEST_DATA_DIR)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, n)
+
+	di, ok, err := sqlStore.Get("test_1", "digest_1")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, &DigestInfo{TestName: "test_1", Digest: "digest_1", First: 15, Last: 50, IssueIDs: []int{3}}, di)
+
+	di, ok, err = sqlStore.Get("test_1", "digest_2")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "bad png", di.Exception)
+
+	di, ok, err = sqlStore.Get("test_2", "digest_1")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, int64(30), di.First)
+	assert.Equal(t, int64(40), di.Last)
+
+	// Importing again does not change anything.
+	n, err = sqlStore.ImportBolt(TEST_DATA_DIR)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, n)
+	di, ok, err = sqlStore.Get("test_1", "digest_1")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, &DigestInfo{TestName: "test_1", Digest: "digest_1", First: 15, Last: 50, IssueIDs: []int{3}}, di)
+}
+
 func testDigestStore(t assert.TestingT, digestStore DigestStore) {
 	testName_1, digest_1 := "smapleTest_1", "sampleDigest_1"
 	timestamp_1 := time.Now().Unix() - 20
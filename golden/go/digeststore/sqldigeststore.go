@@ -0,0 +1,137 @@
+package digeststore
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"go.skia.org/infra/go/database"
+	"go.skia.org/infra/go/util"
+)
+
+// SQLDigestStore implements the DigestStore interface on top of an SQL
+// database, so that it can be shared by multiple processes.
+type SQLDigestStore struct {
+	vdb *database.VersionedDB
+}
+
+// NewSQLDigestStore returns a new DigestStore that is backed by the given
+// database.
+func NewSQLDigestStore(vdb *database.VersionedDB) *SQLDigestStore {
+	return &SQLDigestStore{
+		vdb: vdb,
+	}
+}
+
+// Get, see DigestStore interface.
+func (s *SQLDigestStore) Get(testName, digest string) (*DigestInfo, bool, error) {
+	const stmt = `SELECT first, last, exception, issue_ids FROM digestinfo WHERE name=? AND digest=?`
+
+	ret := &DigestInfo{TestName: testName, Digest: digest}
+	var issueIDs string
+	err := s.vdb.DB.QueryRow(stmt, testName, digest).Scan(&ret.First, &ret.Last, &ret.Exception, &issueIDs)
+	if err == sql.ErrNoRows {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	if err := json.Unmarshal([]byte(issueIDs), &ret.IssueIDs); err != nil {
+		return nil, false, fmt.Errorf("Unable to decode issue ids of %s/%s: %s", testName, digest, err)
+	}
+	return ret, true, nil
+}
+
+// Update, see DigestStore interface. New digests are inserted as they are.
+// For existing digests only the timestamps are updated, the same way
+// DigestInfo.UpdateTimestamps does.
+func (s *SQLDigestStore) Update(digestInfos []*DigestInfo) error {
+	const stmtTmpl = `INSERT INTO digestinfo (name, digest, first, last, exception, issue_ids) VALUES %s
+	                  ON DUPLICATE KEY UPDATE first=LEAST(first, VALUES(first)), last=GREATEST(last, VALUES(last))`
+	return s.insert(stmtTmpl, digestInfos)
+}
+
+// ImportBolt copies all digests of the Bolt digest store in storageDir into
+// the database and returns the number of digests read from it. Digests that
+// are already in the database are left untouched, so running the import again
+// never overwrites newer values. It is meant to be run once by
+// correctness_migratedb when switching from the Bolt store to the database.
+// Nothing is imported if there is no Bolt digest store in storageDir.
+func (s *SQLDigestStore) ImportBolt(storageDir string) (int, error) {
+	const batchSize = 1000
+	const stmtTmpl = `INSERT IGNORE INTO digestinfo (name, digest, first, last, exception, issue_ids) VALUES %s`
+
+	boltPath := path.Join(storageDir, SUB_DIR_NAME, DIGEST_DB_NAME)
+	if _, err := os.Stat(boltPath); os.IsNotExist(err) {
+		return 0, nil
+	}
+	boltDB, err := bolt.Open(boltPath, 0666, &bolt.Options{ReadOnly: true, Timeout: time.Minute})
+	if err != nil {
+		return 0, fmt.Errorf("Unable to open the Bolt digest store in %s: %s", storageDir, err)
+	}
+	defer util.Close(boltDB)
+
+	total := 0
+	batch := make([]*DigestInfo, 0, batchSize)
+	flush := func() error {
+		if err := s.insert(stmtTmpl, batch); err != nil {
+			return err
+		}
+		total += len(batch)
+		batch = batch[:0]
+		return nil
+	}
+
+	err = boltDB.View(func(tx *bolt.Tx) error {
+		return tx.ForEach(func(testName []byte, bucket *bolt.Bucket) error {
+			return bucket.ForEach(func(digest, value []byte) error {
+				di := &DigestInfo{}
+				if err := json.Unmarshal(value, di); err != nil {
+					return fmt.Errorf("Unable to decode digest info of %s/%s: %s", testName, digest, err)
+				}
+				di.TestName, di.Digest = string(testName), string(digest)
+				batch = append(batch, di)
+				if len(batch) == batchSize {
+					return flush()
+				}
+				return nil
+			})
+		})
+	})
+	if err != nil {
+		return total, err
+	}
+	return total, flush()
+}
+
+// insert writes the given digests to the database with the INSERT statement
+// stmtTmpl, whose only verb is replaced by the list of values.
+func (s *SQLDigestStore) insert(stmtTmpl string, digestInfos []*DigestInfo) error {
+	if len(digestInfos) == 0 {
+		return nil
+	}
+
+	placeHolders := make([]string, 0, len(digestInfos))
+	vals := make([]interface{}, 0, 6*len(digestInfos))
+	for _, di := range digestInfos {
+		issueIDs := di.IssueIDs
+		if issueIDs == nil {
+			issueIDs = []int{}
+		}
+		issueIDsJson, err := json.Marshal(issueIDs)
+		if err != nil {
+			return err
+		}
+		placeHolders = append(placeHolders, "(?, ?, ?, ?, ?, ?)")
+		vals = append(vals, di.TestName, di.Digest, di.First, di.Last, di.Exception, string(issueIDsJson))
+	}
+
+	_, err := s.vdb.DB.Exec(fmt.Sprintf(stmtTmpl, strings.Join(placeHolders, ",")), vals...)
+	return err
+}
@@ -31,6 +31,29 @@ func newClosest() *Closest {
 //
 // If no digest of type 'label' is found then Closest.Digest is the empty string.
 func ClosestDigest(test string, digest string, exp *expstorage.Expectations, tallies tally.Tally, diffStore diff.DiffStore, label types.Label) *Closest {
+	return closestDigest(test, digest, exp, tallies, diffStore, label, func(dm *diff.DiffMetrics) (float32, bool) {
+		return combinedDiffMetric(dm.PixelDiffPercent, dm.MaxRGBADiffs), true
+	})
+}
+
+// ClosestDigestByMetric works like ClosestDigest, but ranks the digests by the
+// given diff metric, e.g. diff.METRIC_PERCEPTUAL. Closest.Diff contains the
+// value of that metric. Digests whose diff metrics lack the metric are ignored.
+// If metric is empty it behaves exactly like ClosestDigest.
+func ClosestDigestByMetric(test string, digest string, exp *expstorage.Expectations, tallies tally.Tally, diffStore diff.DiffStore, label types.Label, metric string) *Closest {
+	if metric == "" {
+		return ClosestDigest(test, digest, exp, tallies, diffStore, label)
+	}
+	return closestDigest(test, digest, exp, tallies, diffStore, label, func(dm *diff.DiffMetrics) (float32, bool) {
+		delta, ok := dm.Diffs[metric]
+		return delta, ok
+	})
+}
+
+// closestDigest returns the digest of type 'label' with the smallest delta to
+// 'digest' as returned by deltaFn. deltaFn returns false if a digest should
+// be ignored.
+func closestDigest(test string, digest string, exp *expstorage.Expectations, tallies tally.Tally, diffStore diff.DiffStore, label types.Label, deltaFn func(*diff.DiffMetrics) (float32, bool)) *Closest {
 	ret := newClosest()
 	unavailableDigests := diffStore.UnavailableDigests()
 
@@ -54,7 +77,7 @@ func ClosestDigest(test string, digest string, exp *expstorage.Expectations, tal
 		return ret
 	} else {
 		for digest, diff := range diffMetrics {
-			if delta := combinedDiffMetric(diff.PixelDiffPercent, diff.MaxRGBADiffs); delta < ret.Diff {
+			if delta, ok := deltaFn(diff); ok && delta < ret.Diff {
 				ret.Digest = digest
 				ret.Diff = delta
 				ret.DiffPixels = diff.PixelDiffPercent
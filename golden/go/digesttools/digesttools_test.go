@@ -79,6 +79,67 @@ func TestClosestDigest(t *testing.T) {
 	assert.Equal(t, []int{5, 3, 4, 0}, c.MaxRGBA)
 }
 
+// PerceptualDiffStore returns perceptual diffs where "aaa" is closest to dMain
+// and "ggg" lacks the perceptual metric.
+type PerceptualDiffStore struct {
+	MockDiffStore
+}
+
+func (m PerceptualDiffStore) Get(priority int64, dMain string, dRest []string) (map[string]*diff.DiffMetrics, error) {
+	result, err := m.MockDiffStore.Get(priority, dMain, dRest)
+	if err != nil {
+		return nil, err
+	}
+	for d, dm := range result {
+		switch d {
+		case "aaa":
+			dm.Diffs = map[string]float32{diff.METRIC_PERCEPTUAL: 0.5}
+		case "ggg":
+			dm.Diffs = map[string]float32{}
+		default:
+			dm.Diffs = map[string]float32{diff.METRIC_PERCEPTUAL: 2}
+		}
+	}
+	return result, nil
+}
+
+func TestClosestDigestByMetric(t *testing.T) {
+	testutils.SmallTest(t)
+	diffStore := PerceptualDiffStore{}
+	exp := &expstorage.Expectations{
+		Tests: map[string]types.TestClassification{
+			"foo": map[string]types.Label{
+				"aaa": types.POSITIVE,
+				"bbb": types.NEGATIVE,
+				"eee": types.POSITIVE,
+				"ggg": types.POSITIVE,
+			},
+		},
+	}
+	tallies := tally.Tally{
+		"aaa": 2,
+		"bbb": 2,
+		"eee": 2,
+		"ggg": 2,
+	}
+
+	// "eee" is closest by the combined metric, "aaa" by the perceptual one.
+	c := ClosestDigest("foo", "fff", exp, tallies, diffStore, types.POSITIVE)
+	assert.Equal(t, "eee", c.Digest)
+	c = ClosestDigestByMetric("foo", "fff", exp, tallies, diffStore, types.POSITIVE, diff.METRIC_PERCEPTUAL)
+	assert.Equal(t, "aaa", c.Digest)
+	assert.Equal(t, float32(0.5), c.Diff)
+	c = ClosestDigestByMetric("foo", "fff", exp, tallies, diffStore, types.POSITIVE, "")
+	assert.Equal(t, "eee", c.Digest)
+
+	// Digests without the metric are ignored.
+	exp.Tests["foo"]["aaa"] = types.NEGATIVE
+	exp.Tests["foo"]["eee"] = types.NEGATIVE
+	c = ClosestDigestByMetric("foo", "fff", exp, tallies, diffStore, types.POSITIVE, diff.METRIC_PERCEPTUAL)
+	assert.Equal(t, "", c.Digest)
+	assert.Equal(t, float32(math.MaxFloat32), c.Diff)
+}
+
 func TestCombinedDiffMetric(t *testing.T) {
 	testutils.SmallTest(t)
 	assert.InDelta(t, 1.0, combinedDiffMetric(0.0, []int{}), 0.000001)
@@ -61,6 +61,17 @@ func (e *Expectations) RemoveDigests(digests map[string][]string) {
 	}
 }
 
+// Overlay returns a copy of e with the labels in overlay taking precedence
+// over the labels in e. If overlay is empty, e is returned.
+func (e *Expectations) Overlay(overlay *Expectations) *Expectations {
+	if overlay == nil || len(overlay.Tests) == 0 {
+		return e
+	}
+	ret := e.DeepCopy()
+	ret.AddDigests(overlay.Tests)
+	return ret
+}
+
 func (e *Expectations) DeepCopy() *Expectations {
 	m := make(map[string]types.TestClassification, len(e.Tests))
 	for k, v := range e.Tests {
@@ -138,6 +149,24 @@ type ExpectationsStore interface {
 	// undone.
 	UndoChange(changeID int, userID string) (map[string]types.TestClassification, error)
 
+	// GetIssue returns the expectations that were triaged for the given
+	// trybot issue. They only contain the digests that were triaged on the
+	// issue and are meant to be applied on top of the master expectations
+	// via Expectations.Overlay.
+	GetIssue(issueID string) (*Expectations, error)
+
+	// AddIssueChange writes the given classified digests to the expectations
+	// of the given issue. The master expectations are not changed.
+	AddIssueChange(issueID string, changes map[string]types.TestClassification, userId string) error
+
+	// IssueIDs returns the ids of all issues that have expectations.
+	IssueIDs() ([]string, error)
+
+	// MergeIssue adds the expectations of the given issue to the master
+	// expectations as a change made by userId and removes the expectations
+	// of the issue. It is called once the issue has landed.
+	MergeIssue(issueID string, userId string) error
+
 	// CanonicalTraceIDs returns the cannonical trace IDs for the given list
 	// of test names.
 	CanonicalTraceIDs(testNames []string) (map[string]string, error)
@@ -171,7 +200,10 @@ type MemExpectationsStore struct {
 	readCopy     *Expectations
 	eventBus     *eventbus.EventBus
 
-	// Protects expectations.
+	// issues maps issue ids to the expectations of the issue.
+	issues map[string]*Expectations
+
+	// Protects expectations and issues.
 	mutex sync.Mutex
 }
 
@@ -181,6 +213,7 @@ func NewMemExpectationsStore(eventBus *eventbus.EventBus) ExpectationsStore {
 		expectations: NewExpectations(),
 		readCopy:     NewExpectations(),
 		eventBus:     eventBus,
+		issues:       map[string]*Expectations{},
 	}
 }
 
@@ -197,7 +230,13 @@ func (m *MemExpectationsStore) Get() (*Expectations, error) {
 func (m *MemExpectationsStore) AddChange(changedTests map[string]types.TestClassification, userId string) error {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
+	m.addChange(changedTests)
+	return nil
+}
 
+// addChange applies the given changes to the master expectations. The caller
+// must hold the mutex.
+func (m *MemExpectationsStore) addChange(changedTests map[string]types.TestClassification) {
 	testNames := make([]string, 0, len(changedTests))
 	for testName, digests := range changedTests {
 		if _, ok := m.expectations.Tests[testName]; !ok {
@@ -213,7 +252,6 @@ func (m *MemExpectationsStore) AddChange(changedTests map[string]types.TestClass
 	}
 
 	m.readCopy = m.expectations.DeepCopy()
-	return nil
 }
 
 // RemoveChange, see ExpectationsStore interface.
@@ -252,6 +290,53 @@ func (m *MemExpectationsStore) UndoChange(changeID int, userID string) (map[stri
 	return nil, nil
 }
 
+// See ExpectationsStore interface.
+func (m *MemExpectationsStore) GetIssue(issueID string) (*Expectations, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if exp, ok := m.issues[issueID]; ok {
+		return exp.DeepCopy(), nil
+	}
+	return NewExpectations(), nil
+}
+
+// See ExpectationsStore interface.
+func (m *MemExpectationsStore) AddIssueChange(issueID string, changedTests map[string]types.TestClassification, userId string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if _, ok := m.issues[issueID]; !ok {
+		m.issues[issueID] = NewExpectations()
+	}
+	m.issues[issueID].AddDigests(changedTests)
+	return nil
+}
+
+// See ExpectationsStore interface.
+func (m *MemExpectationsStore) IssueIDs() ([]string, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	ret := make([]string, 0, len(m.issues))
+	for issueID := range m.issues {
+		ret = append(ret, issueID)
+	}
+	return ret, nil
+}
+
+// See ExpectationsStore interface.
+func (m *MemExpectationsStore) MergeIssue(issueID string, userId string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if exp, ok := m.issues[issueID]; ok {
+		delete(m.issues, issueID)
+		m.addChange(exp.Tests)
+	}
+	return nil
+}
+
 // See ExpectationsStore interface.
 // TODO(stephana): Implement once API is defined.
 func (m *MemExpectationsStore) CanonicalTraceIDs(testNames []string) (map[string]string, error) {
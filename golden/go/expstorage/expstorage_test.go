@@ -27,11 +27,97 @@ func TestMySQLExpectationsStore(t *testing.T) {
 	// Test the MySQL backed store
 	sqlStore := NewSQLExpectationStore(vdb)
 	testExpectationStore(t, sqlStore, nil)
+	testIssueExpectations(t, sqlStore, "1234")
 
 	// Test the caching version of the MySQL store.
 	eventBus := eventbus.New(nil)
 	cachingStore := NewCachingExpectationStore(sqlStore, eventBus)
 	testExpectationStore(t, cachingStore, eventBus)
+	testIssueExpectations(t, cachingStore, "5678")
+}
+
+func TestMemIssueExpectations(t *testing.T) {
+	testutils.SmallTest(t)
+	testIssueExpectations(t, NewMemExpectationsStore(nil), "1234")
+}
+
+func TestExpectationsOverlay(t *testing.T) {
+	testutils.SmallTest(t)
+	master := &Expectations{Tests: map[string]types.TestClassification{
+		"test1": {"d1": types.POSITIVE, "d2": types.NEGATIVE},
+	}}
+	overlay := &Expectations{Tests: map[string]types.TestClassification{
+		"test1": {"d2": types.POSITIVE},
+		"test2": {"d3": types.NEGATIVE},
+	}}
+
+	merged := master.Overlay(overlay)
+	assert.Equal(t, types.POSITIVE, merged.Classification("test1", "d1"))
+	assert.Equal(t, types.POSITIVE, merged.Classification("test1", "d2"))
+	assert.Equal(t, types.NEGATIVE, merged.Classification("test2", "d3"))
+
+	// The master expectations are not modified.
+	assert.Equal(t, types.NEGATIVE, master.Classification("test1", "d2"))
+	assert.Equal(t, types.UNTRIAGED, master.Classification("test2", "d3"))
+	assert.True(t, master == master.Overlay(NewExpectations()))
+}
+
+// testIssueExpectations tests the issue expectations of the given store. The
+// issue must not have any expectations yet.
+func testIssueExpectations(t *testing.T, store ExpectationsStore, issueID string) {
+	TEST_1, TEST_2 := "issue-test1", "issue-test2"
+
+	exp, err := store.GetIssue(issueID)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(exp.Tests))
+
+	assert.NoError(t, store.AddChange(map[string]types.TestClassification{
+		TEST_1: {"d11": types.NEGATIVE, "d12": types.POSITIVE},
+	}, "user-0"))
+
+	// Issue changes don't change the master expectations.
+	assert.NoError(t, store.AddIssueChange(issueID, map[string]types.TestClassification{
+		TEST_1: {"d11": types.POSITIVE},
+		TEST_2: {"d21": types.NEGATIVE},
+	}, "user-1"))
+	assert.NoError(t, store.AddIssueChange(issueID, map[string]types.TestClassification{
+		TEST_2: {"d21": types.POSITIVE},
+	}, "user-2"))
+	assert.NoError(t, store.AddIssueChange(issueID, map[string]types.TestClassification{}, "user-2"))
+
+	master, err := store.Get()
+	assert.NoError(t, err)
+	assert.Equal(t, types.NEGATIVE, master.Classification(TEST_1, "d11"))
+	assert.Equal(t, types.UNTRIAGED, master.Classification(TEST_2, "d21"))
+
+	exp, err = store.GetIssue(issueID)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]types.TestClassification{
+		TEST_1: {"d11": types.POSITIVE},
+		TEST_2: {"d21": types.POSITIVE},
+	}, exp.Tests)
+
+	issueIDs, err := store.IssueIDs()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{issueID}, issueIDs)
+
+	// Merging applies the issue expectations to master and removes them.
+	assert.NoError(t, store.MergeIssue(issueID, "merger"))
+	master, err = store.Get()
+	assert.NoError(t, err)
+	assert.Equal(t, types.POSITIVE, master.Classification(TEST_1, "d11"))
+	assert.Equal(t, types.POSITIVE, master.Classification(TEST_1, "d12"))
+	assert.Equal(t, types.POSITIVE, master.Classification(TEST_2, "d21"))
+
+	exp, err = store.GetIssue(issueID)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(exp.Tests))
+	issueIDs, err = store.IssueIDs()
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(issueIDs))
+
+	// Merging an issue without expectations is a no-op.
+	assert.NoError(t, store.MergeIssue(issueID, "merger"))
 }
 
 // Test against the expectation store interface.
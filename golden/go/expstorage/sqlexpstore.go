@@ -1,6 +1,7 @@
 package expstorage
 
 import (
+	"database/sql"
 	"fmt"
 	"strings"
 
@@ -70,6 +71,20 @@ func (s *SQLExpectationsStore) AddChange(changedTests map[string]types.TestClass
 func (s *SQLExpectationsStore) AddChangeWithTimeStamp(changedTests map[string]types.TestClassification, userId string, undoID int, timeStamp int64) (retErr error) {
 	defer timer.New("adding exp change").Stop()
 
+	// start a transaction
+	tx, err := s.vdb.DB.Begin()
+	if err != nil {
+		return err
+	}
+
+	defer func() { retErr = database.CommitOrRollback(tx, retErr) }()
+
+	return s.addChange(tx, changedTests, userId, undoID, timeStamp)
+}
+
+// addChange adds changed tests to the database as part of the given
+// transaction.
+func (s *SQLExpectationsStore) addChange(tx *sql.Tx, changedTests map[string]types.TestClassification, userId string, undoID int, timeStamp int64) error {
 	// Count the number of values to add.
 	changeCount := 0
 	for _, digests := range changedTests {
@@ -81,14 +96,6 @@ func (s *SQLExpectationsStore) AddChangeWithTimeStamp(changedTests map[string]ty
 		insertDigest = `INSERT INTO exp_test_change (changeid, name, digest, label) VALUES`
 	)
 
-	// start a transaction
-	tx, err := s.vdb.DB.Begin()
-	if err != nil {
-		return err
-	}
-
-	defer func() { retErr = database.CommitOrRollback(tx, retErr) }()
-
 	// create the change record
 	result, err := tx.Exec(insertChange, userId, timeStamp, undoID)
 	if err != nil {
@@ -351,6 +358,113 @@ func (s *SQLExpectationsStore) loadChangeEntry(changeID int) (*TriageLogEntry, e
 	return changeInfo[0], nil
 }
 
+// See ExpectationsStore interface.
+func (s *SQLExpectationsStore) GetIssue(issueID string) (*Expectations, error) {
+	return s.getIssue(s.vdb.DB, issueID)
+}
+
+// queryer is implemented by sql.DB and sql.Tx.
+type queryer interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// getIssue loads the expectations of the given issue via db.
+func (s *SQLExpectationsStore) getIssue(db queryer, issueID string) (*Expectations, error) {
+	const stmt = `SELECT name, digest, label FROM exp_issue_change WHERE issue=?`
+
+	rows, err := db.Query(stmt, issueID)
+	if err != nil {
+		return nil, err
+	}
+	defer util.Close(rows)
+
+	ret := NewExpectations()
+	for rows.Next() {
+		var testName, digest, label string
+		if err = rows.Scan(&testName, &digest, &label); err != nil {
+			return nil, err
+		}
+		if _, ok := ret.Tests[testName]; !ok {
+			ret.Tests[testName] = types.TestClassification{}
+		}
+		ret.Tests[testName][digest] = types.LabelFromString(label)
+	}
+	return ret, nil
+}
+
+// See ExpectationsStore interface.
+func (s *SQLExpectationsStore) AddIssueChange(issueID string, changedTests map[string]types.TestClassification, userId string) error {
+	defer timer.New("adding issue exp change").Stop()
+
+	const stmtTmpl = `INSERT INTO exp_issue_change (issue, name, digest, label, userid, ts) VALUES %s
+	                  ON DUPLICATE KEY UPDATE label=VALUES(label), userid=VALUES(userid), ts=VALUES(ts)`
+
+	now := util.TimeStampMs()
+	placeHolders := []string{}
+	vals := []interface{}{}
+	for testName, digests := range changedTests {
+		for d, label := range digests {
+			placeHolders = append(placeHolders, "(?, ?, ?, ?, ?, ?)")
+			vals = append(vals, issueID, testName, d, label.String(), userId, now)
+		}
+	}
+	if len(vals) == 0 {
+		return nil
+	}
+
+	_, err := s.vdb.DB.Exec(fmt.Sprintf(stmtTmpl, strings.Join(placeHolders, ",")), vals...)
+	return err
+}
+
+// See ExpectationsStore interface.
+func (s *SQLExpectationsStore) IssueIDs() ([]string, error) {
+	const stmt = `SELECT DISTINCT issue FROM exp_issue_change`
+
+	rows, err := s.vdb.DB.Query(stmt)
+	if err != nil {
+		return nil, err
+	}
+	defer util.Close(rows)
+
+	ret := []string{}
+	for rows.Next() {
+		var issueID string
+		if err = rows.Scan(&issueID); err != nil {
+			return nil, err
+		}
+		ret = append(ret, issueID)
+	}
+	return ret, nil
+}
+
+// See ExpectationsStore interface.
+func (s *SQLExpectationsStore) MergeIssue(issueID string, userId string) (retErr error) {
+	defer timer.New("merging issue exp change").Stop()
+
+	const deleteStmt = `DELETE FROM exp_issue_change WHERE issue=?`
+
+	// start a transaction
+	tx, err := s.vdb.DB.Begin()
+	if err != nil {
+		return err
+	}
+
+	defer func() { retErr = database.CommitOrRollback(tx, retErr) }()
+
+	exp, err := s.getIssue(tx, issueID)
+	if err != nil {
+		return err
+	}
+	if len(exp.Tests) == 0 {
+		return nil
+	}
+	if err := s.addChange(tx, exp.Tests, userId, 0, util.TimeStampMs()); err != nil {
+		return err
+	}
+	_, err = tx.Exec(deleteStmt, issueID)
+	return err
+}
+
 // See ExpectationsStore interface.
 func (s *SQLExpectationsStore) CanonicalTraceIDs(testNames []string) (map[string]string, error) {
 	return nil, nil
@@ -446,6 +560,36 @@ func (c *CachingExpectationStore) UndoChange(changeID int, userID string) (map[s
 	return changedTests, c.addChangeToCache(changedTests, userID)
 }
 
+// See ExpectationsStore interface.
+func (c *CachingExpectationStore) GetIssue(issueID string) (*Expectations, error) {
+	return c.store.GetIssue(issueID)
+}
+
+// See ExpectationsStore interface.
+func (c *CachingExpectationStore) AddIssueChange(issueID string, changedTests map[string]types.TestClassification, userId string) error {
+	return c.store.AddIssueChange(issueID, changedTests, userId)
+}
+
+// See ExpectationsStore interface.
+func (c *CachingExpectationStore) IssueIDs() ([]string, error) {
+	return c.store.IssueIDs()
+}
+
+// See ExpectationsStore interface.
+func (c *CachingExpectationStore) MergeIssue(issueID string, userId string) error {
+	exp, err := c.store.GetIssue(issueID)
+	if err != nil {
+		return err
+	}
+	if err := c.store.MergeIssue(issueID, userId); err != nil {
+		return err
+	}
+	if len(exp.Tests) == 0 {
+		return nil
+	}
+	return c.addChangeToCache(exp.Tests, userId)
+}
+
 // See ExpectationsStore interface.
 // TODO(stephana): Implement once API is defined.
 func (c *CachingExpectationStore) CanonicalTraceIDs(testNames []string) (map[string]string, error) {
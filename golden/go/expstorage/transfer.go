@@ -0,0 +1,82 @@
+package expstorage
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+
+	"go.skia.org/infra/go/tiling"
+	"go.skia.org/infra/golden/go/types"
+)
+
+// WriteExpectations writes the given test→digest→label map as JSON to w.
+// Labels are written as strings, e.g. "positive", so the output can be
+// edited by hand and read back with ReadExpectations.
+func WriteExpectations(w io.Writer, tests map[string]types.TestClassification) error {
+	out := make(map[string]map[string]string, len(tests))
+	for testName, digests := range tests {
+		labels := make(map[string]string, len(digests))
+		for digest, label := range digests {
+			labels[digest] = label.String()
+		}
+		out[testName] = labels
+	}
+	b, err := json.MarshalIndent(out, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+// ReadExpectations reads a test→digest→label map in the format written by
+// WriteExpectations. It returns an error if any of the labels is invalid.
+func ReadExpectations(r io.Reader) (map[string]types.TestClassification, error) {
+	in := map[string]map[string]string{}
+	if err := json.NewDecoder(r).Decode(&in); err != nil {
+		return nil, fmt.Errorf("Unable to decode expectations: %s", err)
+	}
+
+	ret := make(map[string]types.TestClassification, len(in))
+	for testName, digests := range in {
+		tc := make(types.TestClassification, len(digests))
+		for digest, label := range digests {
+			if !types.ValidLabel(label) {
+				return nil, fmt.Errorf("Invalid label %q for digest %s of test %s.", label, digest, testName)
+			}
+			tc[digest] = types.LabelFromString(label)
+		}
+		ret[testName] = tc
+	}
+	return ret, nil
+}
+
+// Filter returns the expectations of the digests that appear in traces of the
+// tile that match the query. If the query is empty, e is returned.
+func (e *Expectations) Filter(tile *tiling.Tile, query url.Values) *Expectations {
+	if len(query) == 0 {
+		return e
+	}
+
+	ret := NewExpectations()
+	for _, trace := range tile.Traces {
+		if !tiling.Matches(trace, query) {
+			continue
+		}
+		testName := trace.Params()[types.PRIMARY_KEY_FIELD]
+		labels, ok := e.Tests[testName]
+		if !ok {
+			continue
+		}
+		for _, digest := range trace.(*types.GoldenTrace).Values {
+			if label, ok := labels[digest]; ok {
+				if _, ok := ret.Tests[testName]; !ok {
+					ret.Tests[testName] = types.TestClassification{}
+				}
+				ret.Tests[testName][digest] = label
+			}
+		}
+	}
+	return ret
+}
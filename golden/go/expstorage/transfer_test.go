@@ -0,0 +1,67 @@
+package expstorage
+
+import (
+	"bytes"
+	"net/url"
+	"strings"
+	"testing"
+
+	assert "github.com/stretchr/testify/require"
+	"go.skia.org/infra/go/testutils"
+	"go.skia.org/infra/go/tiling"
+	"go.skia.org/infra/golden/go/types"
+)
+
+func TestWriteReadExpectations(t *testing.T) {
+	testutils.SmallTest(t)
+	tests := map[string]types.TestClassification{
+		"test1": {"d1": types.POSITIVE, "d2": types.NEGATIVE},
+		"test2": {"d3": types.UNTRIAGED},
+	}
+	var buf bytes.Buffer
+	assert.NoError(t, WriteExpectations(&buf, tests))
+	assert.Contains(t, buf.String(), `"d1": "positive"`)
+
+	found, err := ReadExpectations(&buf)
+	assert.NoError(t, err)
+	assert.Equal(t, tests, found)
+
+	_, err = ReadExpectations(strings.NewReader(`{"test1": {"d1": "maybe"}}`))
+	assert.EqualError(t, err, "Invalid label \"maybe\" for digest d1 of test test1.")
+	_, err = ReadExpectations(strings.NewReader(`{"test1": ["d1"]}`))
+	assert.Error(t, err)
+}
+
+func TestExpectationsFilter(t *testing.T) {
+	testutils.SmallTest(t)
+	exp := &Expectations{Tests: map[string]types.TestClassification{
+		"test1": {"d1": types.POSITIVE, "d2": types.NEGATIVE, "d3": types.POSITIVE},
+		"test2": {"d4": types.POSITIVE},
+	}}
+	tile := &tiling.Tile{
+		Traces: map[string]tiling.Trace{
+			"gpu:test1": &types.GoldenTrace{
+				Params_: map[string]string{"config": "gpu", types.PRIMARY_KEY_FIELD: "test1"},
+				Values:  []string{"d1", types.MISSING_DIGEST, "d5"},
+			},
+			"8888:test1": &types.GoldenTrace{
+				Params_: map[string]string{"config": "8888", types.PRIMARY_KEY_FIELD: "test1"},
+				Values:  []string{"d2", "d3", "d3"},
+			},
+			"gpu:test2": &types.GoldenTrace{
+				Params_: map[string]string{"config": "gpu", types.PRIMARY_KEY_FIELD: "test2"},
+				Values:  []string{"d4", "d4", "d4"},
+			},
+		},
+	}
+
+	assert.True(t, exp == exp.Filter(tile, url.Values{}))
+	assert.Equal(t, map[string]types.TestClassification{
+		"test1": {"d1": types.POSITIVE},
+		"test2": {"d4": types.POSITIVE},
+	}, exp.Filter(tile, url.Values{"config": {"gpu"}}).Tests)
+	assert.Equal(t, map[string]types.TestClassification{
+		"test1": {"d2": types.NEGATIVE, "d3": types.POSITIVE},
+	}, exp.Filter(tile, url.Values{"config": {"8888"}}).Tests)
+	assert.Equal(t, 0, len(exp.Filter(tile, url.Values{"config": {"565"}}).Tests))
+}
@@ -0,0 +1,179 @@
+package main
+
+// exptool exports and imports Gold expectations directly from and to the
+// database. Expectations are stored as JSON files that map test names to
+// digests to labels, e.g. {"blur": {"d41d8cd9...": "positive"}}.
+//
+// Commands:
+//
+//   export      Writes the current expectations to --file. If --query is set
+//               only digests in matching traces of the current tile are
+//               exported.
+//
+//   import      Adds the expectations in --file as one change by --user. The
+//               change shows up in the triage log and can be undone there.
+//
+//   rebaseline  Writes the digests at head of all traces matching --query
+//               with the label --label to --file. Review the file and then
+//               import it to rebaseline after an intentional change.
+//
+// A running skiacorrectness instance caches the expectations. Use the
+// /json/expectations/import endpoint to import into a running instance or
+// restart it after the import.
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+
+	"github.com/skia-dev/glog"
+	"go.skia.org/infra/go/common"
+	"go.skia.org/infra/go/database"
+	"go.skia.org/infra/go/eventbus"
+	"go.skia.org/infra/go/git/gitinfo"
+	"go.skia.org/infra/go/tiling"
+	tracedb "go.skia.org/infra/go/trace/db"
+	"go.skia.org/infra/go/util"
+	"go.skia.org/infra/golden/go/db"
+	"go.skia.org/infra/golden/go/expstorage"
+	"go.skia.org/infra/golden/go/types"
+)
+
+var (
+	file         = flag.String("file", "", "Path of the expectations file. Defaults to stdout for export and rebaseline and to stdin for import.")
+	gitRepoDir   = flag.String("git_repo_dir", "../../../skia", "Directory location for the Skia repo.")
+	gitRepoURL   = flag.String("git_repo_url", "https://skia.googlesource.com/skia", "The URL to pass to git clone for the source repository.")
+	label        = flag.String("label", types.POSITIVE.String(), "Label assigned by rebaseline.")
+	nCommits     = flag.Int("n_commits", 50, "Number of recent commits to include in the tile.")
+	query        = flag.String("query", "", "Paramset query, e.g. 'config=gpu&source_type=gm', which selects the traces for export and rebaseline.")
+	traceservice = flag.String("trace_service", "localhost:9001", "The address of the traceservice endpoint.")
+	user         = flag.String("user", "", "The user that is recorded in the triage log for import.")
+)
+
+func main() {
+	defer common.LogPanic()
+	dbConf := database.ConfigFromFlags(db.PROD_DB_HOST, db.PROD_DB_PORT, database.USER_RW, db.PROD_DB_NAME, db.MigrationSteps())
+	common.Init()
+
+	if flag.NArg() != 1 {
+		glog.Fatalf("Usage: exptool [flags] export|import|rebaseline")
+	}
+	parsedQuery, err := url.ParseQuery(*query)
+	if err != nil {
+		glog.Fatalf("Unable to parse query %q: %s", *query, err)
+	}
+
+	vdb, err := dbConf.NewVersionedDB()
+	if err != nil {
+		glog.Fatal(err)
+	}
+	if !vdb.IsLatestVersion() {
+		glog.Fatal("Wrong DB version. Please updated to latest version.")
+	}
+	expStore := expstorage.NewSQLExpectationStore(vdb)
+
+	switch cmd := flag.Arg(0); cmd {
+	case "export":
+		exp, err := expStore.Get()
+		if err != nil {
+			glog.Fatalf("Unable to get expectations: %s", err)
+		}
+		if len(parsedQuery) > 0 {
+			exp = exp.Filter(loadTile(), parsedQuery)
+		}
+		write(exp.Tests)
+	case "import":
+		if *user == "" {
+			glog.Fatal("--user is required for import.")
+		}
+		changes := read()
+		if err := expStore.AddChange(changes, *user); err != nil {
+			glog.Fatalf("Unable to import expectations: %s", err)
+		}
+		glog.Infof("Imported expectations for %d tests.", len(changes))
+	case "rebaseline":
+		if !types.ValidLabel(*label) {
+			glog.Fatalf("Invalid label %q.", *label)
+		}
+		write(headDigests(loadTile(), parsedQuery, types.LabelFromString(*label)))
+	default:
+		glog.Fatalf("Unknown command %q.", cmd)
+	}
+}
+
+// headDigests returns the most recent digest of each trace in the tile that
+// matches the query, labeled with the given label.
+func headDigests(tile *tiling.Tile, query url.Values, label types.Label) map[string]types.TestClassification {
+	ret := map[string]types.TestClassification{}
+	for _, trace := range tile.Traces {
+		if !tiling.Matches(trace, query) {
+			continue
+		}
+		gTrace := trace.(*types.GoldenTrace)
+		for i := len(gTrace.Values) - 1; i >= 0; i-- {
+			if digest := gTrace.Values[i]; digest != types.MISSING_DIGEST {
+				testName := gTrace.Params_[types.PRIMARY_KEY_FIELD]
+				if _, ok := ret[testName]; !ok {
+					ret[testName] = types.TestClassification{}
+				}
+				ret[testName][digest] = label
+				break
+			}
+		}
+	}
+	return ret
+}
+
+// loadTile returns the current master tile.
+func loadTile() *tiling.Tile {
+	git, err := gitinfo.CloneOrUpdate(*gitRepoURL, *gitRepoDir, false)
+	if err != nil {
+		glog.Fatal(err)
+	}
+	tdb, err := tracedb.NewTraceServiceDBFromAddress(*traceservice, types.GoldenTraceBuilder)
+	if err != nil {
+		glog.Fatalf("Failed to connect to tracedb: %s", err)
+	}
+	masterTileBuilder, err := tracedb.NewMasterTileBuilder(tdb, git, *nCommits, eventbus.New(nil))
+	if err != nil {
+		glog.Fatalf("Failed to build trace/db.DB: %s", err)
+	}
+	return masterTileBuilder.GetTile()
+}
+
+// write writes the given expectations to --file or stdout.
+func write(tests map[string]types.TestClassification) {
+	var w io.Writer = os.Stdout
+	if *file != "" {
+		f, err := os.Create(*file)
+		if err != nil {
+			glog.Fatalf("Unable to create %s: %s", *file, err)
+		}
+		defer util.Close(f)
+		w = f
+	}
+	if err := expstorage.WriteExpectations(w, tests); err != nil {
+		glog.Fatalf("Unable to write expectations: %s", err)
+	}
+	fmt.Fprintln(w)
+}
+
+// read reads the expectations from --file or stdin.
+func read() map[string]types.TestClassification {
+	var r io.Reader = os.Stdin
+	if *file != "" {
+		f, err := os.Open(*file)
+		if err != nil {
+			glog.Fatalf("Unable to open %s: %s", *file, err)
+		}
+		defer util.Close(f)
+		r = f
+	}
+	changes, err := expstorage.ReadExpectations(r)
+	if err != nil {
+		glog.Fatal(err)
+	}
+	return changes
+}
@@ -0,0 +1,243 @@
+// flaky detects traces that keep flipping between digests and suggests
+// ignore rules for them.
+package flaky
+
+import (
+	"net/url"
+	"sort"
+
+	"go.skia.org/infra/go/tiling"
+	"go.skia.org/infra/go/timer"
+	"go.skia.org/infra/go/util"
+	"go.skia.org/infra/golden/go/tally"
+	"go.skia.org/infra/golden/go/types"
+)
+
+const (
+	// N_COMMITS is the number of most recent commits of a trace that are
+	// considered when calculating its flakiness.
+	N_COMMITS = 50
+
+	// MIN_DIGESTS is the minimum number of distinct digests a trace must have
+	// within the last N_COMMITS commits to be considered flaky.
+	MIN_DIGESTS = 3
+)
+
+// TraceFlakiness captures how flaky a single trace is.
+type TraceFlakiness struct {
+	TraceID string            `json:"traceID"`
+	Test    string            `json:"test"`
+	Params  map[string]string `json:"params"`
+
+	// Digests is the number of distinct digests in the considered commits.
+	Digests int `json:"digests"`
+
+	// Transitions is the number of times the digest changes between two
+	// consecutive commits with data.
+	Transitions int `json:"transitions"`
+
+	// Score is the fraction of consecutive commits with data where the digest
+	// changes. It is in the range [0, 1], 1 meaning the digest changes on
+	// every commit.
+	Score float64 `json:"score"`
+}
+
+// IgnoreSuggestion is a suggested ignore query that covers the flaky traces
+// of one test.
+type IgnoreSuggestion struct {
+	Test     string   `json:"test"`
+	Query    string   `json:"query"`
+	TraceIDs []string `json:"traceIDs"`
+}
+
+// Flakiness keeps the flakiness of all traces in a tile that had at least
+// MIN_DIGESTS distinct digests in the last N_COMMITS commits.
+// It is not thread safe. The client of this package needs to make sure there
+// are no conflicts.
+type Flakiness struct {
+	// flaky is sorted by descending score.
+	flaky []*TraceFlakiness
+
+	// suggestions contains one ignore suggestion per test in flaky, sorted
+	// by test name.
+	suggestions []*IgnoreSuggestion
+}
+
+// New creates a new Flakiness object.
+func New() *Flakiness {
+	return &Flakiness{}
+}
+
+// Calculate sets the flakiness and the ignore suggestions for the given tile.
+// The trace tallies are used to skip traces that can not be flaky without
+// looking at their values.
+func (f *Flakiness) Calculate(tile *tiling.Tile, traceTally map[string]tally.Tally) {
+	defer timer.New("flaky").Stop()
+	ret := []*TraceFlakiness{}
+	for id, trace := range tile.Traces {
+		if t, ok := traceTally[id]; ok && len(t) < MIN_DIGESTS {
+			continue
+		}
+		gTrace := trace.(*types.GoldenTrace)
+		if tf := traceFlakiness(id, gTrace, N_COMMITS); tf.Digests >= MIN_DIGESTS {
+			ret = append(ret, tf)
+		}
+	}
+	sort.Sort(flakySlice(ret))
+	f.flaky = ret
+	f.suggestions = suggestIgnores(tile, ret)
+}
+
+// Get returns the n flakiest traces with a score of at least minScore, in
+// order of descending score. If n <= 0 all traces are returned.
+func (f *Flakiness) Get(n int, minScore float64) []*TraceFlakiness {
+	ret := make([]*TraceFlakiness, 0, len(f.flaky))
+	for _, tf := range f.flaky {
+		if (n > 0) && (len(ret) >= n) {
+			break
+		}
+		if tf.Score >= minScore {
+			ret = append(ret, tf)
+		}
+	}
+	return ret
+}
+
+// GetSuggestions returns the ignore suggestions for the tests of the given
+// flaky traces, sorted by test name. Each suggestion covers all flaky traces
+// of its test, not only the given ones.
+func (f *Flakiness) GetSuggestions(flaky []*TraceFlakiness) []*IgnoreSuggestion {
+	tests := util.StringSet{}
+	for _, tf := range flaky {
+		tests[tf.Test] = true
+	}
+	ret := make([]*IgnoreSuggestion, 0, len(tests))
+	for _, s := range f.suggestions {
+		if tests[s.Test] {
+			ret = append(ret, s)
+		}
+	}
+	return ret
+}
+
+// suggestIgnores returns one suggested ignore query per test for the given
+// flaky traces. Each query matches all flaky traces of the test in the tile
+// and as few other traces as possible.
+func suggestIgnores(tile *tiling.Tile, flaky []*TraceFlakiness) []*IgnoreSuggestion {
+	byTest := map[string][]*TraceFlakiness{}
+	for _, tf := range flaky {
+		byTest[tf.Test] = append(byTest[tf.Test], tf)
+	}
+
+	ret := make([]*IgnoreSuggestion, 0, len(byTest))
+	for test, traces := range byTest {
+		traceIDs := make([]string, 0, len(traces))
+		for _, tf := range traces {
+			traceIDs = append(traceIDs, tf.TraceID)
+		}
+		sort.Strings(traceIDs)
+		ret = append(ret, &IgnoreSuggestion{
+			Test:     test,
+			Query:    suggestQuery(tile, traces).Encode(),
+			TraceIDs: traceIDs,
+		})
+	}
+	sort.Sort(suggestionSlice(ret))
+	return ret
+}
+
+// suggestQuery starts with the paramset of the given traces, which matches
+// all of them, and then drops every parameter that is not needed to exclude
+// other traces in the tile.
+func suggestQuery(tile *tiling.Tile, flaky []*TraceFlakiness) url.Values {
+	query := url.Values{}
+	flakyIDs := util.StringSet{}
+	for _, tf := range flaky {
+		util.AddParamsToParamSet(query, tf.Params)
+		flakyIDs[tf.TraceID] = true
+	}
+
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		if key != types.PRIMARY_KEY_FIELD {
+			sort.Strings(query[key])
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	nOthers := countOthers(tile, query, flakyIDs)
+	for _, key := range keys {
+		values := query[key]
+		delete(query, key)
+		if countOthers(tile, query, flakyIDs) > nOthers {
+			query[key] = values
+		}
+	}
+	return query
+}
+
+// countOthers returns the number of traces in the tile that match the query
+// but are not in the given set of trace ids.
+func countOthers(tile *tiling.Tile, query url.Values, traceIDs util.StringSet) int {
+	ret := 0
+	for id, trace := range tile.Traces {
+		if !traceIDs[id] && tiling.Matches(trace, query) {
+			ret++
+		}
+	}
+	return ret
+}
+
+// traceFlakiness calculates the flakiness of the last nCommits values of the
+// given trace.
+func traceFlakiness(id string, trace *types.GoldenTrace, nCommits int) *TraceFlakiness {
+	start := util.MaxInt(0, len(trace.Values)-nCommits)
+	digests := util.StringSet{}
+	transitions := 0
+	nValues := 0
+	prev := ""
+	for _, digest := range trace.Values[start:] {
+		if digest == types.MISSING_DIGEST {
+			continue
+		}
+		if (prev != "") && (digest != prev) {
+			transitions++
+		}
+		digests[digest] = true
+		prev = digest
+		nValues++
+	}
+
+	score := 0.0
+	if nValues > 1 {
+		score = float64(transitions) / float64(nValues-1)
+	}
+	return &TraceFlakiness{
+		TraceID:     id,
+		Test:        trace.Params_[types.PRIMARY_KEY_FIELD],
+		Params:      trace.Params_,
+		Digests:     len(digests),
+		Transitions: transitions,
+		Score:       score,
+	}
+}
+
+// flakySlice sorts by descending score and then by trace id.
+type flakySlice []*TraceFlakiness
+
+func (f flakySlice) Len() int { return len(f) }
+func (f flakySlice) Less(i, j int) bool {
+	if f[i].Score == f[j].Score {
+		return f[i].TraceID < f[j].TraceID
+	}
+	return f[i].Score > f[j].Score
+}
+func (f flakySlice) Swap(i, j int) { f[i], f[j] = f[j], f[i] }
+
+// suggestionSlice sorts by test name.
+type suggestionSlice []*IgnoreSuggestion
+
+func (s suggestionSlice) Len() int           { return len(s) }
+func (s suggestionSlice) Less(i, j int) bool { return s[i].Test < s[j].Test }
+func (s suggestionSlice) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
@@ -0,0 +1,95 @@
+package flaky
+
+import (
+	"net/url"
+	"testing"
+
+	assert "github.com/stretchr/testify/require"
+
+	"go.skia.org/infra/go/testutils"
+	"go.skia.org/infra/go/tiling"
+	"go.skia.org/infra/golden/go/tally"
+	"go.skia.org/infra/golden/go/types"
+)
+
+func TestFlakiness(t *testing.T) {
+	testutils.SmallTest(t)
+
+	tile := tiling.NewTile()
+	addTrace(tile, "foo:8888:linux", "foo", "8888", "linux", []string{"a", "b", "c", "a", "b", "c"})
+	addTrace(tile, "foo:8888:mac", "foo", "8888", "mac", []string{"a", "a", "b", "b", "c", "c"})
+	addTrace(tile, "foo:gpu:linux", "foo", "gpu", "linux", []string{"a", "a", "a", "a", "a", "a"})
+	addTrace(tile, "foo:gpu:mac", "foo", "gpu", "mac", []string{"a", "b", "a", "b", "a", "b"})
+	addTrace(tile, "bar:8888:linux", "bar", "8888", "linux", []string{"x", types.MISSING_DIGEST, "y", "z", types.MISSING_DIGEST, "x"})
+
+	tallies := tally.New()
+	tallies.Calculate(tile)
+	f := New()
+	f.Calculate(tile, tallies.ByTrace())
+
+	// Traces with fewer than MIN_DIGESTS digests are not flaky.
+	found := f.Get(0, 0)
+	assert.Equal(t, 3, len(found))
+	assert.Equal(t, "bar:8888:linux", found[0].TraceID)
+	assert.Equal(t, "foo:8888:linux", found[1].TraceID)
+	assert.Equal(t, "foo:8888:mac", found[2].TraceID)
+
+	assert.Equal(t, "bar", found[0].Test)
+	assert.Equal(t, 3, found[0].Digests)
+	assert.Equal(t, 3, found[0].Transitions)
+	assert.Equal(t, 1.0, found[0].Score)
+	assert.Equal(t, 5, found[1].Transitions)
+	assert.Equal(t, 2, found[2].Transitions)
+	assert.Equal(t, 0.4, found[2].Score)
+
+	assert.Equal(t, 2, len(f.Get(2, 0)))
+	assert.Equal(t, 2, len(f.Get(0, 0.5)))
+	assert.Equal(t, 0, len(New().Get(10, 0)))
+
+	suggestions := f.GetSuggestions(found)
+	assert.Equal(t, 2, len(suggestions))
+	assert.Equal(t, "bar", suggestions[0].Test)
+	assert.Equal(t, []string{"bar:8888:linux"}, suggestions[0].TraceIDs)
+	assert.Equal(t, url.Values{types.PRIMARY_KEY_FIELD: []string{"bar"}}.Encode(), suggestions[0].Query)
+
+	// The flaky traces of foo only differ from the others in the config.
+	assert.Equal(t, "foo", suggestions[1].Test)
+	assert.Equal(t, []string{"foo:8888:linux", "foo:8888:mac"}, suggestions[1].TraceIDs)
+	expQuery := url.Values{
+		types.PRIMARY_KEY_FIELD: []string{"foo"},
+		"config":                []string{"8888"},
+	}
+	assert.Equal(t, expQuery.Encode(), suggestions[1].Query)
+
+	// Only the suggestions for the tests of the given traces are returned.
+	suggestions = f.GetSuggestions(f.Get(1, 0))
+	assert.Equal(t, 1, len(suggestions))
+	assert.Equal(t, "bar", suggestions[0].Test)
+	assert.Equal(t, 0, len(New().GetSuggestions(found)))
+}
+
+func TestTraceFlakinessWindow(t *testing.T) {
+	testutils.SmallTest(t)
+
+	tile := tiling.NewTile()
+	trace := addTrace(tile, "foo:8888:linux", "foo", "8888", "linux", []string{"a", "b", "c", "c", "c", "c"})
+
+	tf := traceFlakiness("foo:8888:linux", trace, 3)
+	assert.Equal(t, 1, tf.Digests)
+	assert.Equal(t, 0, tf.Transitions)
+	assert.Equal(t, 0.0, tf.Score)
+
+	tf = traceFlakiness("foo:8888:linux", trace, 5)
+	assert.Equal(t, 2, tf.Digests)
+	assert.Equal(t, 1, tf.Transitions)
+}
+
+func addTrace(tile *tiling.Tile, id, name, config, os string, values []string) *types.GoldenTrace {
+	trace := types.NewGoldenTraceN(len(values))
+	copy(trace.Values, values)
+	trace.Params_[types.PRIMARY_KEY_FIELD] = name
+	trace.Params_["config"] = config
+	trace.Params_["os"] = os
+	tile.Traces[id] = trace
+	return trace
+}
@@ -0,0 +1,214 @@
+package ignore
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"net/url"
+	"time"
+
+	"github.com/skia-dev/glog"
+
+	"go.skia.org/infra/go/email"
+	"go.skia.org/infra/go/metrics2"
+	"go.skia.org/infra/golden/go/expstorage"
+	"go.skia.org/infra/golden/go/types"
+)
+
+const (
+	// EXPIRY_USER is recorded as the user for all changes made by the expiry
+	// pass.
+	EXPIRY_USER = "ignore-expiry@skia.org"
+
+	// EXPIRY_WARNING is how long before a rule expires its owner is notified.
+	EXPIRY_WARNING = 7 * 24 * time.Hour
+
+	// EXPIRY_EXTENSION is how long a rule with the EXPIRY_EXTEND action is
+	// extended when it expires.
+	EXPIRY_EXTENSION = 14 * 24 * time.Hour
+)
+
+var emailTemplate = template.Must(template.New("ignoreExpiry").Parse(`
+The ignore rule <b>{{.Rule.Query}}</b> that you own {{.Message}}
+<br><br>
+Note: {{.Rule.Note}}<br>
+Bug: {{.Rule.Bug}}<br>
+Expires: {{.Rule.Expires}}<br>
+On expiry: {{.Rule.ExpiryAction}}<br>
+<br>
+<a href="{{.URL}}">Manage the ignore rules</a>
+`))
+
+// TilePairFn returns the current tile.
+type TilePairFn func() (*types.TilePair, error)
+
+// Expirer applies the expiry actions of expired ignore rules and notifies
+// the owners of rules that are about to expire.
+type Expirer struct {
+	store     IgnoreStore
+	expStore  expstorage.ExpectationsStore
+	getTile   TilePairFn
+	emailer   email.Emailer
+	ignoreURL string
+}
+
+// NewExpirer creates a new Expirer. If emailer is nil no notifications are
+// sent. ignoreURL is the URL of the page that lists the ignore rules and is
+// included in notifications.
+func NewExpirer(store IgnoreStore, expStore expstorage.ExpectationsStore, getTile TilePairFn, emailer email.Emailer, ignoreURL string) *Expirer {
+	return &Expirer{
+		store:     store,
+		expStore:  expStore,
+		getTile:   getTile,
+		emailer:   emailer,
+		ignoreURL: ignoreURL,
+	}
+}
+
+// Start runs the expiry pass in the background with the given interval.
+func (e *Expirer) Start(interval time.Duration) {
+	liveness := metrics2.NewLiveness("gold.ignore-rule-expiry")
+	go func() {
+		for _ = range time.Tick(interval) {
+			if err := e.oneStep(time.Now()); err != nil {
+				glog.Errorf("Failed one step of expiring ignore rules: %s", err)
+				continue
+			}
+			liveness.Reset()
+		}
+	}()
+}
+
+// oneStep applies the expiry actions to all rules that have expired at the
+// given time and notifies owners of rules that expire within EXPIRY_WARNING.
+func (e *Expirer) oneStep(now time.Time) error {
+	rules, err := e.store.List(false)
+	if err != nil {
+		return err
+	}
+
+	for _, rule := range rules {
+		if err := e.processRule(rule, now); err != nil {
+			glog.Errorf("Unable to process expiry of ignore rule %d: %s", rule.ID, err)
+		}
+	}
+	return nil
+}
+
+// processRule handles the expiry of a single rule.
+func (e *Expirer) processRule(rule *IgnoreRule, now time.Time) error {
+	if rule.Expires.After(now) {
+		if rule.Notified || rule.Expires.Sub(now) > EXPIRY_WARNING {
+			return nil
+		}
+		updated := *rule
+		updated.Notified = true
+		if err := e.store.Update(rule.ID, &updated); err != nil {
+			return err
+		}
+		return e.notify(&updated, "Ignore rule expires soon", fmt.Sprintf("expires on %s.", rule.Expires.Format(time.RFC1123)))
+	}
+
+	switch rule.ExpiryAction {
+	case EXPIRY_EXTEND:
+		updated := *rule
+		updated.Expires = now.Add(EXPIRY_EXTENSION)
+		updated.UpdatedBy = EXPIRY_USER
+		updated.Notified = false
+		if err := e.store.Update(rule.ID, &updated); err != nil {
+			return err
+		}
+		glog.Infof("Extended ignore rule %d until %s", rule.ID, updated.Expires)
+		return e.notify(&updated, "Ignore rule extended", fmt.Sprintf("has expired and was extended until %s.", updated.Expires.Format(time.RFC1123)))
+	case EXPIRY_NEGATIVE:
+		n, err := e.markNegative(rule)
+		if err != nil {
+			return err
+		}
+		if _, err := e.store.Delete(rule.ID, EXPIRY_USER); err != nil {
+			return err
+		}
+		glog.Infof("Deleted ignore rule %d and marked %d digests as negative.", rule.ID, n)
+		return e.notify(rule, "Ignore rule expired", fmt.Sprintf("has expired and was deleted. %d untriaged digests were marked as negative.", n))
+	default:
+		if _, err := e.store.Delete(rule.ID, EXPIRY_USER); err != nil {
+			return err
+		}
+		glog.Infof("Deleted ignore rule %d", rule.ID)
+		return e.notify(rule, "Ignore rule expired", "has expired and was deleted.")
+	}
+}
+
+// markNegative labels all untriaged digests in the traces that match the
+// given rule as negative. It returns the number of changed digests.
+func (e *Expirer) markNegative(rule *IgnoreRule) (int, error) {
+	query, err := url.ParseQuery(rule.Query)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid query %q: %s", rule.Query, err)
+	}
+
+	tilePair, err := e.getTile()
+	if err != nil {
+		return 0, err
+	}
+
+	exp, err := e.expStore.Get()
+	if err != nil {
+		return 0, err
+	}
+
+	changes := map[string]types.TestClassification{}
+	n := 0
+	rq := NewQueryRule(query)
+	for _, trace := range tilePair.TileWithIgnores.Traces {
+		gTrace := trace.(*types.GoldenTrace)
+		if !rq.IsMatch(gTrace.Params_) {
+			continue
+		}
+		testName := gTrace.Params_[types.PRIMARY_KEY_FIELD]
+		for _, digest := range gTrace.Values {
+			if (digest == types.MISSING_DIGEST) || (exp.Classification(testName, digest) != types.UNTRIAGED) {
+				continue
+			}
+			if _, ok := changes[testName]; !ok {
+				changes[testName] = types.TestClassification{}
+			}
+			if _, ok := changes[testName][digest]; !ok {
+				changes[testName][digest] = types.NEGATIVE
+				n++
+			}
+		}
+	}
+
+	if n == 0 {
+		return 0, nil
+	}
+	return n, e.expStore.AddChange(changes, EXPIRY_USER)
+}
+
+// notify sends an email about the given rule to its owner.
+func (e *Expirer) notify(rule *IgnoreRule, subject, message string) error {
+	owner := rule.Owner
+	if owner == "" {
+		owner = rule.Name
+	}
+	if (e.emailer == nil) || (owner == "") {
+		glog.Infof("Not notifying owner of ignore rule %d: %s", rule.ID, subject)
+		return nil
+	}
+
+	var body bytes.Buffer
+	context := struct {
+		Rule    *IgnoreRule
+		Message string
+		URL     string
+	}{
+		Rule:    rule,
+		Message: message,
+		URL:     e.ignoreURL,
+	}
+	if err := emailTemplate.Execute(&body, context); err != nil {
+		return fmt.Errorf("Unable to render email: %s", err)
+	}
+	return e.emailer.Send(types.EMAIL_SENDER_DISPLAY_NAME, []string{owner}, subject, body.String())
+}
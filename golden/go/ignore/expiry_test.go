@@ -0,0 +1,97 @@
+package ignore
+
+import (
+	"testing"
+	"time"
+
+	assert "github.com/stretchr/testify/require"
+
+	"go.skia.org/infra/go/testutils"
+	"go.skia.org/infra/go/tiling"
+	"go.skia.org/infra/golden/go/expstorage"
+	"go.skia.org/infra/golden/go/types"
+)
+
+type sentEmail struct {
+	to      []string
+	subject string
+}
+
+type mockEmailer struct {
+	sent []sentEmail
+}
+
+func (m *mockEmailer) Send(senderDisplayName string, to []string, subject string, body string) error {
+	m.sent = append(m.sent, sentEmail{to: to, subject: subject})
+	return nil
+}
+
+func TestExpirer(t *testing.T) {
+	testutils.SmallTest(t)
+
+	now := time.Now()
+	store := NewMemIgnoreStore()
+	expStore := expstorage.NewMemExpectationsStore(nil)
+	assert.NoError(t, expStore.AddChange(map[string]types.TestClassification{
+		"foo": {"aaa": types.POSITIVE},
+	}, "jon@example.com"))
+
+	tile := tiling.NewTile()
+	trace := types.NewGoldenTraceN(3)
+	trace.Values = []string{"aaa", "bbb", "ccc"}
+	trace.Params_ = map[string]string{types.PRIMARY_KEY_FIELD: "foo", "config": "gpu"}
+	tile.Traces["foo:gpu"] = trace
+	getTile := func() (*types.TilePair, error) {
+		return &types.TilePair{Tile: tile, TileWithIgnores: tile}, nil
+	}
+
+	emailer := &mockEmailer{}
+	expirer := NewExpirer(store, expStore, getTile, emailer, "https://gold.skia.org/ignores")
+
+	later := NewIgnoreRule("jon@example.com", now.Add(30*24*time.Hour), "config=565", "later")
+	soon := NewIgnoreRule("jon@example.com", now.Add(3*24*time.Hour), "config=8888", "soon")
+	soon.Owner = "jim@example.com"
+	expired := NewIgnoreRule("jon@example.com", now.Add(-time.Minute), "config=pdf", "delete")
+	extended := NewIgnoreRule("jon@example.com", now.Add(-time.Minute), "config=msaa", "extend")
+	extended.ExpiryAction = EXPIRY_EXTEND
+	negative := NewIgnoreRule("jon@example.com", now.Add(-time.Minute), "config=gpu", "negative")
+	negative.ExpiryAction = EXPIRY_NEGATIVE
+	for _, r := range []*IgnoreRule{later, soon, expired, extended, negative} {
+		assert.NoError(t, store.Create(r))
+	}
+
+	assert.NoError(t, expirer.oneStep(now))
+
+	rules, err := store.List(false)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, len(rules))
+	byID := map[int]*IgnoreRule{}
+	for _, r := range rules {
+		byID[r.ID] = r
+	}
+
+	assert.False(t, byID[later.ID].Notified)
+	assert.True(t, byID[soon.ID].Notified)
+	assert.Equal(t, now.Add(EXPIRY_EXTENSION), byID[extended.ID].Expires)
+	assert.Equal(t, EXPIRY_USER, byID[extended.ID].UpdatedBy)
+
+	// The untriaged digests matched by the negative rule are now negative.
+	exp, err := expStore.Get()
+	assert.NoError(t, err)
+	assert.Equal(t, types.POSITIVE, exp.Classification("foo", "aaa"))
+	assert.Equal(t, types.NEGATIVE, exp.Classification("foo", "bbb"))
+	assert.Equal(t, types.NEGATIVE, exp.Classification("foo", "ccc"))
+
+	assert.Equal(t, 4, len(emailer.sent))
+	bySubject := map[string][]string{}
+	for _, e := range emailer.sent {
+		bySubject[e.subject] = append(bySubject[e.subject], e.to...)
+	}
+	assert.Equal(t, []string{"jim@example.com"}, bySubject["Ignore rule expires soon"])
+	assert.Equal(t, []string{"jon@example.com"}, bySubject["Ignore rule extended"])
+	assert.Equal(t, []string{"jon@example.com", "jon@example.com"}, bySubject["Ignore rule expired"])
+
+	// Owners are only notified once.
+	assert.NoError(t, expirer.oneStep(now))
+	assert.Equal(t, 4, len(emailer.sent))
+}
@@ -38,6 +38,24 @@ type IgnoreStore interface {
 	BuildRuleMatcher() (RuleMatcher, error)
 }
 
+// Actions that are taken when an ignore rule expires.
+const (
+	// EXPIRY_DELETE deletes the rule.
+	EXPIRY_DELETE = "delete"
+
+	// EXPIRY_EXTEND extends the rule by EXPIRY_EXTENSION and notifies the owner.
+	EXPIRY_EXTEND = "extend"
+
+	// EXPIRY_NEGATIVE marks the untriaged digests matched by the rule as
+	// negative and deletes the rule.
+	EXPIRY_NEGATIVE = "negative"
+)
+
+// ValidExpiryAction returns true if the given string is a valid expiry action.
+func ValidExpiryAction(action string) bool {
+	return (action == EXPIRY_DELETE) || (action == EXPIRY_EXTEND) || (action == EXPIRY_NEGATIVE)
+}
+
 // IgnoreRule is the GUI struct for dealing with Ignore rules.
 type IgnoreRule struct {
 	ID             int       `json:"id"`
@@ -46,6 +64,10 @@ type IgnoreRule struct {
 	Expires        time.Time `json:"expires"`
 	Query          string    `json:"query"`
 	Note           string    `json:"note"`
+	Owner          string    `json:"owner"`
+	Bug            string    `json:"bug"`
+	ExpiryAction   string    `json:"expiryAction"`
+	Notified       bool      `json:"notified"` // True if the owner was notified about the upcoming expiration.
 	Count          int       `json:"count"`
 	ExclusiveCount int       `json:"exclusiveCount"`
 }
@@ -63,13 +85,17 @@ func ToQuery(ignores []*IgnoreRule) ([]url.Values, error) {
 	return ret, nil
 }
 
+// NewIgnoreRule creates a new IgnoreRule that is owned by its creator and
+// deleted when it expires.
 func NewIgnoreRule(name string, expires time.Time, queryStr string, note string) *IgnoreRule {
 	return &IgnoreRule{
-		Name:      name,
-		UpdatedBy: name,
-		Expires:   expires,
-		Query:     queryStr,
-		Note:      note,
+		Name:         name,
+		UpdatedBy:    name,
+		Expires:      expires,
+		Query:        queryStr,
+		Note:         note,
+		Owner:        name,
+		ExpiryAction: EXPIRY_DELETE,
 	}
 }
 
@@ -108,7 +134,6 @@ func (m *MemIgnoreStore) List(addCounts bool) ([]*IgnoreRule, error) {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 
-	m.expire()
 	result := make([]*IgnoreRule, len(m.rules))
 	copy(result, m.rules)
 	return result, nil
@@ -119,8 +144,8 @@ func (m *MemIgnoreStore) Update(id int, updated *IgnoreRule) error {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 
-	for i, _ := range m.rules {
-		if updated.ID == id {
+	for i, rule := range m.rules {
+		if rule.ID == id {
 			m.rules[i] = updated
 			m.inc()
 			return nil
@@ -153,17 +178,6 @@ func (m *MemIgnoreStore) Revision() int64 {
 	return m.revision
 }
 
-func (m *MemIgnoreStore) expire() {
-	newrules := make([]*IgnoreRule, 0, len(m.rules))
-	now := time.Now()
-	for _, rule := range m.rules {
-		if rule.Expires.After(now) {
-			newrules = append(newrules, rule)
-		}
-	}
-	m.rules = newrules
-}
-
 // BuildRuleMatcher, see IgnoreStore interface.
 func (m *MemIgnoreStore) BuildRuleMatcher() (RuleMatcher, error) {
 	return buildRuleMatcher(m)
@@ -22,6 +22,8 @@ func testIgnoreStore(t *testing.T, store IgnoreStore) {
 	r2 := NewIgnoreRule("jim@example.com", time.Now().Add(time.Minute*10), "config=8888", "No good reason.")
 	r3 := NewIgnoreRule("jon@example.com", time.Now().Add(time.Minute*50), "extra=123&extra=abc", "Ignore multiple.")
 	r4 := NewIgnoreRule("jon@example.com", time.Now().Add(time.Minute*100), "extra=123&extra=abc&config=8888", "Ignore multiple.")
+	r1.Bug = "https://bug.skia.org/1234"
+	r1.ExpiryAction = EXPIRY_EXTEND
 	assert.Equal(t, int64(0), store.Revision())
 	assert.NoError(t, store.Create(r1))
 	assert.NoError(t, store.Create(r2))
@@ -33,6 +35,15 @@ func testIgnoreStore(t *testing.T, store IgnoreStore) {
 	assert.NoError(t, err)
 	assert.Equal(t, 4, len(allRules))
 	assert.Equal(t, int64(4), store.Revision())
+	for _, oneRule := range allRules {
+		assert.Equal(t, oneRule.Name, oneRule.Owner)
+		if oneRule.ID == r1.ID {
+			assert.Equal(t, "https://bug.skia.org/1234", oneRule.Bug)
+			assert.Equal(t, EXPIRY_EXTEND, oneRule.ExpiryAction)
+		} else {
+			assert.Equal(t, EXPIRY_DELETE, oneRule.ExpiryAction)
+		}
+	}
 
 	// Test the rule matcher
 	matcher, err := store.BuildRuleMatcher()
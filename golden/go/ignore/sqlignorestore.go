@@ -45,10 +45,10 @@ func (m *SQLIgnoreStore) inc() {
 
 // Create, see IgnoreStore interface.
 func (m *SQLIgnoreStore) Create(rule *IgnoreRule) error {
-	stmt := `INSERT INTO ignorerule (userid, updated_by, expires, query, note)
-	         VALUES(?,?,?,?,?)`
+	stmt := `INSERT INTO ignorerule (userid, updated_by, expires, query, note, owner, bug, expiry_action, notified)
+	         VALUES(?,?,?,?,?,?,?,?,?)`
 
-	ret, err := m.vdb.DB.Exec(stmt, rule.Name, rule.Name, rule.Expires.Unix(), rule.Query, rule.Note)
+	ret, err := m.vdb.DB.Exec(stmt, rule.Name, rule.Name, rule.Expires.Unix(), rule.Query, rule.Note, rule.Owner, rule.Bug, rule.ExpiryAction, rule.Notified)
 	if err != nil {
 		return err
 	}
@@ -63,9 +63,9 @@ func (m *SQLIgnoreStore) Create(rule *IgnoreRule) error {
 
 // Update, see IgnoreStore interface.
 func (m *SQLIgnoreStore) Update(id int, rule *IgnoreRule) error {
-	stmt := `UPDATE ignorerule SET updated_by=?, expires=?, query=?, note=? WHERE id=?`
+	stmt := `UPDATE ignorerule SET updated_by=?, expires=?, query=?, note=?, owner=?, bug=?, expiry_action=?, notified=? WHERE id=?`
 
-	res, err := m.vdb.DB.Exec(stmt, rule.UpdatedBy, rule.Expires.Unix(), rule.Query, rule.Note, rule.ID)
+	res, err := m.vdb.DB.Exec(stmt, rule.UpdatedBy, rule.Expires.Unix(), rule.Query, rule.Note, rule.Owner, rule.Bug, rule.ExpiryAction, rule.Notified, rule.ID)
 	if err != nil {
 		return err
 	}
@@ -79,7 +79,7 @@ func (m *SQLIgnoreStore) Update(id int, rule *IgnoreRule) error {
 
 // List, see IgnoreStore interface.
 func (m *SQLIgnoreStore) List(addCounts bool) ([]*IgnoreRule, error) {
-	stmt := `SELECT id, userid, updated_by, expires, query, note
+	stmt := `SELECT id, userid, updated_by, expires, query, note, owner, bug, expiry_action, notified
 	         FROM ignorerule
 	         ORDER BY expires ASC`
 	rows, err := m.vdb.DB.Query(stmt)
@@ -92,7 +92,7 @@ func (m *SQLIgnoreStore) List(addCounts bool) ([]*IgnoreRule, error) {
 	for rows.Next() {
 		target := &IgnoreRule{}
 		var expiresTS int64
-		err := rows.Scan(&target.ID, &target.Name, &target.UpdatedBy, &expiresTS, &target.Query, &target.Note)
+		err := rows.Scan(&target.ID, &target.Name, &target.UpdatedBy, &expiresTS, &target.Query, &target.Note, &target.Owner, &target.Bug, &target.ExpiryAction, &target.Notified)
 		if err != nil {
 			return nil, err
 		}
@@ -13,6 +13,7 @@ import (
 	"go.skia.org/infra/go/timer"
 	"go.skia.org/infra/golden/go/blame"
 	"go.skia.org/infra/golden/go/expstorage"
+	"go.skia.org/infra/golden/go/flaky"
 	"go.skia.org/infra/golden/go/paramsets"
 	"go.skia.org/infra/golden/go/pdag"
 	"go.skia.org/infra/golden/go/storage"
@@ -39,6 +40,7 @@ type SearchIndex struct {
 	paramsetSummary *paramsets.ParamSummary
 	blamer          *blame.Blamer
 	warmer          *warmer.Warmer
+	flakiness       *flaky.Flakiness
 
 	// Used by the pdag pipeline.
 	testNames []string
@@ -55,6 +57,7 @@ func newSearchIndex(storages *storage.Storage, tilePair *types.TilePair) *Search
 		paramsetSummary: paramsets.New(),
 		blamer:          blame.New(storages),
 		warmer:          warmer.New(storages),
+		flakiness:       flaky.New(),
 	}
 }
 
@@ -104,6 +107,18 @@ func (idx *SearchIndex) GetBlame(test, digest string, commits []*tiling.Commit)
 	return idx.blamer.GetBlame(test, digest, commits)
 }
 
+// GetFlakyTraces returns the n flakiest traces with a score of at least
+// minScore. Ignored traces are not included.
+func (idx *SearchIndex) GetFlakyTraces(n int, minScore float64) []*flaky.TraceFlakiness {
+	return idx.flakiness.Get(n, minScore)
+}
+
+// GetFlakySuggestions returns the ignore suggestions, calculated along with the
+// flakiness, for the tests of the given flaky traces.
+func (idx *SearchIndex) GetFlakySuggestions(traces []*flaky.TraceFlakiness) []*flaky.IgnoreSuggestion {
+	return idx.flakiness.GetSuggestions(traces)
+}
+
 // Indexer is the type that drive continously indexing as the underlying
 // data change. It uses a DAG that encodes the dependencies of the
 // different components of an index and creates a processing pipeline on top
@@ -132,8 +147,9 @@ func New(storages *storage.Storage, interval time.Duration) (*Indexer, error) {
 	blamerNode := root.Child(calcBlame)
 	tallyNode := root.Child(calcTallies)
 
-	// parameters depend on tallies.
+	// parameters and flakiness depend on tallies.
 	tallyNode.Child(calcParamsets)
+	flakyNode := tallyNode.Child(calcFlakiness)
 
 	// summaries depend on tallies and blamer.
 	summaryNode := pdag.NewNode(calcSummaries, tallyNode, blamerNode)
@@ -142,7 +158,7 @@ func New(storages *storage.Storage, interval time.Duration) (*Indexer, error) {
 	pdag.NewNode(runWarmer, summaryNode, tallyNode)
 
 	// Set the result on the Indexer instance.
-	pdag.NewNode(ret.setIndex, summaryNode)
+	pdag.NewNode(ret.setIndex, summaryNode, flakyNode)
 
 	ret.pipeline = root
 	ret.blamerNode = blamerNode
@@ -233,6 +249,7 @@ func (ixr *Indexer) indexTests(testNames []string) {
 		paramsetSummary: lastIdx.paramsetSummary,
 		blamer:          blame.New(ixr.storages),
 		warmer:          warmer.New(ixr.storages),
+		flakiness:       lastIdx.flakiness,
 		testNames:       testNames,
 	}
 
@@ -274,6 +291,13 @@ func calcParamsets(state interface{}) error {
 	return nil
 }
 
+// calcFlakiness is the pipeline function to calculate the flakiness of traces.
+func calcFlakiness(state interface{}) error {
+	idx := state.(*SearchIndex)
+	idx.flakiness.Calculate(idx.tilePair.Tile, idx.tallies.ByTrace())
+	return nil
+}
+
 // calcBlame is the pipeline function to calculate the blame.
 func calcBlame(state interface{}) error {
 	idx := state.(*SearchIndex)
@@ -9,8 +9,10 @@ import (
 
 	assert "github.com/stretchr/testify/require"
 
+	"go.skia.org/infra/go/database/testutil"
 	"go.skia.org/infra/go/testutils"
 	"go.skia.org/infra/go/util"
+	"go.skia.org/infra/golden/go/db"
 )
 
 const (
@@ -26,13 +28,30 @@ const (
 
 func TestIssueStore(t *testing.T) {
 	testutils.MediumTest(t)
-	const N_ISSUES = 20
 
-	// Add a number of issues
 	issueStore, err := New(TEST_DATA_DIR)
 	assert.NoError(t, err)
 	defer testutils.RemoveAll(t, TEST_DATA_DIR)
+	testIssueStore(t, issueStore)
+}
+
+func TestSQLIssueStore(t *testing.T) {
+	testutils.MediumTest(t)
+
+	// Set up the test database.
+	testDb := testutil.SetupMySQLTestDatabase(t, db.MigrationSteps())
+	defer testDb.Close(t)
 
+	conf := testutil.LocalTestDatabaseConfig(db.MigrationSteps())
+	vdb, err := conf.NewVersionedDB()
+	assert.NoError(t, err)
+	testIssueStore(t, NewSQLIssueStore(vdb))
+}
+
+func testIssueStore(t *testing.T, issueStore IssueStore) {
+	const N_ISSUES = 20
+
+	// Add a number of issues
 	lookup := map[string][]string{}
 	initIssues := genIssues(t, lookup, N_ISSUES, N_ISSUES/4+1, N_ISSUES/2+1, N_ISSUES/3+1, N_ISSUES/3+1)
 	issueIDs := make([]string, 0, len(initIssues))
@@ -45,12 +64,12 @@ func TestIssueStore(t *testing.T) {
 		found, err := issueStore.Get([]string{issue.IssueID})
 		assert.NoError(t, err)
 		assert.Equal(t, 1, len(found))
-		assert.Equal(t, issue, found[0])
+		compareEntries(t, []*Annotation{issue}, found)
 	}
 
 	found, err := issueStore.Get(issueIDs)
 	assert.NoError(t, err)
-	assert.Equal(t, initIssues, found)
+	compareEntries(t, initIssues, found)
 
 	testAgainstLookup(t, issueStore, lookup)
 
@@ -0,0 +1,242 @@
+package issuestore
+
+import (
+	"fmt"
+	"strings"
+
+	"go.skia.org/infra/go/database"
+	"go.skia.org/infra/go/util"
+)
+
+// Kinds of items that can be connected to an issue. They are stored in the
+// 'kind' column of the issue_annotation table.
+const (
+	KIND_DIGEST = "digest"
+	KIND_TRACE  = "trace"
+	KIND_IGNORE = "ignore"
+	KIND_TEST   = "test"
+)
+
+// sqlIssueStore implements the IssueStore interface on top of an SQL
+// database. Every row in the issue_annotation table connects one item to an
+// issue. An issue exists as long as it has at least one item.
+type sqlIssueStore struct {
+	vdb *database.VersionedDB
+}
+
+// NewSQLIssueStore returns a new IssueStore that is backed by the given
+// database, so that it can be shared by multiple processes.
+func NewSQLIssueStore(vdb *database.VersionedDB) IssueStore {
+	return &sqlIssueStore{
+		vdb: vdb,
+	}
+}
+
+// ByDigest, see IssueStore interface.
+func (s *sqlIssueStore) ByDigest(digest string) ([]string, error) {
+	return s.byItem(KIND_DIGEST, digest)
+}
+
+// ByIgnore, see IssueStore interface.
+func (s *sqlIssueStore) ByIgnore(ignoreID string) ([]string, error) {
+	return s.byItem(KIND_IGNORE, ignoreID)
+}
+
+// ByTrace, see IssueStore interface.
+func (s *sqlIssueStore) ByTrace(traceID string) ([]string, error) {
+	return s.byItem(KIND_TRACE, traceID)
+}
+
+// ByTest, see IssueStore interface.
+func (s *sqlIssueStore) ByTest(testName string) ([]string, error) {
+	return s.byItem(KIND_TEST, testName)
+}
+
+// Add, see IssueStore interface.
+func (s *sqlIssueStore) Add(delta *Annotation) error {
+	const stmtTmpl = `INSERT IGNORE INTO issue_annotation (issue, kind, item) VALUES %s`
+
+	placeHolders := []string{}
+	vals := []interface{}{}
+	forEachItem(delta, func(kind, item string) {
+		placeHolders = append(placeHolders, "(?, ?, ?)")
+		vals = append(vals, delta.IssueID, kind, item)
+	})
+	if len(vals) == 0 {
+		return nil
+	}
+
+	_, err := s.vdb.DB.Exec(fmt.Sprintf(stmtTmpl, strings.Join(placeHolders, ",")), vals...)
+	return err
+}
+
+// Subtract, see IssueStore interface.
+func (s *sqlIssueStore) Subtract(delta *Annotation) error {
+	const stmtTmpl = `DELETE FROM issue_annotation WHERE issue=? AND (%s)`
+
+	conditions := []string{}
+	vals := []interface{}{delta.IssueID}
+	forEachItem(delta, func(kind, item string) {
+		conditions = append(conditions, "(kind=? AND item=?)")
+		vals = append(vals, kind, item)
+	})
+	if len(conditions) == 0 {
+		return nil
+	}
+
+	_, err := s.vdb.DB.Exec(fmt.Sprintf(stmtTmpl, strings.Join(conditions, " OR ")), vals...)
+	return err
+}
+
+// Get, see IssueStore interface.
+func (s *sqlIssueStore) Get(issueIDs []string) ([]*Annotation, error) {
+	if len(issueIDs) == 0 {
+		return []*Annotation{}, nil
+	}
+
+	const stmtTmpl = `SELECT issue, kind, item FROM issue_annotation WHERE issue IN (%s) ORDER BY issue, kind, item`
+	vals := make([]interface{}, 0, len(issueIDs))
+	for _, issueID := range issueIDs {
+		vals = append(vals, issueID)
+	}
+	rows, err := s.vdb.DB.Query(fmt.Sprintf(stmtTmpl, placeHolders(len(issueIDs))), vals...)
+	if err != nil {
+		return nil, err
+	}
+	defer util.Close(rows)
+
+	byID := map[string]*Annotation{}
+	for rows.Next() {
+		var issueID, kind, item string
+		if err := rows.Scan(&issueID, &kind, &item); err != nil {
+			return nil, err
+		}
+		anno, ok := byID[issueID]
+		if !ok {
+			anno = &Annotation{
+				IssueID:   issueID,
+				Digests:   []string{},
+				Traces:    []string{},
+				Ignores:   []string{},
+				TestNames: []string{},
+			}
+			byID[issueID] = anno
+		}
+		switch kind {
+		case KIND_DIGEST:
+			anno.Digests = append(anno.Digests, item)
+		case KIND_TRACE:
+			anno.Traces = append(anno.Traces, item)
+		case KIND_IGNORE:
+			anno.Ignores = append(anno.Ignores, item)
+		case KIND_TEST:
+			anno.TestNames = append(anno.TestNames, item)
+		default:
+			return nil, fmt.Errorf("Unknown kind %q of item %q in issue %s", kind, item, issueID)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Return the annotations in the order of the requested ids.
+	ret := make([]*Annotation, 0, len(byID))
+	for _, issueID := range issueIDs {
+		if anno, ok := byID[issueID]; ok {
+			ret = append(ret, anno)
+		}
+	}
+	return ret, nil
+}
+
+// List, see IssueStore interface.
+func (s *sqlIssueStore) List(offset int, size int) ([]*Annotation, int, error) {
+	total := 0
+	if err := s.vdb.DB.QueryRow(`SELECT COUNT(DISTINCT issue) FROM issue_annotation`).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	// If size <= 0 then we want all entries.
+	if size <= 0 {
+		size = total
+	}
+	if util.MinInt(total-offset, size) <= 0 {
+		return []*Annotation{}, total, nil
+	}
+
+	const stmt = `SELECT DISTINCT issue FROM issue_annotation ORDER BY issue LIMIT ?, ?`
+	issueIDs, err := s.queryStrings(stmt, offset, size)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	ret, err := s.Get(issueIDs)
+	if err != nil {
+		return nil, 0, err
+	}
+	return ret, total, nil
+}
+
+// Delete, see IssueStore interface.
+func (s *sqlIssueStore) Delete(issueIDs []string) error {
+	if len(issueIDs) == 0 {
+		return nil
+	}
+
+	const stmtTmpl = `DELETE FROM issue_annotation WHERE issue IN (%s)`
+	vals := make([]interface{}, 0, len(issueIDs))
+	for _, issueID := range issueIDs {
+		vals = append(vals, issueID)
+	}
+	_, err := s.vdb.DB.Exec(fmt.Sprintf(stmtTmpl, placeHolders(len(issueIDs))), vals...)
+	return err
+}
+
+// byItem returns the sorted ids of all issues connected to the given item.
+func (s *sqlIssueStore) byItem(kind, item string) ([]string, error) {
+	if item == "" {
+		return []string{}, nil
+	}
+	const stmt = `SELECT issue FROM issue_annotation WHERE kind=? AND item=? ORDER BY issue`
+	return s.queryStrings(stmt, kind, item)
+}
+
+// queryStrings runs a query that returns a single string column.
+func (s *sqlIssueStore) queryStrings(stmt string, args ...interface{}) ([]string, error) {
+	rows, err := s.vdb.DB.Query(stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer util.Close(rows)
+
+	ret := []string{}
+	for rows.Next() {
+		var val string
+		if err := rows.Scan(&val); err != nil {
+			return nil, err
+		}
+		ret = append(ret, val)
+	}
+	return ret, rows.Err()
+}
+
+// forEachItem calls fn for every item in the annotation together with its kind.
+func forEachItem(anno *Annotation, fn func(kind, item string)) {
+	for _, digest := range anno.Digests {
+		fn(KIND_DIGEST, digest)
+	}
+	for _, trace := range anno.Traces {
+		fn(KIND_TRACE, trace)
+	}
+	for _, ignore := range anno.Ignores {
+		fn(KIND_IGNORE, ignore)
+	}
+	for _, testName := range anno.TestNames {
+		fn(KIND_TEST, testName)
+	}
+}
+
+// placeHolders returns a comma separated list of n SQL placeholders.
+func placeHolders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?,", n), ",")
+}
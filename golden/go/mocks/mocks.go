@@ -38,8 +38,9 @@ func (m MockDiffStore) Get(priority int64, dMain string, dRest []string) (map[st
 				MaxRGBADiffs:     []int{5, 3, 4, 0},
 				DimDiffer:        false,
 				Diffs: map[string]float32{
-					diff.METRIC_COMBINED: rand.Float32(),
-					diff.METRIC_PERCENT:  rand.Float32(),
+					diff.METRIC_COMBINED:   rand.Float32(),
+					diff.METRIC_PERCENT:    rand.Float32(),
+					diff.METRIC_PERCEPTUAL: rand.Float32(),
 				},
 			}
 		}
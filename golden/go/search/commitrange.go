@@ -0,0 +1,332 @@
+package search
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/skia-dev/glog"
+	"go.skia.org/infra/go/tiling"
+	"go.skia.org/infra/go/util"
+	"go.skia.org/infra/golden/go/diff"
+	"go.skia.org/infra/golden/go/digesttools"
+	"go.skia.org/infra/golden/go/expstorage"
+	"go.skia.org/infra/golden/go/indexer"
+	"go.skia.org/infra/golden/go/storage"
+	"go.skia.org/infra/golden/go/types"
+)
+
+// MIN_HASH_PREFIX is the minimum length of a git hash prefix that identifies
+// a commit in a commit range.
+const MIN_HASH_PREFIX = 7
+
+// DigestChange is a digest of a test that appeared or disappeared in a
+// commit range.
+type DigestChange struct {
+	Digest   string              `json:"digest"`
+	Status   string              `json:"status"`
+	ParamSet map[string][]string `json:"paramset"` // Params of the traces that produced the digest.
+
+	// Closest is the closest digest the same traces produced at the beginning
+	// of the range. It is only set for new digests and nil if there is no
+	// earlier digest to compare to.
+	Closest *digesttools.Closest `json:"closest"`
+}
+
+// LabelChange counts the traces that switched from a digest with one label
+// to a digest with a different label in a commit range.
+type LabelChange struct {
+	From       string `json:"from"`
+	FromStatus string `json:"fromStatus"`
+	To         string `json:"to"`
+	ToStatus   string `json:"toStatus"`
+	Traces     int    `json:"traces"`
+}
+
+// TestChange captures how the digests of one test changed in a commit range.
+type TestChange struct {
+	Test         string          `json:"test"`
+	Added        []*DigestChange `json:"added"`
+	Removed      []*DigestChange `json:"removed"`
+	LabelChanges []*LabelChange  `json:"labelChanges"`
+}
+
+// CommitRangeResponse is the result of CompareCommitRange.
+type CommitRangeResponse struct {
+	Begin *tiling.Commit `json:"begin"`
+	End   *tiling.Commit `json:"end"`
+	Tests []*TestChange  `json:"tests"`
+}
+
+// CompareCommitRange returns every test whose digests changed between the
+// two commits in q.CommitRange. Only traces that match q.Query are
+// considered. Both commits have to be in the current tile.
+func CompareCommitRange(q *Query, storages *storage.Storage, idx *indexer.SearchIndex) (*CommitRangeResponse, error) {
+	tile := idx.GetTile(q.IncludeIgnores)
+	begin, end, err := q.CommitRange.indices(tile)
+	if err != nil {
+		return nil, err
+	}
+
+	exp, err := storages.ExpectationsStore.Get()
+	if err != nil {
+		return nil, fmt.Errorf("Couldn't get expectations: %s", err)
+	}
+
+	return &CommitRangeResponse{
+		Begin: tile.Commits[begin],
+		End:   tile.Commits[end],
+		Tests: compareCommits(tile, begin, end, q, exp, storages.DiffStore),
+	}, nil
+}
+
+// indices returns the indices of the first and last commit of the range in
+// the given tile.
+func (c CommitRange) indices(tile *tiling.Tile) (int, int, error) {
+	if (c.Begin == "") || (c.End == "") {
+		return 0, 0, fmt.Errorf("The beginning and the end of the commit range are required.")
+	}
+	last := tile.LastCommitIndex()
+	begin, err := commitIndex(tile.Commits[:last+1], c.Begin)
+	if err != nil {
+		return 0, 0, err
+	}
+	end, err := commitIndex(tile.Commits[:last+1], c.End)
+	if err != nil {
+		return 0, 0, err
+	}
+	if begin > end {
+		return 0, 0, fmt.Errorf("Commit range %s - %s ends before it begins.", c.Begin, c.End)
+	}
+	return begin, end, nil
+}
+
+// commitIndex returns the index of the given commit in commits. The commit is
+// either a git hash or a prefix of one, or a time in RFC3339 format. For a time
+// the last commit at or before that time is returned.
+func commitIndex(commits []*tiling.Commit, commit string) (int, error) {
+	if ts, err := time.Parse(time.RFC3339, commit); err == nil {
+		for i := len(commits) - 1; i >= 0; i-- {
+			if commits[i].CommitTime <= ts.Unix() {
+				return i, nil
+			}
+		}
+		return 0, fmt.Errorf("The current tile has no commits at or before %s.", commit)
+	}
+
+	for i, c := range commits {
+		if (len(commit) >= MIN_HASH_PREFIX) && strings.HasPrefix(c.Hash, commit) {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("Commit %s is not in the current tile.", commit)
+}
+
+// rangeIntermediate collects the digests of the traces of one test that
+// changed in a commit range.
+type rangeIntermediate struct {
+	begin map[string]map[string][]string // digest -> paramset.
+	end   map[string]map[string][]string // digest -> paramset.
+
+	// earlier maps the new digests to the digests their traces produced at
+	// the beginning of the range.
+	earlier map[string]util.StringSet
+
+	// labelChanges is keyed by "from:to".
+	labelChanges map[string]*LabelChange
+}
+
+// compareCommits compares the digests of all traces that match the query at
+// the commits with index begin and end.
+func compareCommits(tile *tiling.Tile, begin, end int, q *Query, exp *expstorage.Expectations, diffStore diff.DiffStore) []*TestChange {
+	// Collect the digests of each test at the beginning and end of the range,
+	// and the details of the traces that changed.
+	allBegin := map[string]util.StringSet{}
+	allEnd := map[string]util.StringSet{}
+	byTest := map[string]*rangeIntermediate{}
+	for _, trace := range tile.Traces {
+		if !tiling.Matches(trace, q.Query) {
+			continue
+		}
+		gTrace := trace.(*types.GoldenTrace)
+		test := gTrace.Params_[types.PRIMARY_KEY_FIELD]
+		beginDigest := lastDigestAt(gTrace, begin)
+		endDigest := lastDigestAt(gTrace, end)
+		addDigest(allBegin, test, beginDigest)
+		addDigest(allEnd, test, endDigest)
+		if beginDigest == endDigest {
+			continue
+		}
+
+		td, ok := byTest[test]
+		if !ok {
+			td = &rangeIntermediate{
+				begin:        map[string]map[string][]string{},
+				end:          map[string]map[string][]string{},
+				earlier:      map[string]util.StringSet{},
+				labelChanges: map[string]*LabelChange{},
+			}
+			byTest[test] = td
+		}
+		addParams(td.begin, beginDigest, gTrace.Params_)
+		addParams(td.end, endDigest, gTrace.Params_)
+
+		if (beginDigest == types.MISSING_DIGEST) || (endDigest == types.MISSING_DIGEST) {
+			continue
+		}
+		if _, ok := td.earlier[endDigest]; !ok {
+			td.earlier[endDigest] = util.StringSet{}
+		}
+		td.earlier[endDigest][beginDigest] = true
+
+		fromStatus := exp.Classification(test, beginDigest)
+		toStatus := exp.Classification(test, endDigest)
+		if fromStatus != toStatus {
+			key := beginDigest + ":" + endDigest
+			if lc, ok := td.labelChanges[key]; ok {
+				lc.Traces++
+			} else {
+				td.labelChanges[key] = &LabelChange{
+					From:       beginDigest,
+					FromStatus: fromStatus.String(),
+					To:         endDigest,
+					ToStatus:   toStatus.String(),
+					Traces:     1,
+				}
+			}
+		}
+	}
+
+	// Traces that changed digests don't necessarily change the set of digests
+	// of a test. Only report tests where digests appeared or disappeared or
+	// labels changed.
+	ret := []*TestChange{}
+	for test, td := range byTest {
+		tc := &TestChange{
+			Test:         test,
+			Added:        []*DigestChange{},
+			Removed:      []*DigestChange{},
+			LabelChanges: []*LabelChange{},
+		}
+		for digest, paramSet := range td.end {
+			if allBegin[test][digest] {
+				continue
+			}
+			earlier := td.earlier[digest]
+			if len(earlier) == 0 {
+				earlier = allBegin[test]
+			}
+			tc.Added = append(tc.Added, &DigestChange{
+				Digest:   digest,
+				Status:   exp.Classification(test, digest).String(),
+				ParamSet: paramSet,
+				Closest:  closestEarlier(digest, earlier.Keys(), diffStore),
+			})
+		}
+		for digest, paramSet := range td.begin {
+			if allEnd[test][digest] {
+				continue
+			}
+			tc.Removed = append(tc.Removed, &DigestChange{
+				Digest:   digest,
+				Status:   exp.Classification(test, digest).String(),
+				ParamSet: paramSet,
+			})
+		}
+		for _, lc := range td.labelChanges {
+			tc.LabelChanges = append(tc.LabelChanges, lc)
+		}
+
+		if len(tc.Added)+len(tc.Removed)+len(tc.LabelChanges) > 0 {
+			sort.Sort(digestChangeSlice(tc.Added))
+			sort.Sort(digestChangeSlice(tc.Removed))
+			sort.Sort(labelChangeSlice(tc.LabelChanges))
+			ret = append(ret, tc)
+		}
+	}
+	sort.Sort(testChangeSlice(ret))
+	return ret
+}
+
+// lastDigestAt returns the last digest of the trace at or before the commit
+// with the given index.
+func lastDigestAt(trace *types.GoldenTrace, index int) string {
+	for i := index; i >= 0; i-- {
+		if !trace.IsMissing(i) {
+			return trace.Values[i]
+		}
+	}
+	return types.MISSING_DIGEST
+}
+
+// addDigest adds the digest to the set of digests of the given test.
+func addDigest(digestsByTest map[string]util.StringSet, test, digest string) {
+	if digest == types.MISSING_DIGEST {
+		return
+	}
+	if _, ok := digestsByTest[test]; !ok {
+		digestsByTest[test] = util.StringSet{}
+	}
+	digestsByTest[test][digest] = true
+}
+
+// addParams adds params to the paramset of the given digest.
+func addParams(paramSets map[string]map[string][]string, digest string, params map[string]string) {
+	if digest == types.MISSING_DIGEST {
+		return
+	}
+	if _, ok := paramSets[digest]; !ok {
+		paramSets[digest] = map[string][]string{}
+	}
+	util.AddParamsToParamSet(paramSets[digest], params)
+}
+
+// closestEarlier returns the digest in earlier that is closest to digest or
+// nil if there are no earlier digests or they couldn't be diffed.
+func closestEarlier(digest string, earlier []string, diffStore diff.DiffStore) *digesttools.Closest {
+	if len(earlier) == 0 {
+		return nil
+	}
+	diffs, err := diffStore.Get(diff.PRIORITY_NOW, digest, earlier)
+	if err != nil {
+		glog.Errorf("Unable to diff %s against earlier digests %v: %s", digest, earlier, err)
+		return nil
+	}
+
+	var ret *digesttools.Closest
+	for other, dm := range diffs {
+		closest := digesttools.ClosestFromDiffMetrics(dm)
+		closest.Digest = other
+		if (ret == nil) || (closest.Diff < ret.Diff) {
+			ret = closest
+		}
+	}
+	return ret
+}
+
+// digestChangeSlice sorts DigestChanges by digest.
+type digestChangeSlice []*DigestChange
+
+func (d digestChangeSlice) Len() int           { return len(d) }
+func (d digestChangeSlice) Less(i, j int) bool { return d[i].Digest < d[j].Digest }
+func (d digestChangeSlice) Swap(i, j int)      { d[i], d[j] = d[j], d[i] }
+
+// labelChangeSlice sorts LabelChanges by descending number of traces.
+type labelChangeSlice []*LabelChange
+
+func (l labelChangeSlice) Len() int { return len(l) }
+func (l labelChangeSlice) Less(i, j int) bool {
+	if l[i].Traces == l[j].Traces {
+		return l[i].From+l[i].To < l[j].From+l[j].To
+	}
+	return l[i].Traces > l[j].Traces
+}
+func (l labelChangeSlice) Swap(i, j int) { l[i], l[j] = l[j], l[i] }
+
+// testChangeSlice sorts TestChanges by test name.
+type testChangeSlice []*TestChange
+
+func (t testChangeSlice) Len() int           { return len(t) }
+func (t testChangeSlice) Less(i, j int) bool { return t[i].Test < t[j].Test }
+func (t testChangeSlice) Swap(i, j int)      { t[i], t[j] = t[j], t[i] }
@@ -0,0 +1,124 @@
+package search
+
+import (
+	"net/url"
+	"testing"
+
+	assert "github.com/stretchr/testify/require"
+
+	"go.skia.org/infra/go/testutils"
+	"go.skia.org/infra/go/tiling"
+	"go.skia.org/infra/golden/go/expstorage"
+	"go.skia.org/infra/golden/go/mocks"
+	"go.skia.org/infra/golden/go/types"
+)
+
+func TestCommitIndex(t *testing.T) {
+	testutils.SmallTest(t)
+
+	commits := []*tiling.Commit{
+		{Hash: "aaaaaaaaaa", CommitTime: 1000},
+		{Hash: "bbbbbbbbbb", CommitTime: 2000},
+		{Hash: "cccccccccc", CommitTime: 3000},
+	}
+
+	idx, err := commitIndex(commits, "bbbbbbb")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, idx)
+
+	idx, err = commitIndex(commits, "1970-01-01T00:41:00Z")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, idx)
+
+	idx, err = commitIndex(commits, "1970-01-01T01:00:00Z")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, idx)
+
+	_, err = commitIndex(commits, "bbb")
+	assert.Error(t, err)
+	_, err = commitIndex(commits, "ddddddddd")
+	assert.Error(t, err)
+	_, err = commitIndex(commits, "1970-01-01T00:00:00Z")
+	assert.Error(t, err)
+
+	tile := tiling.NewTile()
+	tile.Commits = commits
+	_, _, err = CommitRange{Begin: "ccccccc", End: "aaaaaaa"}.indices(tile)
+	assert.Error(t, err)
+	_, _, err = CommitRange{Begin: "aaaaaaa"}.indices(tile)
+	assert.Error(t, err)
+	begin, end, err := CommitRange{Begin: "aaaaaaa", End: "ccccccc"}.indices(tile)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, begin)
+	assert.Equal(t, 2, end)
+}
+
+func TestCompareCommits(t *testing.T) {
+	testutils.SmallTest(t)
+
+	tile := tiling.NewTile()
+	addTrace := func(id, test, config string, values []string) {
+		trace := types.NewGoldenTraceN(len(values))
+		copy(trace.Values, values)
+		trace.Params_[types.PRIMARY_KEY_FIELD] = test
+		trace.Params_["config"] = config
+		tile.Traces[id] = trace
+	}
+	addTrace("foo:8888", "foo", "8888", []string{"a", "a", "b", "b"})
+	addTrace("foo:gpu", "foo", "gpu", []string{"a", types.MISSING_DIGEST, "a", "a"})
+	addTrace("bar:8888", "bar", "8888", []string{"x", "y", "z", "z"})
+	addTrace("bar:gpu", "bar", "gpu", []string{"x", "x", "y", "y"})
+	addTrace("baz:8888", "baz", "8888", []string{"p", "p", "p", types.MISSING_DIGEST})
+
+	expStore := expstorage.NewMemExpectationsStore(nil)
+	assert.NoError(t, expStore.AddChange(map[string]types.TestClassification{
+		"foo": {"a": types.POSITIVE, "b": types.NEGATIVE},
+		"bar": {"x": types.POSITIVE, "y": types.POSITIVE},
+	}, "jon@example.com"))
+	exp, err := expStore.Get()
+	assert.NoError(t, err)
+
+	q := &Query{Query: url.Values{}}
+	changes := compareCommits(tile, 0, 3, q, exp, mocks.NewMockDiffStore())
+
+	// Traces of baz keep their last digest, so baz did not change.
+	assert.Equal(t, 2, len(changes))
+
+	bar := changes[0]
+	assert.Equal(t, "bar", bar.Test)
+	assert.Equal(t, 2, len(bar.Added))
+	assert.Equal(t, "y", bar.Added[0].Digest)
+	assert.Equal(t, types.POSITIVE.String(), bar.Added[0].Status)
+	assert.Equal(t, "x", bar.Added[0].Closest.Digest)
+	assert.Equal(t, "z", bar.Added[1].Digest)
+	assert.Equal(t, types.UNTRIAGED.String(), bar.Added[1].Status)
+	assert.Equal(t, []string{"8888"}, bar.Added[1].ParamSet["config"])
+	assert.Equal(t, 1, len(bar.Removed))
+	assert.Equal(t, "x", bar.Removed[0].Digest)
+	assert.Equal(t, 1, len(bar.LabelChanges))
+	assert.Equal(t, &LabelChange{
+		From:       "x",
+		FromStatus: types.POSITIVE.String(),
+		To:         "z",
+		ToStatus:   types.UNTRIAGED.String(),
+		Traces:     1,
+	}, bar.LabelChanges[0])
+
+	// The digest a is still produced by foo:gpu, so it is not removed.
+	foo := changes[1]
+	assert.Equal(t, "foo", foo.Test)
+	assert.Equal(t, 1, len(foo.Added))
+	assert.Equal(t, "b", foo.Added[0].Digest)
+	assert.Equal(t, "a", foo.Added[0].Closest.Digest)
+	assert.Equal(t, 0, len(foo.Removed))
+	assert.Equal(t, 1, len(foo.LabelChanges))
+
+	// Restricting the query and the range limits the changes.
+	q = &Query{Query: url.Values{"config": []string{"gpu"}}}
+	changes = compareCommits(tile, 0, 1, q, exp, mocks.NewMockDiffStore())
+	assert.Equal(t, 0, len(changes))
+	changes = compareCommits(tile, 1, 2, q, exp, mocks.NewMockDiffStore())
+	assert.Equal(t, 1, len(changes))
+	assert.Equal(t, "bar", changes[0].Test)
+	assert.Equal(t, 0, len(changes[0].LabelChanges))
+}
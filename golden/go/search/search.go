@@ -92,9 +92,11 @@ type Digest struct {
 	Diff     *Diff               `json:"diff"`
 }
 
-// CommitRange is a range of commits, starting at the git hash Begin and ending at End, inclusive.
-//
-// Currently unimplemented in search.
+// CommitRange is a range of commits, starting at Begin and ending at End, inclusive.
+// Begin and End are either git hashes, or prefixes of at least MIN_HASH_PREFIX
+// characters, or times in RFC3339 format. If set, Search only returns digests
+// within the range and CompareCommitRange compares the digests at the ends of
+// the range.
 type CommitRange struct {
 	Begin string
 	End   string
@@ -116,6 +118,7 @@ type Query struct {
 	CommitRange    CommitRange `json:"-"`
 	Limit          int         `json:"limit"`
 	IncludeMaster  bool        `json:"master"` // Include digests also contained in master when searching Rietveld issues.
+	Metric         string      `json:"metric"` // Diff metric used to find the closest digests. Empty for the combined metric.
 }
 
 // SearchResponse is the standard search response. Depending on the query some fields
@@ -188,7 +191,12 @@ func Search(q *Query, storages *storage.Storage, idx *indexer.SearchIndex) (*Sea
 	var issueResponse *IssueResponse = nil
 	var commits []*tiling.Commit = nil
 	if q.Issue != "" {
-		ret, issueResponse, err = searchByIssue(q.Issue, q, e, q.Query, storages, idx)
+		// Digests triaged on the issue take precedence over master.
+		var issueExp *expstorage.Expectations
+		if issueExp, err = storages.ExpectationsStore.GetIssue(q.Issue); err != nil {
+			return nil, fmt.Errorf("Couldn't get expectations for issue %s: %s", q.Issue, err)
+		}
+		ret, issueResponse, err = searchByIssue(q.Issue, q, e.Overlay(issueExp), q.Query, storages, idx)
 	} else {
 		ret, commits, err = searchTile(q, e, q.Query, storages, tile, idx)
 	}
@@ -320,7 +328,7 @@ func searchByIssue(issueID string, q *Query, exp *expstorage.Expectations, parse
 	allDigests := make([]string, len(digestMap))
 	emptyTraces := &Traces{}
 	for _, digestEntry := range digestMap {
-		digestEntry.Diff = buildDiff(digestEntry.Test, digestEntry.Digest, exp, nil, talliesByTest, storages.DiffStore, idx, q.IncludeIgnores)
+		digestEntry.Diff = buildDiff(digestEntry.Test, digestEntry.Digest, exp, nil, talliesByTest, storages.DiffStore, idx, q.IncludeIgnores, q.Metric)
 		digestEntry.Traces = emptyTraces
 		ret = append(ret, digestEntry)
 		allDigests = append(allDigests, digestEntry.Digest)
@@ -339,10 +347,18 @@ func searchByIssue(issueID string, q *Query, exp *expstorage.Expectations, parse
 
 // searchTile queries across a tile.
 func searchTile(q *Query, e *expstorage.Expectations, parsedQuery url.Values, storages *storage.Storage, tile *tiling.Tile, idx *indexer.SearchIndex) ([]*Digest, []*tiling.Commit, error) {
-	// TODO Use CommitRange to create a trimmed tile.
-
 	traceTally := idx.TalliesByTrace()
-	lastCommitIndex := tile.LastCommitIndex()
+	firstCommitIndex, lastCommitIndex := 0, tile.LastCommitIndex()
+
+	// Restrict the search to the commit range. The tallies cover the entire
+	// tile, so they can't be used.
+	if (q.CommitRange.Begin != "") || (q.CommitRange.End != "") {
+		var err error
+		if firstCommitIndex, lastCommitIndex, err = q.CommitRange.indices(tile); err != nil {
+			return nil, nil, err
+		}
+		traceTally = nil
+	}
 
 	// Loop over the tile and pull out all the digests that match
 	// the query, collecting the matching traces as you go. Build
@@ -355,7 +371,7 @@ func searchTile(q *Query, e *expstorage.Expectations, parsedQuery url.Values, st
 		if tiling.Matches(tr, parsedQuery) {
 			test := tr.Params()[types.PRIMARY_KEY_FIELD]
 			// Get all the digests
-			digests := digestsFromTrace(id, tr, q.Head, lastCommitIndex, traceTally)
+			digests := digestsFromTrace(id, tr, q.Head, firstCommitIndex, lastCommitIndex, traceTally)
 			for _, digest := range digests {
 				cl := e.Classification(test, digest)
 				if q.excludeClassification(cl) {
@@ -386,12 +402,12 @@ func searchTile(q *Query, e *expstorage.Expectations, parsedQuery url.Values, st
 	ret := make([]*Digest, 0, len(inter))
 	for key, i := range inter {
 		parts := strings.Split(key, ":")
-		ret = append(ret, digestFromIntermediate(parts[0], parts[1], i, e, tile, idx, storages.DiffStore, q.IncludeIgnores))
+		ret = append(ret, digestFromIntermediate(parts[0], parts[1], i, e, tile, idx, storages.DiffStore, q.IncludeIgnores, q.Metric))
 	}
 	return ret, tile.Commits, nil
 }
 
-func digestFromIntermediate(test, digest string, inter *intermediate, e *expstorage.Expectations, tile *tiling.Tile, idx *indexer.SearchIndex, diffStore diff.DiffStore, includeIgnores bool) *Digest {
+func digestFromIntermediate(test, digest string, inter *intermediate, e *expstorage.Expectations, tile *tiling.Tile, idx *indexer.SearchIndex, diffStore diff.DiffStore, includeIgnores bool, metric string) *Digest {
 	traceTally := idx.TalliesByTrace()
 	ret := &Digest{
 		Test:     test,
@@ -399,13 +415,14 @@ func digestFromIntermediate(test, digest string, inter *intermediate, e *expstor
 		Status:   e.Classification(test, digest).String(),
 		ParamSet: idx.GetParamsetSummary(test, digest, includeIgnores),
 		Traces:   buildTraces(test, digest, inter.Traces, e, tile, traceTally),
-		Diff:     buildDiff(test, digest, e, tile, idx.TalliesByTest(), diffStore, idx, includeIgnores),
+		Diff:     buildDiff(test, digest, e, tile, idx.TalliesByTest(), diffStore, idx, includeIgnores, metric),
 	}
 	return ret
 }
 
-// buildDiff creates a Diff for the given intermediate.
-func buildDiff(test, digest string, e *expstorage.Expectations, tile *tiling.Tile, testTally map[string]tally.Tally, diffStore diff.DiffStore, idx *indexer.SearchIndex, includeIgnores bool) *Diff {
+// buildDiff creates a Diff for the given intermediate. The closest digests are
+// found using the given diff metric, or the combined metric if it is empty.
+func buildDiff(test, digest string, e *expstorage.Expectations, tile *tiling.Tile, testTally map[string]tally.Tally, diffStore diff.DiffStore, idx *indexer.SearchIndex, includeIgnores bool, metric string) *Diff {
 	ret := &Diff{
 		Diff: math.MaxFloat32,
 		Pos:  nil,
@@ -422,7 +439,7 @@ func buildDiff(test, digest string, e *expstorage.Expectations, tile *tiling.Til
 	}
 
 	var diffVal float32 = 0
-	if closest := digesttools.ClosestDigest(test, digest, e, t, diffStore, types.POSITIVE); closest.Digest != "" {
+	if closest := digesttools.ClosestDigestByMetric(test, digest, e, t, diffStore, types.POSITIVE, metric); closest.Digest != "" {
 		ret.Pos = &DiffDigest{
 			Closest: closest,
 		}
@@ -430,7 +447,7 @@ func buildDiff(test, digest string, e *expstorage.Expectations, tile *tiling.Til
 		diffVal = closest.Diff
 	}
 
-	if closest := digesttools.ClosestDigest(test, digest, e, t, diffStore, types.NEGATIVE); closest.Digest != "" {
+	if closest := digesttools.ClosestDigestByMetric(test, digest, e, t, diffStore, types.NEGATIVE, metric); closest.Digest != "" {
 		ret.Neg = &DiffDigest{
 			Closest: closest,
 		}
@@ -538,14 +555,14 @@ func blameGroupID(b *blame.BlameDistribution, commits []*tiling.Commit) string {
 	return strings.Join(ret, ":")
 }
 
-// digestsFromTrace returns all the digests in the given trace, controlled by
-// 'head', and being robust to tallies not having been calculated for the
-// trace.
-func digestsFromTrace(id string, tr tiling.Trace, head bool, lastCommitIndex int, traceTally map[string]tally.Tally) []string {
+// digestsFromTrace returns all the digests in the given trace between the
+// first and last commit index, controlled by 'head', and being robust to
+// tallies not having been calculated for the trace.
+func digestsFromTrace(id string, tr tiling.Trace, head bool, firstCommitIndex, lastCommitIndex int, traceTally map[string]tally.Tally) []string {
 	digests := util.NewStringSet()
 	if head {
 		// Find the last non-missing value in the trace.
-		for i := lastCommitIndex; i >= 0; i-- {
+		for i := lastCommitIndex; i >= firstCommitIndex; i-- {
 			if tr.IsMissing(i) {
 				continue
 			} else {
@@ -560,7 +577,7 @@ func digestsFromTrace(id string, tr tiling.Trace, head bool, lastCommitIndex int
 				digests[k] = true
 			}
 		} else {
-			for i := lastCommitIndex; i >= 0; i-- {
+			for i := lastCommitIndex; i >= firstCommitIndex; i-- {
 				if !tr.IsMissing(i) {
 					digests[tr.(*types.GoldenTrace).Values[i]] = true
 				}
@@ -654,7 +671,7 @@ func GetDigestDetails(test, digest string, storages *storage.Storage, idx *index
 			Status:   exp.Classification(test, digest).String(),
 			ParamSet: idx.GetParamsetSummary(test, digest, true),
 			Traces:   buildTraces(test, digest, traces, exp, tile, idx.TalliesByTrace()),
-			Diff:     buildDiff(test, digest, exp, nil, idx.TalliesByTest(), storages.DiffStore, idx, true),
+			Diff:     buildDiff(test, digest, exp, nil, idx.TalliesByTest(), storages.DiffStore, idx, true, ""),
 		},
 		Commits: tile.Commits,
 	}, nil
@@ -924,7 +941,7 @@ func iterTile(query *Query, addFn AddFn, acceptFn AcceptFn, storages *storage.St
 			// Check if we should accept this trace.
 			if ok, acceptRet := acceptFn(tr); ok {
 				test := tr.Params()[types.PRIMARY_KEY_FIELD]
-				digests := digestsFromTrace(id, tr, query.Head, lastCommitIndex, traceTally)
+				digests := digestsFromTrace(id, tr, query.Head, 0, lastCommitIndex, traceTally)
 				for _, digest := range digests {
 					cl := exp.Classification(test, digest)
 					if query.excludeClassification(cl) {
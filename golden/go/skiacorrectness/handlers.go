@@ -22,6 +22,7 @@ import (
 	"go.skia.org/infra/golden/go/blame"
 	"go.skia.org/infra/golden/go/diff"
 	"go.skia.org/infra/golden/go/expstorage"
+	"go.skia.org/infra/golden/go/flaky"
 	"go.skia.org/infra/golden/go/ignore"
 	"go.skia.org/infra/golden/go/indexer"
 	"go.skia.org/infra/golden/go/search"
@@ -36,6 +37,10 @@ const (
 
 	// MAX_PAGE_SIZE is the maximum page size used for pagination.
 	MAX_PAGE_SIZE = 100
+
+	// DEFAULT_N_FLAKY_TRACES is the default number of traces returned by
+	// jsonFlakyHandler.
+	DEFAULT_N_FLAKY_TRACES = 50
 )
 
 // TODO(stephana): once the byBlameHandler is removed, refactor this to
@@ -271,6 +276,25 @@ func adaptIssueResponse(ir *search.IssueResponse) *IssueSearchResult {
 	}
 }
 
+// jsonCommitRangeHandler returns every test whose digests changed between
+// two commits. It accepts the same parameters as jsonSearchHandler, where
+// 'begin' and 'end' are required and are either git hashes or times in
+// RFC3339 format.
+func jsonCommitRangeHandler(w http.ResponseWriter, r *http.Request) {
+	query := search.Query{}
+	if err := parseQuery(r, &query); err != nil {
+		httputils.ReportError(w, r, err, "Search for digests failed.")
+		return
+	}
+
+	ret, err := search.CompareCommitRange(&query, storages, ixr.GetIndex())
+	if err != nil {
+		httputils.ReportError(w, r, err, "Comparing the commit range failed.")
+		return
+	}
+	sendJsonResponse(w, ret)
+}
+
 // jsonDetailsHandler returns the details about a single digest.
 func jsonDetailsHandler(w http.ResponseWriter, r *http.Request) {
 	// Extract: test, digest.
@@ -319,9 +343,28 @@ func jsonDiffHandler(w http.ResponseWriter, r *http.Request) {
 
 // IgnoresRequest encapsulates a single ignore rule that is submitted for addition or update.
 type IgnoresRequest struct {
-	Duration string `json:"duration"`
-	Filter   string `json:"filter"`
-	Note     string `json:"note"`
+	Duration     string `json:"duration"`
+	Filter       string `json:"filter"`
+	Note         string `json:"note"`
+	Owner        string `json:"owner"`        // Defaults to the logged in user, or the current owner on updates.
+	Bug          string `json:"bug"`          // Optional link to a bug.
+	ExpiryAction string `json:"expiryAction"` // One of the ignore.EXPIRY_* actions. Defaults to ignore.EXPIRY_DELETE, or the current action on updates.
+}
+
+// setOwnership sets the owner, bug and expiry action of the given rule to the
+// values in the request, if they are set.
+func (req *IgnoresRequest) setOwnership(rule *ignore.IgnoreRule) error {
+	if req.Owner != "" {
+		rule.Owner = req.Owner
+	}
+	if req.ExpiryAction != "" {
+		if !ignore.ValidExpiryAction(req.ExpiryAction) {
+			return fmt.Errorf("Invalid expiry action: %q", req.ExpiryAction)
+		}
+		rule.ExpiryAction = req.ExpiryAction
+	}
+	rule.Bug = req.Bug
+	return nil
 }
 
 // jsonIgnoresHandler returns the current ignore rules in JSON format.
@@ -369,12 +412,23 @@ func jsonIgnoresUpdateHandler(w http.ResponseWriter, r *http.Request) {
 		httputils.ReportError(w, r, err, "Failed to parse duration")
 		return
 	}
-	ignoreRule := ignore.NewIgnoreRule(user, time.Now().Add(d), req.Filter, req.Note)
+	existing, err := getIgnoreRule(int(id))
 	if err != nil {
-		httputils.ReportError(w, r, err, "Failed to create ignore rule.")
+		httputils.ReportError(w, r, err, "Unable to find ignore rule.")
 		return
 	}
+
+	// The owner and expiry action of the rule are kept unless the request
+	// changes them.
+	ignoreRule := ignore.NewIgnoreRule(existing.Name, time.Now().Add(d), req.Filter, req.Note)
 	ignoreRule.ID = int(id)
+	ignoreRule.UpdatedBy = user
+	ignoreRule.Owner = existing.Owner
+	ignoreRule.ExpiryAction = existing.ExpiryAction
+	if err := req.setOwnership(ignoreRule); err != nil {
+		httputils.ReportError(w, r, err, "Invalid ignore rule.")
+		return
+	}
 
 	err = storages.IgnoreStore.Update(int(id), ignoreRule)
 	if err != nil {
@@ -386,6 +440,20 @@ func jsonIgnoresUpdateHandler(w http.ResponseWriter, r *http.Request) {
 	jsonIgnoresHandler(w, r)
 }
 
+// getIgnoreRule returns the ignore rule with the given id.
+func getIgnoreRule(id int) (*ignore.IgnoreRule, error) {
+	rules, err := storages.IgnoreStore.List(false)
+	if err != nil {
+		return nil, err
+	}
+	for _, rule := range rules {
+		if rule.ID == id {
+			return rule, nil
+		}
+	}
+	return nil, fmt.Errorf("Did not find an IgnoreRule with id: %d", id)
+}
+
 // jsonIgnoresDeleteHandler deletes an existing ignores rule.
 func jsonIgnoresDeleteHandler(w http.ResponseWriter, r *http.Request) {
 	user := login.LoggedInAs(r)
@@ -434,6 +502,11 @@ func jsonIgnoresAddHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err := req.setOwnership(ignoreRule); err != nil {
+		httputils.ReportError(w, r, err, "Invalid ignore rule.")
+		return
+	}
+
 	if err = storages.IgnoreStore.Create(ignoreRule); err != nil {
 		httputils.ReportError(w, r, err, "Failed to create ignore rule.")
 		return
@@ -442,6 +515,42 @@ func jsonIgnoresAddHandler(w http.ResponseWriter, r *http.Request) {
 	jsonIgnoresHandler(w, r)
 }
 
+// FlakyResponse is the response of jsonFlakyHandler.
+type FlakyResponse struct {
+	Traces      []*flaky.TraceFlakiness   `json:"traces"`
+	Suggestions []*flaky.IgnoreSuggestion `json:"suggestions"`
+}
+
+// jsonFlakyHandler returns the flakiest traces that are not ignored and
+// suggested ignore queries for them. It accepts the optional query parameters
+// 'n', the maximum number of traces to return, and 'min_score', the minimum
+// flakiness score in [0, 1].
+func jsonFlakyHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	n := DEFAULT_N_FLAKY_TRACES
+	minScore := 0.0
+	var err error
+	if v := q.Get("n"); v != "" {
+		if n, err = strconv.Atoi(v); err != nil {
+			httputils.ReportError(w, r, err, "Invalid value for n.")
+			return
+		}
+	}
+	if v := q.Get("min_score"); v != "" {
+		if minScore, err = strconv.ParseFloat(v, 64); err != nil {
+			httputils.ReportError(w, r, err, "Invalid value for min_score.")
+			return
+		}
+	}
+
+	idx := ixr.GetIndex()
+	traces := idx.GetFlakyTraces(n, minScore)
+	sendJsonResponse(w, &FlakyResponse{
+		Traces:      traces,
+		Suggestions: idx.GetFlakySuggestions(traces),
+	})
+}
+
 // TODO(stephana): Triage by query is not used on the front-end and we should
 // see if we can remove it from jsonTriageHandler.
 
@@ -456,6 +565,7 @@ type TriageRequest struct {
 	Filter           string                       `json:"filter"`
 	Include          bool                         `json:"include"` // Include ignored digests.
 	Head             bool                         `json:"head"`    // Only include digests at head if true.
+	Issue            string                       `json:"issue"`   // If set, the expectations of this trybot issue are changed instead of master.
 }
 
 // jsonTriageHandler handles a request to change the triage status of one or more
@@ -486,6 +596,14 @@ func jsonTriageHandler(w http.ResponseWriter, r *http.Request) {
 			httputils.ReportError(w, r, err, "Failed to load expectations.")
 			return
 		}
+		if req.Issue != "" {
+			issueExp, err := storages.ExpectationsStore.GetIssue(req.Issue)
+			if err != nil {
+				httputils.ReportError(w, r, err, "Failed to load issue expectations.")
+				return
+			}
+			exp = exp.Overlay(issueExp)
+		}
 
 		e := exp.Tests[req.Test]
 		digests, err := filterDigests(req.Filter, req.Query, req.Test, e, req.Include, req.Head)
@@ -518,7 +636,13 @@ func jsonTriageHandler(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	if err := storages.ExpectationsStore.AddChange(tc, user); err != nil {
+	// Triage decisions on an issue only apply to the issue until it lands.
+	if req.Issue != "" {
+		if err := storages.ExpectationsStore.AddIssueChange(req.Issue, tc, user); err != nil {
+			httputils.ReportError(w, r, err, "Failed to store the updated issue expectations.")
+			return
+		}
+	} else if err := storages.ExpectationsStore.AddChange(tc, user); err != nil {
 		httputils.ReportError(w, r, err, "Failed to store the updated expectations.")
 		return
 	}
@@ -530,6 +654,54 @@ func jsonTriageHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// jsonExportExpectationsHandler returns the current expectations in the
+// format written by expstorage.WriteExpectations. The optional 'query'
+// parameter is a paramset query which restricts the result to digests that
+// appear in matching traces of the current tile.
+func jsonExportExpectationsHandler(w http.ResponseWriter, r *http.Request) {
+	query, err := url.ParseQuery(r.FormValue("query"))
+	if err != nil {
+		httputils.ReportError(w, r, err, "Unable to parse query.")
+		return
+	}
+
+	exp, err := storages.ExpectationsStore.Get()
+	if err != nil {
+		httputils.ReportError(w, r, err, "Failed to load expectations.")
+		return
+	}
+	exp = exp.Filter(ixr.GetIndex().GetTile(true), query)
+
+	setJSONHeaders(w)
+	if err := expstorage.WriteExpectations(w, exp.Tests); err != nil {
+		glog.Errorf("Failed to write or encode result: %s", err)
+	}
+}
+
+// jsonImportExpectationsHandler accepts a POST'd test→digest→label map in
+// the format written by expstorage.WriteExpectations and adds it to the
+// expectations as a single change by the logged in user.
+func jsonImportExpectationsHandler(w http.ResponseWriter, r *http.Request) {
+	user := login.LoggedInAs(r)
+	if user == "" {
+		httputils.ReportError(w, r, fmt.Errorf("Not logged in."), "You must be logged in to import expectations.")
+		return
+	}
+
+	defer util.Close(r.Body)
+	changes, err := expstorage.ReadExpectations(r.Body)
+	if err != nil {
+		httputils.ReportError(w, r, err, "Failed to parse the expectations.")
+		return
+	}
+
+	if err := storages.ExpectationsStore.AddChange(changes, user); err != nil {
+		httputils.ReportError(w, r, err, "Failed to store the imported expectations.")
+		return
+	}
+	sendJsonResponse(w, map[string]string{})
+}
+
 // TODO(stephana): Replace filterDigests with a call to search where this
 // functionality is already implementd but not exposed as a function.
 
@@ -823,6 +995,14 @@ func parseQuery(r *http.Request, query *search.Query) error {
 	query.IncludeIgnores = r.FormValue("include") == "true"
 	query.Issue = r.FormValue("issue")
 	query.IncludeMaster = r.FormValue("master") == "true"
+	query.CommitRange = search.CommitRange{
+		Begin: r.FormValue("begin"),
+		End:   r.FormValue("end"),
+	}
+	query.Metric = r.FormValue("metric")
+	if query.Metric != "" && !util.In(query.Metric, diff.GetDiffMetricIDs()) {
+		return fmt.Errorf("Unknown diff metric: %s", query.Metric)
+	}
 
 	return nil
 }
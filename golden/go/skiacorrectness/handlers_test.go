@@ -0,0 +1,70 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	assert "github.com/stretchr/testify/require"
+	"go.skia.org/infra/go/login"
+	"go.skia.org/infra/go/testutils"
+	"go.skia.org/infra/golden/go/ignore"
+	"go.skia.org/infra/golden/go/storage"
+)
+
+func TestJsonIgnoresUpdateHandler(t *testing.T) {
+	testutils.SmallTest(t)
+	login.Init("id", "secret", "http://localhost", "salt", login.DEFAULT_SCOPE, login.DEFAULT_DOMAIN_WHITELIST, false)
+
+	storages = &storage.Storage{
+		IgnoreStore: ignore.NewMemIgnoreStore(),
+	}
+	rule := ignore.NewIgnoreRule("alice@example.com", time.Now().Add(time.Hour), "config=gpu", "flaky")
+	rule.Owner = "bob@example.com"
+	rule.ExpiryAction = ignore.EXPIRY_EXTEND
+	assert.NoError(t, storages.IgnoreStore.Create(rule))
+
+	router := mux.NewRouter()
+	router.HandleFunc("/json/ignores/save/{id}", jsonIgnoresUpdateHandler).Methods("POST")
+	update := func(id, body string) *httptest.ResponseRecorder {
+		r, err := http.NewRequest("POST", "/json/ignores/save/"+id, strings.NewReader(body))
+		assert.NoError(t, err)
+		cookie, err := login.CookieFor(&login.Session{
+			Email:     "carol@example.com",
+			AuthScope: login.DEFAULT_SCOPE[0],
+		})
+		assert.NoError(t, err)
+		r.AddCookie(cookie)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w
+	}
+
+	// An update which omits the owner and expiry action keeps them.
+	w := update("0", `{"duration": "2h", "filter": "config=gpu&os=linux", "note": "still flaky"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	rules, err := storages.IgnoreStore.List(false)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(rules))
+	assert.Equal(t, "config=gpu&os=linux", rules[0].Query)
+	assert.Equal(t, "still flaky", rules[0].Note)
+	assert.Equal(t, "alice@example.com", rules[0].Name)
+	assert.Equal(t, "carol@example.com", rules[0].UpdatedBy)
+	assert.Equal(t, "bob@example.com", rules[0].Owner)
+	assert.Equal(t, ignore.EXPIRY_EXTEND, rules[0].ExpiryAction)
+
+	// An update which sets them changes them.
+	w = update("0", `{"duration": "2h", "filter": "config=gpu", "owner": "carol@example.com", "expiryAction": "negative"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	rules, err = storages.IgnoreStore.List(false)
+	assert.NoError(t, err)
+	assert.Equal(t, "carol@example.com", rules[0].Owner)
+	assert.Equal(t, ignore.EXPIRY_NEGATIVE, rules[0].ExpiryAction)
+
+	// Unknown rules can't be updated.
+	w = update("5", `{"duration": "2h", "filter": "config=gpu"}`)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+}
@@ -17,6 +17,7 @@ import (
 	"go.skia.org/infra/go/auth"
 	"go.skia.org/infra/go/common"
 	"go.skia.org/infra/go/database"
+	"go.skia.org/infra/go/email"
 	"go.skia.org/infra/go/eventbus"
 	"go.skia.org/infra/go/gerrit"
 	"go.skia.org/infra/go/git/gitinfo"
@@ -27,9 +28,13 @@ import (
 	"go.skia.org/infra/go/metadata"
 	"go.skia.org/infra/go/rietveld"
 	"go.skia.org/infra/go/skiaversion"
+	"go.skia.org/infra/go/tiling"
 	"go.skia.org/infra/go/timer"
 	tracedb "go.skia.org/infra/go/trace/db"
 	"go.skia.org/infra/go/util"
+	"go.skia.org/infra/go/webhook"
+	"go.skia.org/infra/golden/go/autotriage"
+	"go.skia.org/infra/golden/go/blame"
 	"go.skia.org/infra/golden/go/db"
 	"go.skia.org/infra/golden/go/diffstore"
 	"go.skia.org/infra/golden/go/digeststore"
@@ -48,15 +53,23 @@ import (
 // Command line flags.
 var (
 	authWhiteList      = flag.String("auth_whitelist", login.DEFAULT_DOMAIN_WHITELIST, "White space separated list of domains and email addresses that are allowed to login.")
+	autoTriageRules    = flag.String("auto_triage_rules", "", "Path to a JSON file with a list of rules for automatically triaging untriaged digests which are very similar to a positive digest. Auto-triage is disabled if empty.")
 	cacheSize          = flag.Int("cache_size", 1, "Approximate cachesize used to cache images and diff metrics in GiB. This is just a way to limit caching. 0 means no caching at all. Use default for testing.")
 	cpuProfile         = flag.Duration("cpu_profile", 0, "Duration for which to profile the CPU usage. After this duration the program writes the CPU profile and exits.")
 	doOauth            = flag.Bool("oauth", true, "Run through the OAuth 2.0 flow on startup, otherwise use a GCE service account.")
+	emailClientID      = flag.String("email_clientid", "", "OAuth Client ID for sending email to the owners of expiring ignore rules and to status subscribers. No emails are sent if empty.")
+	emailClientSecret  = flag.String("email_clientsecret", "", "OAuth Client Secret for sending email.")
+	emailTokenCache    = flag.String("email_token_cache_file", "google_email_token.data", "Path to the file where to cache the email OAuth token.")
+	expireIgnores      = flag.Bool("expire_ignores", false, "Apply the expiry actions of ignore rules and notify their owners. Only one instance sharing a database should set this.")
 	forceLogin         = flag.Bool("force_login", false, "Force the user to be authenticated for all requests.")
 	gsBucketNames      = flag.String("gs_buckets", "skia-infra-gm,chromium-skia-gm", "Comma-separated list of google storage bucket that hold uploaded images.")
 	imageDir           = flag.String("image_dir", "/tmp/imagedir", "What directory to store test and diff images in.")
+	imageSourceDir     = flag.String("image_source_dir", "", "Local directory that holds the uploaded images as <digest>.png. If set, images are not retrieved from Google storage.")
+	imageSourceURL     = flag.String("image_source_url", "", "URL of an HTTP server that serves the uploaded images as <url>/<digest>.png. If set, images are not retrieved from Google storage.")
 	issueTrackerKey    = flag.String("issue_tracker_key", "", "API Key for accessing the project hosting API.")
 	local              = flag.Bool("local", false, "Running locally if true. As opposed to in production.")
 	memProfile         = flag.Duration("memprofile", 0, "Duration for which to profile memory. After this duration the program writes the memory profile and exits.")
+	mergeLandedIssues  = flag.Bool("merge_landed_issues", false, "Merge the expectations of trybot issues into master once they land. Only one instance sharing a database should set this.")
 	nCommits           = flag.Int("n_commits", 50, "Number of recent commits to include in the analysis.")
 	nTilesToBackfill   = flag.Int("backfill_tiles", 0, "Number of tiles to backfill in our history of tiles.")
 	oauthCacheFile     = flag.String("oauth_cache_file", "/home/perf/google_storage_token.data", "Path to the file where to cache cache the oauth credentials.")
@@ -68,6 +81,7 @@ var (
 	storageDir         = flag.String("storage_dir", "/tmp/gold-storage", "Directory to store reproducible application data.")
 	gitRepoDir         = flag.String("git_repo_dir", "../../../skia", "Directory location for the Skia repo.")
 	gitRepoURL         = flag.String("git_repo_url", "https://skia.googlesource.com/skia", "The URL to pass to git clone for the source repository.")
+	statusSubs         = flag.String("status_subscriptions", "", "Path to a JSON file with a list of subscriptions to notify via webhooks or email when the number of untriaged digests in a corpus goes past a threshold. No notifications are sent if empty.")
 	serviceAccountFile = flag.String("service_account_file", "", "Credentials file for service account.")
 	traceservice       = flag.String("trace_service", "localhost:10000", "The address of the traceservice endpoint.")
 
@@ -168,7 +182,20 @@ func main() {
 	}
 
 	// Get the expecations storage, the filediff storage and the tilestore.
-	diffStore, err := diffstore.New(client, *imageDir, strings.Split(*gsBucketNames, ","), diffstore.DEFAULT_GS_IMG_DIR_NAME, *cacheSize)
+	var imgSource diffstore.ImageSource
+	switch {
+	case *imageSourceDir != "" && *imageSourceURL != "":
+		glog.Fatal("Only one of --image_source_dir and --image_source_url can be set.")
+	case *imageSourceDir != "":
+		imgSource = diffstore.NewLocalImageSource(*imageSourceDir)
+	case *imageSourceURL != "":
+		imgSource = diffstore.NewHTTPImageSource(httputils.NewTimeoutClient(), *imageSourceURL)
+	default:
+		if imgSource, err = diffstore.NewGSImageSource(client, strings.Split(*gsBucketNames, ","), diffstore.DEFAULT_GS_IMG_DIR_NAME); err != nil {
+			glog.Fatalf("Unable to create image source: %s", err)
+		}
+	}
+	diffStore, err := diffstore.New(imgSource, *imageDir, *cacheSize)
 	if err != nil {
 		glog.Fatalf("Allocating DiffStore failed: %s", err)
 	}
@@ -187,10 +214,9 @@ func main() {
 		glog.Fatal("Wrong DB version. Please updated to latest version.")
 	}
 
-	digestStore, err := digeststore.New(*storageDir)
-	if err != nil {
-		glog.Fatal(err)
-	}
+	// The digest store is kept in the database, so that multiple instances
+	// can share it.
+	digestStore := digeststore.NewSQLDigestStore(vdb)
 
 	git, err := gitinfo.CloneOrUpdate(*gitRepoURL, *gitRepoDir, false)
 	if err != nil {
@@ -245,6 +271,40 @@ func main() {
 		glog.Fatalf("Failed to start monitoring for expired ignore rules: %s", err)
 	}
 
+	// The emailer notifies the owners of expiring ignore rules and status
+	// subscribers.
+	var emailer email.Emailer
+	if *emailClientID != "" {
+		gmail, err := email.NewGMail(*emailClientID, *emailClientSecret, *emailTokenCache)
+		if err != nil {
+			glog.Fatalf("Failed to create email auth: %s", err)
+		}
+		emailer = gmail
+	}
+
+	// Apply the expiry actions of ignore rules and notify their owners.
+	if *expireIgnores {
+		ignoresURL := strings.TrimSuffix(useRedirectURL, OAUTH2_CALLBACK_PATH) + "/ignores"
+		ignore.NewExpirer(storages.IgnoreStore, storages.ExpectationsStore, storages.GetLastTileTrimmed, emailer, ignoresURL).Start(time.Hour)
+	}
+
+	// Merge the expectations of trybot issues into master once they land.
+	if *mergeLandedIssues {
+		trybot.StartMergingLandedIssues(storages.ExpectationsStore, storages.TrybotResults.IsCommitted, 5*time.Minute)
+	}
+
+	// Auto-triage digests whenever the index is rebuilt.
+	if *autoTriageRules != "" {
+		rules, err := autotriage.LoadRules(*autoTriageRules)
+		if err != nil {
+			glog.Fatalf("Failed to load auto-triage rules: %s", err)
+		}
+		if _, err := autotriage.New(storages, rules); err != nil {
+			glog.Fatalf("Failed to start auto-triage: %s", err)
+		}
+		glog.Infof("Loaded %d auto-triage rules.", len(rules))
+	}
+
 	// Rebuild the index every two minutes.
 	ixr, err = indexer.New(storages, 2*time.Minute)
 	if err != nil {
@@ -261,6 +321,26 @@ func main() {
 	if err != nil {
 		glog.Fatalf("Failed to initialize status watcher: %s", err)
 	}
+
+	// Notify subscribers when new untriaged digests show up.
+	if *statusSubs != "" {
+		subs, err := status.LoadSubscriptions(*statusSubs)
+		if err != nil {
+			glog.Fatalf("Failed to load status subscriptions: %s", err)
+		}
+		if *local {
+			webhook.InitRequestSaltForTesting()
+		} else {
+			webhook.MustInitRequestSaltFromMetadata()
+		}
+		blameFn := func(test, digest string, commits []*tiling.Commit) *blame.BlameDistribution {
+			return ixr.GetIndex().GetBlame(test, digest, commits)
+		}
+		baseURL := strings.TrimSuffix(useRedirectURL, OAUTH2_CALLBACK_PATH)
+		notifier := status.NewNotifier(subs, blameFn, emailer, httputils.NewTimeoutClient(), baseURL)
+		statusWatcher.AddListener(notifier.OnStatusChange)
+		glog.Infof("Loaded %d status subscriptions.", len(subs))
+	}
 	mainTimer.Stop()
 
 	router := mux.NewRouter()
@@ -287,13 +367,17 @@ func main() {
 	router.HandleFunc("/json/list", jsonListTestsHandler).Methods("GET")
 	router.HandleFunc("/json/paramset", jsonParamsHandler).Methods("GET")
 	router.HandleFunc("/json/search", jsonSearchHandler).Methods("GET")
+	router.HandleFunc("/json/commitrange", jsonCommitRangeHandler).Methods("GET")
 	router.HandleFunc("/json/diff", jsonDiffHandler).Methods("GET")
 	router.HandleFunc("/json/details", jsonDetailsHandler).Methods("GET")
 	router.HandleFunc("/json/ignores", jsonIgnoresHandler).Methods("GET")
 	router.HandleFunc("/json/ignores/add/", jsonIgnoresAddHandler).Methods("POST")
 	router.HandleFunc("/json/ignores/del/{id}", jsonIgnoresDeleteHandler).Methods("POST")
 	router.HandleFunc("/json/ignores/save/{id}", jsonIgnoresUpdateHandler).Methods("POST")
+	router.HandleFunc("/json/flaky", jsonFlakyHandler).Methods("GET")
 	router.HandleFunc("/json/triage", jsonTriageHandler).Methods("POST")
+	router.HandleFunc("/json/expectations/export", jsonExportExpectationsHandler).Methods("GET")
+	router.HandleFunc("/json/expectations/import", jsonImportExpectationsHandler).Methods("POST")
 	router.HandleFunc("/json/clusterdiff", jsonClusterDiffHandler).Methods("GET")
 	router.HandleFunc("/json/cmp/{test}", jsonCompareTestHandler).Methods("POST")
 	router.HandleFunc("/json/triagelog", jsonTriageLogHandler).Methods("GET")
@@ -0,0 +1,270 @@
+package status
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+
+	"github.com/skia-dev/glog"
+	"go.skia.org/infra/go/email"
+	"go.skia.org/infra/go/tiling"
+	"go.skia.org/infra/go/util"
+	"go.skia.org/infra/go/webhook"
+	"go.skia.org/infra/golden/go/blame"
+	"go.skia.org/infra/golden/go/types"
+)
+
+const (
+	// MAX_BLAMED_COMMITS is the maximum number of blamed commits included in
+	// a notification.
+	MAX_BLAMED_COMMITS = 20
+)
+
+var emailTemplate = template.Must(template.New("statusNotification").Parse(`
+The corpus <b>{{.Corpus}}</b> now has {{.UntriagedCount}} untriaged digests
+(previously {{.PrevUntriagedCount}}).
+<br><br>
+{{if .Commits}}
+Likely caused by:<br>
+{{range .Commits}}{{.Hash}} by {{.Author}}<br>
+{{end}}
+<br>
+{{end}}
+<a href="{{.URL}}">Triage the digests</a>
+`))
+
+// Subscription defines who is notified when the number of untriaged digests
+// in a corpus goes past a threshold.
+type Subscription struct {
+	// Corpus restricts the subscription to this corpus. All corpora are
+	// watched if empty.
+	Corpus string `json:"corpus"`
+
+	// Threshold is the number of untriaged digests that has to be exceeded
+	// for a notification to be sent. With a threshold of 0 a notification is
+	// sent whenever the untriaged count goes from zero to non-zero.
+	Threshold int `json:"threshold"`
+
+	// Webhooks are URLs that receive a signed POST request with a
+	// Notification in JSON format.
+	Webhooks []string `json:"webhooks"`
+
+	// Emails are the addresses that receive an email notification.
+	Emails []string `json:"emails"`
+}
+
+// Validate returns an error if the subscription is not valid.
+func (s *Subscription) Validate() error {
+	if s.Threshold < 0 {
+		return fmt.Errorf("Status subscription for corpus %q has a negative threshold.", s.Corpus)
+	}
+	if len(s.Webhooks) == 0 && len(s.Emails) == 0 {
+		return fmt.Errorf("Status subscription for corpus %q has neither webhooks nor emails.", s.Corpus)
+	}
+	return nil
+}
+
+// ReadSubscriptions reads a JSON array of subscriptions from the given reader
+// and validates them.
+func ReadSubscriptions(r io.Reader) ([]*Subscription, error) {
+	var subs []*Subscription
+	if err := json.NewDecoder(r).Decode(&subs); err != nil {
+		return nil, fmt.Errorf("Failed to decode status subscriptions: %s", err)
+	}
+	for _, sub := range subs {
+		if err := sub.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	return subs, nil
+}
+
+// LoadSubscriptions reads the subscriptions from the given JSON file. See
+// ReadSubscriptions.
+func LoadSubscriptions(path string) ([]*Subscription, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer util.Close(f)
+	return ReadSubscriptions(f)
+}
+
+// Notification is sent to subscribers when the untriaged count of a corpus
+// goes past the threshold of their subscription. It is the body of webhook
+// requests.
+type Notification struct {
+	Corpus             string           `json:"corpus"`
+	UntriagedCount     int              `json:"untriagedCount"`
+	PrevUntriagedCount int              `json:"prevUntriagedCount"`
+	Threshold          int              `json:"threshold"`
+	Commits            []*tiling.Commit `json:"commits"` // Commits blamed for the untriaged digests.
+	URL                string           `json:"url"`
+}
+
+// BlameFn returns the indices of the given commits that likely caused the
+// digest of the test. It is implemented by indexer.SearchIndex.GetBlame.
+type BlameFn func(test, digest string, commits []*tiling.Commit) *blame.BlameDistribution
+
+// Notifier notifies subscribers about status changes. It is registered with a
+// StatusWatcher via AddListener.
+type Notifier struct {
+	subs    []*Subscription
+	blameFn BlameFn
+	emailer email.Emailer
+	client  *http.Client
+	baseURL string
+}
+
+// NewNotifier creates a new Notifier. If emailer is nil no emails are sent.
+// Webhook requests are signed with go/webhook, so the request salt has to be
+// initialized if any subscription has webhooks. baseURL is the URL of the
+// Gold instance and is used to link to the untriaged digests.
+func NewNotifier(subs []*Subscription, blameFn BlameFn, emailer email.Emailer, client *http.Client, baseURL string) *Notifier {
+	return &Notifier{
+		subs:    subs,
+		blameFn: blameFn,
+		emailer: emailer,
+		client:  client,
+		baseURL: baseURL,
+	}
+}
+
+// OnStatusChange sends notifications for all subscriptions whose threshold
+// was crossed by the given change. It implements StatusListener.
+func (n *Notifier) OnStatusChange(change *StatusChange) {
+	// Without a previous status we don't know whether a threshold was crossed.
+	if change.Prev == nil {
+		return
+	}
+
+	prevCounts := map[string]int{}
+	for _, cs := range change.Prev.CorpStatus {
+		prevCounts[cs.Name] = cs.UntriagedCount
+	}
+
+	for _, cs := range change.Current.CorpStatus {
+		prev := prevCounts[cs.Name]
+		for _, sub := range n.subs {
+			if (sub.Corpus != "" && sub.Corpus != cs.Name) || (prev > sub.Threshold) || (cs.UntriagedCount <= sub.Threshold) {
+				continue
+			}
+			notification := &Notification{
+				Corpus:             cs.Name,
+				UntriagedCount:     cs.UntriagedCount,
+				PrevUntriagedCount: prev,
+				Threshold:          sub.Threshold,
+				Commits:            n.blamedCommits(change.Untriaged[cs.Name], change.Commits),
+				URL:                n.searchURL(cs.Name),
+			}
+			if err := n.send(sub, notification); err != nil {
+				glog.Errorf("Failed to notify subscribers of corpus %q: %s", cs.Name, err)
+			}
+		}
+	}
+}
+
+// searchURL returns the URL of the untriaged digests at HEAD in the corpus.
+func (n *Notifier) searchURL(corpus string) string {
+	query := url.Values{types.CORPUS_FIELD: []string{corpus}}
+	params := url.Values{
+		"query": []string{query.Encode()},
+		"unt":   []string{"true"},
+		"head":  []string{"true"},
+	}
+	return n.baseURL + "/search?" + params.Encode()
+}
+
+// blamedCommits returns the commits that are blamed for the given untriaged
+// digests, most recent first.
+func (n *Notifier) blamedCommits(untriaged map[string]util.StringSet, commits []*tiling.Commit) []*tiling.Commit {
+	if n.blameFn == nil {
+		return []*tiling.Commit{}
+	}
+
+	indices := map[int]bool{}
+	for test, digests := range untriaged {
+		for digest := range digests {
+			for _, idx := range n.blameFn(test, digest, commits).Freq {
+				indices[idx] = true
+			}
+		}
+	}
+
+	sorted := make([]int, 0, len(indices))
+	for idx := range indices {
+		sorted = append(sorted, idx)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(sorted)))
+
+	ret := make([]*tiling.Commit, 0, util.MinInt(len(sorted), MAX_BLAMED_COMMITS))
+	for _, idx := range sorted {
+		if len(ret) >= MAX_BLAMED_COMMITS {
+			break
+		}
+		ret = append(ret, commits[idx])
+	}
+	return ret
+}
+
+// send delivers the notification to the webhooks and emails of the
+// subscription. It keeps going if a single delivery fails.
+func (n *Notifier) send(sub *Subscription, notification *Notification) error {
+	var lastErr error
+	if len(sub.Webhooks) > 0 {
+		body, err := json.Marshal(notification)
+		if err != nil {
+			return fmt.Errorf("Failed to encode notification: %s", err)
+		}
+		for _, hookURL := range sub.Webhooks {
+			if err := n.postWebhook(hookURL, body); err != nil {
+				glog.Errorf("Failed to call webhook %s: %s", hookURL, err)
+				lastErr = err
+			}
+		}
+	}
+
+	if (len(sub.Emails) > 0) && (n.emailer != nil) {
+		var body bytes.Buffer
+		if err := emailTemplate.Execute(&body, notification); err != nil {
+			return fmt.Errorf("Unable to render email: %s", err)
+		}
+		subject := fmt.Sprintf("%d untriaged digests in %s", notification.UntriagedCount, notification.Corpus)
+		if err := n.emailer.Send(types.EMAIL_SENDER_DISPLAY_NAME, sub.Emails, subject, body.String()); err != nil {
+			glog.Errorf("Failed to send email to %v: %s", sub.Emails, err)
+			lastErr = err
+		}
+	}
+	return lastErr
+}
+
+// postWebhook sends the body to the given URL, signed with go/webhook.
+func (n *Notifier) postWebhook(hookURL string, body []byte) error {
+	hash, err := webhook.ComputeAuthHashBase64(body)
+	if err != nil {
+		return fmt.Errorf("Could not compute authentication hash: %s", err)
+	}
+	req, err := http.NewRequest("POST", hookURL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("Could not create HTTP request: %s", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(webhook.REQUEST_AUTH_HASH_HEADER, hash)
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer util.Close(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		response, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("POST %s returned %d: %s", hookURL, resp.StatusCode, response)
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package status
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	assert "github.com/stretchr/testify/require"
+	"go.skia.org/infra/go/testutils"
+	"go.skia.org/infra/go/tiling"
+	"go.skia.org/infra/go/util"
+	"go.skia.org/infra/go/webhook"
+	"go.skia.org/infra/golden/go/blame"
+)
+
+type sentEmail struct {
+	to      []string
+	subject string
+	body    string
+}
+
+type mockEmailer struct {
+	sent []sentEmail
+}
+
+func (m *mockEmailer) Send(senderDisplayName string, to []string, subject string, body string) error {
+	m.sent = append(m.sent, sentEmail{to: to, subject: subject, body: body})
+	return nil
+}
+
+func TestReadSubscriptions(t *testing.T) {
+	testutils.SmallTest(t)
+
+	subs, err := ReadSubscriptions(strings.NewReader(`[{"corpus": "gm", "threshold": 5, "emails": ["jon@example.com"]}]`))
+	assert.NoError(t, err)
+	assert.Equal(t, []*Subscription{{Corpus: "gm", Threshold: 5, Emails: []string{"jon@example.com"}}}, subs)
+
+	_, err = ReadSubscriptions(strings.NewReader(`[{"corpus": "gm"}]`))
+	assert.Error(t, err)
+	_, err = ReadSubscriptions(strings.NewReader(`[{"threshold": -1, "emails": ["jon@example.com"]}]`))
+	assert.Error(t, err)
+}
+
+func TestNotifier(t *testing.T) {
+	testutils.SmallTest(t)
+
+	webhook.InitRequestSaltForTesting()
+	received := []*Notification{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, err := webhook.AuthenticateRequest(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		n := &Notification{}
+		assert.NoError(t, json.Unmarshal(data, n))
+		received = append(received, n)
+	}))
+	defer server.Close()
+
+	commits := []*tiling.Commit{
+		{Hash: "aaa", Author: "jon@example.com", CommitTime: 1},
+		{Hash: "bbb", Author: "jim@example.com", CommitTime: 2},
+		{Hash: "ccc", Author: "joe@example.com", CommitTime: 3},
+	}
+	blameFn := func(test, digest string, c []*tiling.Commit) *blame.BlameDistribution {
+		if digest == "d1" {
+			return &blame.BlameDistribution{Freq: []int{1}}
+		}
+		return &blame.BlameDistribution{Freq: []int{1, 2}}
+	}
+
+	subs := []*Subscription{
+		{Corpus: "gm", Webhooks: []string{server.URL}},
+		{Threshold: 2, Emails: []string{"jon@example.com"}},
+	}
+	emailer := &mockEmailer{}
+	notifier := NewNotifier(subs, blameFn, emailer, http.DefaultClient, "https://gold.skia.org")
+
+	status := func(gm, svg int) *GUIStatus {
+		return &GUIStatus{
+			CorpStatus: []*GUICorpusStatus{
+				{Name: "gm", UntriagedCount: gm},
+				{Name: "svg", UntriagedCount: svg},
+			},
+		}
+	}
+	untriaged := map[string]map[string]util.StringSet{
+		"gm":  {"foo": util.NewStringSet([]string{"d1", "d2"})},
+		"svg": {"bar": util.NewStringSet([]string{"d1"})},
+	}
+
+	// No notifications for the first status.
+	notifier.OnStatusChange(&StatusChange{Current: status(1, 5), Commits: commits, Untriaged: untriaged})
+	assert.Equal(t, 0, len(received))
+	assert.Equal(t, 0, len(emailer.sent))
+
+	// gm goes from zero to non-zero, svg past the threshold.
+	notifier.OnStatusChange(&StatusChange{Prev: status(0, 2), Current: status(1, 5), Commits: commits, Untriaged: untriaged})
+	assert.Equal(t, 1, len(received))
+	assert.Equal(t, "gm", received[0].Corpus)
+	assert.Equal(t, 1, received[0].UntriagedCount)
+	assert.Equal(t, 0, received[0].PrevUntriagedCount)
+	assert.Equal(t, []*tiling.Commit{commits[2], commits[1]}, received[0].Commits)
+	assert.True(t, strings.HasPrefix(received[0].URL, "https://gold.skia.org/search?"))
+
+	assert.Equal(t, 1, len(emailer.sent))
+	assert.Equal(t, []string{"jon@example.com"}, emailer.sent[0].to)
+	assert.Equal(t, "5 untriaged digests in svg", emailer.sent[0].subject)
+	assert.Contains(t, emailer.sent[0].body, "bbb by jim@example.com")
+	assert.NotContains(t, emailer.sent[0].body, "ccc")
+
+	// Counts that stay above the thresholds don't trigger notifications.
+	notifier.OnStatusChange(&StatusChange{Prev: status(1, 5), Current: status(2, 6), Commits: commits, Untriaged: untriaged})
+	assert.Equal(t, 1, len(received))
+	assert.Equal(t, 1, len(emailer.sent))
+}
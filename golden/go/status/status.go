@@ -71,11 +71,32 @@ func (c CorpusStatusSorter) Len() int           { return len(c) }
 func (c CorpusStatusSorter) Less(i, j int) bool { return c[i].Name < c[j].Name }
 func (c CorpusStatusSorter) Swap(i, j int)      { c[i], c[j] = c[j], c[i] }
 
+// StatusChange is passed to listeners whenever the status is recalculated.
+type StatusChange struct {
+	// Prev is the previous status. It is nil for the first status.
+	Prev *GUIStatus
+
+	// Current is the new status.
+	Current *GUIStatus
+
+	// Commits are the commits of the tile the status was calculated from.
+	Commits []*tiling.Commit
+
+	// Untriaged contains the untriaged digests at HEAD, keyed by corpus and
+	// test name.
+	Untriaged map[string]map[string]util.StringSet
+}
+
+// StatusListener is called with every status change. Listeners are called
+// in a separate go routine, so they can't delay the status calculation.
+type StatusListener func(change *StatusChange)
+
 type StatusWatcher struct {
 	storages *storage.Storage
 
-	current *GUIStatus
-	mutex   sync.Mutex
+	current   *GUIStatus
+	listeners []StatusListener
+	mutex     sync.Mutex
 }
 
 func New(storages *storage.Storage) (*StatusWatcher, error) {
@@ -96,6 +117,14 @@ func (s *StatusWatcher) GetStatus() *GUIStatus {
 	return s.current
 }
 
+// AddListener registers a listener that is called whenever the status is
+// recalculated.
+func (s *StatusWatcher) AddListener(listener StatusListener) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.listeners = append(s.listeners, listener)
+}
+
 func (s *StatusWatcher) calcAndWatchStatus() error {
 	expChanges := make(chan []string)
 	s.storages.EventBus.SubscribeAsync(expstorage.EV_EXPSTORAGE_CHANGED, func(e interface{}) {
@@ -154,6 +183,9 @@ func (s *StatusWatcher) calcStatus(tile *tiling.Tile) error {
 	// Gathers unique labels by corpus and label.
 	byCorpus := map[string]map[types.Label]map[string]bool{}
 
+	// Gathers the untriaged digests by corpus and test.
+	untriaged := map[string]map[string]util.StringSet{}
+
 	// Iterate over the current traces
 	tileLen := tile.LastCommitIndex() + 1
 	for _, trace := range tile.Traces {
@@ -203,6 +235,15 @@ func (s *StatusWatcher) calcStatus(tile *tiling.Tile) error {
 			((status == types.NEGATIVE) && (len(digestInfo.IssueIDs) > 0)))
 		minCommitId[corpus] = util.MinInt(idx, minCommitId[corpus])
 		byCorpus[corpus][status][digest] = true
+		if status == types.UNTRIAGED {
+			if _, ok := untriaged[corpus]; !ok {
+				untriaged[corpus] = map[string]util.StringSet{}
+			}
+			if _, ok := untriaged[corpus][testName]; !ok {
+				untriaged[corpus][testName] = util.StringSet{}
+			}
+			untriaged[corpus][testName][digest] = true
+		}
 	}
 
 	commits := tile.Commits[:tileLen]
@@ -245,8 +286,19 @@ func (s *StatusWatcher) calcStatus(tile *tiling.Tile) error {
 		CorpStatus: corpStatus,
 	}
 	s.mutex.Lock()
+	change := &StatusChange{
+		Prev:      s.current,
+		Current:   result,
+		Commits:   commits,
+		Untriaged: untriaged,
+	}
 	s.current = result
+	listeners := s.listeners
 	s.mutex.Unlock()
 
+	for _, listener := range listeners {
+		go listener(change)
+	}
+
 	return nil
 }
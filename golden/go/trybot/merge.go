@@ -0,0 +1,82 @@
+package trybot
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/skia-dev/glog"
+	"go.skia.org/infra/go/metrics2"
+	"go.skia.org/infra/golden/go/expstorage"
+)
+
+const (
+	// MERGE_USER is the user under which the expectations of landed issues
+	// are added to the master expectations.
+	MERGE_USER = "landed-issue@skia.org"
+)
+
+// IsCommitted returns true if the given Rietveld or Gerrit issue has landed.
+func (t *TrybotResults) IsCommitted(issueID string) (bool, error) {
+	numIssueID, err := strconv.ParseInt(issueID, 10, 64)
+	if err != nil {
+		return false, err
+	}
+
+	if _, isGerrit := t.getPrefix(numIssueID); isGerrit {
+		issue, err := t.gerritAPI.GetIssueProperties(numIssueID)
+		if err != nil {
+			return false, err
+		}
+		return issue.Committed, nil
+	}
+
+	issue, err := t.rietveldAPI.GetIssueProperties(numIssueID, false)
+	if err != nil {
+		return false, err
+	}
+	return issue.Committed, nil
+}
+
+// MergeLandedIssues adds the expectations of all issues for which isCommitted
+// returns true to the master expectations. It returns the ids of the issues
+// that were merged.
+func MergeLandedIssues(expStore expstorage.ExpectationsStore, isCommitted func(issueID string) (bool, error)) ([]string, error) {
+	issueIDs, err := expStore.IssueIDs()
+	if err != nil {
+		return nil, fmt.Errorf("Unable to list issues with expectations: %s", err)
+	}
+
+	merged := []string{}
+	for _, issueID := range issueIDs {
+		committed, err := isCommitted(issueID)
+		if err != nil {
+			glog.Errorf("Unable to determine whether issue %s has landed: %s", issueID, err)
+			continue
+		}
+		if !committed {
+			continue
+		}
+		if err := expStore.MergeIssue(issueID, MERGE_USER); err != nil {
+			return merged, fmt.Errorf("Unable to merge expectations of issue %s: %s", issueID, err)
+		}
+		glog.Infof("Merged expectations of landed issue %s.", issueID)
+		merged = append(merged, issueID)
+	}
+	return merged, nil
+}
+
+// StartMergingLandedIssues calls MergeLandedIssues in the background every
+// interval.
+func StartMergingLandedIssues(expStore expstorage.ExpectationsStore, isCommitted func(issueID string) (bool, error), interval time.Duration) {
+	liveness := metrics2.NewLiveness("gold.merge-landed-issues")
+	go func() {
+		for _ = range time.Tick(interval) {
+			if _, err := MergeLandedIssues(expStore, isCommitted); err != nil {
+				glog.Errorf("Failed to merge expectations of landed issues: %s", err)
+				continue
+			}
+			liveness.Reset()
+		}
+	}()
+}
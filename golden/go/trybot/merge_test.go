@@ -0,0 +1,43 @@
+package trybot
+
+import (
+	"fmt"
+	"testing"
+
+	assert "github.com/stretchr/testify/require"
+	"go.skia.org/infra/go/testutils"
+	"go.skia.org/infra/golden/go/expstorage"
+	"go.skia.org/infra/golden/go/types"
+)
+
+func TestMergeLandedIssues(t *testing.T) {
+	testutils.SmallTest(t)
+	expStore := expstorage.NewMemExpectationsStore(nil)
+	for issueID, digest := range map[string]string{"1": "d1", "2": "d2", "3": "d3"} {
+		assert.NoError(t, expStore.AddIssueChange(issueID, map[string]types.TestClassification{
+			"test": {digest: types.POSITIVE},
+		}, "user@example.com"))
+	}
+
+	// Issue 1 has landed, issue 2 hasn't, and the status of issue 3 can't be
+	// determined.
+	isCommitted := func(issueID string) (bool, error) {
+		if issueID == "3" {
+			return false, fmt.Errorf("Unknown issue.")
+		}
+		return issueID == "1", nil
+	}
+	merged, err := MergeLandedIssues(expStore, isCommitted)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"1"}, merged)
+
+	exp, err := expStore.Get()
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]types.TestClassification{"test": {"d1": types.POSITIVE}}, exp.Tests)
+	issueExp, err := expStore.GetIssue("1")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(issueExp.Tests))
+	issueExp, err = expStore.GetIssue("2")
+	assert.NoError(t, err)
+	assert.Equal(t, types.POSITIVE, issueExp.Classification("test", "d2"))
+}
@@ -21,6 +21,9 @@ const (
 
 	// Field that contains the corpus identifier.
 	CORPUS_FIELD = "source_type"
+
+	// EMAIL_SENDER_DISPLAY_NAME is the sender of notification emails.
+	EMAIL_SENDER_DISPLAY_NAME = "Gold"
 )
 
 // Label for classifying digests.
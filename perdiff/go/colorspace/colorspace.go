@@ -0,0 +1,61 @@
+// colorspace contains the color space conversions used for perceptual
+// differencing of images.
+package colorspace
+
+import (
+	"math"
+)
+
+var xWhite, yWhite, zWhite float64
+
+func init() {
+	xWhite, yWhite, zWhite = ConvertAdobeRGBToXYZ(1, 1, 1)
+}
+
+// ConvertAdobeRGBToXYZ converts Adobe RGB (1998) with reference white D65 to
+// XYZ. The RGB components are in [0, 1].
+func ConvertAdobeRGBToXYZ(r, g, b float64) (x, y, z float64) {
+	// matrix is from http://www.brucelindbloom.com/
+	x = r*0.576700 + g*0.185556 + b*0.188212
+	y = r*0.297361 + g*0.627355 + b*0.0752847
+	z = r*0.0270328 + g*0.0706879 + b*0.991248
+	return
+}
+
+// ConvertXYZToLAB converts XYZ to CIE L*a*b*, relative to the reference white
+// of ConvertAdobeRGBToXYZ.
+func ConvertXYZToLAB(x, y, z float64) (L, A, B float64) {
+	const epsilon = 216.0 / 24389.0
+	const kappa = 24389.0 / 27.0
+
+	var f, r [3]float64
+	r[0] = x / xWhite
+	r[1] = y / yWhite
+	r[2] = z / zWhite
+	for i := 0; i < 3; i++ {
+		if r[i] > epsilon {
+			f[i] = math.Pow(r[i], 1.0/3.0)
+		} else {
+			f[i] = (kappa*r[i] + 16.0) / 116.0
+		}
+	}
+	L = 116.0*f[1] - 16.0
+	A = 500.0 * (f[0] - f[1])
+	B = 200.0 * (f[1] - f[2])
+	return
+}
+
+// ConvertRGBToLAB converts Adobe RGB (1998) to CIE L*a*b*. The RGB components
+// are in [0, 1].
+func ConvertRGBToLAB(r, g, b float64) (L, A, B float64) {
+	return ConvertXYZToLAB(ConvertAdobeRGBToXYZ(r, g, b))
+}
+
+// DeltaE returns the CIE76 color difference between two L*a*b* colors. A
+// difference of about 2.3 is just noticeable.
+func DeltaE(L1, A1, B1, L2, A2, B2 float64) float64 {
+	dL := L1 - L2
+	dA := A1 - A2
+	dB := B1 - B2
+	return math.Sqrt(dL*dL + dA*dA + dB*dB)
+}
@@ -2,6 +2,8 @@ package main
 
 import (
 	"math"
+
+	"go.skia.org/infra/perdiff/go/colorspace"
 )
 
 func applyColorMapping(src *FloatImage, fn func(r, g, b, a float64) (outr, outg, outb, outa float64)) *FloatImage {
@@ -72,8 +74,8 @@ func AdjustGamma(img *FloatImage, gamma float64) *FloatImage {
 func RGBAToLAB(img *FloatImage) *FloatImage {
 	fn := func(r, g, b, a float64) (float64, float64, float64, float64) {
 
-		x, y, z := ConvertAdobeRGBToXYZ(r, g, b)
-		l, a, b := ConvertXYZToLAB(x, y, z)
+		x, y, z := colorspace.ConvertAdobeRGBToXYZ(r, g, b)
+		l, a, b := colorspace.ConvertXYZToLAB(x, y, z)
 
 		return l, a, b, 1.0
 	}
@@ -84,7 +86,7 @@ func RGBAToLAB(img *FloatImage) *FloatImage {
 func RGBAToXYZ(img *FloatImage) *FloatImage {
 	fn := func(r, g, b, a float64) (float64, float64, float64, float64) {
 
-		x, y, z := ConvertAdobeRGBToXYZ(r, g, b)
+		x, y, z := colorspace.ConvertAdobeRGBToXYZ(r, g, b)
 
 		return x, y, z, 1
 	}
@@ -94,46 +96,10 @@ func RGBAToXYZ(img *FloatImage) *FloatImage {
 
 func RGBAToY(img *FloatImage) *FloatGrayImage {
 	fn := func(r, g, b, a float64) float64 {
-		_, y, _ := ConvertAdobeRGBToXYZ(r, g, b)
+		_, y, _ := colorspace.ConvertAdobeRGBToXYZ(r, g, b)
 
 		return y
 	}
 
 	return applyColorMappingGray(img, fn)
 }
-
-// convert Adobe RGB (1998) with reference white D65 to XYZ
-func ConvertAdobeRGBToXYZ(r, g, b float64) (x, y, z float64) {
-	// matrix is from http://www.brucelindbloom.com/
-	x = r*0.576700 + g*0.185556 + b*0.188212
-	y = r*0.297361 + g*0.627355 + b*0.0752847
-	z = r*0.0270328 + g*0.0706879 + b*0.991248
-	return
-}
-
-var xWhite, yWhite, zWhite float64
-
-func init() {
-	xWhite, yWhite, zWhite = ConvertAdobeRGBToXYZ(1, 1, 1)
-}
-
-func ConvertXYZToLAB(x, y, z float64) (L, A, B float64) {
-	const epsilon = 216.0 / 24389.0
-	const kappa = 24389.0 / 27.0
-
-	var f, r [3]float64
-	r[0] = x / xWhite
-	r[1] = y / yWhite
-	r[2] = z / zWhite
-	for i := 0; i < 3; i++ {
-		if r[i] > epsilon {
-			f[i] = math.Pow(r[i], 1.0/3.0)
-		} else {
-			f[i] = (kappa*r[i] + 16.0) / 116.0
-		}
-	}
-	L = 116.0*f[1] - 16.0
-	A = 500.0 * (f[0] - f[1])
-	B = 200.0 * (f[1] - f[2])
-	return
-}
@@ -0,0 +1,292 @@
+package alerts
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"go.skia.org/infra/go/issues"
+	"go.skia.org/infra/go/metrics2"
+	"go.skia.org/infra/go/testutils"
+	"go.skia.org/infra/perf/go/clustering2"
+	"go.skia.org/infra/perf/go/dataframe"
+)
+
+func TestConfigValidate(t *testing.T) {
+	testutils.SmallTest(t)
+	valid := func() *Config {
+		cfg := NewConfig()
+		cfg.DisplayName = "Skps"
+		cfg.Query = "source_type=skp&sub_result=min_ms"
+		cfg.Owners = []string{"alice@example.com"}
+		return cfg
+	}
+	assert.NoError(t, valid().Validate())
+
+	cfg := valid()
+	cfg.DisplayName = ""
+	assert.Error(t, cfg.Validate())
+
+	cfg = valid()
+	cfg.Query = "%gh&%ij"
+	assert.Error(t, cfg.Validate())
+
+	cfg = valid()
+	cfg.Radius = 0
+	assert.Error(t, cfg.Validate())
+
+	cfg = valid()
+	cfg.K = -1
+	assert.Error(t, cfg.Validate())
+
+	cfg = valid()
+	cfg.Interesting = 0
+	assert.Error(t, cfg.Validate())
+
+	cfg = valid()
+	cfg.Direction = "SIDEWAYS"
+	assert.Error(t, cfg.Validate())
+
+	cfg = valid()
+	cfg.Owners = []string{}
+	assert.Error(t, cfg.Validate())
+}
+
+func summary(regression float32, offset int64) *clustering2.ClusterSummary {
+	return &clustering2.ClusterSummary{
+		Keys:      []string{fmt.Sprintf(",name=t%d,", offset)},
+		StepFit:   &clustering2.StepFit{Regression: regression},
+		StepPoint: &dataframe.ColumnHeader{Source: SOURCE, Offset: offset},
+		Num:       1,
+	}
+}
+
+func TestConfigMatches(t *testing.T) {
+	testutils.SmallTest(t)
+	cfg := NewConfig()
+	cfg.Interesting = 100
+
+	up := summary(-200, 0)
+	down := summary(200, 0)
+	small := summary(-50, 0)
+
+	assert.True(t, cfg.Matches(up))
+	assert.True(t, cfg.Matches(down))
+	assert.False(t, cfg.Matches(small))
+	assert.False(t, cfg.Matches(&clustering2.ClusterSummary{}))
+
+	cfg.Direction = UP
+	assert.True(t, cfg.Matches(up))
+	assert.False(t, cfg.Matches(down))
+
+	cfg.Direction = DOWN
+	assert.False(t, cfg.Matches(up))
+	assert.True(t, cfg.Matches(down))
+}
+
+// memRegression is a regression recorded in a memStore.
+type memRegression struct {
+	id       int64
+	cl       *clustering2.ClusterSummary
+	reported bool
+}
+
+// memStore is an in-memory Store.
+type memStore struct {
+	configs     []*Config
+	regressions map[string]*memRegression
+}
+
+func regressionKey(id int64, cl *clustering2.ClusterSummary) string {
+	return fmt.Sprintf("%d:%d:%s", id, cl.StepPoint.Offset, directionOf(cl))
+}
+
+func (m *memStore) List() ([]*Config, error) { return m.configs, nil }
+
+func (m *memStore) Get(id int64) (*Config, error) {
+	for _, cfg := range m.configs {
+		if cfg.ID == id {
+			return cfg, nil
+		}
+	}
+	return nil, fmt.Errorf("Not found.")
+}
+
+func (m *memStore) Save(cfg *Config) error { return nil }
+
+func (m *memStore) Delete(id int64) error { return nil }
+
+func (m *memStore) AddRegression(id int64, cl *clustering2.ClusterSummary) (bool, error) {
+	key := regressionKey(id, cl)
+	if _, ok := m.regressions[key]; ok {
+		return false, nil
+	}
+	m.regressions[key] = &memRegression{id: id, cl: cl}
+	return true, nil
+}
+
+func (m *memStore) SetReported(id int64, cl *clustering2.ClusterSummary) error {
+	m.regressions[regressionKey(id, cl)].reported = true
+	return nil
+}
+
+func (m *memStore) Unreported(id int64) ([]*clustering2.ClusterSummary, error) {
+	keys := []string{}
+	for key, r := range m.regressions {
+		if r.id == id && !r.reported {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	ret := []*clustering2.ClusterSummary{}
+	for _, key := range keys {
+		ret = append(ret, m.regressions[key].cl)
+	}
+	return ret, nil
+}
+
+type mockIssueTracker struct {
+	requests []issues.IssueRequest
+}
+
+func (m *mockIssueTracker) FromQuery(q string) ([]issues.Issue, error) { return nil, nil }
+
+func (m *mockIssueTracker) AddComment(id string, comment issues.CommentRequest) error { return nil }
+
+func (m *mockIssueTracker) AddIssue(issue issues.IssueRequest) error {
+	m.requests = append(m.requests, issue)
+	return nil
+}
+
+type sentEmail struct {
+	to      []string
+	subject string
+	body    string
+}
+
+type mockEmailer struct {
+	sent []sentEmail
+	err  error
+}
+
+func (m *mockEmailer) Send(senderDisplayName string, to []string, subject string, body string) error {
+	if m.err != nil {
+		return m.err
+	}
+	m.sent = append(m.sent, sentEmail{to: to, subject: subject, body: body})
+	return nil
+}
+
+func TestContinuous(t *testing.T) {
+	testutils.SmallTest(t)
+
+	byEmail := NewConfig()
+	byEmail.ID = 1
+	byEmail.DisplayName = "Skps"
+	byEmail.Query = "source_type=skp"
+	byEmail.Radius = 2
+	byEmail.Direction = UP
+	byEmail.Owners = []string{"alice@example.com"}
+
+	byIssue := NewConfig()
+	byIssue.ID = 2
+	byIssue.DisplayName = "Gms"
+	byIssue.Query = "source_type=gm"
+	byIssue.Radius = 2
+	byIssue.Owners = []string{"bob@example.com"}
+	byIssue.FileIssue = true
+
+	store := &memStore{
+		configs:     []*Config{byEmail, byIssue},
+		regressions: map[string]*memRegression{},
+	}
+	issueTracker := &mockIssueTracker{}
+	emailer := &mockEmailer{}
+
+	requests := []*clustering2.ClusterRequest{}
+	latest := 10
+	c := &Continuous{
+		store: store,
+		cluster: func(req *clustering2.ClusterRequest) (*clustering2.ClusterResponse, error) {
+			requests = append(requests, req)
+			return &clustering2.ClusterResponse{
+				Summary: &clustering2.ClusterSummaries{
+					Clusters: []*clustering2.ClusterSummary{
+						// Only the steps at the middle commit are reported.
+						summary(-500, int64(req.Offset)),
+						summary(500, int64(req.Offset)),
+						summary(-500, int64(req.Offset-1)),
+						summary(-50, int64(req.Offset)),
+					},
+				},
+			}, nil
+		},
+		latest: func() int {
+			return latest
+		},
+		issueTracker:       issueTracker,
+		emailer:            emailer,
+		perfURL:            "https://perf.skia.org",
+		last:               -1,
+		regressionsCounter: metrics2.GetCounter("perf.alerts.regressions.test", nil),
+	}
+
+	// The first step only evaluates the latest commit.
+	c.step()
+	assert.Equal(t, 2, len(requests))
+	assert.Equal(t, &clustering2.ClusterRequest{Source: SOURCE, Offset: 8, Radius: 2, Query: "source_type=skp"}, requests[0])
+	assert.Equal(t, &clustering2.ClusterRequest{Source: SOURCE, Offset: 8, Radius: 2, Query: "source_type=gm"}, requests[1])
+
+	assert.Equal(t, 1, len(emailer.sent))
+	assert.Equal(t, []string{"alice@example.com"}, emailer.sent[0].to)
+	assert.Equal(t, `Perf alert "Skps": step UP at commit 8`, emailer.sent[0].subject)
+	assert.True(t, strings.Contains(emailer.sent[0].body, "https://perf.skia.org/c/?"))
+
+	assert.Equal(t, 2, len(issueTracker.requests))
+	assert.Equal(t, "bob@example.com", issueTracker.requests[0].CC[0].Name)
+	assert.Equal(t, `Perf alert "Gms": step UP at commit 8`, issueTracker.requests[0].Summary)
+	assert.Equal(t, `Perf alert "Gms": step DOWN at commit 8`, issueTracker.requests[1].Summary)
+
+	// Nothing happens without a new commit.
+	c.step()
+	assert.Equal(t, 2, len(requests))
+
+	// Every new commit is evaluated.
+	latest = 12
+	c.step()
+	assert.Equal(t, 6, len(requests))
+	assert.Equal(t, 9, requests[2].Offset)
+	assert.Equal(t, 10, requests[4].Offset)
+	assert.Equal(t, 3, len(emailer.sent))
+	assert.Equal(t, 6, len(issueTracker.requests))
+
+	// Regressions that were already reported aren't reported again.
+	c.last = 11
+	c.step()
+	assert.Equal(t, 8, len(requests))
+	assert.Equal(t, 3, len(emailer.sent))
+	assert.Equal(t, 6, len(issueTracker.requests))
+
+	// A regression whose report failed is reported on the next step, even
+	// without a new commit.
+	emailer.err = fmt.Errorf("Failed to send.")
+	latest = 13
+	c.step()
+	assert.Equal(t, 10, len(requests))
+	assert.Equal(t, 3, len(emailer.sent))
+	unreported, err := store.Unreported(byEmail.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(unreported))
+
+	emailer.err = nil
+	c.step()
+	assert.Equal(t, 10, len(requests))
+	assert.Equal(t, 4, len(emailer.sent))
+	assert.Equal(t, `Perf alert "Skps": step UP at commit 11`, emailer.sent[3].subject)
+	unreported, err = store.Unreported(byEmail.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(unreported))
+}
@@ -0,0 +1,114 @@
+// alerts handles named alert configurations that are evaluated continuously
+// as new commits arrive.
+package alerts
+
+import (
+	"fmt"
+	"net/url"
+
+	"go.skia.org/infra/perf/go/clustering2"
+)
+
+// Direction is the direction of a step that an alert Config is interested in.
+type Direction string
+
+const (
+	// UP is a step up in the values, which usually looks like a performance
+	// regression.
+	UP Direction = "UP"
+
+	// DOWN is a step down in the values.
+	DOWN Direction = "DOWN"
+
+	// BOTH means steps in either direction are reported.
+	BOTH Direction = "BOTH"
+
+	// DEFAULT_RADIUS is the default number of commits on either side of the
+	// commit being evaluated.
+	DEFAULT_RADIUS = 10
+
+	// INVALID_ID is the ID of a Config that hasn't been stored yet.
+	INVALID_ID = -1
+)
+
+// Config is a named alert configuration. Every Config is run through
+// clustering2 for each new commit and the interesting clusters it finds are
+// reported to the owners.
+type Config struct {
+	ID          int64     `json:"id"`
+	DisplayName string    `json:"display_name"`
+	Query       string    `json:"query"`       // The query used to select the traces to cluster.
+	Radius      int       `json:"radius"`      // The number of commits on either side of the commit being evaluated.
+	K           int       `json:"k"`           // The number of clusters, if 0 then a value is picked based on the number of traces.
+	Interesting float32   `json:"interesting"` // The minimum absolute StepFit.Regression of a cluster to be reported.
+	Direction   Direction `json:"direction"`   // Which direction of steps to report.
+	Owners      []string  `json:"owners"`      // The email addresses of the owners of this alert.
+
+	// FileIssue controls how new regressions are reported. If true an issue
+	// is filed with the owners on CC, otherwise the owners are emailed.
+	FileIssue bool `json:"file_issue"`
+}
+
+// NewConfig returns a new Config with default values.
+func NewConfig() *Config {
+	return &Config{
+		ID:          INVALID_ID,
+		Radius:      DEFAULT_RADIUS,
+		Interesting: clustering2.INTERESTING_THRESHHOLD,
+		Direction:   BOTH,
+		Owners:      []string{},
+	}
+}
+
+// Validate returns an error if the Config isn't valid.
+func (c *Config) Validate() error {
+	if c.DisplayName == "" {
+		return fmt.Errorf("An alert config must have a name.")
+	}
+	if _, err := url.ParseQuery(c.Query); err != nil {
+		return fmt.Errorf("Invalid query %q: %s", c.Query, err)
+	}
+	if c.Radius <= 0 {
+		return fmt.Errorf("Radius must be greater than 0, got %d.", c.Radius)
+	}
+	if c.K < 0 {
+		return fmt.Errorf("K must not be negative, got %d.", c.K)
+	}
+	if c.Interesting <= 0 {
+		return fmt.Errorf("Interesting must be greater than 0, got %f.", c.Interesting)
+	}
+	if c.Direction != UP && c.Direction != DOWN && c.Direction != BOTH {
+		return fmt.Errorf("Unknown direction %q.", c.Direction)
+	}
+	if len(c.Owners) == 0 {
+		return fmt.Errorf("An alert config must have at least one owner.")
+	}
+	return nil
+}
+
+// Matches returns true if the cluster summary is interesting enough and in
+// the right direction to be reported for this Config.
+func (c *Config) Matches(cl *clustering2.ClusterSummary) bool {
+	if cl.StepFit == nil {
+		return false
+	}
+	dir := directionOf(cl)
+	if c.Direction != BOTH && c.Direction != dir {
+		return false
+	}
+	r := cl.StepFit.Regression
+	if r < 0 {
+		r = -r
+	}
+	return r >= c.Interesting
+}
+
+// directionOf returns the direction of the step in the cluster summary.
+//
+// See clustering2.StepFit for why a negative regression is a step up.
+func directionOf(cl *clustering2.ClusterSummary) Direction {
+	if cl.StepFit.Regression < 0 {
+		return UP
+	}
+	return DOWN
+}
@@ -0,0 +1,255 @@
+package alerts
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"net/url"
+	"time"
+
+	"github.com/skia-dev/glog"
+
+	"go.skia.org/infra/go/email"
+	"go.skia.org/infra/go/git/gitinfo"
+	"go.skia.org/infra/go/issues"
+	"go.skia.org/infra/go/metrics2"
+	"go.skia.org/infra/perf/go/cid"
+	"go.skia.org/infra/perf/go/clustering2"
+)
+
+const (
+	// SOURCE is the source of the commits that are evaluated.
+	SOURCE = "master"
+
+	// MAX_KEYS is the maximum number of trace ids listed in a notification.
+	MAX_KEYS = 10
+
+	// CLUSTER_PAGE_WINDOW is the time before and after the step that is
+	// displayed on the cluster page linked from a notification.
+	CLUSTER_PAGE_WINDOW = 24 * time.Hour
+)
+
+var notificationTemplate = template.Must(template.New("notification").Parse(`
+<b>{{.Config.DisplayName}}</b> found a step {{.Direction}} in {{.Cluster.Num}} traces.
+<br><br>
+Query: {{.Config.Query}}<br>
+Regression: {{.Cluster.StepFit.Regression}}<br>
+Step size: {{.Cluster.StepFit.StepSize}}<br>
+Commit offset: {{.Cluster.StepPoint.Offset}}<br>
+<br>
+Traces:<br>
+{{range .Keys}}{{.}}<br>
+{{end}}
+<br>
+<a href="{{.URL}}">View the cluster</a>
+`))
+
+// ClusterFn runs the clustering described by the request.
+type ClusterFn func(req *clustering2.ClusterRequest) (*clustering2.ClusterResponse, error)
+
+// LatestFn returns the offset of the most recent commit.
+type LatestFn func() int
+
+// Continuous evaluates all the alert Configs each time a new commit arrives
+// and reports the new regressions found to the owners of each Config.
+type Continuous struct {
+	store        Store
+	cluster      ClusterFn
+	latest       LatestFn
+	issueTracker issues.IssueTracker
+	emailer      email.Emailer
+	perfURL      string
+
+	// last is the offset of the last commit that was evaluated, -1 if none
+	// has been evaluated yet.
+	last int
+
+	regressionsCounter *metrics2.Counter
+}
+
+// NewContinuous returns a new Continuous.
+//
+// If issueTracker is nil then no issues are filed, if emailer is nil then no
+// emails are sent. perfURL is the base URL of the perf server used to link to
+// the regressions found.
+func NewContinuous(store Store, git *gitinfo.GitInfo, cidl *cid.CommitIDLookup, issueTracker issues.IssueTracker, emailer email.Emailer, perfURL string) *Continuous {
+	return &Continuous{
+		store: store,
+		cluster: func(req *clustering2.ClusterRequest) (*clustering2.ClusterResponse, error) {
+			return clustering2.RunClusterRequest(req, git, cidl)
+		},
+		latest: func() int {
+			return git.NumCommits() - 1
+		},
+		issueTracker:       issueTracker,
+		emailer:            emailer,
+		perfURL:            perfURL,
+		last:               -1,
+		regressionsCounter: metrics2.GetCounter("perf.alerts.regressions", nil),
+	}
+}
+
+// Start evaluates the alert Configs in a Go routine every time a new commit
+// has arrived. The commits are checked for every period.
+func (c *Continuous) Start(period time.Duration) {
+	go func() {
+		c.step()
+		for _ = range time.Tick(period) {
+			c.step()
+		}
+	}()
+}
+
+// step retries the reports that failed earlier and then evaluates all the
+// alert Configs for each commit that arrived since the last step. On the
+// first step only the most recent commit is evaluated.
+func (c *Continuous) step() {
+	configs, err := c.store.List()
+	if err != nil {
+		glog.Errorf("Failed to load the alert configs: %s", err)
+		return
+	}
+	for _, cfg := range configs {
+		unreported, err := c.store.Unreported(cfg.ID)
+		if err != nil {
+			glog.Errorf("Failed to load the unreported regressions of alert config %q: %s", cfg.DisplayName, err)
+			continue
+		}
+		for _, cl := range unreported {
+			c.notify(cfg, cl)
+		}
+	}
+
+	latest := c.latest()
+	if c.last == -1 {
+		c.last = latest - 1
+	}
+	if latest <= c.last {
+		return
+	}
+	for offset := c.last + 1; offset <= latest; offset++ {
+		for _, cfg := range configs {
+			c.evaluate(cfg, offset)
+		}
+	}
+	c.last = latest
+}
+
+// evaluate runs the clustering for the given Config over the range of commits
+// that ends at the commit with the offset latest, and reports all the new
+// regressions found at the commit in the middle of that range.
+//
+// Only steps at the middle commit are reported since that is the only commit
+// with a full radius of commits on either side. Each commit ends up in the
+// middle once as new commits arrive.
+func (c *Continuous) evaluate(cfg *Config, latest int) {
+	middle := latest - cfg.Radius
+	if middle-cfg.Radius < 0 {
+		return
+	}
+	req := &clustering2.ClusterRequest{
+		Source: SOURCE,
+		Offset: middle,
+		Radius: cfg.Radius,
+		Query:  cfg.Query,
+		K:      cfg.K,
+	}
+	resp, err := c.cluster(req)
+	if err != nil {
+		glog.Errorf("Failed to run clustering for alert config %q: %s", cfg.DisplayName, err)
+		return
+	}
+	for _, cl := range resp.Summary.Clusters {
+		if cl.StepPoint == nil || cl.StepPoint.Offset != int64(middle) || !cfg.Matches(cl) {
+			continue
+		}
+		isNew, err := c.store.AddRegression(cfg.ID, cl)
+		if err != nil {
+			glog.Errorf("Failed to record regression for alert config %q: %s", cfg.DisplayName, err)
+			continue
+		}
+		if !isNew {
+			continue
+		}
+		c.regressionsCounter.Inc(1)
+		c.notify(cfg, cl)
+	}
+}
+
+// notify reports the regression in cl and marks it as reported. If the report
+// fails the regression stays unreported and is retried on the next step.
+func (c *Continuous) notify(cfg *Config, cl *clustering2.ClusterSummary) {
+	if err := c.report(cfg, cl); err != nil {
+		glog.Errorf("Failed to report regression for alert config %q: %s", cfg.DisplayName, err)
+		return
+	}
+	if err := c.store.SetReported(cfg.ID, cl); err != nil {
+		glog.Errorf("Failed to mark regression as reported for alert config %q: %s", cfg.DisplayName, err)
+	}
+}
+
+// report sends a notification about the regression in cl to the owners of
+// cfg, either by filing an issue or by email.
+func (c *Continuous) report(cfg *Config, cl *clustering2.ClusterSummary) error {
+	dir := directionOf(cl)
+	subject := fmt.Sprintf("Perf alert %q: step %s at commit %d", cfg.DisplayName, dir, cl.StepPoint.Offset)
+	keys := cl.Keys
+	if len(keys) > MAX_KEYS {
+		keys = keys[:MAX_KEYS]
+	}
+	context := struct {
+		Config    *Config
+		Cluster   *clustering2.ClusterSummary
+		Direction Direction
+		Keys      []string
+		URL       string
+	}{
+		Config:    cfg,
+		Cluster:   cl,
+		Direction: dir,
+		Keys:      keys,
+		URL:       c.clusterURL(cfg, cl),
+	}
+	var body bytes.Buffer
+	if err := notificationTemplate.Execute(&body, context); err != nil {
+		return fmt.Errorf("Failed to expand notification template: %s", err)
+	}
+
+	if cfg.FileIssue {
+		if c.issueTracker == nil {
+			return fmt.Errorf("No issue tracker configured.")
+		}
+		cc := make([]issues.MonorailPerson, 0, len(cfg.Owners))
+		for _, owner := range cfg.Owners {
+			cc = append(cc, issues.MonorailPerson{
+				Name: owner,
+				Kind: "monorail#issuePerson",
+			})
+		}
+		return c.issueTracker.AddIssue(issues.IssueRequest{
+			Status:      "Untriaged",
+			CC:          cc,
+			Labels:      []string{"Type-Defect", "Priority-Medium", "Perf-Regression"},
+			Summary:     subject,
+			Description: fmt.Sprintf("%s\n\nQuery: %s\nRegression: %f\nTraces: %d\n\n%s", subject, cfg.Query, cl.StepFit.Regression, cl.Num, context.URL),
+		})
+	}
+	if c.emailer == nil {
+		return fmt.Errorf("No emailer configured.")
+	}
+	return c.emailer.Send("Skia Perf", cfg.Owners, subject, body.String())
+}
+
+// clusterURL returns the URL of the cluster page that shows the clustering
+// that found cl.
+func (c *Continuous) clusterURL(cfg *Config, cl *clustering2.ClusterSummary) string {
+	ts := time.Unix(cl.StepPoint.Timestamp, 0)
+	v := url.Values{}
+	v.Set("begin", fmt.Sprintf("%d", ts.Add(-CLUSTER_PAGE_WINDOW).Unix()))
+	v.Set("end", fmt.Sprintf("%d", ts.Add(CLUSTER_PAGE_WINDOW).Unix()))
+	v.Set("source", cl.StepPoint.Source)
+	v.Set("offset", fmt.Sprintf("%d", cl.StepPoint.Offset))
+	v.Set("radius", fmt.Sprintf("%d", cfg.Radius))
+	v.Set("query", cfg.Query)
+	return c.perfURL + "/c/?" + v.Encode()
+}
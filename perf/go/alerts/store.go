@@ -0,0 +1,179 @@
+package alerts
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"go.skia.org/infra/go/util"
+	"go.skia.org/infra/perf/go/clustering2"
+	"go.skia.org/infra/perf/go/db"
+)
+
+// Store persists alert Configs and keeps track of the regressions that have
+// already been reported for them.
+type Store interface {
+	// List returns all the alert Configs.
+	List() ([]*Config, error)
+
+	// Get returns the Config with the given id.
+	Get(id int64) (*Config, error)
+
+	// Save writes the Config. If cfg.ID is INVALID_ID then the Config is
+	// added and cfg.ID is set to the new id, otherwise the existing Config is
+	// updated.
+	Save(cfg *Config) error
+
+	// Delete removes the Config with the given id.
+	Delete(id int64) error
+
+	// AddRegression records that the cluster was found for the Config. It
+	// returns false if a regression in the same direction at the same commit
+	// was already recorded for the Config. New regressions are recorded as not
+	// yet reported.
+	AddRegression(id int64, cl *clustering2.ClusterSummary) (bool, error)
+
+	// SetReported marks the regression in the cluster as reported to the
+	// owners of the Config.
+	SetReported(id int64, cl *clustering2.ClusterSummary) error
+
+	// Unreported returns the clusters of the regressions recorded for the
+	// Config that haven't been reported yet.
+	Unreported(id int64) ([]*clustering2.ClusterSummary, error)
+}
+
+// sqlStore implements Store on top of the perf SQL database.
+type sqlStore struct{}
+
+// NewStore returns a Store that uses the database set up via
+// db.DatabaseConfig.InitDB().
+func NewStore() Store {
+	return &sqlStore{}
+}
+
+// List implements the Store interface.
+func (s *sqlStore) List() ([]*Config, error) {
+	rows, err := db.DB.Query("SELECT id, config FROM alert_config ORDER BY id")
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read alert configs: %s", err)
+	}
+	defer util.Close(rows)
+
+	ret := []*Config{}
+	for rows.Next() {
+		var id int64
+		var body string
+		if err := rows.Scan(&id, &body); err != nil {
+			return nil, fmt.Errorf("Failed to read alert config row: %s", err)
+		}
+		cfg, err := decodeConfig(id, body)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, cfg)
+	}
+	return ret, nil
+}
+
+// Get implements the Store interface.
+func (s *sqlStore) Get(id int64) (*Config, error) {
+	var body string
+	if err := db.DB.QueryRow("SELECT config FROM alert_config WHERE id=?", id).Scan(&body); err != nil {
+		return nil, fmt.Errorf("Failed to retrieve alert config %d: %s", id, err)
+	}
+	return decodeConfig(id, body)
+}
+
+// Save implements the Store interface.
+func (s *sqlStore) Save(cfg *Config) error {
+	b, err := json.Marshal(cfg)
+	if err != nil {
+		return fmt.Errorf("Failed to encode alert config: %s", err)
+	}
+	if cfg.ID == INVALID_ID {
+		result, err := db.DB.Exec("INSERT INTO alert_config (config) VALUES (?)", string(b))
+		if err != nil {
+			return fmt.Errorf("Failed to write alert config: %s", err)
+		}
+		if cfg.ID, err = result.LastInsertId(); err != nil {
+			return fmt.Errorf("Failed to retrieve the ID of the new alert config: %s", err)
+		}
+		return nil
+	}
+	if _, err := db.DB.Exec("UPDATE alert_config SET config=? WHERE id=?", string(b), cfg.ID); err != nil {
+		return fmt.Errorf("Failed to update alert config: %s", err)
+	}
+	return nil
+}
+
+// Delete implements the Store interface.
+func (s *sqlStore) Delete(id int64) error {
+	if _, err := db.DB.Exec("DELETE FROM alert_config WHERE id=?", id); err != nil {
+		return fmt.Errorf("Failed to delete alert config: %s", err)
+	}
+	if _, err := db.DB.Exec("DELETE FROM alert_regression WHERE config_id=?", id); err != nil {
+		return fmt.Errorf("Failed to delete the regressions of alert config: %s", err)
+	}
+	return nil
+}
+
+// AddRegression implements the Store interface.
+func (s *sqlStore) AddRegression(id int64, cl *clustering2.ClusterSummary) (bool, error) {
+	b, err := json.Marshal(cl)
+	if err != nil {
+		return false, fmt.Errorf("Failed to encode cluster: %s", err)
+	}
+	result, err := db.DB.Exec(
+		"INSERT IGNORE INTO alert_regression (config_id, source, offset, direction, ts, cluster) VALUES (?, ?, ?, ?, ?, ?)",
+		id, cl.StepPoint.Source, cl.StepPoint.Offset, string(directionOf(cl)), cl.StepPoint.Timestamp, string(b))
+	if err != nil {
+		return false, fmt.Errorf("Failed to write regression: %s", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("Failed to retrieve the number of regressions written: %s", err)
+	}
+	return n > 0, nil
+}
+
+// SetReported implements the Store interface.
+func (s *sqlStore) SetReported(id int64, cl *clustering2.ClusterSummary) error {
+	if _, err := db.DB.Exec(
+		"UPDATE alert_regression SET reported=1 WHERE config_id=? AND source=? AND offset=? AND direction=?",
+		id, cl.StepPoint.Source, cl.StepPoint.Offset, string(directionOf(cl))); err != nil {
+		return fmt.Errorf("Failed to mark regression as reported: %s", err)
+	}
+	return nil
+}
+
+// Unreported implements the Store interface.
+func (s *sqlStore) Unreported(id int64) ([]*clustering2.ClusterSummary, error) {
+	rows, err := db.DB.Query("SELECT cluster FROM alert_regression WHERE config_id=? AND reported=0 ORDER BY offset, direction", id)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read unreported regressions: %s", err)
+	}
+	defer util.Close(rows)
+
+	ret := []*clustering2.ClusterSummary{}
+	for rows.Next() {
+		var body string
+		if err := rows.Scan(&body); err != nil {
+			return nil, fmt.Errorf("Failed to read regression row: %s", err)
+		}
+		cl := &clustering2.ClusterSummary{}
+		if err := json.Unmarshal([]byte(body), cl); err != nil {
+			return nil, fmt.Errorf("Found invalid JSON in alert_regression table: %s", err)
+		}
+		ret = append(ret, cl)
+	}
+	return ret, nil
+}
+
+// decodeConfig decodes the JSON stored in the alert_config table.
+func decodeConfig(id int64, body string) (*Config, error) {
+	cfg := NewConfig()
+	if err := json.Unmarshal([]byte(body), cfg); err != nil {
+		return nil, fmt.Errorf("Found invalid JSON in alert_config table: %d %s", id, err)
+	}
+	cfg.ID = id
+	return cfg, nil
+}
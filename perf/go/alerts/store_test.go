@@ -0,0 +1,81 @@
+package alerts
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"go.skia.org/infra/go/database/testutil"
+	"go.skia.org/infra/go/testutils"
+	"go.skia.org/infra/perf/go/clustering2"
+	"go.skia.org/infra/perf/go/db"
+)
+
+func TestSQLStore(t *testing.T) {
+	testutils.MediumTest(t)
+
+	// Set up the test database.
+	testDb := testutil.SetupMySQLTestDatabase(t, db.MigrationSteps())
+	defer testDb.Close(t)
+
+	conf := &db.DatabaseConfig{DatabaseConfig: testutil.LocalTestDatabaseConfig(db.MigrationSteps())}
+	assert.NoError(t, conf.InitDB())
+	defer testutils.AssertCloses(t, db.DB)
+
+	store := NewStore()
+	configs, err := store.List()
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(configs))
+
+	// Add a Config.
+	cfg := NewConfig()
+	cfg.DisplayName = "Skps"
+	cfg.Query = "source_type=skp"
+	cfg.Owners = []string{"alice@example.com"}
+	assert.NoError(t, store.Save(cfg))
+	assert.NotEqual(t, int64(INVALID_ID), cfg.ID)
+
+	got, err := store.Get(cfg.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, cfg, got)
+
+	// Update the Config.
+	cfg.Radius = 5
+	assert.NoError(t, store.Save(cfg))
+	configs, err = store.List()
+	assert.NoError(t, err)
+	assert.Equal(t, []*Config{cfg}, configs)
+
+	// Record regressions.
+	up := summary(-500, 10)
+	down := summary(500, 10)
+	isNew, err := store.AddRegression(cfg.ID, up)
+	assert.NoError(t, err)
+	assert.True(t, isNew)
+	isNew, err = store.AddRegression(cfg.ID, up)
+	assert.NoError(t, err)
+	assert.False(t, isNew)
+	isNew, err = store.AddRegression(cfg.ID, down)
+	assert.NoError(t, err)
+	assert.True(t, isNew)
+
+	unreported, err := store.Unreported(cfg.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, []*clustering2.ClusterSummary{down, up}, unreported)
+
+	assert.NoError(t, store.SetReported(cfg.ID, down))
+	unreported, err = store.Unreported(cfg.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, []*clustering2.ClusterSummary{up}, unreported)
+
+	// Deleting the Config removes its regressions.
+	assert.NoError(t, store.Delete(cfg.ID))
+	configs, err = store.List()
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(configs))
+	_, err = store.Get(cfg.ID)
+	assert.Error(t, err)
+	unreported, err = store.Unreported(cfg.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(unreported))
+}
@@ -43,6 +43,10 @@ type ClusterRequest struct {
 	Offset int    `json:"offset"`
 	Radius int    `json:"radius"`
 	Query  string `json:"query"`
+
+	// K is the number of clusters to use, if 0 then the square root of the
+	// number of traces is used.
+	K int `json:"k"`
 }
 
 func (c *ClusterRequest) Id() string {
@@ -59,6 +63,7 @@ type ClusterResponse struct {
 type ClusterRequestProcess struct {
 	// These members are read-only, should not be modified.
 	request *ClusterRequest
+	step    *StepRequest // Only set if this process runs step detection instead of clustering.
 	git     *gitinfo.GitInfo
 	cidl    *cid.CommitIDLookup
 
@@ -70,9 +75,10 @@ type ClusterRequestProcess struct {
 	message    string           // Describes the current state of the process.
 }
 
-func newProcess(req *ClusterRequest, git *gitinfo.GitInfo, cidl *cid.CommitIDLookup) *ClusterRequestProcess {
+func newProcess(req *ClusterRequest, step *StepRequest, git *gitinfo.GitInfo, cidl *cid.CommitIDLookup) *ClusterRequestProcess {
 	ret := &ClusterRequestProcess{
 		request:    req,
+		step:       step,
 		git:        git,
 		cidl:       cidl,
 		lastUpdate: time.Now(),
@@ -138,7 +144,20 @@ func (fr *RunningClusterRequests) Add(req *ClusterRequest) string {
 	defer fr.mutex.Unlock()
 	id := req.Id()
 	if _, ok := fr.inProcess[id]; !ok {
-		fr.inProcess[id] = newProcess(req, fr.git, fr.cidl)
+		fr.inProcess[id] = newProcess(req, nil, fr.git, fr.cidl)
+	}
+	return id
+}
+
+// AddStep starts a new running ClusterRequestProcess that does step
+// detection, and returns the ID of the process to be used in calls to
+// Status() and Response().
+func (fr *RunningClusterRequests) AddStep(req *StepRequest) string {
+	fr.mutex.Lock()
+	defer fr.mutex.Unlock()
+	id := req.Id()
+	if _, ok := fr.inProcess[id]; !ok {
+		fr.inProcess[id] = newProcess(&req.ClusterRequest, req, fr.git, fr.cidl)
 	}
 	return id
 }
@@ -207,6 +226,26 @@ func (p *ClusterRequestProcess) Status() (ProcessState, string, error) {
 	return p.state, p.message, nil
 }
 
+// RunClusterRequest does the clustering described by req and returns the
+// ClusterResponse once it is complete. Unlike RunningClusterRequests.Add it
+// doesn't return until all the work is done.
+func RunClusterRequest(req *ClusterRequest, git *gitinfo.GitInfo, cidl *cid.CommitIDLookup) (*ClusterResponse, error) {
+	p := &ClusterRequestProcess{
+		request:    req,
+		git:        git,
+		cidl:       cidl,
+		lastUpdate: time.Now(),
+		state:      PROCESS_RUNNING,
+		message:    "Running",
+	}
+	p.Run()
+	state, message, _ := p.Status()
+	if state != PROCESS_SUCCESS {
+		return nil, fmt.Errorf("Clustering failed: %s", message)
+	}
+	return p.Response(), nil
+}
+
 // Run does the work in a ClusterRequestProcess. It does not return until all the
 // work is done or the request failed. Should be run as a Go routine.
 func (p *ClusterRequestProcess) Run() {
@@ -232,12 +271,24 @@ func (p *ClusterRequestProcess) Run() {
 		p.reportError(err, "Invalid range of commits.")
 		return
 	}
-	n := len(df.TraceSet)
-	k := int(math.Floor(math.Sqrt(float64(n))))
-	summary, err := CalculateClusterSummaries(df, k, config.MIN_STDDEV, p.clusterProgress)
-	if err != nil {
-		p.reportError(err, "Invalid clustering.")
-		return
+	var summary *ClusterSummaries
+	if p.step != nil {
+		summary, err = CalculateStepSummaries(df, p.step)
+		if err != nil {
+			p.reportError(err, "Invalid step detection.")
+			return
+		}
+	} else {
+		k := p.request.K
+		if k <= 0 {
+			n := len(df.TraceSet)
+			k = int(math.Floor(math.Sqrt(float64(n))))
+		}
+		summary, err = CalculateClusterSummaries(df, k, config.MIN_STDDEV, p.clusterProgress)
+		if err != nil {
+			p.reportError(err, "Invalid clustering.")
+			return
+		}
 	}
 
 	df.TraceSet = ptracestore.TraceSet{}
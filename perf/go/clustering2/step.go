@@ -0,0 +1,210 @@
+package clustering2
+
+import (
+	"crypto/md5"
+	"fmt"
+	"math"
+	"sort"
+
+	"go.skia.org/infra/go/vec32"
+	"go.skia.org/infra/perf/go/config"
+	"go.skia.org/infra/perf/go/ctrace2"
+	"go.skia.org/infra/perf/go/dataframe"
+	"go.skia.org/infra/perf/go/kmeans"
+)
+
+const (
+	// STAT_MEAN and STAT_MEDIAN are the statistics that can be used to
+	// compare the values before and after a commit in a StepRequest.
+	STAT_MEAN   = "mean"
+	STAT_MEDIAN = "median"
+
+	// DEFAULT_MIN_SEGMENT is the default number of values that are required
+	// before and after a step.
+	DEFAULT_MIN_SEGMENT = 3
+)
+
+// StepRequest is all the info needed to start a step detection run. Instead
+// of clustering traces, every trace that matches the query is searched
+// individually for the commit where its values change the most.
+//
+// A step is reported if it is at least MinStepSize in absolute terms and at
+// least MinStepPercent relative to the value before the step.
+type StepRequest struct {
+	ClusterRequest
+
+	// Stat is the statistic used to compare the values before and after a
+	// commit, either STAT_MEAN or STAT_MEDIAN.
+	Stat string `json:"stat"`
+
+	// MinSegment is the minimum number of values that are required before and
+	// after a step. DEFAULT_MIN_SEGMENT is used if it is <= 0.
+	MinSegment int `json:"min_segment"`
+
+	// MinStepSize is the minimum absolute size of a step.
+	MinStepSize float32 `json:"min_step_size"`
+
+	// MinStepPercent is the minimum size of a step in percent of the value
+	// before the step.
+	MinStepPercent float32 `json:"min_step_percent"`
+}
+
+func (s *StepRequest) Id() string {
+	return fmt.Sprintf("%x", md5.Sum([]byte(fmt.Sprintf("%#v", *s))))
+}
+
+// Validate returns an error if the step parameters are not valid.
+func (s *StepRequest) Validate() error {
+	if s.Stat != STAT_MEAN && s.Stat != STAT_MEDIAN {
+		return fmt.Errorf("Unknown statistic %q.", s.Stat)
+	}
+	if s.MinStepSize < 0 || s.MinStepPercent < 0 {
+		return fmt.Errorf("Step thresholds must not be negative.")
+	}
+	if s.MinStepSize == 0 && s.MinStepPercent == 0 {
+		return fmt.Errorf("Either the minimum step size or the minimum step percent must be set.")
+	}
+	return nil
+}
+
+// step is the largest step found in a single trace.
+type step struct {
+	turn   int     // Index of the first value after the step.
+	before float32 // Statistic of the values before the step.
+	after  float32 // Statistic of the values after the step.
+}
+
+// CalculateStepSummaries runs step detection over every trace in the
+// DataFrame and returns one ClusterSummary for each trace that has a step that
+// passes the thresholds in req. The summaries are sorted by their
+// StepFit.Regression, the same as the summaries of k-means clustering.
+func CalculateStepSummaries(df *dataframe.DataFrame, req *StepRequest) (*ClusterSummaries, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+	if len(df.TraceSet) == 0 {
+		return nil, fmt.Errorf("Zero traces in the DataFrame.")
+	}
+	minSegment := req.MinSegment
+	if minSegment <= 0 {
+		minSegment = DEFAULT_MIN_SEGMENT
+	}
+	statFn := vec32.Mean
+	if req.Stat == STAT_MEDIAN {
+		statFn = median
+	}
+
+	ret := &ClusterSummaries{
+		Clusters: []*ClusterSummary{},
+	}
+	for key, trace := range df.TraceSet {
+		s := findStep(trace, minSegment, statFn)
+		if s == nil || !req.accepts(s) {
+			continue
+		}
+
+		values := vec32.Dup(trace)
+		vec32.Fill(values)
+		summary := newClusterSummary()
+		summary.Centroid = values
+		summary.Keys = []string{key}
+		summary.ParamSummaries = getParamSummaries([]kmeans.Clusterable{&ctrace2.ClusterableTrace{Key: key, Values: values}})
+		summary.StepFit = newStepFit(values, s)
+		summary.StepPoint = df.Header[s.turn]
+		summary.Num = 1
+		ret.Clusters = append(ret.Clusters, summary)
+	}
+	sort.Sort(sortableClusterSummarySlice(ret.Clusters))
+	return ret, nil
+}
+
+// accepts returns true if the step passes the thresholds of the request.
+func (s *StepRequest) accepts(st *step) bool {
+	size := float32(math.Abs(float64(st.after - st.before)))
+	if size == 0 || size < s.MinStepSize {
+		return false
+	}
+	if s.MinStepPercent > 0 {
+		if st.before == 0 {
+			return true
+		}
+		return 100*size/float32(math.Abs(float64(st.before))) >= s.MinStepPercent
+	}
+	return true
+}
+
+// findStep returns the step in the trace where the statistic of the values
+// before and after differs the most, weighted by the number of values on
+// either side so that a step near the ends of the trace doesn't win on noise.
+// Missing values are ignored. Returns nil if the trace doesn't have enough
+// values for a step.
+func findStep(trace []float32, minSegment int, statFn func([]float32) float32) *step {
+	// Collect the indices of all values that are present.
+	indices := make([]int, 0, len(trace))
+	values := make([]float32, 0, len(trace))
+	for i, v := range trace {
+		if v != vec32.MISSING_DATA_SENTINEL {
+			indices = append(indices, i)
+			values = append(values, v)
+		}
+	}
+
+	n := len(values)
+	var ret *step
+	bestScore := 0.0
+	for i := minSegment; i <= n-minSegment; i++ {
+		before, after := statFn(values[:i]), statFn(values[i:])
+		score := math.Abs(float64(after-before)) * math.Sqrt(float64(i*(n-i))/float64(n))
+		if score > bestScore {
+			bestScore = score
+			ret = &step{
+				turn:   indices[i],
+				before: before,
+				after:  after,
+			}
+		}
+	}
+	return ret
+}
+
+// newStepFit returns the StepFit for the given step, calculated the same way
+// as getStepFit does for the centroids of clusters.
+func newStepFit(values []float32, s *step) *StepFit {
+	lse := vec32.SSE(values[:s.turn], s.before) + vec32.SSE(values[s.turn:], s.after)
+	lse = float32(math.Sqrt(float64(lse))) / float32(len(values))
+	if lse < config.MIN_STDDEV {
+		lse = config.MIN_STDDEV
+	}
+	stepSize := s.before - s.after
+	status := "High"
+	if stepSize < 0 {
+		status = "Low"
+	}
+	return &StepFit{
+		LeastSquares: lse,
+		StepSize:     stepSize,
+		TurningPoint: s.turn,
+		Regression:   stepSize / lse,
+		Status:       status,
+	}
+}
+
+// median returns the median of the given values.
+func median(xs []float32) float32 {
+	if len(xs) == 0 {
+		return 0
+	}
+	sorted := vec32.Dup(xs)
+	sort.Sort(float32Slice(sorted))
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 1 {
+		return sorted[mid]
+	}
+	return (sorted[mid-1] + sorted[mid]) / 2
+}
+
+type float32Slice []float32
+
+func (p float32Slice) Len() int           { return len(p) }
+func (p float32Slice) Less(i, j int) bool { return p[i] < p[j] }
+func (p float32Slice) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
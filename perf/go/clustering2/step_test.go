@@ -0,0 +1,102 @@
+package clustering2
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"go.skia.org/infra/go/testutils"
+	"go.skia.org/infra/go/vec32"
+	"go.skia.org/infra/perf/go/dataframe"
+	"go.skia.org/infra/perf/go/ptracestore"
+)
+
+func TestFindStep(t *testing.T) {
+	testutils.SmallTest(t)
+	e := vec32.MISSING_DATA_SENTINEL
+
+	s := findStep([]float32{1, 1, 1, 5, 5, 5}, 3, vec32.Mean)
+	assert.Equal(t, &step{turn: 3, before: 1, after: 5}, s)
+
+	// Missing values are ignored.
+	s = findStep([]float32{1, e, 1, 1, 5, e, 5, 5}, 3, vec32.Mean)
+	assert.Equal(t, &step{turn: 4, before: 1, after: 5}, s)
+
+	// The median ignores outliers.
+	s = findStep([]float32{1, 1, 100, 2, 2, 2}, 3, median)
+	assert.Equal(t, &step{turn: 3, before: 1, after: 2}, s)
+
+	// Not enough values.
+	assert.Nil(t, findStep([]float32{1, 5, 5, e, e}, 3, vec32.Mean))
+
+	// No step at all.
+	assert.Nil(t, findStep([]float32{2, 2, 2, 2, 2, 2}, 2, vec32.Mean))
+}
+
+func TestMedian(t *testing.T) {
+	testutils.SmallTest(t)
+	assert.Equal(t, float32(0), median([]float32{}))
+	assert.Equal(t, float32(2), median([]float32{3, 1, 2}))
+	assert.Equal(t, float32(2.5), median([]float32{4, 1, 2, 3}))
+}
+
+func TestStepRequestValidate(t *testing.T) {
+	testutils.SmallTest(t)
+	assert.NoError(t, (&StepRequest{Stat: STAT_MEAN, MinStepSize: 1}).Validate())
+	assert.NoError(t, (&StepRequest{Stat: STAT_MEDIAN, MinStepPercent: 5}).Validate())
+	assert.Error(t, (&StepRequest{Stat: "mode", MinStepSize: 1}).Validate())
+	assert.Error(t, (&StepRequest{Stat: STAT_MEAN}).Validate())
+	assert.Error(t, (&StepRequest{Stat: STAT_MEAN, MinStepSize: -1, MinStepPercent: 5}).Validate())
+
+	assert.NotEqual(t, (&StepRequest{Stat: STAT_MEAN}).Id(), (&StepRequest{Stat: STAT_MEDIAN}).Id())
+}
+
+func TestCalculateStepSummaries(t *testing.T) {
+	testutils.SmallTest(t)
+	df := &dataframe.DataFrame{
+		TraceSet: ptracestore.TraceSet{
+			",config=8888,name=up,":    []float32{10, 10, 10, 10, 20, 20, 20, 20},
+			",config=8888,name=down,":  []float32{10, 10, 10, 10, 5, 5, 5, 5},
+			",config=8888,name=small,": []float32{10, 10, 10, 10, 10.5, 10.5, 10.5, 10.5},
+			",config=8888,name=flat,":  []float32{10, 10, 10, 10, 10, 10, 10, 10},
+		},
+		Header: []*dataframe.ColumnHeader{
+			{Offset: 0}, {Offset: 1}, {Offset: 2}, {Offset: 3},
+			{Offset: 4}, {Offset: 5}, {Offset: 6}, {Offset: 7},
+		},
+	}
+
+	req := &StepRequest{Stat: STAT_MEAN, MinStepPercent: 10}
+	summaries, err := CalculateStepSummaries(df, req)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(summaries.Clusters))
+
+	up := summaries.Clusters[0]
+	assert.Equal(t, []string{",config=8888,name=up,"}, up.Keys)
+	assert.Equal(t, "Low", up.StepFit.Status)
+	assert.Equal(t, float32(-10), up.StepFit.StepSize)
+	assert.Equal(t, 4, up.StepFit.TurningPoint)
+	assert.Equal(t, int64(4), up.StepPoint.Offset)
+	assert.Equal(t, 1, up.Num)
+	assert.Equal(t, []ValueWeight{{"up", 26}}, up.ParamSummaries["name"])
+
+	down := summaries.Clusters[1]
+	assert.Equal(t, []string{",config=8888,name=down,"}, down.Keys)
+	assert.Equal(t, "High", down.StepFit.Status)
+	assert.Equal(t, float32(5), down.StepFit.StepSize)
+
+	// An absolute threshold below the small step includes it.
+	req = &StepRequest{Stat: STAT_MEDIAN, MinStepSize: 0.5}
+	summaries, err = CalculateStepSummaries(df, req)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, len(summaries.Clusters))
+
+	// Both thresholds have to be met.
+	req = &StepRequest{Stat: STAT_MEAN, MinStepSize: 6, MinStepPercent: 10}
+	summaries, err = CalculateStepSummaries(df, req)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(summaries.Clusters))
+
+	_, err = CalculateStepSummaries(&dataframe.DataFrame{TraceSet: ptracestore.TraceSet{}}, req)
+	assert.Error(t, err)
+}
@@ -51,6 +51,7 @@ type FrameRequest struct {
 	Queries  []string `json:"queries"`  // The queries to perform encoded as a URL query.
 	Hidden   []string `json:"hidden"`   // The ids of traces to remove from the response.
 	Keys     string   `json:"keys"`     // The id of a list of keys stored via shortcut2.
+	Stat     string   `json:"stat"`     // The ptracestore.Stat of each point to return, defaults to the ingested value.
 }
 
 func (f *FrameRequest) Id() string {
@@ -75,6 +76,9 @@ type FrameRequestProcess struct {
 	//   changed, but git is Go routine safe.
 	git *gitinfo.GitInfo
 
+	// truncate is true if the number of traces in the response is limited.
+	truncate bool
+
 	mutex         sync.RWMutex // Protects access to the remaining struct members.
 	response      *FrameResponse
 	lastUpdate    time.Time    // The last time this process was updated.
@@ -93,6 +97,7 @@ func newProcess(req *FrameRequest, git *gitinfo.GitInfo) *FrameRequestProcess {
 	ret := &FrameRequestProcess{
 		git:           git,
 		request:       req,
+		truncate:      true,
 		lastUpdate:    time.Now(),
 		state:         PROCESS_RUNNING,
 		totalSearches: len(req.Formulas) + len(req.Queries) + numKeys,
@@ -101,6 +106,28 @@ func newProcess(req *FrameRequest, git *gitinfo.GitInfo) *FrameRequestProcess {
 	return ret
 }
 
+// RunFrameRequest builds the FrameResponse for the given FrameRequest and
+// doesn't return until all the work is done. Unlike the responses from
+// RunningFrameRequests, the number of traces in the response is not limited.
+func RunFrameRequest(req *FrameRequest, git *gitinfo.GitInfo) (*FrameResponse, error) {
+	p := &FrameRequestProcess{
+		git:           git,
+		request:       req,
+		lastUpdate:    time.Now(),
+		state:         PROCESS_RUNNING,
+		totalSearches: len(req.Formulas) + len(req.Queries),
+	}
+	if req.Keys != "" {
+		p.totalSearches += 1
+	}
+	p.Run()
+	state, message, _, _ := p.Status()
+	if state != PROCESS_SUCCESS {
+		return nil, fmt.Errorf("Failed to build frame: %s", message)
+	}
+	return p.Response(), nil
+}
+
 // RunningFrameRequests keeps track of all the FrameRequestProcess's.
 //
 // Once a FrameRequestProcess is complete the results will be kept in memory
@@ -182,6 +209,18 @@ func (fr *RunningFrameRequests) Response(id string) (*FrameResponse, error) {
 	}
 }
 
+// Request returns the FrameRequest of the FrameRequestProcess of the given
+// 'id'.
+func (fr *RunningFrameRequests) Request(id string) (*FrameRequest, error) {
+	fr.mutex.Lock()
+	defer fr.mutex.Unlock()
+	if p, ok := fr.inProcess[id]; !ok {
+		return nil, errorNotFound
+	} else {
+		return p.request, nil
+	}
+}
+
 // reportError records the reason a FrameRequestProcess failed.
 func (p *FrameRequestProcess) reportError(err error, message string) {
 	p.mutex.Lock()
@@ -228,13 +267,18 @@ func (p *FrameRequestProcess) Status() (ProcessState, string, float32, error) {
 func (p *FrameRequestProcess) Run() {
 	begin := time.Unix(int64(p.request.Begin), 0)
 	end := time.Unix(int64(p.request.End), 0)
+	stat, err := ptracestore.ParseStat(p.request.Stat)
+	if err != nil {
+		p.reportError(err, "Invalid stat.")
+		return
+	}
 
 	// Results from all the queries and calcs will be accumulated in this dataframe.
 	df := NewEmpty()
 
 	// Queries.
 	for _, q := range p.request.Queries {
-		newDF, err := p.doSearch(q, begin, end)
+		newDF, err := p.doSearch(q, begin, end, stat)
 		if err != nil {
 			p.reportError(err, "Failed to complete query.")
 			return
@@ -245,7 +289,7 @@ func (p *FrameRequestProcess) Run() {
 
 	// Formulas.
 	for _, formula := range p.request.Formulas {
-		newDF, err := p.doCalc(formula, begin, end)
+		newDF, err := p.doCalc(formula, begin, end, stat)
 		if err != nil {
 			p.reportError(err, "Failed to complete query.")
 			return
@@ -256,7 +300,7 @@ func (p *FrameRequestProcess) Run() {
 
 	// Keys
 	if p.request.Keys != "" {
-		newDF, err := p.doKeys(p.request.Keys, begin, end)
+		newDF, err := p.doKeys(p.request.Keys, begin, end, stat)
 		if err != nil {
 			p.reportError(err, "Failed to complete query.")
 			return
@@ -273,7 +317,7 @@ func (p *FrameRequestProcess) Run() {
 		df = NewHeaderOnly(p.git, begin, end)
 	}
 
-	resp, err := ResponseFromDataFrame(df, p.git, true)
+	resp, err := ResponseFromDataFrame(df, p.git, p.truncate)
 	if err != nil {
 		p.reportError(err, "Failed to get ticks or skps.")
 		return
@@ -395,8 +439,9 @@ func ResponseFromDataFrame(df *DataFrame, git *gitinfo.GitInfo, truncate bool) (
 }
 
 // doSearch applies the given query and returns a dataframe that matches the
-// given time range [begin, end) in a DataFrame.
-func (p *FrameRequestProcess) doSearch(queryStr string, begin, end time.Time) (*DataFrame, error) {
+// given time range [begin, end) in a DataFrame, with the given 'stat' of each
+// point.
+func (p *FrameRequestProcess) doSearch(queryStr string, begin, end time.Time, stat ptracestore.Stat) (*DataFrame, error) {
 	urlValues, err := url.ParseQuery(queryStr)
 	if err != nil {
 		return nil, fmt.Errorf("Failed to parse query: %s", err)
@@ -405,22 +450,23 @@ func (p *FrameRequestProcess) doSearch(queryStr string, begin, end time.Time) (*
 	if err != nil {
 		return nil, fmt.Errorf("Invalid Query: %s", err)
 	}
-	return NewFromQueryAndRange(p.git, ptracestore.Default, begin, end, q, p.progress)
+	return NewFromQueryAndRange(p.git, ptracestore.Default, begin, end, q, stat, p.progress)
 }
 
 // doKeys returns a DataFrame that matches the given set of keys given
-// the time range [begin, end).
-func (p *FrameRequestProcess) doKeys(keyID string, begin, end time.Time) (*DataFrame, error) {
+// the time range [begin, end), with the given 'stat' of each point.
+func (p *FrameRequestProcess) doKeys(keyID string, begin, end time.Time, stat ptracestore.Stat) (*DataFrame, error) {
 	keys, err := shortcut2.Get(keyID)
 	if err != nil {
 		return nil, fmt.Errorf("Failed to find that set of keys %q: %s", keyID, err)
 	}
-	return NewFromKeysAndRange(p.git, keys.Keys, ptracestore.Default, begin, end, p.progress)
+	return NewFromKeysAndRange(p.git, keys.Keys, ptracestore.Default, begin, end, stat, p.progress)
 }
 
 // doCalc applies the given formula and returns a dataframe that matches the
-// given time range [begin, end) in a DataFrame.
-func (p *FrameRequestProcess) doCalc(formula string, begin, end time.Time) (*DataFrame, error) {
+// given time range [begin, end) in a DataFrame. The rows the formula works on
+// are the given 'stat' of each point.
+func (p *FrameRequestProcess) doCalc(formula string, begin, end time.Time, stat ptracestore.Stat) (*DataFrame, error) {
 	// During the calculation 'rowsFromQuery' will be called to load up data, we
 	// will capture the dataframe that's created at that time. We only really
 	// need df.Headers so it doesn't matter if the calculation has multiple calls
@@ -436,7 +482,7 @@ func (p *FrameRequestProcess) doCalc(formula string, begin, end time.Time) (*Dat
 		if err != nil {
 			return nil, err
 		}
-		df, err = NewFromQueryAndRange(p.git, ptracestore.Default, begin, end, q, p.progress)
+		df, err = NewFromQueryAndRange(p.git, ptracestore.Default, begin, end, q, stat, p.progress)
 		if err != nil {
 			return nil, err
 		}
@@ -88,9 +88,9 @@ func getRange(vcs vcsinfo.VCS, begin, end time.Time) ([]*ColumnHeader, []*cid.Co
 	return rangeImpl(commits, skip)
 }
 
-func _new(colHeaders []*ColumnHeader, commitIDs []*cid.CommitID, matches ptracestore.KeyMatches, store ptracestore.PTraceStore, progress ptracestore.Progress, skip int) (*DataFrame, error) {
+func _new(colHeaders []*ColumnHeader, commitIDs []*cid.CommitID, matches ptracestore.KeyMatches, stat ptracestore.Stat, store ptracestore.PTraceStore, progress ptracestore.Progress, skip int) (*DataFrame, error) {
 	defer timer.New("_new time").Stop()
-	traceSet, err := store.Match(commitIDs, matches, progress)
+	traceSet, err := store.MatchStat(commitIDs, matches, stat, progress)
 	if err != nil {
 		return nil, fmt.Errorf("DataFrame failed to query for all traces: %s", err)
 	}
@@ -116,23 +116,25 @@ func New(vcs vcsinfo.VCS, store ptracestore.PTraceStore, progress ptracestore.Pr
 	matches := func(key string) bool {
 		return true
 	}
-	return _new(colHeaders, commitIDs, matches, store, progress, skip)
+	return _new(colHeaders, commitIDs, matches, ptracestore.STAT_VALUE, store, progress, skip)
 }
 
 // NewFromQueryAndRange returns a populated DataFrame of the traces that match
 // the given time range [begin, end) and the passed in query, or a non-nil
-// error if the traces can't be retrieved. The 'progress' callback is called
-// periodically as the query is processed.
-func NewFromQueryAndRange(vcs vcsinfo.VCS, store ptracestore.PTraceStore, begin, end time.Time, q *query.Query, progress ptracestore.Progress) (*DataFrame, error) {
+// error if the traces can't be retrieved. The values in the traces are the
+// given 'stat' of each point. The 'progress' callback is called periodically
+// as the query is processed.
+func NewFromQueryAndRange(vcs vcsinfo.VCS, store ptracestore.PTraceStore, begin, end time.Time, q *query.Query, stat ptracestore.Stat, progress ptracestore.Progress) (*DataFrame, error) {
 	defer timer.New("NewFromQueryAndRange time").Stop()
 	colHeaders, commitIDs, skip := getRange(vcs, begin, end)
-	return _new(colHeaders, commitIDs, q.Matches, store, progress, skip)
+	return _new(colHeaders, commitIDs, q.Matches, stat, store, progress, skip)
 }
 
 // NewFromKeysAndRange returns a populated DataFrame of the traces that match
-// the given set of 'keys' over the range of [begin, end). The 'progress'
-// callback is called periodically as the query is processed.
-func NewFromKeysAndRange(vcs vcsinfo.VCS, keys []string, store ptracestore.PTraceStore, begin, end time.Time, progress ptracestore.Progress) (*DataFrame, error) {
+// the given set of 'keys' over the range of [begin, end). The values in the
+// traces are the given 'stat' of each point. The 'progress' callback is
+// called periodically as the query is processed.
+func NewFromKeysAndRange(vcs vcsinfo.VCS, keys []string, store ptracestore.PTraceStore, begin, end time.Time, stat ptracestore.Stat, progress ptracestore.Progress) (*DataFrame, error) {
 	defer timer.New("NewFromKeysAndRange time").Stop()
 	colHeaders, commitIDs, skip := getRange(vcs, begin, end)
 	sort.Strings(keys)
@@ -143,7 +145,7 @@ func NewFromKeysAndRange(vcs vcsinfo.VCS, keys []string, store ptracestore.PTrac
 		}
 		return keys[i] == key
 	}
-	return _new(colHeaders, commitIDs, matches, store, progress, skip)
+	return _new(colHeaders, commitIDs, matches, stat, store, progress, skip)
 }
 
 // NewFromCommitIDsAndQuery returns a populated DataFrame of the traces that
@@ -162,7 +164,7 @@ func NewFromCommitIDsAndQuery(cids []*cid.CommitID, cidl *cid.CommitIDLookup, st
 			Timestamp: d.Timestamp,
 		})
 	}
-	return _new(colHeaders, cids, q.Matches, store, progress, 0)
+	return _new(colHeaders, cids, q.Matches, ptracestore.STAT_VALUE, store, progress, 0)
 }
 
 // NewEmpty returns a new empty DataFrame.
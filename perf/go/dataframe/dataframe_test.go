@@ -55,6 +55,10 @@ func (m mockPTraceStore) Add(commitID *cid.CommitID, values map[string]float32,
 	return nil
 }
 
+func (m mockPTraceStore) AddWithSummaries(commitID *cid.CommitID, values map[string]float32, summaries map[string]*ptracestore.Summary, sourceFile string) error {
+	return nil
+}
+
 func (m mockPTraceStore) Details(commitID *cid.CommitID, traceID string) (string, float32, error) {
 	return "", 0, nil
 }
@@ -66,6 +70,10 @@ func (m mockPTraceStore) Match(commitIDs []*cid.CommitID, matches ptracestore.Ke
 	return m.traceSet, nil
 }
 
+func (m mockPTraceStore) MatchStat(commitIDs []*cid.CommitID, matches ptracestore.KeyMatches, stat ptracestore.Stat, progress ptracestore.Progress) (ptracestore.TraceSet, error) {
+	return m.Match(commitIDs, matches, progress)
+}
+
 var (
 	ts0 = time.Unix(1406721642, 0).UTC()
 	ts1 = time.Unix(1406721715, 0).UTC()
@@ -158,7 +166,7 @@ func TestNew(t *testing.T) {
 	matches := func(key string) bool {
 		return true
 	}
-	d, err := _new(colHeaders, pcommits, matches, store, nil, 1)
+	d, err := _new(colHeaders, pcommits, matches, ptracestore.STAT_VALUE, store, nil, 1)
 	assert.NoError(t, err)
 	assert.Equal(t, 3, len(d.TraceSet))
 	assert.True(t, util.SSliceEqual(d.ParamSet["arch"], []string{"x86"}))
@@ -177,7 +185,7 @@ func TestVCS(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, 3, len(d.TraceSet))
 
-	d, err = NewFromQueryAndRange(vcs, store, ts0, ts1.Add(time.Second), &query.Query{}, nil)
+	d, err = NewFromQueryAndRange(vcs, store, ts0, ts1.Add(time.Second), &query.Query{}, ptracestore.STAT_VALUE, nil)
 	assert.NoError(t, err)
 	assert.Equal(t, 3, len(d.TraceSet))
 
@@ -185,13 +193,13 @@ func TestVCS(t *testing.T) {
 	vcs.updateFail = true
 	_, err = New(vcs, store, nil)
 	assert.NoError(t, err)
-	_, err = NewFromQueryAndRange(vcs, store, ts0, ts1.Add(time.Second), &query.Query{}, nil)
+	_, err = NewFromQueryAndRange(vcs, store, ts0, ts1.Add(time.Second), &query.Query{}, ptracestore.STAT_VALUE, nil)
 	assert.NoError(t, err)
 
 	store.matchFail = true
 	// Test error conditions if the store fails.
 	_, err = New(vcs, store, nil)
 	assert.Error(t, err)
-	_, err = NewFromQueryAndRange(vcs, store, ts0, ts1.Add(time.Second), &query.Query{}, nil)
+	_, err = NewFromQueryAndRange(vcs, store, ts0, ts1.Add(time.Second), &query.Query{}, ptracestore.STAT_VALUE, nil)
 	assert.Error(t, err)
 }
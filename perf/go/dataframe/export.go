@@ -0,0 +1,156 @@
+package dataframe
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+
+	"go.skia.org/infra/go/query"
+	"go.skia.org/infra/go/vec32"
+)
+
+const (
+	// FORMAT_CSV and FORMAT_JSON are the formats a DataFrame can be exported in.
+	FORMAT_CSV  = "csv"
+	FORMAT_JSON = "json"
+)
+
+// CompactDataFrame is a DataFrame in a form that is easier to consume outside
+// of Perf. Each trace has its params broken out and missing values are
+// serialized as null.
+type CompactDataFrame struct {
+	Header []*ColumnHeader `json:"header"`
+	Traces []*CompactTrace `json:"traces"`
+}
+
+// CompactTrace is a single trace in a CompactDataFrame.
+type CompactTrace struct {
+	Key    string            `json:"key"`
+	Params map[string]string `json:"params"`
+	Values CompactValues     `json:"values"`
+}
+
+// CompactValues are the values of a trace, where missing values are
+// serialized to JSON as null.
+type CompactValues []float32
+
+// MarshalJSON implements json.Marshaler.
+func (c CompactValues) MarshalJSON() ([]byte, error) {
+	b := []byte{'['}
+	for i, v := range c {
+		if i > 0 {
+			b = append(b, ',')
+		}
+		if v == vec32.MISSING_DATA_SENTINEL {
+			b = append(b, "null"...)
+		} else {
+			b = strconv.AppendFloat(b, float64(v), 'g', -1, 32)
+		}
+	}
+	return append(b, ']'), nil
+}
+
+// NewCompact returns a CompactDataFrame for the given DataFrame. The traces
+// are sorted by key.
+func NewCompact(df *DataFrame) *CompactDataFrame {
+	ret := &CompactDataFrame{
+		Header: df.Header,
+		Traces: make([]*CompactTrace, 0, len(df.TraceSet)),
+	}
+	for _, key := range sortedKeys(df) {
+		ret.Traces = append(ret.Traces, &CompactTrace{
+			Key:    key,
+			Params: paramsFromKey(key),
+			Values: CompactValues(df.TraceSet[key]),
+		})
+	}
+	return ret
+}
+
+// WriteJSON writes the DataFrame to w as a CompactDataFrame.
+func WriteJSON(w io.Writer, df *DataFrame) error {
+	if err := json.NewEncoder(w).Encode(NewCompact(df)); err != nil {
+		return fmt.Errorf("Failed to encode DataFrame: %s", err)
+	}
+	return nil
+}
+
+// WriteCSV writes the DataFrame to w as CSV. There is one row per trace,
+// sorted by key. The first columns are the key and the params of the traces,
+// followed by one column per commit, named by the time of the commit. Missing
+// values are left empty.
+func WriteCSV(w io.Writer, df *DataFrame) error {
+	paramKeys := make([]string, 0, len(df.ParamSet))
+	for key, _ := range df.ParamSet {
+		paramKeys = append(paramKeys, key)
+	}
+	sort.Strings(paramKeys)
+
+	cw := csv.NewWriter(w)
+	row := make([]string, 0, 1+len(paramKeys)+len(df.Header))
+	row = append(row, "key")
+	row = append(row, paramKeys...)
+	for _, h := range df.Header {
+		row = append(row, time.Unix(h.Timestamp, 0).UTC().Format(time.RFC3339))
+	}
+	if err := cw.Write(row); err != nil {
+		return fmt.Errorf("Failed to write CSV header: %s", err)
+	}
+
+	for _, key := range sortedKeys(df) {
+		params := paramsFromKey(key)
+		row = append(row[:0], key)
+		for _, p := range paramKeys {
+			row = append(row, params[p])
+		}
+		for _, v := range df.TraceSet[key] {
+			if v == vec32.MISSING_DATA_SENTINEL {
+				row = append(row, "")
+			} else {
+				row = append(row, strconv.FormatFloat(float64(v), 'g', -1, 32))
+			}
+		}
+		if err := cw.Write(row); err != nil {
+			return fmt.Errorf("Failed to write CSV row: %s", err)
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// Write writes the DataFrame to w in the given format, either FORMAT_CSV or
+// FORMAT_JSON.
+func Write(w io.Writer, df *DataFrame, format string) error {
+	switch format {
+	case FORMAT_CSV:
+		return WriteCSV(w, df)
+	case FORMAT_JSON:
+		return WriteJSON(w, df)
+	default:
+		return fmt.Errorf("Unknown export format %q.", format)
+	}
+}
+
+// paramsFromKey returns the params of a trace key. Calculated traces don't
+// have structured keys, so they have no params.
+func paramsFromKey(key string) map[string]string {
+	params, err := query.ParseKey(key)
+	if err != nil {
+		return map[string]string{}
+	}
+	return params
+}
+
+// sortedKeys returns the trace keys of the DataFrame in sorted order.
+func sortedKeys(df *DataFrame) []string {
+	keys := make([]string, 0, len(df.TraceSet))
+	for key, _ := range df.TraceSet {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,65 @@
+package dataframe
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"go.skia.org/infra/go/paramtools"
+	"go.skia.org/infra/go/testutils"
+	"go.skia.org/infra/go/vec32"
+	"go.skia.org/infra/perf/go/ptracestore"
+)
+
+func exportTestFrame() *DataFrame {
+	e := vec32.MISSING_DATA_SENTINEL
+	return &DataFrame{
+		TraceSet: ptracestore.TraceSet{
+			",arch=x86,config=8888,":  []float32{1, e, 3.5},
+			",arch=arm,config=565,":   []float32{e, 2, 0.25},
+			`ave(filter("arch=x86"))`: []float32{1, 1, 1},
+		},
+		Header: []*ColumnHeader{
+			{Source: "master", Offset: 10, Timestamp: 1477000000},
+			{Source: "master", Offset: 11, Timestamp: 1477000100},
+			{Source: "master", Offset: 12, Timestamp: 1477000200},
+		},
+		ParamSet: paramtools.ParamSet{
+			"arch":   []string{"arm", "x86"},
+			"config": []string{"565", "8888"},
+		},
+	}
+}
+
+func TestWriteCSV(t *testing.T) {
+	testutils.SmallTest(t)
+	var b bytes.Buffer
+	assert.NoError(t, WriteCSV(&b, exportTestFrame()))
+	expected := `key,arch,config,2016-10-20T21:46:40Z,2016-10-20T21:48:20Z,2016-10-20T21:50:00Z
+",arch=arm,config=565,",arm,565,,2,0.25
+",arch=x86,config=8888,",x86,8888,1,,3.5
+"ave(filter(""arch=x86""))",,,1,1,1
+`
+	assert.Equal(t, expected, b.String())
+}
+
+func TestWriteJSON(t *testing.T) {
+	testutils.SmallTest(t)
+	var b bytes.Buffer
+	assert.NoError(t, WriteJSON(&b, exportTestFrame()))
+	expected := `{"header":[{"source":"master","offset":10,"timestamp":1477000000},{"source":"master","offset":11,"timestamp":1477000100},{"source":"master","offset":12,"timestamp":1477000200}],` +
+		`"traces":[{"key":",arch=arm,config=565,","params":{"arch":"arm","config":"565"},"values":[null,2,0.25]},` +
+		`{"key":",arch=x86,config=8888,","params":{"arch":"x86","config":"8888"},"values":[1,null,3.5]},` +
+		`{"key":"ave(filter(\"arch=x86\"))","params":{},"values":[1,1,1]}]}
+`
+	assert.Equal(t, expected, b.String())
+}
+
+func TestWrite(t *testing.T) {
+	testutils.SmallTest(t)
+	var b bytes.Buffer
+	assert.NoError(t, Write(&b, exportTestFrame(), FORMAT_CSV))
+	assert.NoError(t, Write(&b, exportTestFrame(), FORMAT_JSON))
+	assert.Error(t, Write(&b, exportTestFrame(), "xml"))
+}
@@ -34,7 +34,7 @@ func onestep() {
 	matches := func(key string) bool {
 		return false
 	}
-	_, err := _new(colHeaders, commitIDs, matches, ptracestore.Default, nil, skip)
+	_, err := _new(colHeaders, commitIDs, matches, ptracestore.STAT_VALUE, ptracestore.Default, nil, skip)
 	if err != nil {
 		glog.Errorf("Failed building the dataframe while warming: %s", err)
 	}
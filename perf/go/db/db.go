@@ -87,6 +87,30 @@ var migrationSteps = []database.MigrationStep{
 		},
 		MySQLDown: []string{},
 	},
+	// version 3
+	{
+		MySQLUp: []string{
+			`CREATE TABLE IF NOT EXISTS alert_config (
+				id     INT          NOT NULL AUTO_INCREMENT PRIMARY KEY,
+				config MEDIUMTEXT   NOT NULL
+			)`,
+
+			`CREATE TABLE IF NOT EXISTS alert_regression (
+				config_id  INT          NOT NULL,
+				source     VARCHAR(255) NOT NULL,
+				offset     INT          NOT NULL,
+				direction  VARCHAR(8)   NOT NULL,
+				ts         BIGINT       NOT NULL,
+				cluster    MEDIUMTEXT   NOT NULL,
+				reported   TINYINT      NOT NULL DEFAULT 0,
+				PRIMARY KEY(config_id, source, offset, direction)
+			)`,
+		},
+		MySQLDown: []string{
+			`DROP TABLE IF EXISTS alert_regression`,
+			`DROP TABLE IF EXISTS alert_config`,
+		},
+	},
 
 	// Use this is a template for more migration steps.
 	// version x
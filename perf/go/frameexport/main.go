@@ -0,0 +1,128 @@
+// A command line tool for exporting DataFrames from a ptracestore.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/skia-dev/glog"
+
+	"go.skia.org/infra/go/git/gitinfo"
+	"go.skia.org/infra/go/human"
+	"go.skia.org/infra/go/util"
+	"go.skia.org/infra/perf/go/dataframe"
+	"go.skia.org/infra/perf/go/ptracestore"
+)
+
+// Command line flags.
+var (
+	begin          = flag.String("begin", "1w", "Select the commit ids for the range beginning this long ago.")
+	end            = flag.String("end", "0s", "Select the commit ids for the range ending this long ago.")
+	format         = flag.String("format", dataframe.FORMAT_CSV, "The output format, either 'csv' or 'json'.")
+	formula        = flag.String("formula", "", "A formula to evaluate, the same as on the explore page.")
+	gitRepoDir     = flag.String("git_repo_dir", "../../../skia", "Directory location for the Skia repo.")
+	gitRepoURL     = flag.String("git_repo_url", "https://skia.googlesource.com/skia", "The URL to pass to git clone for the source repository.")
+	out            = flag.String("out", "", "The file to write the frame to. Defaults to stdout.")
+	ptraceStoreDir = flag.String("ptrace_store_dir", "/tmp/ptracestore", "The directory where the ptracestore tiles are stored.")
+	queryStr       = flag.String("query", "", "A URL encoded query to select the traces.")
+	stat           = flag.String("stat", "", "The statistic of the samples at each point to export, one of 'min', 'median', 'max', 'stddev', or 'count'. Defaults to the ingested value.")
+)
+
+var Usage = func() {
+	fmt.Printf(`Usage: frameexport [OPTIONS]...
+Export a DataFrame built from a ptracestore as CSV or JSON.
+
+The frame is built the same way as on the explore page, from a query and/or a
+formula over a range of commits, except that the number of traces isn't
+limited.
+
+Only one application can interact with a BoltDB database at one time, so the
+Perf application should not be running at the same time as frameexport.
+
+Examples:
+
+  To export the last three days of values for traces that have the test name
+  'draw_stroke_bezier' as CSV:
+
+    frameexport --begin=3d --query='test=draw_stroke_bezier' --out=bezier.csv
+
+  To export the average of all the skp min_ms traces over the last week as
+  JSON:
+
+    frameexport --format=json --formula='ave(filter("source_type=skp&sub_result=min_ms"))'
+
+  To export the standard deviation of the samples of the skp min_ms traces
+  over the last week as CSV:
+
+    frameexport --stat=stddev --query='source_type=skp&sub_result=min_ms'
+
+Flags:
+
+`)
+	flag.PrintDefaults()
+}
+
+func main() {
+	flag.Usage = Usage
+	flag.Parse()
+	if *queryStr == "" && *formula == "" {
+		Usage()
+		return
+	}
+	if *format != dataframe.FORMAT_CSV && *format != dataframe.FORMAT_JSON {
+		glog.Fatalf("Unknown format: %q", *format)
+	}
+	if _, err := ptracestore.ParseStat(*stat); err != nil {
+		glog.Fatalf("Invalid stat: %s", err)
+	}
+
+	now := time.Now()
+	b, err := human.ParseDuration(*begin)
+	if err != nil {
+		glog.Fatalf("Invalid begin value: %s", err)
+	}
+	e, err := human.ParseDuration(*end)
+	if err != nil {
+		glog.Fatalf("Invalid end value: %s", err)
+	}
+	req := &dataframe.FrameRequest{
+		Begin:    int(now.Add(-b).Unix()),
+		End:      int(now.Add(-e).Unix()),
+		Formulas: []string{},
+		Queries:  []string{},
+		Stat:     *stat,
+	}
+	if *queryStr != "" {
+		req.Queries = append(req.Queries, *queryStr)
+	}
+	if *formula != "" {
+		req.Formulas = append(req.Formulas, *formula)
+	}
+
+	git, err := gitinfo.CloneOrUpdate(*gitRepoURL, *gitRepoDir, false)
+	if err != nil {
+		glog.Fatal(err)
+	}
+	ptracestore.Init(*ptraceStoreDir)
+
+	resp, err := dataframe.RunFrameRequest(req, git)
+	if err != nil {
+		glog.Fatalf("Failed to build frame: %s", err)
+	}
+
+	var w io.Writer = os.Stdout
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			glog.Fatalf("Failed to create output file: %s", err)
+		}
+		defer util.Close(f)
+		w = f
+	}
+	if err := dataframe.Write(w, resp.DataFrame, *format); err != nil {
+		glog.Fatalf("Failed to write frame: %s", err)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"math"
 	"net/url"
+	"sort"
 	"strconv"
 
 	"go.skia.org/infra/go/tiling"
@@ -391,3 +392,358 @@ func (LogFunc) Describe() string {
 }
 
 var logFunc = LogFunc{}
+
+// numArg returns the value of the argument at index i of the node, which
+// must be a number.
+func numArg(name string, node *Node, i int) (float64, error) {
+	if node.Args[i].Typ != NodeNum {
+		return 0, fmt.Errorf("%s() takes a number as argument %d.", name, i+1)
+	}
+	f, err := strconv.ParseFloat(node.Args[i].Val, 32)
+	if err != nil {
+		return 0, fmt.Errorf("%s() argument %d not a valid number %s : %s", name, i+1, node.Args[i].Val, err)
+	}
+	return f, nil
+}
+
+// foldTraces returns a single trace where each value is f() applied to the
+// non-missing values of all the traces at that index. If all the values at an
+// index are MISSING_DATA_SENTINEL then the value will be
+// MISSING_DATA_SENTINEL.
+func foldTraces(ctx *Context, traces []*types.PerfTrace, f func([]float64) float64) *types.PerfTrace {
+	ret := types.NewPerfTraceN(len(traces[0].Values))
+	ret.Params()["id"] = tiling.AsFormulaID(ctx.formula)
+	values := make([]float64, 0, len(traces))
+	for i, _ := range ret.Values {
+		values = values[:0]
+		for _, tr := range traces {
+			if v := tr.Values[i]; v != config.MISSING_DATA_SENTINEL {
+				values = append(values, v)
+			}
+		}
+		if len(values) > 0 {
+			ret.Values[i] = f(values)
+		}
+	}
+	return ret
+}
+
+// percentile returns the p-th percentile of the values, interpolating
+// linearly between the closest ranks. The values are sorted in place.
+func percentile(values []float64, p float64) float64 {
+	sort.Float64s(values)
+	rank := p / 100 * float64(len(values)-1)
+	lo := int(math.Floor(rank))
+	hi := int(math.Ceil(rank))
+	return values[lo] + (rank-float64(lo))*(values[hi]-values[lo])
+}
+
+// foldFunc implements Func for functions that fold the values of all
+// argument traces into a single trace, such as min() or max().
+type foldFunc struct {
+	name     string
+	fold     func([]float64) float64
+	describe string
+}
+
+func (f foldFunc) Eval(ctx *Context, node *Node) ([]*types.PerfTrace, error) {
+	if len(node.Args) != 1 {
+		return nil, fmt.Errorf("%s() takes a single argument.", f.name)
+	}
+	if node.Args[0].Typ != NodeFunc {
+		return nil, fmt.Errorf("%s() takes a function argument.", f.name)
+	}
+	traces, err := node.Args[0].Eval(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%s() argument failed to evaluate: %s", f.name, err)
+	}
+
+	if len(traces) == 0 {
+		return traces, nil
+	}
+	return []*types.PerfTrace{foldTraces(ctx, traces, f.fold)}, nil
+}
+
+func (f foldFunc) Describe() string {
+	return f.describe
+}
+
+var medianFunc = foldFunc{
+	name: "median",
+	fold: func(values []float64) float64 {
+		return percentile(values, 50)
+	},
+	describe: `median() folds the values of all argument traces into a single trace of their median.`,
+}
+
+var minFunc = foldFunc{
+	name: "min",
+	fold: func(values []float64) float64 {
+		ret := values[0]
+		for _, v := range values {
+			ret = math.Min(ret, v)
+		}
+		return ret
+	},
+	describe: `min() folds the values of all argument traces into a single trace of their minimum.`,
+}
+
+var maxFunc = foldFunc{
+	name: "max",
+	fold: func(values []float64) float64 {
+		ret := values[0]
+		for _, v := range values {
+			ret = math.Max(ret, v)
+		}
+		return ret
+	},
+	describe: `max() folds the values of all argument traces into a single trace of their maximum.`,
+}
+
+var stddevFunc = foldFunc{
+	name: "stddev",
+	fold: func(values []float64) float64 {
+		_, stddev, _ := vec.MeanAndStdDev(values)
+		return stddev
+	},
+	describe: `stddev() folds the values of all argument traces into a single trace of their standard deviation.`,
+}
+
+type PercentileFunc struct{}
+
+// PercentileFunc implements Func and folds the values of all argument traces
+// into a single trace of their p-th percentile.
+//
+// MISSING_DATA_SENTINEL values are not included in the percentile.
+func (PercentileFunc) Eval(ctx *Context, node *Node) ([]*types.PerfTrace, error) {
+	if len(node.Args) != 2 {
+		return nil, fmt.Errorf("percentile() takes two arguments.")
+	}
+	if node.Args[0].Typ != NodeFunc {
+		return nil, fmt.Errorf("percentile() takes a function as its first argument.")
+	}
+	p, err := numArg("percentile", node, 1)
+	if err != nil {
+		return nil, err
+	}
+	if p < 0 || p > 100 {
+		return nil, fmt.Errorf("percentile() must be between 0 and 100, got %f.", p)
+	}
+	traces, err := node.Args[0].Eval(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("percentile() argument failed to evaluate: %s", err)
+	}
+
+	if len(traces) == 0 {
+		return traces, nil
+	}
+	ret := foldTraces(ctx, traces, func(values []float64) float64 {
+		return percentile(values, p)
+	})
+	return []*types.PerfTrace{ret}, nil
+}
+
+func (PercentileFunc) Describe() string {
+	return `percentile(x, p) folds the values of all argument traces into a single trace of their p-th percentile.
+
+  The percentile p must be between 0 and 100.`
+}
+
+var percentileFunc = PercentileFunc{}
+
+type MovingAveFunc struct{}
+
+// MovingAveFunc implements Func and replaces each value in the traces with
+// the average of the trailing window of values that ends at that value.
+//
+// MISSING_DATA_SENTINEL values are not included in the average. If all the
+// values in a window are MISSING_DATA_SENTINEL then the average will be
+// MISSING_DATA_SENTINEL.
+func (MovingAveFunc) Eval(ctx *Context, node *Node) ([]*types.PerfTrace, error) {
+	if len(node.Args) != 2 {
+		return nil, fmt.Errorf("moving_ave() takes two arguments.")
+	}
+	if node.Args[0].Typ != NodeFunc {
+		return nil, fmt.Errorf("moving_ave() takes a function as its first argument.")
+	}
+	window, err := numArg("moving_ave", node, 1)
+	if err != nil {
+		return nil, err
+	}
+	if window < 1 || window != math.Floor(window) {
+		return nil, fmt.Errorf("moving_ave() window must be a positive integer, got %s.", node.Args[1].Val)
+	}
+	traces, err := node.Args[0].Eval(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("moving_ave() failed evaluating argument: %s", err)
+	}
+
+	n := int(window)
+	for _, tr := range traces {
+		values := make([]float64, len(tr.Values))
+		for i, _ := range tr.Values {
+			begin := i - n + 1
+			if begin < 0 {
+				begin = 0
+			}
+			values[i] = config.MISSING_DATA_SENTINEL
+			if mean, _, err := vec.MeanAndStdDev(tr.Values[begin : i+1]); err == nil {
+				values[i] = mean
+			}
+		}
+		tr.Values = values
+	}
+	return traces, nil
+}
+
+func (MovingAveFunc) Describe() string {
+	return `moving_ave(x, n) replaces each value with the average of the window of n values that ends at that value.`
+}
+
+var movingAveFunc = MovingAveFunc{}
+
+type ShiftFunc struct{}
+
+// ShiftFunc implements Func and shifts all the values in the traces one
+// commit later, so that each value is the value at the previous commit.
+//
+// The first value of each trace will be MISSING_DATA_SENTINEL.
+func (ShiftFunc) Eval(ctx *Context, node *Node) ([]*types.PerfTrace, error) {
+	if len(node.Args) != 1 {
+		return nil, fmt.Errorf("shift() takes a single argument.")
+	}
+	if node.Args[0].Typ != NodeFunc {
+		return nil, fmt.Errorf("shift() takes a function argument.")
+	}
+	traces, err := node.Args[0].Eval(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("shift() failed evaluating argument: %s", err)
+	}
+
+	for _, tr := range traces {
+		for i := len(tr.Values) - 1; i > 0; i-- {
+			tr.Values[i] = tr.Values[i-1]
+		}
+		if len(tr.Values) > 0 {
+			tr.Values[0] = config.MISSING_DATA_SENTINEL
+		}
+	}
+	return traces, nil
+}
+
+func (ShiftFunc) Describe() string {
+	return `shift() shifts the values one commit later, i.e. each value is the value at the previous commit.`
+}
+
+var shiftFunc = ShiftFunc{}
+
+type DeltaFunc struct{}
+
+// DeltaFunc implements Func and replaces each value in the traces with the
+// difference to the value at the previous commit.
+//
+// If either value is MISSING_DATA_SENTINEL then the difference will be
+// MISSING_DATA_SENTINEL. Use fill() first to compare against the last value
+// present.
+func (DeltaFunc) Eval(ctx *Context, node *Node) ([]*types.PerfTrace, error) {
+	if len(node.Args) != 1 {
+		return nil, fmt.Errorf("delta() takes a single argument.")
+	}
+	if node.Args[0].Typ != NodeFunc {
+		return nil, fmt.Errorf("delta() takes a function argument.")
+	}
+	traces, err := node.Args[0].Eval(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("delta() failed evaluating argument: %s", err)
+	}
+
+	for _, tr := range traces {
+		for i := len(tr.Values) - 1; i >= 0; i-- {
+			if i == 0 || tr.Values[i] == config.MISSING_DATA_SENTINEL || tr.Values[i-1] == config.MISSING_DATA_SENTINEL {
+				tr.Values[i] = config.MISSING_DATA_SENTINEL
+			} else {
+				tr.Values[i] = tr.Values[i] - tr.Values[i-1]
+			}
+		}
+	}
+	return traces, nil
+}
+
+func (DeltaFunc) Describe() string {
+	return `delta() replaces each value with the difference to the value at the previous commit.`
+}
+
+var deltaFunc = DeltaFunc{}
+
+type ScaleFunc struct{}
+
+// ScaleFunc implements Func and multiplies all the values in the traces by a
+// constant.
+//
+// MISSING_DATA_SENTINEL values are left untouched.
+func (ScaleFunc) Eval(ctx *Context, node *Node) ([]*types.PerfTrace, error) {
+	if len(node.Args) != 2 {
+		return nil, fmt.Errorf("scale() takes two arguments.")
+	}
+	if node.Args[0].Typ != NodeFunc {
+		return nil, fmt.Errorf("scale() takes a function as its first argument.")
+	}
+	k, err := numArg("scale", node, 1)
+	if err != nil {
+		return nil, err
+	}
+	traces, err := node.Args[0].Eval(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("scale() failed evaluating argument: %s", err)
+	}
+
+	for _, tr := range traces {
+		for i, v := range tr.Values {
+			if v != config.MISSING_DATA_SENTINEL {
+				tr.Values[i] = v * k
+			}
+		}
+	}
+	return traces, nil
+}
+
+func (ScaleFunc) Describe() string {
+	return `scale(x, k) multiplies all the values by the number k.`
+}
+
+var scaleFunc = ScaleFunc{}
+
+type TraceAveFunc struct{}
+
+// TraceAveFunc implements Func and replaces all the values in each trace with
+// the average of that trace.
+//
+// MISSING_DATA_SENTINEL values are not included in the average. A trace with
+// all MISSING_DATA_SENTINEL values is left untouched.
+func (TraceAveFunc) Eval(ctx *Context, node *Node) ([]*types.PerfTrace, error) {
+	if len(node.Args) != 1 {
+		return nil, fmt.Errorf("trace_ave() takes a single argument.")
+	}
+	if node.Args[0].Typ != NodeFunc {
+		return nil, fmt.Errorf("trace_ave() takes a function argument.")
+	}
+	traces, err := node.Args[0].Eval(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("trace_ave() failed evaluating argument: %s", err)
+	}
+
+	for _, tr := range traces {
+		if mean, _, err := vec.MeanAndStdDev(tr.Values); err == nil {
+			for i, _ := range tr.Values {
+				tr.Values[i] = mean
+			}
+		}
+	}
+	return traces, nil
+}
+
+func (TraceAveFunc) Describe() string {
+	return `trace_ave() replaces all the values of each trace with the average of that trace.`
+}
+
+var traceAveFunc = TraceAveFunc{}
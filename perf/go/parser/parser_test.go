@@ -282,3 +282,99 @@ func TestLog(t *testing.T) {
 		}
 	}
 }
+
+func TestFolds(t *testing.T) {
+	testutils.SmallTest(t)
+	testCases := []struct {
+		formula string
+		want    []float64
+	}{
+		{`median(filter(""))`, []float64{2.0, 2.0, -2.0, 1e100}},
+		{`min(filter(""))`, []float64{1.0, -1.0, -2.0, 1e100}},
+		{`max(filter(""))`, []float64{3.0, 5.0, -2.0, 1e100}},
+		{`stddev(filter(""))`, []float64{1.0, 2.4495, 0.0, 1e100}},
+		{`percentile(filter(""), 75)`, []float64{2.5, 3.5, -2.0, 1e100}},
+	}
+	for _, tc := range testCases {
+		ctx := newTestContext()
+		ctx.Tile.Traces["t1"].(*types.PerfTrace).Values = []float64{1.0, -1.0, 1e100, 1e100}
+		ctx.Tile.Traces["t2"].(*types.PerfTrace).Values = []float64{1e100, 2.0, -2.0, 1e100}
+		t3 := types.NewPerfTraceN(4)
+		t3.Values = []float64{3.0, 5.0, 1e100, 1e100}
+		ctx.Tile.Traces["t3"] = t3
+		traces, err := ctx.Eval(tc.formula)
+		if err != nil {
+			t.Fatalf("Failed to eval %q: %s", tc.formula, err)
+		}
+		if got, want := len(traces), 1; got != want {
+			t.Errorf("%q returned wrong length: Got %v Want %v", tc.formula, got, want)
+		}
+		for i, want := range tc.want {
+			if got := traces[0].Values[i]; !near(got, want) {
+				t.Errorf("%q mismatch at %d: Got %v Want %v", tc.formula, i, got, want)
+			}
+		}
+	}
+}
+
+func TestTraceTransforms(t *testing.T) {
+	testutils.SmallTest(t)
+	testCases := []struct {
+		formula string
+		want    []float64
+	}{
+		{`moving_ave(filter("config=8888"), 2)`, []float64{1, 2, 3, 5, 6}},
+		{`shift(filter("config=8888"))`, []float64{1e100, 1, 3, 1e100, 5}},
+		{`delta(filter("config=8888"))`, []float64{1e100, 2, 1e100, 1e100, 2}},
+		{`delta(fill(filter("config=8888")))`, []float64{1e100, 2, 2, 0, 2}},
+		{`scale(filter("config=8888"), 0.5)`, []float64{0.5, 1.5, 1e100, 2.5, 3.5}},
+		{`trace_ave(filter("config=8888"))`, []float64{4, 4, 4, 4, 4}},
+	}
+	for _, tc := range testCases {
+		ctx := newTestContext()
+		ctx.Tile.Traces["t1"].(*types.PerfTrace).Values = []float64{1, 3, 1e100, 5, 7}
+		traces, err := ctx.Eval(tc.formula)
+		if err != nil {
+			t.Fatalf("Failed to eval %q: %s", tc.formula, err)
+		}
+		if got, want := len(traces), 1; got != want {
+			t.Fatalf("%q returned wrong length: Got %v Want %v", tc.formula, got, want)
+		}
+		for i, want := range tc.want {
+			if got := traces[0].Values[i]; !near(got, want) {
+				t.Errorf("%q mismatch at %d: Got %v Want %v", tc.formula, i, got, want)
+			}
+		}
+		// Make sure the tile wasn't modified.
+		if got, want := ctx.Tile.Traces["t1"].(*types.PerfTrace).Values[1], 3.0; got != want {
+			t.Errorf("Tile incorrectly modified: Got %v Want %v", got, want)
+		}
+	}
+}
+
+func TestNewFuncErrors(t *testing.T) {
+	testutils.SmallTest(t)
+	ctx := newTestContext()
+
+	testCases := []string{
+		`median(2)`,
+		`min()`,
+		`max("foo")`,
+		`stddev(filter(""), 2)`,
+		`percentile(filter(""))`,
+		`percentile(filter(""), "foo")`,
+		`percentile(filter(""), 101)`,
+		`moving_ave(filter(""))`,
+		`moving_ave(filter(""), 0)`,
+		`shift(2)`,
+		`delta()`,
+		`scale(filter(""))`,
+		`trace_ave("foo")`,
+	}
+	for _, tc := range testCases {
+		_, err := ctx.Eval(tc)
+		if err == nil {
+			t.Fatalf("Expected %q to fail:", tc)
+		}
+	}
+}
@@ -8,12 +8,19 @@ import (
 	"go.skia.org/infra/go/query"
 	"go.skia.org/infra/go/util"
 	"go.skia.org/infra/perf/go/ingestcommon"
+	"go.skia.org/infra/perf/go/ptracestore"
 )
 
 // getValueMap returns a map[string]float32 of trace keys and their new values
-// from the given BenchData.
-func getValueMap(b *ingestcommon.BenchData) map[string]float32 {
+// from the given BenchData, along with a map of trace keys to the Summary of
+// the samples the values were derived from.
+//
+// Nanobench records the timing samples for each result in ms under the
+// "samples" key, so the Summary of those samples is attached to every trace of
+// that result with a sub_result that's also in ms, i.e. that ends in "_ms".
+func getValueMap(b *ingestcommon.BenchData) (map[string]float32, map[string]*ptracestore.Summary) {
 	ret := make(map[string]float32, len(b.Results))
+	summaries := map[string]*ptracestore.Summary{}
 	for testName, allConfigs := range b.Results {
 		for configName, result := range allConfigs {
 			key := util.CopyStringMap(b.Key)
@@ -37,8 +44,13 @@ func getValueMap(b *ingestcommon.BenchData) map[string]float32 {
 				}
 			}
 
+			var summary *ptracestore.Summary
+			if samples, ok := result["samples"]; ok {
+				summary = getSummary(samples)
+			}
+
 			for k, vi := range result {
-				if k == "options" {
+				if k == "options" || k == "samples" {
 					continue
 				}
 				key["sub_result"] = k
@@ -53,8 +65,31 @@ func getValueMap(b *ingestcommon.BenchData) map[string]float32 {
 					continue
 				}
 				ret[keyString] = float32(floatVal)
+				if summary != nil && strings.HasSuffix(k, "_ms") {
+					summaries[keyString] = summary
+				}
 			}
 		}
 	}
-	return ret
+	return ret, summaries
+}
+
+// getSummary returns the Summary of the samples decoded from a BenchResult,
+// or nil if there are no valid samples.
+func getSummary(samples interface{}) *ptracestore.Summary {
+	values, ok := samples.([]interface{})
+	if !ok {
+		glog.Errorf("Found non-list samples: %v", samples)
+		return nil
+	}
+	floats := make([]float32, 0, len(values))
+	for _, vi := range values {
+		floatVal, ok := vi.(float64)
+		if !ok {
+			glog.Errorf("Found a non-float64 sample in %v", values)
+			return nil
+		}
+		floats = append(floats, float32(floatVal))
+	}
+	return ptracestore.NewSummary(floats)
 }
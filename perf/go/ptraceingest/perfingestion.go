@@ -49,7 +49,8 @@ func (p *perfProcessor) Process(resultsFile ingestion.ResultFileLocation) error
 		return err
 	}
 
-	return p.store.Add(commitID, getValueMap(benchData), resultsFile.Name())
+	values, summaries := getValueMap(benchData)
+	return p.store.AddWithSummaries(commitID, values, summaries, resultsFile.Name())
 }
 
 // See ingestion.Processor interface.
@@ -54,7 +54,7 @@ func TestBenchData(t *testing.T) {
 	benchData, err := ingestcommon.ParseBenchDataFromReader(r)
 	assert.NoError(t, err)
 
-	traceSet := getValueMap(benchData)
+	traceSet, summaries := getValueMap(benchData)
 	expected := map[string]float32{
 		",arch=x86,config=565,gpu=GTX660,model=ShuttleA,os=Ubuntu12,source_type=bench,sub_result=min_ms,system=UNIX,test=DeferredSurfaceCopy_discardable_640_480,":             2.215988,
 		",arch=x86,config=gpu,gpu=GTX660,model=ShuttleA,os=Ubuntu12,source_type=bench,sub_result=min_ms,system=UNIX,test=DeferredSurfaceCopy_discardable_640_480,":             0.115713276,
@@ -71,6 +71,15 @@ func TestBenchData(t *testing.T) {
 		",arch=x86,config=meta,gpu=GTX660,model=ShuttleA,os=Ubuntu12,sub_result=max_rss_mb,system=UNIX,test=memory_usage_0_0,":                                                 858}
 
 	testutils.AssertDeepEqual(t, expected, traceSet)
+
+	// Only the ms sub_results of a result with samples have a summary.
+	assert.Equal(t, 1, len(summaries))
+	summary := summaries[",arch=x86,config=8888,gpu=GTX660,model=ShuttleA,os=Ubuntu12,source_type=bench,sub_result=min_ms,system=UNIX,test=DeferredSurfaceCopy_nonDiscardable_640_480,"]
+	assert.NotNil(t, summary)
+	assert.Equal(t, int32(4), summary.Count)
+	assert.Equal(t, float32(2.855735), summary.Min)
+	assert.Equal(t, float32(2.95), summary.Median)
+	assert.Equal(t, float32(3.1), summary.Max)
 }
 
 // Tests the processor in conjunction with the vcs.
@@ -101,12 +110,18 @@ func TestPerfProcessor(t *testing.T) {
 
 	traceId := ",arch=x86,config=nonrendering,gpu=GTX660,model=ShuttleA,os=Ubuntu12,source_type=bench,sub_result=min_ms,system=UNIX,test=ChunkAlloc_Push_640_480,"
 	expectedValue := float32(0.009535795)
-	cid := &cid.CommitID{
+	commitID := &cid.CommitID{
 		Source: "master",
 		Offset: 0,
 	}
-	source, value, err := ptracestore.Default.Details(cid, traceId)
+	source, value, err := ptracestore.Default.Details(commitID, traceId)
 	assert.NoError(t, err)
 	assert.Equal(t, expectedValue, value)
 	assert.Equal(t, "nano.json", source)
+
+	// The summary of the samples is stored.
+	traceId = ",arch=x86,config=8888,gpu=GTX660,model=ShuttleA,os=Ubuntu12,source_type=bench,sub_result=min_ms,system=UNIX,test=DeferredSurfaceCopy_nonDiscardable_640_480,"
+	traces, err := ptracestore.Default.MatchStat([]*cid.CommitID{commitID}, func(key string) bool { return key == traceId }, ptracestore.STAT_MAX, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, ptracestore.Trace{3.1}, traces[traceId])
 }
@@ -63,7 +63,8 @@ func (p *perfTrybotProcessor) Process(resultsFile ingestion.ResultFileLocation)
 		return err
 	}
 
-	return p.store.Add(commitID, getValueMap(benchData), resultsFile.Name())
+	values, summaries := getValueMap(benchData)
+	return p.store.AddWithSummaries(commitID, values, summaries, resultsFile.Name())
 }
 
 // See ingestion.Processor interface.
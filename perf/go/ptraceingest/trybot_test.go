@@ -26,7 +26,7 @@ func TestTrybotBenchData(t *testing.T) {
 
 	benchData, err := ingestcommon.ParseBenchDataFromReader(r)
 	assert.NoError(t, err)
-	traceSet := getValueMap(benchData)
+	traceSet, _ := getValueMap(benchData)
 	expected := map[string]float32{
 		",arch=x86_64,bench_type=micro,compiler=Clang,config=gpu,cpu_or_gpu=GPU,cpu_or_gpu_value=GeForce320M,model=MacMini4.1,name=GLInstancedArraysBench_instance,os=Mac10.8,source_type=bench,sub_result=min_ms,test=GLInstancedArraysBench_instance_640_480,": 0.0052282223,
 		",arch=x86_64,bench_type=micro,compiler=Clang,config=gpu,cpu_or_gpu=GPU,cpu_or_gpu_value=GeForce320M,model=MacMini4.1,name=GLInstancedArraysBench_one_0,os=Mac10.8,source_type=bench,sub_result=min_ms,test=GLInstancedArraysBench_one_0_640_480,":       7.122931e-06}
@@ -95,7 +95,7 @@ func _df(vcs vcsinfo.VCS, store ptracestore.PTraceStore, q *query.Query) (*dataf
 	if *verbose {
 		fmt.Printf("Requesting from %s to %s\n", beginTime, endTime)
 	}
-	return dataframe.NewFromQueryAndRange(vcs, store, beginTime, endTime, q, progress)
+	return dataframe.NewFromQueryAndRange(vcs, store, beginTime, endTime, q, ptracestore.STAT_VALUE, progress)
 }
 
 func count(vcs vcsinfo.VCS, store ptracestore.PTraceStore) {
@@ -14,6 +14,8 @@
    ------------+------------------+-----------------------
     sourceList | sourceIndex      | sourceFullname
    ------------+------------------+-----------------------
+    summaries  | traceid          | [index, summary]*
+   ------------+------------------+-----------------------
 
   The keys for 'traces' and 'sources' are structured keys, see the go/query package
   for more details.
@@ -67,5 +69,22 @@
 
   The largest sourceIndex used is stored at the key 'lastSourceIndex' and is incremented
   when new sourceFullname's are added.
+
+  Nanobench takes repeated samples for each measurement, and a summary of
+  those samples may be stored along with the value of a point. The summary is
+  the count, min, median, max, and standard deviation of the samples. The
+  storage in 'summaries' is the same as in 'traces', but each pair is an index
+  and then the summary:
+
+    [2, 10, 5.50, 5.62, 5.91, 0.12], ...
+
+  Not every point has a summary. Once a trace has a summary then every later
+  value added to the trace also gets a summary, values added without samples
+  get the summary of a single sample, i.e. a count of 1 and a standard
+  deviation of 0. That way the last summary for an index always describes
+  the last value for that index.
+
+  Points without a summary, including all the points in tiles written before
+  summaries were stored, act as if they had a single sample.
 */
 package ptracestore
@@ -27,6 +27,7 @@ const (
 	TRACE_VALUES_BUCKET_NAME  = "traces"
 	TRACE_SOURCES_BUCKET_NAME = "sources"
 	SOURCE_LIST_BUCKET_NAME   = "sourceList"
+	SUMMARIES_BUCKET_NAME     = "summaries"
 )
 
 var (
@@ -73,6 +74,13 @@ type PTraceStore interface {
 	//   usually the Google Storage URL.
 	Add(commitID *cid.CommitID, values map[string]float32, sourceFile string) error
 
+	// AddWithSummaries is the same as Add, but also stores a Summary of the
+	// samples each value was derived from.
+	//
+	// summaries - A map from the trace id to a Summary. Not every trace in
+	//   values needs to have a Summary.
+	AddWithSummaries(commitID *cid.CommitID, values map[string]float32, summaries map[string]*Summary, sourceFile string) error
+
 	// Retrieve the source and value for a given measurement in a given trace,
 	// and a non-nil error if no such point was found.
 	Details(commitID *cid.CommitID, traceID string) (string, float32, error)
@@ -84,6 +92,11 @@ type PTraceStore interface {
 	// The returned TraceSet will contain a slice of Trace, and that list will be
 	// empty if there are no matches.
 	Match(commitIDs []*cid.CommitID, matches KeyMatches, progress Progress) (TraceSet, error)
+
+	// MatchStat is the same as Match, but the values in the returned TraceSet
+	// are the given Stat of each point. Match is equivalent to MatchStat with
+	// a Stat of STAT_VALUE.
+	MatchStat(commitIDs []*cid.CommitID, matches KeyMatches, stat Stat, progress Progress) (TraceSet, error)
 }
 
 // BoltTraceStore is an implementation of PTraceStore that uses BoltDB.
@@ -161,6 +174,38 @@ type traceValue struct {
 	Value float32
 }
 
+// summaryValue is used to encode/decode trace summaries.
+type summaryValue struct {
+	Index  int64
+	Count  int32
+	Min    float32
+	Median float32
+	Max    float32
+	StdDev float32
+}
+
+func newSummaryValue(index int64, s *Summary) summaryValue {
+	return summaryValue{
+		Index:  index,
+		Count:  s.Count,
+		Min:    s.Min,
+		Median: s.Median,
+		Max:    s.Max,
+		StdDev: s.StdDev,
+	}
+}
+
+// summary returns the Summary stored in the summaryValue.
+func (s summaryValue) summary() *Summary {
+	return &Summary{
+		Count:  s.Count,
+		Min:    s.Min,
+		Median: s.Median,
+		Max:    s.Max,
+		StdDev: s.StdDev,
+	}
+}
+
 // sourceValue is used to encode/decode trace sources.
 type sourceValue struct {
 	Index  int64
@@ -231,6 +276,10 @@ func serialize(i interface{}) ([]byte, error) {
 }
 
 func (b *BoltTraceStore) Add(commitID *cid.CommitID, values map[string]float32, sourceFile string) error {
+	return b.AddWithSummaries(commitID, values, nil, sourceFile)
+}
+
+func (b *BoltTraceStore) AddWithSummaries(commitID *cid.CommitID, values map[string]float32, summaries map[string]*Summary, sourceFile string) error {
 	index := commitID.Offset % constants.COMMITS_PER_TILE
 	entry, err := b.getBoltDB(commitID, false)
 	if err != nil {
@@ -271,6 +320,10 @@ func (b *BoltTraceStore) Add(commitID *cid.CommitID, values map[string]float32,
 		if err != nil {
 			return fmt.Errorf("Failed to get bucket: %s", err)
 		}
+		sum, err := tx.CreateBucketIfNotExists([]byte(SUMMARIES_BUCKET_NAME))
+		if err != nil {
+			return fmt.Errorf("Failed to get bucket: %s", err)
+		}
 
 		// Add values and source index.
 		for traceID, value := range values {
@@ -299,6 +352,27 @@ func (b *BoltTraceStore) Add(commitID *cid.CommitID, values map[string]float32,
 			if err := s.Put([]byte(traceID), append(s.Get([]byte(traceID)), sourceBytes...)); err != nil {
 				return fmt.Errorf("bucket.Put() of source failed: %s", err)
 			}
+
+			// Write the summary. If there's no summary for this value but the
+			// trace already has summaries then write a single sample summary, so
+			// that an older summary at the same index doesn't take precedence
+			// over this value.
+			summary := summaries[traceID]
+			existing := sum.Get([]byte(traceID))
+			if summary == nil && existing == nil {
+				continue
+			}
+			if summary == nil {
+				summary = singleSummary(value)
+			}
+			summaryBytes, err := serialize(newSummaryValue(int64(index), summary))
+			if err != nil {
+				return err
+			}
+			// Append the serialized summaryValue to the current trace summaries.
+			if err := sum.Put([]byte(traceID), append(existing, summaryBytes...)); err != nil {
+				return fmt.Errorf("bucket.Put() of summary failed: %s", err)
+			}
 		}
 		return nil
 	}
@@ -478,7 +552,8 @@ func dup(b []byte) []byte {
 // loadMatches loads values into 'traceSet' that match the 'matches' from the
 // tile in the BoltDB 'db'.  Only values at the offsets in 'idxmap' are
 // actually loaded, and 'idxmap' determines where they are stored in the Trace.
-func loadMatches(entry *cacheEntry, idxmap map[int]int, matches KeyMatches, traceSet TraceSet, traceLen int) error {
+// The values loaded are the 'stat' of each point.
+func loadMatches(entry *cacheEntry, idxmap map[int]int, matches KeyMatches, stat Stat, traceSet TraceSet, traceLen int) error {
 	defer timer.New("loadMatches time").Stop()
 	defer entry.Done()
 
@@ -490,8 +565,13 @@ func loadMatches(entry *cacheEntry, idxmap map[int]int, matches KeyMatches, trac
 			// it just means it has no data.
 			return nil
 		}
+		// The summaries bucket doesn't exist in tiles that were written before
+		// summaries were stored, in which case every point acts as if it had a
+		// single sample.
+		summaries := tx.Bucket([]byte(SUMMARIES_BUCKET_NAME))
 		v := bucket.Cursor()
 		value := traceValue{}
+		summary := summaryValue{}
 		// Loop over the entire bucket.
 		for btraceid, rawValues := v.First(); btraceid != nil; btraceid, rawValues = v.Next() {
 			// Does the trace id match the query?
@@ -515,10 +595,34 @@ func loadMatches(entry *cacheEntry, idxmap map[int]int, matches KeyMatches, trac
 				}
 				// Store the value in trace if the index appears in idxmap.
 				if offset, ok := idxmap[int(value.Index)]; ok {
-					trace[offset] = value.Value
+					if stat == STAT_VALUE {
+						trace[offset] = value.Value
+					} else {
+						trace[offset] = singleSummary(value.Value).Get(stat)
+					}
 					// Don't break, we want the last value for index.
 				}
 			}
+			if stat == STAT_VALUE || summaries == nil {
+				continue
+			}
+
+			// Decode all the summaries stored for the trace, they override the
+			// single sample summaries of the values.
+			rawSummaries := summaries.Get(btraceid)
+			if rawSummaries == nil {
+				continue
+			}
+			buf = bytes.NewBuffer(rawSummaries)
+			for {
+				if err := binary.Read(buf, binary.LittleEndian, &summary); err != nil {
+					break
+				}
+				if offset, ok := idxmap[int(summary.Index)]; ok {
+					trace[offset] = summary.summary().Get(stat)
+					// Don't break, we want the last summary for index.
+				}
+			}
 		}
 		return nil
 	}
@@ -527,6 +631,10 @@ func loadMatches(entry *cacheEntry, idxmap map[int]int, matches KeyMatches, trac
 }
 
 func (b *BoltTraceStore) Match(commitIDs []*cid.CommitID, matches KeyMatches, progress Progress) (TraceSet, error) {
+	return b.MatchStat(commitIDs, matches, STAT_VALUE, progress)
+}
+
+func (b *BoltTraceStore) MatchStat(commitIDs []*cid.CommitID, matches KeyMatches, stat Stat, progress Progress) (TraceSet, error) {
 	ret := TraceSet{}
 	mapper := buildMapper(commitIDs)
 	i := 0
@@ -544,7 +652,7 @@ func (b *BoltTraceStore) Match(commitIDs []*cid.CommitID, matches KeyMatches, pr
 			return nil, fmt.Errorf("Failed to open tile from %s: %s", tm.commitID.Filename(), err)
 		}
 		// loadMatches calls entry.Done().
-		if err := loadMatches(entry, tm.idxmap, matches, ret, len(commitIDs)); err != nil {
+		if err := loadMatches(entry, tm.idxmap, matches, stat, ret, len(commitIDs)); err != nil {
 			return nil, fmt.Errorf("Failed to load traces from %s: %s", tm.commitID.Filename(), err)
 		}
 	}
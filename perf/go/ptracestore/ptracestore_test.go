@@ -277,3 +277,121 @@ func TestMatch(t *testing.T) {
 	assert.Equal(t, Trace{1.23, 2.34, 3.45, vec32.MISSING_DATA_SENTINEL}, traces[",config=565,test=foo,"])
 	assert.Equal(t, Trace{3.21, 5.43, 9.10, vec32.MISSING_DATA_SENTINEL}, traces[",config=8888,test=foo,"])
 }
+
+func TestMatchStat(t *testing.T) {
+	testutils.SmallTest(t)
+	setupStoreDir(t)
+	defer cleanup()
+
+	d, err := New(tmpDir)
+	assert.NoError(t, err)
+	commitID1 := &cid.CommitID{
+		Offset: 1,
+		Source: "master",
+	}
+	commitID2 := &cid.CommitID{
+		Offset: 2,
+		Source: "master",
+	}
+	commitID3 := &cid.CommitID{
+		Offset: 3,
+		Source: "master",
+	}
+	commitID4 := &cid.CommitID{
+		Offset: 4,
+		Source: "master",
+	}
+
+	// Only ",config=565," has samples.
+	values := map[string]float32{
+		",config=565,":  1.0,
+		",config=8888,": 3.0,
+	}
+	summaries := map[string]*Summary{
+		",config=565,": NewSummary([]float32{1, 2, 4, 5}),
+	}
+	err = d.AddWithSummaries(commitID1, values, summaries, "gs://foo")
+	assert.NoError(t, err)
+
+	// A re-run without samples replaces the summary at that commit.
+	err = d.Add(commitID2, values, "gs://foo")
+	assert.NoError(t, err)
+	summaries = map[string]*Summary{
+		",config=565,": NewSummary([]float32{7, 8, 9}),
+	}
+	err = d.AddWithSummaries(commitID2, values, summaries, "gs://foo")
+	assert.NoError(t, err)
+	err = d.Add(commitID2, values, "gs://foo")
+	assert.NoError(t, err)
+
+	values = map[string]float32{
+		",config=565,":  2.0,
+		",config=8888,": 4.0,
+	}
+	summaries = map[string]*Summary{
+		",config=565,": NewSummary([]float32{2, 3, 4}),
+	}
+	err = d.AddWithSummaries(commitID3, values, summaries, "gs://foo")
+	assert.NoError(t, err)
+
+	q, err := query.New(url.Values{})
+	assert.NoError(t, err)
+	commits := []*cid.CommitID{commitID1, commitID2, commitID3, commitID4}
+	e := vec32.MISSING_DATA_SENTINEL
+
+	traces, err := d.MatchStat(commits, q.Matches, STAT_VALUE, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, Trace{1, 1, 2, e}, traces[",config=565,"])
+	assert.Equal(t, Trace{3, 3, 4, e}, traces[",config=8888,"])
+
+	traces, err = d.MatchStat(commits, q.Matches, STAT_COUNT, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, Trace{4, 1, 3, e}, traces[",config=565,"])
+	assert.Equal(t, Trace{1, 1, 1, e}, traces[",config=8888,"])
+
+	traces, err = d.MatchStat(commits, q.Matches, STAT_MEDIAN, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, Trace{3, 1, 3, e}, traces[",config=565,"])
+	assert.Equal(t, Trace{3, 3, 4, e}, traces[",config=8888,"])
+
+	traces, err = d.MatchStat(commits, q.Matches, STAT_MAX, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, Trace{5, 1, 4, e}, traces[",config=565,"])
+
+	traces, err = d.MatchStat(commits, q.Matches, STAT_STDDEV, nil)
+	assert.NoError(t, err)
+	assert.InDelta(t, 1.5811, traces[",config=565,"][0], 0.0001)
+	assert.Equal(t, float32(0), traces[",config=565,"][1])
+	assert.Equal(t, Trace{0, 0, 0, e}, traces[",config=8888,"])
+}
+
+func TestNewSummary(t *testing.T) {
+	testutils.SmallTest(t)
+	assert.Nil(t, NewSummary([]float32{}))
+	assert.Nil(t, NewSummary([]float32{vec32.MISSING_DATA_SENTINEL}))
+
+	s := NewSummary([]float32{3, 1, vec32.MISSING_DATA_SENTINEL, 2})
+	assert.Equal(t, &Summary{Count: 3, Min: 1, Median: 2, Max: 3, StdDev: s.StdDev}, s)
+	assert.InDelta(t, 0.8165, s.StdDev, 0.0001)
+
+	s = NewSummary([]float32{4, 1, 2, 3})
+	assert.Equal(t, float32(2.5), s.Median)
+	assert.Equal(t, float32(4), s.Get(STAT_COUNT))
+	assert.Equal(t, float32(1), s.Get(STAT_MIN))
+	assert.Equal(t, float32(4), s.Get(STAT_MAX))
+	assert.Equal(t, vec32.MISSING_DATA_SENTINEL, s.Get(STAT_VALUE))
+}
+
+func TestParseStat(t *testing.T) {
+	testutils.SmallTest(t)
+	stat, err := ParseStat("")
+	assert.NoError(t, err)
+	assert.Equal(t, STAT_VALUE, stat)
+
+	stat, err = ParseStat("median")
+	assert.NoError(t, err)
+	assert.Equal(t, STAT_MEDIAN, stat)
+
+	_, err = ParseStat("mode")
+	assert.Error(t, err)
+}
@@ -0,0 +1,116 @@
+package ptracestore
+
+import (
+	"fmt"
+	"sort"
+
+	"go.skia.org/infra/go/vec32"
+)
+
+// Stat is the statistic of each point that is returned from MatchStat.
+type Stat string
+
+const (
+	// STAT_VALUE is the value of the point as it was ingested.
+	STAT_VALUE Stat = "value"
+
+	// The rest of the stats are taken from the Summary of the samples of the
+	// point. Points that were stored without a Summary act as if they had a
+	// single sample, their value.
+	STAT_COUNT  Stat = "count"
+	STAT_MIN    Stat = "min"
+	STAT_MEDIAN Stat = "median"
+	STAT_MAX    Stat = "max"
+	STAT_STDDEV Stat = "stddev"
+)
+
+// ALL_STATS is the list of all valid Stats.
+var ALL_STATS = []Stat{STAT_VALUE, STAT_COUNT, STAT_MIN, STAT_MEDIAN, STAT_MAX, STAT_STDDEV}
+
+// ParseStat converts a string into a Stat, returning an error if the string
+// isn't a valid Stat. The empty string is parsed as STAT_VALUE.
+func ParseStat(s string) (Stat, error) {
+	if s == "" {
+		return STAT_VALUE, nil
+	}
+	for _, stat := range ALL_STATS {
+		if string(stat) == s {
+			return stat, nil
+		}
+	}
+	return STAT_VALUE, fmt.Errorf("Unknown stat: %q", s)
+}
+
+// Summary is a summary of the repeated samples that were taken to produce a
+// single point in a trace.
+type Summary struct {
+	Count  int32   `json:"count"`
+	Min    float32 `json:"min"`
+	Median float32 `json:"median"`
+	Max    float32 `json:"max"`
+	StdDev float32 `json:"stddev"`
+}
+
+// NewSummary returns a Summary of the given samples, or nil if there are no
+// samples. Missing values are ignored.
+func NewSummary(samples []float32) *Summary {
+	sorted := make([]float32, 0, len(samples))
+	for _, x := range samples {
+		if x != vec32.MISSING_DATA_SENTINEL {
+			sorted = append(sorted, x)
+		}
+	}
+	if len(sorted) == 0 {
+		return nil
+	}
+	sort.Sort(float32Slice(sorted))
+	n := len(sorted)
+	median := sorted[n/2]
+	if n%2 == 0 {
+		median = (sorted[n/2-1] + sorted[n/2]) / 2
+	}
+	_, stddev, _ := vec32.MeanAndStdDev(sorted)
+	return &Summary{
+		Count:  int32(n),
+		Min:    sorted[0],
+		Median: median,
+		Max:    sorted[n-1],
+		StdDev: stddev,
+	}
+}
+
+// singleSummary returns the Summary of a point with a single sample.
+func singleSummary(value float32) *Summary {
+	return &Summary{
+		Count:  1,
+		Min:    value,
+		Median: value,
+		Max:    value,
+		StdDev: 0,
+	}
+}
+
+// Get returns the value of the given stat. STAT_VALUE isn't part of a Summary,
+// so vec32.MISSING_DATA_SENTINEL is returned for it.
+func (s *Summary) Get(stat Stat) float32 {
+	switch stat {
+	case STAT_COUNT:
+		return float32(s.Count)
+	case STAT_MIN:
+		return s.Min
+	case STAT_MEDIAN:
+		return s.Median
+	case STAT_MAX:
+		return s.Max
+	case STAT_STDDEV:
+		return s.StdDev
+	default:
+		return vec32.MISSING_DATA_SENTINEL
+	}
+}
+
+type float32Slice []float32
+
+func (p float32Slice) Len() int           { return len(p) }
+func (p float32Slice) Less(i, j int) bool { return p[i] < p[j] }
+func (p float32Slice) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
@@ -22,6 +22,7 @@ import (
 
 	"go.skia.org/infra/go/auth"
 	"go.skia.org/infra/go/common"
+	"go.skia.org/infra/go/email"
 	"go.skia.org/infra/go/eventbus"
 	"go.skia.org/infra/go/gerrit"
 	"go.skia.org/infra/go/git/gitinfo"
@@ -29,6 +30,7 @@ import (
 	"go.skia.org/infra/go/human"
 	"go.skia.org/infra/go/influxdb"
 	"go.skia.org/infra/go/ingestion"
+	"go.skia.org/infra/go/issues"
 	"go.skia.org/infra/go/login"
 	"go.skia.org/infra/go/query"
 	"go.skia.org/infra/go/rietveld"
@@ -38,6 +40,7 @@ import (
 	"go.skia.org/infra/go/util"
 	"go.skia.org/infra/perf/go/activitylog"
 	"go.skia.org/infra/perf/go/alerting"
+	"go.skia.org/infra/perf/go/alerts"
 	"go.skia.org/infra/perf/go/annotate"
 	"go.skia.org/infra/perf/go/cid"
 	"go.skia.org/infra/perf/go/clustering"
@@ -106,20 +109,23 @@ var (
 
 // flags
 var (
-	configFilename = flag.String("config_filename", "default.toml", "Configuration file in TOML format.")
-	gitRepoDir     = flag.String("git_repo_dir", "../../../skia", "Directory location for the Skia repo.")
-	gitRepoURL     = flag.String("git_repo_url", "https://skia.googlesource.com/skia", "The URL to pass to git clone for the source repository.")
-	influxDatabase = flag.String("influxdb_database", influxdb.DEFAULT_DATABASE, "The InfluxDB database.")
-	influxHost     = flag.String("influxdb_host", influxdb.DEFAULT_HOST, "The InfluxDB hostname.")
-	influxPassword = flag.String("influxdb_password", influxdb.DEFAULT_PASSWORD, "The InfluxDB password.")
-	influxUser     = flag.String("influxdb_name", influxdb.DEFAULT_USER, "The InfluxDB username.")
-	local          = flag.Bool("local", false, "Running locally if true. As opposed to in production.")
-	newonly        = flag.Bool("newonly", false, "Only run with the new UI, don't load tracedb stuff.")
-	port           = flag.String("port", ":8000", "HTTP service address (e.g., ':8000')")
-	ptraceStoreDir = flag.String("ptrace_store_dir", "/tmp/ptracestore", "The directory where the ptracestore tiles are stored.")
-	resourcesDir   = flag.String("resources_dir", "", "The directory to find templates, JS, and CSS files. If blank the current directory will be used.")
-	tileSize       = flag.Int("tile_size", 100, "The size of Tiles.")
-	traceservice   = flag.String("trace_service", "localhost:9090", "The address of the traceservice endpoint.")
+	configFilename    = flag.String("config_filename", "default.toml", "Configuration file in TOML format.")
+	emailClientID     = flag.String("email_clientid", "", "OAuth Client ID for sending email to the owners of alert configs. No emails are sent if empty.")
+	emailClientSecret = flag.String("email_clientsecret", "", "OAuth Client Secret for sending email.")
+	emailTokenCache   = flag.String("email_token_cache_file", "google_email_token.data", "Path to the file where to cache the email OAuth token.")
+	gitRepoDir        = flag.String("git_repo_dir", "../../../skia", "Directory location for the Skia repo.")
+	gitRepoURL        = flag.String("git_repo_url", "https://skia.googlesource.com/skia", "The URL to pass to git clone for the source repository.")
+	influxDatabase    = flag.String("influxdb_database", influxdb.DEFAULT_DATABASE, "The InfluxDB database.")
+	influxHost        = flag.String("influxdb_host", influxdb.DEFAULT_HOST, "The InfluxDB hostname.")
+	influxPassword    = flag.String("influxdb_password", influxdb.DEFAULT_PASSWORD, "The InfluxDB password.")
+	influxUser        = flag.String("influxdb_name", influxdb.DEFAULT_USER, "The InfluxDB username.")
+	local             = flag.Bool("local", false, "Running locally if true. As opposed to in production.")
+	newonly           = flag.Bool("newonly", false, "Only run with the new UI, don't load tracedb stuff.")
+	port              = flag.String("port", ":8000", "HTTP service address (e.g., ':8000')")
+	ptraceStoreDir    = flag.String("ptrace_store_dir", "/tmp/ptracestore", "The directory where the ptracestore tiles are stored.")
+	resourcesDir      = flag.String("resources_dir", "", "The directory to find templates, JS, and CSS files. If blank the current directory will be used.")
+	tileSize          = flag.Int("tile_size", 100, "The size of Tiles.")
+	traceservice      = flag.String("trace_service", "localhost:9090", "The address of the traceservice endpoint.")
 )
 
 var (
@@ -138,6 +144,8 @@ var (
 	frameRequests *dataframe.RunningFrameRequests
 
 	clusterRequests *clustering2.RunningClusterRequests
+
+	alertStore alerts.Store
 )
 
 func loadTemplates() {
@@ -1315,9 +1323,14 @@ func frameStatusHandler(w http.ResponseWriter, r *http.Request) {
 
 // frameResultsHandler returns the results of a pending FrameRequest.
 //
+// By default the FrameResponse is returned as JSON. The DataFrame of the
+// response can be downloaded instead by passing the query parameter
+// format=csv or format=json, where json is a dataframe.CompactDataFrame.
+// Downloads contain all the traces of the frame, even if the FrameResponse
+// was truncated.
+//
 // See frameStatusHandler for more details.
 func frameResultsHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
 	id := mux.Vars(r)["id"]
 	df, err := frameRequests.Response(id)
 	if err != nil {
@@ -1325,8 +1338,44 @@ func frameResultsHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := json.NewEncoder(w).Encode(df); err != nil {
-		glog.Errorf("Failed to encode response: %s", err)
+	switch format := r.FormValue("format"); format {
+	case "":
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(df); err != nil {
+			glog.Errorf("Failed to encode response: %s", err)
+		}
+	case dataframe.FORMAT_CSV, dataframe.FORMAT_JSON:
+		if df == nil || df.DataFrame == nil {
+			httputils.ReportError(w, r, fmt.Errorf("Frame %s has no results.", id), "The frame isn't finished.")
+			return
+		}
+		// The FrameResponse holds at most MAX_TRACES_IN_RESPONSE traces, so
+		// rebuild the frame without that limit if it may have been truncated.
+		exportDF := df.DataFrame
+		if len(exportDF.TraceSet) >= dataframe.MAX_TRACES_IN_RESPONSE {
+			req, err := frameRequests.Request(id)
+			if err != nil {
+				httputils.ReportError(w, r, err, "Failed to find the frame request.")
+				return
+			}
+			resp, err := dataframe.RunFrameRequest(req, git)
+			if err != nil {
+				httputils.ReportError(w, r, err, "Failed to build the frame for export.")
+				return
+			}
+			exportDF = resp.DataFrame
+		}
+		contentType := "text/csv"
+		if format == dataframe.FORMAT_JSON {
+			contentType = "application/json"
+		}
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=frame-%s.%s", id, format))
+		if err := dataframe.Write(w, exportDF, format); err != nil {
+			glog.Errorf("Failed to export frame: %s", err)
+		}
+	default:
+		httputils.ReportError(w, r, fmt.Errorf("Unknown format %q.", format), "Unknown export format.")
 	}
 }
 
@@ -1406,6 +1455,95 @@ func clusterStartHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// stepStartHandler takes a POST'd StepRequest and starts a long running Go
+// routine to do step detection on the individual traces. The ID of the long
+// running routine is returned and its status and results are available from
+// clusterStatusHandler, the same as for clustering.
+func stepStartHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	req := &clustering2.StepRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httputils.ReportError(w, r, err, "Could not decode POST body.")
+		return
+	}
+	if err := req.Validate(); err != nil {
+		httputils.ReportError(w, r, err, "Invalid step detection request.")
+		return
+	}
+	resp := ClusterStartResponse{
+		ID: clusterRequests.AddStep(req),
+	}
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		glog.Errorf("Failed to encode paramset: %s", err)
+	}
+}
+
+// alertListHandler returns all the alert configs as JSON.
+func alertListHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	configs, err := alertStore.List()
+	if err != nil {
+		httputils.ReportError(w, r, err, "Failed to load alert configs.")
+		return
+	}
+	if err := json.NewEncoder(w).Encode(configs); err != nil {
+		glog.Errorf("Failed to encode alert configs: %s", err)
+	}
+}
+
+// alertNewHandler returns a new alert config with default values as JSON.
+func alertNewHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(alerts.NewConfig()); err != nil {
+		glog.Errorf("Failed to encode alert config: %s", err)
+	}
+}
+
+// alertUpdateHandler takes a POST'd alerts.Config and stores it. If the id of
+// the config is alerts.INVALID_ID then a new config is added. The stored
+// config is returned as JSON.
+func alertUpdateHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if login.LoggedInAs(r) == "" {
+		httputils.ReportError(w, r, fmt.Errorf("Not logged in."), "You must be logged in to change an alert config.")
+		return
+	}
+	cfg := alerts.NewConfig()
+	if err := json.NewDecoder(r.Body).Decode(cfg); err != nil {
+		httputils.ReportError(w, r, err, "Could not decode POST body.")
+		return
+	}
+	if err := cfg.Validate(); err != nil {
+		httputils.ReportError(w, r, err, "Invalid alert config.")
+		return
+	}
+	if err := alertStore.Save(cfg); err != nil {
+		httputils.ReportError(w, r, err, "Failed to store alert config.")
+		return
+	}
+	if err := json.NewEncoder(w).Encode(cfg); err != nil {
+		glog.Errorf("Failed to encode alert config: %s", err)
+	}
+}
+
+// alertDeleteHandler deletes the alert config with the id given in the URL.
+func alertDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	if login.LoggedInAs(r) == "" {
+		httputils.ReportError(w, r, fmt.Errorf("Not logged in."), "You must be logged in to delete an alert config.")
+		return
+	}
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		httputils.ReportError(w, r, err, "Invalid alert config id.")
+		return
+	}
+	if err := alertStore.Delete(id); err != nil {
+		httputils.ReportError(w, r, err, "Failed to delete alert config.")
+		return
+	}
+}
+
 // ClusterStatus is used to serialize a JSON response in clusterStatusHandler.
 type ClusterStatus struct {
 	State   clustering2.ProcessState     `json:"state"`
@@ -1558,6 +1696,35 @@ func initIngestion() {
 	}
 }
 
+// startAlerts starts the continuous evaluation of the alert configs. Must be
+// called after the database has been initialized.
+func startAlerts() {
+	alertStore = alerts.NewStore()
+
+	var issueTracker issues.IssueTracker
+	client, err := auth.NewDefaultJWTServiceAccountClient("https://www.googleapis.com/auth/userinfo.email")
+	if err != nil {
+		glog.Errorf("Not filing issues for alerts, not able to construct an authenticated client: %s", err)
+	} else {
+		issueTracker = issues.NewMonorailIssueTracker(client)
+	}
+
+	var emailer email.Emailer
+	if *emailClientID != "" {
+		gmail, err := email.NewGMail(*emailClientID, *emailClientSecret, *emailTokenCache)
+		if err != nil {
+			glog.Fatalf("Failed to create email auth: %s", err)
+		}
+		emailer = gmail
+	}
+
+	perfURL := "https://perf.skia.org"
+	if *local {
+		perfURL = "http://localhost" + *port
+	}
+	alerts.NewContinuous(alertStore, git, cidl, issueTracker, emailer, perfURL).Start(time.Minute)
+}
+
 func main() {
 	defer common.LogPanic()
 	// Setup DB flags.
@@ -1579,6 +1746,7 @@ func main() {
 		stats.Start(masterTileBuilder, git)
 		alerting.Start(masterTileBuilder)
 	}
+	startAlerts()
 
 	var redirectURL = fmt.Sprintf("http://localhost%s/oauth2callback/", *port)
 	if !*local {
@@ -1608,7 +1776,12 @@ func main() {
 	router.HandleFunc("/_/frame/status/{id:[a-zA-Z0-9]+}", frameStatusHandler)
 	router.HandleFunc("/_/frame/results/{id:[a-zA-Z0-9]+}", frameResultsHandler)
 	router.HandleFunc("/_/cluster/start", clusterStartHandler)
+	router.HandleFunc("/_/step/start", stepStartHandler)
 	router.HandleFunc("/_/cluster/status/{id:[a-zA-Z0-9]+}", clusterStatusHandler)
+	router.HandleFunc("/_/alert/list", alertListHandler).Methods("GET")
+	router.HandleFunc("/_/alert/new", alertNewHandler).Methods("GET")
+	router.HandleFunc("/_/alert/update", alertUpdateHandler).Methods("POST")
+	router.HandleFunc("/_/alert/delete/{id:[0-9]+}", alertDeleteHandler).Methods("POST")
 
 	router.HandleFunc("/frame/", templateHandler("frame.html"))
 	router.HandleFunc("/shortcuts/", shortcutHandler)
@@ -29,6 +29,10 @@ type TaskCache interface {
 	// by creation time.
 	GetTasksByKey(*TaskKey) ([]*Task, error)
 
+	// GetTasksByPropertiesHash returns the tasks with the given
+	// PropertiesHash, sorted by creation time.
+	GetTasksByPropertiesHash(string) ([]*Task, error)
+
 	// GetTasksForCommits retrieves all tasks which included[1] each of the
 	// given commits. Returns a map whose keys are commit hashes and values are
 	// sub-maps whose keys are task spec names and values are tasks.
@@ -80,6 +84,8 @@ type taskCache struct {
 	tasksByCommit map[string]map[string]map[string]*Task
 	// map[TaskKey]map[task_id]*Task
 	tasksByKey map[TaskKey]map[string]*Task
+	// map[properties_hash]map[task_id]*Task
+	tasksByPropertiesHash map[string]map[string]*Task
 	// tasksByTime is sorted by Task.Created.
 	tasksByTime []*Task
 	timePeriod  time.Duration
@@ -115,6 +121,20 @@ func (c *taskCache) GetTasksByKey(k *TaskKey) ([]*Task, error) {
 	return rv, nil
 }
 
+// See documentation for TaskCache interface.
+func (c *taskCache) GetTasksByPropertiesHash(hash string) ([]*Task, error) {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+
+	tasks := c.tasksByPropertiesHash[hash]
+	rv := make([]*Task, 0, len(tasks))
+	for _, t := range tasks {
+		rv = append(rv, t.Copy())
+	}
+	sort.Sort(TaskSlice(rv))
+	return rv, nil
+}
+
 // See documentation for TaskCache interface.
 func (c *taskCache) GetTasksForCommits(repo string, commits []string) (map[string]map[string]*Task, error) {
 	c.mtx.RLock()
@@ -211,6 +231,21 @@ func (c *taskCache) removeFromTasksByCommit(task *Task) {
 
 }
 
+// removeFromTasksByPropertiesHash removes task (which must be a
+// previously-inserted Task, not a new Task) from c.tasksByPropertiesHash.
+// Assumes the caller holds a lock.
+func (c *taskCache) removeFromTasksByPropertiesHash(task *Task) {
+	if task.PropertiesHash == "" {
+		return
+	}
+	if byHash, ok := c.tasksByPropertiesHash[task.PropertiesHash]; ok {
+		delete(byHash, task.Id)
+		if len(byHash) == 0 {
+			delete(c.tasksByPropertiesHash, task.PropertiesHash)
+		}
+	}
+}
+
 // expireTasks removes data from c whose Created time is before start. Assumes
 // the caller holds a lock. This is a helper for expireAndUpdate.
 func (c *taskCache) expireTasks(start time.Time) {
@@ -242,6 +277,9 @@ func (c *taskCache) expireTasks(start time.Time) {
 			}
 		}
 
+		// Tasks by properties hash.
+		c.removeFromTasksByPropertiesHash(task)
+
 		// Tasks by time.
 		c.tasksByTime[i] = nil // Allow GC.
 
@@ -278,6 +316,16 @@ func (c *taskCache) insertOrUpdateTask(task *Task) {
 		// If we already know about this task, the blamelist might have changed, so
 		// we need to remove it from tasksByCommit and re-insert where needed.
 		c.removeFromTasksByCommit(old)
+		c.removeFromTasksByPropertiesHash(old)
+	}
+	// Insert into tasksByPropertiesHash.
+	if task.PropertiesHash != "" {
+		byHash, ok := c.tasksByPropertiesHash[task.PropertiesHash]
+		if !ok {
+			byHash = map[string]*Task{}
+			c.tasksByPropertiesHash[task.PropertiesHash] = byHash
+		}
+		byHash[task.Id] = task
 	}
 	// Insert the task into tasksByCommits.
 	commitMap, ok := c.tasksByCommit[task.Repo]
@@ -376,6 +424,7 @@ func (c *taskCache) reset(now time.Time) error {
 	c.tasks = map[string]*Task{}
 	c.tasksByCommit = map[string]map[string]map[string]*Task{}
 	c.tasksByKey = map[TaskKey]map[string]*Task{}
+	c.tasksByPropertiesHash = map[string]map[string]*Task{}
 	c.unfinished = map[string]*Task{}
 	c.expireAndUpdate(start, tasks)
 	return nil
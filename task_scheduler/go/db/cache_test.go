@@ -179,6 +179,50 @@ func TestTaskCacheGetTasksFromDateRange(t *testing.T) {
 	testutils.AssertDeepEqual(t, []*Task{}, tasks)
 }
 
+func TestTaskCacheGetTasksByPropertiesHash(t *testing.T) {
+	testutils.SmallTest(t)
+	db := NewInMemoryTaskDB()
+
+	period := 10 * time.Minute
+	timeStart := time.Now().Add(-period)
+
+	t1 := makeTask(timeStart.Add(time.Minute), []string{"a"})
+	t1.PropertiesHash = "abc"
+	t2 := makeTask(timeStart.Add(2*time.Minute), []string{"b"})
+	t2.PropertiesHash = "abc"
+	t3 := makeTask(timeStart.Add(3*time.Minute), []string{"c"})
+	t3.PropertiesHash = "def"
+	t4 := makeTask(timeStart.Add(4*time.Minute), []string{"d"})
+	assert.NoError(t, db.PutTasks([]*Task{t1, t2, t3, t4}))
+
+	taskCacheI, err := NewTaskCache(db, period)
+	assert.NoError(t, err)
+	c := taskCacheI.(*taskCache) // To access update method.
+
+	check := func(hash string, expect ...*Task) {
+		tasks, err := c.GetTasksByPropertiesHash(hash)
+		assert.NoError(t, err)
+		testutils.AssertDeepEqual(t, append([]*Task{}, expect...), tasks)
+	}
+	check("abc", t1, t2)
+	check("def", t3)
+	check("")
+
+	// Change the hash of a task.
+	t2.PropertiesHash = "def"
+	assert.NoError(t, db.PutTask(t2))
+	assert.NoError(t, c.Update())
+	check("abc", t1)
+	check("def", t2, t3)
+
+	// Expire t1 and t2.
+	assert.NoError(t, c.update(timeStart.Add(period).Add(3*time.Minute)))
+	check("abc")
+	check("def", t3)
+	_, ok := c.tasksByPropertiesHash["abc"]
+	assert.False(t, ok)
+}
+
 func TestTaskCacheMultiRepo(t *testing.T) {
 	testutils.SmallTest(t)
 	db := NewInMemoryTaskDB()
@@ -24,6 +24,9 @@ type TaskComment struct {
 	TaskId    string    `json:"taskId"`
 	User      string    `json:"user"`
 	Message   string    `json:"message"`
+	// Deleted is only set for comments returned from GetModifiedComments,
+	// indicating that the comment was deleted.
+	Deleted bool `json:"deleted,omitempty"`
 }
 
 func (c TaskComment) Copy() *TaskComment {
@@ -42,6 +45,9 @@ type TaskSpecComment struct {
 	Flaky         bool      `json:"flaky"`
 	IgnoreFailure bool      `json:"ignoreFailure"`
 	Message       string    `json:"message"`
+	// Deleted is only set for comments returned from GetModifiedComments,
+	// indicating that the comment was deleted.
+	Deleted bool `json:"deleted,omitempty"`
 }
 
 func (c TaskSpecComment) Copy() *TaskSpecComment {
@@ -58,12 +64,36 @@ type CommitComment struct {
 	Timestamp time.Time `json:"time"`
 	User      string    `json:"user"`
 	Message   string    `json:"message"`
+	// Deleted is only set for comments returned from GetModifiedComments,
+	// indicating that the comment was deleted.
+	Deleted bool `json:"deleted,omitempty"`
 }
 
 func (c CommitComment) Copy() *CommitComment {
 	return &c
 }
 
+// taskCommentSlice implements sort.Interface, sorting by Timestamp.
+type taskCommentSlice []*TaskComment
+
+func (s taskCommentSlice) Len() int           { return len(s) }
+func (s taskCommentSlice) Less(i, j int) bool { return s[i].Timestamp.Before(s[j].Timestamp) }
+func (s taskCommentSlice) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+// taskSpecCommentSlice implements sort.Interface, sorting by Timestamp.
+type taskSpecCommentSlice []*TaskSpecComment
+
+func (s taskSpecCommentSlice) Len() int           { return len(s) }
+func (s taskSpecCommentSlice) Less(i, j int) bool { return s[i].Timestamp.Before(s[j].Timestamp) }
+func (s taskSpecCommentSlice) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+// commitCommentSlice implements sort.Interface, sorting by Timestamp.
+type commitCommentSlice []*CommitComment
+
+func (s commitCommentSlice) Len() int           { return len(s) }
+func (s commitCommentSlice) Less(i, j int) bool { return s[i].Timestamp.Before(s[j].Timestamp) }
+func (s commitCommentSlice) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
 // RepoComments contains comments that all pertain to the same repository.
 type RepoComments struct {
 	// Repo is the repository (Repo field) of all the comments contained in
@@ -127,6 +157,22 @@ type CommentDB interface {
 	// DeleteCommitComment deletes the matching CommitComment from the database.
 	// Non-ID fields of the argument are ignored.
 	DeleteCommitComment(*CommitComment) error
+
+	// GetModifiedComments returns all comments added or deleted since the
+	// last time GetModifiedComments was run with the given id. Deleted
+	// comments have their Deleted field set. Each of the returned slices is
+	// sorted by Timestamp.
+	GetModifiedComments(string) ([]*TaskComment, []*TaskSpecComment, []*CommitComment, error)
+
+	// StartTrackingModifiedComments initiates tracking of modified comments
+	// for the current caller. Returns a unique ID which can be used by the
+	// caller to retrieve comments which have been added or deleted since the
+	// last query. The ID expires after a period of inactivity.
+	StartTrackingModifiedComments() (string, error)
+
+	// StopTrackingModifiedComments cancels tracking of modified comments for
+	// the provided ID.
+	StopTrackingModifiedComments(string)
 }
 
 // CommentBox implements CommentDB with in-memory storage.
@@ -142,6 +188,9 @@ type CommentBox struct {
 	comments map[string]*RepoComments
 	// writer is called to persist comments after every change.
 	writer func(map[string]*RepoComments) error
+	// ModifiedComments is embedded in order to implement the modified
+	// comment tracking methods of CommentDB.
+	ModifiedComments
 }
 
 // NewCommentBoxWithPersistence creates a CommentBox that is initialized with
@@ -282,6 +331,7 @@ func (b *CommentBox) PutTaskComment(c *TaskComment) error {
 		}
 		return err
 	}
+	b.TrackModifiedTaskComment(c)
 	return nil
 }
 
@@ -301,6 +351,9 @@ func (b *CommentBox) DeleteTaskComment(c *TaskComment) error {
 			}
 			return err
 		}
+		deleted := existing.Copy()
+		deleted.Deleted = true
+		b.TrackModifiedTaskComment(deleted)
 	}
 	return nil
 }
@@ -379,6 +432,7 @@ func (b *CommentBox) PutTaskSpecComment(c *TaskSpecComment) error {
 		}
 		return err
 	}
+	b.TrackModifiedTaskSpecComment(c)
 	return nil
 }
 
@@ -398,6 +452,9 @@ func (b *CommentBox) DeleteTaskSpecComment(c *TaskSpecComment) error {
 			}
 			return err
 		}
+		deleted := existing.Copy()
+		deleted.Deleted = true
+		b.TrackModifiedTaskSpecComment(deleted)
 	}
 	return nil
 }
@@ -476,6 +533,7 @@ func (b *CommentBox) PutCommitComment(c *CommitComment) error {
 		}
 		return err
 	}
+	b.TrackModifiedCommitComment(c)
 	return nil
 }
 
@@ -495,6 +553,9 @@ func (b *CommentBox) DeleteCommitComment(c *CommitComment) error {
 			}
 			return err
 		}
+		deleted := existing.Copy()
+		deleted.Deleted = true
+		b.TrackModifiedCommitComment(deleted)
 	}
 	return nil
 }
@@ -13,6 +13,7 @@ import (
 func TestCopyTaskComment(t *testing.T) {
 	testutils.SmallTest(t)
 	v := makeTaskComment(1, 1, 1, 1, time.Now())
+	v.Deleted = true
 	testutils.AssertCopy(t, v, v.Copy())
 }
 
@@ -21,12 +22,14 @@ func TestCopyTaskSpecComment(t *testing.T) {
 	v := makeTaskSpecComment(1, 1, 1, time.Now())
 	v.Flaky = true
 	v.IgnoreFailure = true
+	v.Deleted = true
 	testutils.AssertCopy(t, v, v.Copy())
 }
 
 func TestCopyCommitComment(t *testing.T) {
 	testutils.SmallTest(t)
 	v := makeCommitComment(1, 1, 1, time.Now())
+	v.Deleted = true
 	testutils.AssertCopy(t, v, v.Copy())
 }
 
@@ -55,6 +58,11 @@ func TestCommentBox(t *testing.T) {
 	TestCommentDB(t, &CommentBox{})
 }
 
+func TestCommentBoxModified(t *testing.T) {
+	testutils.SmallTest(t)
+	TestCommentDBModified(t, &CommentBox{})
+}
+
 // TestCommentBoxWithPersistence checks that NewCommentBoxWithPersistence can be
 // initialized with a persisted map and will correctly write changes to the
 // provided writer.
@@ -0,0 +1,141 @@
+package db
+
+import (
+	"fmt"
+	"strconv"
+)
+
+const (
+	// DEPENDENCY_ON_SUCCESS indicates that the dependent TaskSpec should
+	// run after a Task for the parent TaskSpec succeeds. This is the
+	// behavior of TaskSpec.Dependencies.
+	DEPENDENCY_ON_SUCCESS = "success"
+
+	// DEPENDENCY_ON_FAILURE indicates that the dependent TaskSpec should
+	// run after a Task for the parent TaskSpec fails, and should not run if
+	// it succeeds.
+	DEPENDENCY_ON_FAILURE = "failure"
+
+	// DEPENDENCY_ON_ANY indicates that the dependent TaskSpec should run
+	// after a Task for the parent TaskSpec finishes, regardless of its
+	// result.
+	DEPENDENCY_ON_ANY = "any"
+
+	// DEPENDENCY_ON_OUTPUT indicates that the dependent TaskSpec should
+	// run after a Task for the parent TaskSpec succeeds, if a key in a JSON
+	// file in its isolated output has the expected value.
+	DEPENDENCY_ON_OUTPUT = "output"
+)
+
+// DependencyOutputChecker returns true iff the output of the Task with the
+// given ID satisfies the given DEPENDENCY_ON_OUTPUT TaskDependency.
+type DependencyOutputChecker func(dep *TaskDependency, parentId string) (bool, error)
+
+// TaskDependency describes a conditional dependency on another TaskSpec.
+//
+// TaskDependency is stored as part of a Job, which is stored as a GOB, so
+// changes must maintain backwards compatibility.
+type TaskDependency struct {
+	// Task is the name of the parent TaskSpec.
+	Task string `json:"task"`
+
+	// On indicates which results of the parent Task trigger the dependent
+	// TaskSpec. One of DEPENDENCY_ON_SUCCESS, DEPENDENCY_ON_FAILURE,
+	// DEPENDENCY_ON_ANY, or DEPENDENCY_ON_OUTPUT.
+	On string `json:"on"`
+
+	// OutputFile is the path of a JSON file within the isolated output of
+	// the parent Task. Required iff On is DEPENDENCY_ON_OUTPUT.
+	OutputFile string `json:"output_file,omitempty"`
+
+	// OutputKey is a top-level key in OutputFile. Required iff On is
+	// DEPENDENCY_ON_OUTPUT.
+	OutputKey string `json:"output_key,omitempty"`
+
+	// OutputValue is the expected value of OutputKey, formatted as a
+	// string. If empty, the dependency is satisfied if OutputKey is present
+	// and its value is not false, zero, empty, or null.
+	OutputValue string `json:"output_value,omitempty"`
+}
+
+// Validate returns an error if the TaskDependency is not valid.
+func (d *TaskDependency) Validate() error {
+	if d.Task == "" {
+		return fmt.Errorf("Conditional dependency must specify a task.")
+	}
+	switch d.On {
+	case DEPENDENCY_ON_SUCCESS, DEPENDENCY_ON_FAILURE, DEPENDENCY_ON_ANY:
+		if d.OutputFile != "" || d.OutputKey != "" || d.OutputValue != "" {
+			return fmt.Errorf("Conditional dependency on %q: output_file, output_key, and output_value are only valid with on=%q.", d.Task, DEPENDENCY_ON_OUTPUT)
+		}
+	case DEPENDENCY_ON_OUTPUT:
+		if d.OutputFile == "" || d.OutputKey == "" {
+			return fmt.Errorf("Conditional dependency on %q: output_file and output_key are required with on=%q.", d.Task, DEPENDENCY_ON_OUTPUT)
+		}
+	default:
+		return fmt.Errorf("Conditional dependency on %q: invalid on value %q; must be one of %q, %q, %q, or %q.", d.Task, d.On, DEPENDENCY_ON_SUCCESS, DEPENDENCY_ON_FAILURE, DEPENDENCY_ON_ANY, DEPENDENCY_ON_OUTPUT)
+	}
+	return nil
+}
+
+// Copy returns a copy of the TaskDependency.
+func (d *TaskDependency) Copy() *TaskDependency {
+	return &TaskDependency{
+		Task:        d.Task,
+		On:          d.On,
+		OutputFile:  d.OutputFile,
+		OutputKey:   d.OutputKey,
+		OutputValue: d.OutputValue,
+	}
+}
+
+// MetByStatus returns true iff a parent TaskSpec which finished with the given
+// JobStatus may trigger the dependent TaskSpec. For DEPENDENCY_ON_OUTPUT, the
+// output must also be checked using OutputMet.
+func (d *TaskDependency) MetByStatus(s JobStatus) bool {
+	switch d.On {
+	case DEPENDENCY_ON_SUCCESS, DEPENDENCY_ON_OUTPUT:
+		return s == JOB_STATUS_SUCCESS
+	case DEPENDENCY_ON_FAILURE:
+		return s != JOB_STATUS_SUCCESS && s != JOB_STATUS_IN_PROGRESS
+	case DEPENDENCY_ON_ANY:
+		return s != JOB_STATUS_IN_PROGRESS
+	}
+	return false
+}
+
+// OutputMet returns true iff the given values, decoded from OutputFile,
+// satisfy the TaskDependency.
+func (d *TaskDependency) OutputMet(values map[string]interface{}) bool {
+	v, ok := values[d.OutputKey]
+	if !ok {
+		return false
+	}
+	if d.OutputValue != "" {
+		return formatOutputValue(v) == d.OutputValue
+	}
+	switch t := v.(type) {
+	case nil:
+		return false
+	case bool:
+		return t
+	case float64:
+		return t != 0
+	case string:
+		return t != ""
+	case []interface{}:
+		return len(t) > 0
+	case map[string]interface{}:
+		return len(t) > 0
+	}
+	return true
+}
+
+// formatOutputValue formats a value decoded from JSON for comparison with
+// TaskDependency.OutputValue.
+func formatOutputValue(v interface{}) string {
+	if f, ok := v.(float64); ok {
+		return strconv.FormatFloat(f, 'f', -1, 64)
+	}
+	return fmt.Sprint(v)
+}
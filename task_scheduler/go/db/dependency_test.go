@@ -0,0 +1,78 @@
+package db
+
+import (
+	"encoding/json"
+	"testing"
+
+	assert "github.com/stretchr/testify/require"
+
+	"go.skia.org/infra/go/testutils"
+)
+
+func TestCopyTaskDependency(t *testing.T) {
+	testutils.SmallTest(t)
+	v := &TaskDependency{
+		Task:        "parent",
+		On:          DEPENDENCY_ON_OUTPUT,
+		OutputFile:  "results.json",
+		OutputKey:   "needs_triage",
+		OutputValue: "true",
+	}
+	testutils.AssertCopy(t, v, v.Copy())
+}
+
+func TestTaskDependencyValidate(t *testing.T) {
+	testutils.SmallTest(t)
+	assert.NoError(t, (&TaskDependency{Task: "a", On: DEPENDENCY_ON_SUCCESS}).Validate())
+	assert.NoError(t, (&TaskDependency{Task: "a", On: DEPENDENCY_ON_FAILURE}).Validate())
+	assert.NoError(t, (&TaskDependency{Task: "a", On: DEPENDENCY_ON_ANY}).Validate())
+	assert.NoError(t, (&TaskDependency{Task: "a", On: DEPENDENCY_ON_OUTPUT, OutputFile: "f.json", OutputKey: "k"}).Validate())
+	assert.EqualError(t, (&TaskDependency{On: DEPENDENCY_ON_ANY}).Validate(), "Conditional dependency must specify a task.")
+	assert.EqualError(t, (&TaskDependency{Task: "a", On: "sometimes"}).Validate(), "Conditional dependency on \"a\": invalid on value \"sometimes\"; must be one of \"success\", \"failure\", \"any\", or \"output\".")
+	assert.EqualError(t, (&TaskDependency{Task: "a", On: DEPENDENCY_ON_OUTPUT, OutputFile: "f.json"}).Validate(), "Conditional dependency on \"a\": output_file and output_key are required with on=\"output\".")
+	assert.EqualError(t, (&TaskDependency{Task: "a", On: DEPENDENCY_ON_FAILURE, OutputKey: "k"}).Validate(), "Conditional dependency on \"a\": output_file, output_key, and output_value are only valid with on=\"output\".")
+}
+
+func TestTaskDependencyMetByStatus(t *testing.T) {
+	testutils.SmallTest(t)
+	test := func(on string, s JobStatus, expect bool) {
+		assert.Equal(t, expect, (&TaskDependency{Task: "a", On: on}).MetByStatus(s))
+	}
+	for _, on := range []string{DEPENDENCY_ON_SUCCESS, DEPENDENCY_ON_FAILURE, DEPENDENCY_ON_ANY, DEPENDENCY_ON_OUTPUT} {
+		test(on, JOB_STATUS_IN_PROGRESS, false)
+	}
+	test(DEPENDENCY_ON_SUCCESS, JOB_STATUS_SUCCESS, true)
+	test(DEPENDENCY_ON_SUCCESS, JOB_STATUS_FAILURE, false)
+	test(DEPENDENCY_ON_OUTPUT, JOB_STATUS_SUCCESS, true)
+	test(DEPENDENCY_ON_OUTPUT, JOB_STATUS_MISHAP, false)
+	test(DEPENDENCY_ON_FAILURE, JOB_STATUS_SUCCESS, false)
+	test(DEPENDENCY_ON_FAILURE, JOB_STATUS_FAILURE, true)
+	test(DEPENDENCY_ON_FAILURE, JOB_STATUS_MISHAP, true)
+	test(DEPENDENCY_ON_ANY, JOB_STATUS_SUCCESS, true)
+	test(DEPENDENCY_ON_ANY, JOB_STATUS_FAILURE, true)
+}
+
+func TestTaskDependencyOutputMet(t *testing.T) {
+	testutils.SmallTest(t)
+	var values map[string]interface{}
+	assert.NoError(t, json.Unmarshal([]byte(`{"t": true, "f": false, "zero": 0, "n": 3, "s": "yes", "empty": "", "null": null, "list": [1]}`), &values))
+	test := func(key, value string, expect bool) {
+		d := &TaskDependency{Task: "a", On: DEPENDENCY_ON_OUTPUT, OutputFile: "f.json", OutputKey: key, OutputValue: value}
+		assert.Equal(t, expect, d.OutputMet(values), "%s=%q", key, value)
+	}
+	test("t", "", true)
+	test("f", "", false)
+	test("zero", "", false)
+	test("n", "", true)
+	test("s", "", true)
+	test("empty", "", false)
+	test("null", "", false)
+	test("list", "", true)
+	test("missing", "", false)
+	test("t", "true", true)
+	test("f", "false", true)
+	test("n", "3", true)
+	test("n", "4", false)
+	test("s", "yes", true)
+	test("missing", "yes", false)
+}
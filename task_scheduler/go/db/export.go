@@ -0,0 +1,247 @@
+package db
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/skia-dev/glog"
+	"go.skia.org/infra/go/util"
+)
+
+const (
+	// EXPORT_CHUNK_PERIOD is the time period of tasks and jobs retrieved
+	// from the DB at once by Export.
+	EXPORT_CHUNK_PERIOD = 24 * time.Hour
+
+	// IMPORT_BATCH_SIZE is the maximum number of tasks or jobs inserted
+	// into the DB at once by Import.
+	IMPORT_BATCH_SIZE = 100
+)
+
+// ExportRecord is one line of the format written by Export and read by Import.
+// Exactly one field is set.
+type ExportRecord struct {
+	Task            *Task            `json:"task,omitempty"`
+	Job             *Job             `json:"job,omitempty"`
+	TaskComment     *TaskComment     `json:"taskComment,omitempty"`
+	TaskSpecComment *TaskSpecComment `json:"taskSpecComment,omitempty"`
+	CommitComment   *CommitComment   `json:"commitComment,omitempty"`
+}
+
+// ExportCounts contains the number of each type of record written by Export or
+// read by Import.
+type ExportCounts struct {
+	Tasks    int
+	Jobs     int
+	Comments int
+}
+
+// Export writes all tasks and jobs with Created in the given range, and all
+// comments with Timestamp in the given range, to w as line-delimited JSON, one
+// ExportRecord per line. Comments are exported for the given repos as well as
+// for any repos of the exported tasks and jobs.
+func Export(d RemoteDB, w io.Writer, from, to time.Time, repos []string) (*ExportCounts, error) {
+	enc := json.NewEncoder(w)
+	counts := &ExportCounts{}
+	allRepos := util.NewStringSet(repos)
+	for start := from; start.Before(to); start = start.Add(EXPORT_CHUNK_PERIOD) {
+		end := start.Add(EXPORT_CHUNK_PERIOD)
+		if end.After(to) {
+			end = to
+		}
+		tasks, err := d.GetTasksFromDateRange(start, end)
+		if err != nil {
+			return nil, err
+		}
+		for _, t := range tasks {
+			if err := enc.Encode(&ExportRecord{Task: t}); err != nil {
+				return nil, err
+			}
+			allRepos[t.Repo] = true
+		}
+		counts.Tasks += len(tasks)
+		jobs, err := d.GetJobsFromDateRange(start, end)
+		if err != nil {
+			return nil, err
+		}
+		for _, j := range jobs {
+			if err := enc.Encode(&ExportRecord{Job: j}); err != nil {
+				return nil, err
+			}
+			allRepos[j.Repo] = true
+		}
+		counts.Jobs += len(jobs)
+	}
+
+	if len(allRepos) == 0 {
+		return counts, nil
+	}
+	repoList := allRepos.Keys()
+	sort.Strings(repoList)
+	comments, err := d.GetCommentsForRepos(repoList, from)
+	if err != nil {
+		return nil, err
+	}
+	inRange := func(ts time.Time) bool {
+		return !ts.Before(from) && ts.Before(to)
+	}
+	for _, rc := range comments {
+		for _, byName := range rc.TaskComments {
+			for _, cs := range byName {
+				for _, c := range cs {
+					if inRange(c.Timestamp) {
+						if err := enc.Encode(&ExportRecord{TaskComment: c}); err != nil {
+							return nil, err
+						}
+						counts.Comments++
+					}
+				}
+			}
+		}
+		for _, cs := range rc.TaskSpecComments {
+			for _, c := range cs {
+				if inRange(c.Timestamp) {
+					if err := enc.Encode(&ExportRecord{TaskSpecComment: c}); err != nil {
+						return nil, err
+					}
+					counts.Comments++
+				}
+			}
+		}
+		for _, cs := range rc.CommitComments {
+			for _, c := range cs {
+				if inRange(c.Timestamp) {
+					if err := enc.Encode(&ExportRecord{CommitComment: c}); err != nil {
+						return nil, err
+					}
+					counts.Comments++
+				}
+			}
+		}
+	}
+	return counts, nil
+}
+
+// Import reads ExportRecords written by Export from r and inserts them into d.
+// Tasks and jobs keep their Ids, so that references between them remain valid;
+// the Ids must therefore be valid for d. Existing tasks, jobs, and comments with
+// the same Ids are overwritten. DbModified is not preserved.
+func Import(d DB, r io.Reader) (*ExportCounts, error) {
+	dec := json.NewDecoder(r)
+	counts := &ExportCounts{}
+	tasks := make([]*Task, 0, IMPORT_BATCH_SIZE)
+	jobs := make([]*Job, 0, IMPORT_BATCH_SIZE)
+	flushTasks := func() error {
+		if len(tasks) == 0 {
+			return nil
+		}
+		if err := importTasks(d, tasks); err != nil {
+			return err
+		}
+		counts.Tasks += len(tasks)
+		tasks = tasks[:0]
+		return nil
+	}
+	flushJobs := func() error {
+		if len(jobs) == 0 {
+			return nil
+		}
+		if err := importJobs(d, jobs); err != nil {
+			return err
+		}
+		counts.Jobs += len(jobs)
+		jobs = jobs[:0]
+		return nil
+	}
+	for line := 1; ; line++ {
+		var rec ExportRecord
+		if err := dec.Decode(&rec); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("Failed to decode record %d: %s", line, err)
+		}
+		var err error
+		switch {
+		case rec.Task != nil:
+			tasks = append(tasks, rec.Task)
+			if len(tasks) == IMPORT_BATCH_SIZE {
+				err = flushTasks()
+			}
+		case rec.Job != nil:
+			jobs = append(jobs, rec.Job)
+			if len(jobs) == IMPORT_BATCH_SIZE {
+				err = flushJobs()
+			}
+		case rec.TaskComment != nil:
+			err = importComment(func() error { return d.PutTaskComment(rec.TaskComment) }, func() error { return d.DeleteTaskComment(rec.TaskComment) })
+			counts.Comments++
+		case rec.TaskSpecComment != nil:
+			err = importComment(func() error { return d.PutTaskSpecComment(rec.TaskSpecComment) }, func() error { return d.DeleteTaskSpecComment(rec.TaskSpecComment) })
+			counts.Comments++
+		case rec.CommitComment != nil:
+			err = importComment(func() error { return d.PutCommitComment(rec.CommitComment) }, func() error { return d.DeleteCommitComment(rec.CommitComment) })
+			counts.Comments++
+		default:
+			err = fmt.Errorf("Empty record")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Failed to import record %d: %s", line, err)
+		}
+	}
+	if err := flushTasks(); err != nil {
+		return nil, err
+	}
+	if err := flushJobs(); err != nil {
+		return nil, err
+	}
+	return counts, nil
+}
+
+// importTasks inserts the given tasks into d, overwriting any existing tasks
+// with the same Ids.
+func importTasks(d TaskDB, tasks []*Task) error {
+	for _, t := range tasks {
+		t.DbModified = time.Time{}
+		existing, err := d.GetTaskById(t.Id)
+		if err != nil {
+			return err
+		}
+		if existing != nil {
+			t.DbModified = existing.DbModified
+		}
+	}
+	return d.PutTasks(tasks)
+}
+
+// importJobs inserts the given jobs into d, overwriting any existing jobs with
+// the same Ids.
+func importJobs(d JobDB, jobs []*Job) error {
+	for _, j := range jobs {
+		j.DbModified = time.Time{}
+		existing, err := d.GetJobById(j.Id)
+		if err != nil {
+			return err
+		}
+		if existing != nil {
+			j.DbModified = existing.DbModified
+		}
+	}
+	return d.PutJobs(jobs)
+}
+
+// importComment calls put, which inserts a comment. If a different comment with
+// the same ID fields exists, calls del to delete it before calling put again.
+func importComment(put, del func() error) error {
+	err := put()
+	if !IsAlreadyExists(err) {
+		return err
+	}
+	glog.Infof("Overwriting existing comment.")
+	if err := del(); err != nil {
+		return err
+	}
+	return put()
+}
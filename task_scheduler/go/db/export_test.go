@@ -0,0 +1,91 @@
+package db
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	assert "github.com/stretchr/testify/require"
+
+	"go.skia.org/infra/go/testutils"
+)
+
+func TestExportImport(t *testing.T) {
+	testutils.SmallTest(t)
+
+	now := time.Now().UTC()
+	from := now.Add(-2 * EXPORT_CHUNK_PERIOD)
+	src := NewInMemoryDB()
+
+	// Tasks and jobs in multiple chunks, and one of each outside of the range.
+	t1 := makeTask(from, []string{"a"})
+	t2 := makeTask(now.Add(-time.Hour), []string{"b", "c"})
+	t2.Status = TASK_STATUS_SUCCESS
+	t3 := makeTask(from.Add(-time.Hour), []string{"d"})
+	assert.NoError(t, src.PutTasks([]*Task{t1, t2, t3}))
+	j1 := makeJob(from.Add(time.Hour))
+	j1.Dependencies = map[string][]string{"Test-Task": {}}
+	j1.Tasks = map[string][]*TaskSummary{"Test-Task": {t1.MakeTaskSummary()}}
+	j2 := makeJob(from.Add(-time.Hour))
+	assert.NoError(t, src.PutJobs([]*Job{j1, j2}))
+
+	tc := &TaskComment{Repo: DEFAULT_TEST_REPO, Revision: "a", Name: "Test-Task", Timestamp: now.Add(-time.Minute), TaskId: t1.Id, User: "me", Message: "task"}
+	sc := &TaskSpecComment{Repo: DEFAULT_TEST_REPO, Name: "Test-Task", Timestamp: now.Add(-time.Minute), User: "me", Flaky: true, Message: "spec"}
+	cc := &CommitComment{Repo: DEFAULT_TEST_REPO, Revision: "b", Timestamp: now.Add(-time.Minute), User: "me", Message: "commit"}
+	ccOld := &CommitComment{Repo: DEFAULT_TEST_REPO, Revision: "d", Timestamp: from.Add(-time.Hour), User: "me", Message: "old"}
+	assert.NoError(t, src.PutTaskComment(tc))
+	assert.NoError(t, src.PutTaskSpecComment(sc))
+	assert.NoError(t, src.PutCommitComment(cc))
+	assert.NoError(t, src.PutCommitComment(ccOld))
+
+	var buf bytes.Buffer
+	counts, err := Export(src, &buf, from, now, nil)
+	assert.NoError(t, err)
+	testutils.AssertDeepEqual(t, &ExportCounts{Tasks: 2, Jobs: 1, Comments: 3}, counts)
+	assert.Equal(t, 6, strings.Count(buf.String(), "\n"))
+	exported := buf.String()
+
+	check := func(d DB) {
+		tasks, err := d.GetTasksFromDateRange(from.Add(-EXPORT_CHUNK_PERIOD), now)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, len(tasks))
+		for i, expect := range []*Task{t1, t2} {
+			assert.Equal(t, expect.Id, tasks[i].Id)
+			tasks[i].DbModified = expect.DbModified
+			testutils.AssertDeepEqual(t, expect, tasks[i])
+		}
+		jobs, err := d.GetJobsFromDateRange(from.Add(-EXPORT_CHUNK_PERIOD), now)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, len(jobs))
+		jobs[0].DbModified = j1.DbModified
+		testutils.AssertDeepEqual(t, j1, jobs[0])
+		comments, err := d.GetCommentsForRepos([]string{DEFAULT_TEST_REPO}, time.Time{})
+		assert.NoError(t, err)
+		testutils.AssertDeepEqual(t, []*TaskComment{tc}, comments[0].TaskComments["a"]["Test-Task"])
+		testutils.AssertDeepEqual(t, []*TaskSpecComment{sc}, comments[0].TaskSpecComments["Test-Task"])
+		testutils.AssertDeepEqual(t, []*CommitComment{cc}, comments[0].CommitComments["b"])
+		assert.Equal(t, 1, len(comments[0].CommitComments))
+	}
+
+	dst := NewInMemoryDB()
+	counts, err = Import(dst, strings.NewReader(exported))
+	assert.NoError(t, err)
+	testutils.AssertDeepEqual(t, &ExportCounts{Tasks: 2, Jobs: 1, Comments: 3}, counts)
+	check(dst)
+
+	// Importing again overwrites the existing entries.
+	cc.Message = "changed"
+	assert.NoError(t, src.DeleteCommitComment(cc))
+	assert.NoError(t, src.PutCommitComment(cc))
+	buf.Reset()
+	_, err = Export(src, &buf, from, now, nil)
+	assert.NoError(t, err)
+	_, err = Import(dst, &buf)
+	assert.NoError(t, err)
+	check(dst)
+
+	// Invalid input.
+	_, err = Import(dst, strings.NewReader("{}\n"))
+	assert.EqualError(t, err, "Failed to import record 1: Empty record")
+}
@@ -32,11 +32,15 @@ const (
 	// JOB_STATUS_CANCELED indicates that the Job has been canceled.
 	JOB_STATUS_CANCELED JobStatus = "CANCELED"
 
+	// JOB_STATUS_TIMED_OUT indicates that the Job did not finish within
+	// its MaxDuration.
+	JOB_STATUS_TIMED_OUT JobStatus = "TIMED_OUT"
+
 	// JOB_URL_TMPL is a template for Job URLs.
 	JOB_URL_TMPL = "https://task-scheduler.skia.org/job/%s"
 
 	// MAX_TASK_ATTEMPTS is the maximum number of attempts we'll make of
-	// each TaskSpec in a Job.
+	// each TaskSpec in a Job, unless the TaskSpec specifies a RetryPolicy.
 	MAX_TASK_ATTEMPTS = 2
 )
 
@@ -45,8 +49,9 @@ var (
 		JOB_STATUS_SUCCESS:     0,
 		JOB_STATUS_IN_PROGRESS: 1,
 		JOB_STATUS_CANCELED:    2,
-		JOB_STATUS_FAILURE:     3,
-		JOB_STATUS_MISHAP:      4,
+		JOB_STATUS_TIMED_OUT:   3,
+		JOB_STATUS_FAILURE:     4,
+		JOB_STATUS_MISHAP:      5,
 	}
 )
 
@@ -99,6 +104,12 @@ type Job struct {
 	// TODO(borenet): Maybe this doesn't belong in the DB.
 	BuildbucketLeaseKey int64
 
+	// ConditionalDependencies maps TaskSpec names to the conditional
+	// dependencies of that TaskSpec. The parent TaskSpecs are also present
+	// in Dependencies. This property should never change for a given Job
+	// instance.
+	ConditionalDependencies map[string][]*TaskDependency
+
 	// Created is the creation timestamp. This property should never change
 	// for a given Job instance.
 	Created time.Time
@@ -126,6 +137,12 @@ type Job struct {
 	// opposed to a normally scheduled one, or a try job.
 	IsForce bool
 
+	// MaxDuration is the amount of time the Job may remain in progress
+	// after its creation before it is marked as timed out. Zero indicates
+	// no limit. This property should never change for a given Job
+	// instance.
+	MaxDuration time.Duration
+
 	// Name is a human-friendly descriptive name for the Job. All Jobs
 	// generated from the same JobSpec have the same name. This property
 	// should never change for a given Job instance.
@@ -137,6 +154,12 @@ type Job struct {
 	// RepoState is the current state of the repository for this Job.
 	RepoState
 
+	// RetryPolicies maps TaskSpec names to the RetryPolicy for Tasks
+	// generated from that TaskSpec. TaskSpecs which are not present use
+	// DEFAULT_RETRY_POLICY. This property should never change for a given
+	// Job instance.
+	RetryPolicies map[string]*RetryPolicy
+
 	// Status is the current Job status, default JOB_STATUS_IN_PROGRESS.
 	Status JobStatus
 
@@ -157,6 +180,17 @@ func (j *Job) Copy() *Job {
 			deps[k] = cpy
 		}
 	}
+	var condDeps map[string][]*TaskDependency
+	if j.ConditionalDependencies != nil {
+		condDeps = make(map[string][]*TaskDependency, len(j.ConditionalDependencies))
+		for k, v := range j.ConditionalDependencies {
+			cpy := make([]*TaskDependency, 0, len(v))
+			for _, d := range v {
+				cpy = append(cpy, d.Copy())
+			}
+			condDeps[k] = cpy
+		}
+	}
 	var tasks map[string][]*TaskSummary
 	if j.Tasks != nil {
 		tasks = make(map[string][]*TaskSummary, len(j.Tasks))
@@ -168,20 +202,30 @@ func (j *Job) Copy() *Job {
 			tasks[k] = cpy
 		}
 	}
+	var retryPolicies map[string]*RetryPolicy
+	if j.RetryPolicies != nil {
+		retryPolicies = make(map[string]*RetryPolicy, len(j.RetryPolicies))
+		for k, v := range j.RetryPolicies {
+			retryPolicies[k] = v.Copy()
+		}
+	}
 	return &Job{
-		BuildbucketBuildId:  j.BuildbucketBuildId,
-		BuildbucketLeaseKey: j.BuildbucketLeaseKey,
-		Created:             j.Created,
-		DbModified:          j.DbModified,
-		Dependencies:        deps,
-		Finished:            j.Finished,
-		Id:                  j.Id,
-		IsForce:             j.IsForce,
-		Name:                j.Name,
-		Priority:            j.Priority,
-		RepoState:           j.RepoState.Copy(),
-		Status:              j.Status,
-		Tasks:               tasks,
+		BuildbucketBuildId:      j.BuildbucketBuildId,
+		BuildbucketLeaseKey:     j.BuildbucketLeaseKey,
+		ConditionalDependencies: condDeps,
+		Created:                 j.Created,
+		DbModified:              j.DbModified,
+		Dependencies:            deps,
+		Finished:                j.Finished,
+		Id:                      j.Id,
+		IsForce:                 j.IsForce,
+		MaxDuration:             j.MaxDuration,
+		Name:                    j.Name,
+		Priority:                j.Priority,
+		RepoState:               j.RepoState.Copy(),
+		RetryPolicies:           retryPolicies,
+		Status:                  j.Status,
+		Tasks:                   tasks,
 	}
 }
 
@@ -189,6 +233,12 @@ func (j *Job) Done() bool {
 	return j.Status != JOB_STATUS_IN_PROGRESS
 }
 
+// TimedOut returns true iff the Job is unfinished and has been in progress for
+// longer than its MaxDuration as of the given time.
+func (j *Job) TimedOut(now time.Time) bool {
+	return !j.Done() && j.MaxDuration > 0 && now.Sub(j.Created) > j.MaxDuration
+}
+
 // MakeTaskKey returns a TaskKey for the given Task name.
 func (j *Job) MakeTaskKey(taskName string) TaskKey {
 	rv := TaskKey{
@@ -201,6 +251,14 @@ func (j *Job) MakeTaskKey(taskName string) TaskKey {
 	return rv
 }
 
+// GetRetryPolicy returns the RetryPolicy for the given TaskSpec name.
+func (j *Job) GetRetryPolicy(taskName string) *RetryPolicy {
+	if p, ok := j.RetryPolicies[taskName]; ok && p != nil {
+		return p
+	}
+	return DEFAULT_RETRY_POLICY
+}
+
 // URL returns a URL for the Job.
 func (j *Job) URL() string {
 	return fmt.Sprintf(JOB_URL_TMPL, j.Id)
@@ -236,39 +294,70 @@ func (j *Job) TraverseDependencies(fn func(string) error) error {
 }
 
 // DeriveStatus derives a JobStatus based on the TaskStatuses in the Job's
-// dependency tree.
+// dependency tree. Conditional dependencies on the output of a parent task are
+// assumed to be satisfied if the parent task succeeded.
 func (j *Job) DeriveStatus() JobStatus {
+	return j.DeriveStatusWithOutputs(nil)
+}
+
+// DeriveStatusWithOutputs derives a JobStatus based on the TaskStatuses in the
+// Job's dependency tree, using the given DependencyOutputChecker to determine
+// whether conditional dependencies on the output of a parent task are
+// satisfied. If checker is nil, those dependencies are assumed to be satisfied
+// if the parent task succeeded.
+//
+// TaskSpecs which have not run and whose dependencies finished with results
+// which do not trigger them are skipped and do not affect the JobStatus. If
+// the Job has any conditional dependencies, it remains in progress until all
+// of its TaskSpecs have either finished or been skipped.
+func (j *Job) DeriveStatusWithOutputs(checker DependencyOutputChecker) JobStatus {
 	if len(j.Tasks) == 0 {
 		return JOB_STATUS_IN_PROGRESS
 	}
+	// statuses holds the best Task for each TaskSpec, or nil if the
+	// TaskSpec was skipped.
+	statuses := make(map[string]*TaskSummary, len(j.Dependencies))
+	specStatus := make(map[string]JobStatus, len(j.Dependencies))
 	worstStatus := JOB_STATUS_SUCCESS
+	inProgress := false
 	if err := j.TraverseDependencies(func(name string) error {
 		tasks, ok := j.Tasks[name]
 		if !ok || len(tasks) == 0 {
+			if j.skipped(name, statuses, specStatus, checker) {
+				statuses[name] = nil
+				return nil
+			}
+			specStatus[name] = JOB_STATUS_IN_PROGRESS
+			inProgress = true
 			worstStatus = WorseJobStatus(worstStatus, JOB_STATUS_IN_PROGRESS)
 			return nil
 		}
 
 		// We may have more than one Task for this spec, due to
 		// retrying of failed Tasks. We should not return a "failed"
-		// result if we still have retry attempts remaining or if we've
+		// result if the RetryPolicy allows another attempt or if we've
 		// already retried and succeeded.
 
-		canRetry := len(tasks) < MAX_TASK_ATTEMPTS
+		canRetry := j.GetRetryPolicy(name).ShouldRetry(tasks[len(tasks)-1].Status, len(tasks))
 		bestStatus := JOB_STATUS_MISHAP
+		bestTask := tasks[len(tasks)-1]
 		for _, t := range tasks {
 			status := JobStatusFromTaskStatus(t.Status)
 			if bestStatus.WorseThan(status) {
 				bestStatus = status
+				bestTask = t
 			}
 		}
-		if bestStatus == JOB_STATUS_SUCCESS || bestStatus == JOB_STATUS_IN_PROGRESS {
-			worstStatus = WorseJobStatus(worstStatus, bestStatus)
-		} else if canRetry {
-			worstStatus = WorseJobStatus(worstStatus, JOB_STATUS_IN_PROGRESS)
-		} else {
-			worstStatus = WorseJobStatus(worstStatus, bestStatus)
+		status := bestStatus
+		if bestStatus != JOB_STATUS_SUCCESS && bestStatus != JOB_STATUS_IN_PROGRESS && canRetry {
+			status = JOB_STATUS_IN_PROGRESS
+		}
+		statuses[name] = bestTask
+		specStatus[name] = status
+		if status == JOB_STATUS_IN_PROGRESS {
+			inProgress = true
 		}
+		worstStatus = WorseJobStatus(worstStatus, status)
 		return nil
 	}); err != nil {
 		// Our inner function doesn't return errors, and
@@ -277,9 +366,57 @@ func (j *Job) DeriveStatus() JobStatus {
 		glog.Errorf("Got error traversing Job dependencies: %s", err)
 		return JOB_STATUS_IN_PROGRESS
 	}
+	if inProgress && len(j.ConditionalDependencies) > 0 {
+		return JOB_STATUS_IN_PROGRESS
+	}
 	return worstStatus
 }
 
+// skipped returns true iff the given TaskSpec, which has no Tasks, will never
+// run because one of its dependencies was skipped or finished with a result
+// which does not trigger it. statuses and specStatus contain the best Task and
+// the JobStatus of each TaskSpec upon which the given TaskSpec depends, as
+// computed by DeriveStatusWithOutputs.
+func (j *Job) skipped(name string, statuses map[string]*TaskSummary, specStatus map[string]JobStatus, checker DependencyOutputChecker) bool {
+	conds := make(map[string]*TaskDependency, len(j.ConditionalDependencies[name]))
+	for _, d := range j.ConditionalDependencies[name] {
+		conds[d.Task] = d
+	}
+	for _, parent := range j.Dependencies[name] {
+		best, ok := statuses[parent]
+		if !ok {
+			// This shouldn't happen, since TraverseDependencies
+			// visits parents first.
+			continue
+		}
+		if best == nil {
+			return true
+		}
+		status := specStatus[parent]
+		if status == JOB_STATUS_IN_PROGRESS {
+			continue
+		}
+		d, ok := conds[parent]
+		if !ok {
+			d = &TaskDependency{Task: parent, On: DEPENDENCY_ON_SUCCESS}
+		}
+		if !d.MetByStatus(status) {
+			return true
+		}
+		if d.On == DEPENDENCY_ON_OUTPUT && checker != nil {
+			met, err := checker(d, best.Id)
+			if err != nil {
+				glog.Errorf("Failed to check output of task %s for dependency of %q: %s", best.Id, name, err)
+				continue
+			}
+			if !met {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 // JobSlice implements sort.Interface. To sort jobs []*Job, use
 // sort.Sort(JobSlice(jobs)).
 type JobSlice []*Job
@@ -19,17 +19,27 @@ func TestJobCopy(t *testing.T) {
 	v := &Job{
 		BuildbucketBuildId:  12345,
 		BuildbucketLeaseKey: 987,
-		Created:             now.Add(time.Nanosecond),
-		DbModified:          now.Add(time.Millisecond),
-		Dependencies:        map[string][]string{"A": []string{"B"}, "B": []string{}},
-		Finished:            now.Add(time.Second),
-		Id:                  "abc123",
-		IsForce:             true,
-		Name:                "C",
-		Priority:            1.2,
+		ConditionalDependencies: map[string][]*TaskDependency{
+			"A": []*TaskDependency{&TaskDependency{Task: "B", On: DEPENDENCY_ON_ANY}},
+		},
+		Created:      now.Add(time.Nanosecond),
+		DbModified:   now.Add(time.Millisecond),
+		Dependencies: map[string][]string{"A": []string{"B"}, "B": []string{}},
+		Finished:     now.Add(time.Second),
+		Id:           "abc123",
+		IsForce:      true,
+		MaxDuration:  time.Hour,
+		Name:         "C",
+		Priority:     1.2,
 		RepoState: RepoState{
 			Repo: DEFAULT_TEST_REPO,
 		},
+		RetryPolicies: map[string]*RetryPolicy{
+			"task-name": &RetryPolicy{
+				MaxAttempts: 3,
+				RetryOn:     RETRY_ON_MISHAP,
+			},
+		},
 		Status: JOB_STATUS_SUCCESS,
 		Tasks: map[string][]*TaskSummary{
 			"task-name": {&TaskSummary{
@@ -228,3 +238,143 @@ func TestJobDeriveStatus(t *testing.T) {
 	t3.Status = TASK_STATUS_SUCCESS
 	assert.Equal(t, j1.DeriveStatus(), JOB_STATUS_SUCCESS)
 }
+
+func TestJobTimedOut(t *testing.T) {
+	testutils.SmallTest(t)
+	now := time.Now()
+	j := &Job{
+		Created: now.Add(-2 * time.Hour),
+	}
+	// No max duration.
+	assert.False(t, j.TimedOut(now))
+
+	// Within the max duration.
+	j.MaxDuration = 3 * time.Hour
+	assert.False(t, j.TimedOut(now))
+
+	// Past the max duration.
+	j.MaxDuration = time.Hour
+	assert.True(t, j.TimedOut(now))
+
+	// Finished Jobs never time out.
+	j.Status = JOB_STATUS_SUCCESS
+	assert.False(t, j.TimedOut(now))
+}
+
+func TestJobDeriveStatusRetryPolicy(t *testing.T) {
+	testutils.SmallTest(t)
+	j1 := &Job{
+		Dependencies: map[string][]string{"build": []string{}},
+		Name:         "j1",
+		RepoState: RepoState{
+			Repo:     "my-repo",
+			Revision: "my-revision",
+		},
+		RetryPolicies: map[string]*RetryPolicy{
+			"build": &RetryPolicy{
+				MaxAttempts: 3,
+				RetryOn:     RETRY_ON_MISHAP,
+			},
+		},
+	}
+
+	// A failure is not retried under this policy.
+	t1 := &TaskSummary{Status: TASK_STATUS_FAILURE}
+	j1.Tasks = map[string][]*TaskSummary{"build": []*TaskSummary{t1}}
+	assert.Equal(t, JOB_STATUS_FAILURE, j1.DeriveStatus())
+
+	// A mishap is retried.
+	t1.Status = TASK_STATUS_MISHAP
+	assert.Equal(t, JOB_STATUS_IN_PROGRESS, j1.DeriveStatus())
+
+	// The retry also had a mishap; we have one more attempt.
+	t2 := &TaskSummary{Status: TASK_STATUS_MISHAP}
+	j1.Tasks["build"] = append(j1.Tasks["build"], t2)
+	assert.Equal(t, JOB_STATUS_IN_PROGRESS, j1.DeriveStatus())
+
+	// The last attempt had a mishap too. We're out of retries.
+	t3 := &TaskSummary{Status: TASK_STATUS_MISHAP}
+	j1.Tasks["build"] = append(j1.Tasks["build"], t3)
+	assert.Equal(t, JOB_STATUS_MISHAP, j1.DeriveStatus())
+
+	// Or it succeeded.
+	t3.Status = TASK_STATUS_SUCCESS
+	assert.Equal(t, JOB_STATUS_SUCCESS, j1.DeriveStatus())
+}
+
+func TestJobDeriveStatusConditionalDependencies(t *testing.T) {
+	testutils.SmallTest(t)
+	// "upload" runs if "test" fails, "cleanup" runs after "test" regardless
+	// of the result, and "triage" runs if "test" succeeds with failures to
+	// triage in its output.
+	j1 := &Job{
+		ConditionalDependencies: map[string][]*TaskDependency{
+			"upload":  []*TaskDependency{&TaskDependency{Task: "test", On: DEPENDENCY_ON_FAILURE}},
+			"cleanup": []*TaskDependency{&TaskDependency{Task: "test", On: DEPENDENCY_ON_ANY}},
+			"triage":  []*TaskDependency{&TaskDependency{Task: "test", On: DEPENDENCY_ON_OUTPUT, OutputFile: "results.json", OutputKey: "triage"}},
+		},
+		Dependencies: map[string][]string{
+			"build":   []string{},
+			"test":    []string{"build"},
+			"upload":  []string{"test"},
+			"cleanup": []string{"test"},
+			"triage":  []string{"test"},
+		},
+		Name: "j1",
+		RetryPolicies: map[string]*RetryPolicy{
+			"test": &RetryPolicy{
+				MaxAttempts: 1,
+				RetryOn:     RETRY_ON_BOTH,
+			},
+		},
+	}
+	build := &TaskSummary{Id: "build", Status: TASK_STATUS_SUCCESS}
+	test := &TaskSummary{Id: "test", Status: TASK_STATUS_RUNNING}
+	j1.Tasks = map[string][]*TaskSummary{
+		"build": []*TaskSummary{build},
+		"test":  []*TaskSummary{test},
+	}
+	assert.Equal(t, JOB_STATUS_IN_PROGRESS, j1.DeriveStatus())
+
+	// The test failed. The Job doesn't fail until the upload and cleanup
+	// tasks have finished.
+	test.Status = TASK_STATUS_FAILURE
+	assert.Equal(t, JOB_STATUS_IN_PROGRESS, j1.DeriveStatus())
+	upload := &TaskSummary{Id: "upload", Status: TASK_STATUS_SUCCESS}
+	j1.Tasks["upload"] = []*TaskSummary{upload}
+	assert.Equal(t, JOB_STATUS_IN_PROGRESS, j1.DeriveStatus())
+	cleanup := &TaskSummary{Id: "cleanup", Status: TASK_STATUS_SUCCESS}
+	j1.Tasks["cleanup"] = []*TaskSummary{cleanup}
+	assert.Equal(t, JOB_STATUS_FAILURE, j1.DeriveStatus())
+
+	// The test succeeded. The upload task is skipped, but the triage task
+	// depends on the output of the test.
+	test.Status = TASK_STATUS_SUCCESS
+	delete(j1.Tasks, "upload")
+	checked := 0
+	needsTriage := false
+	checker := func(dep *TaskDependency, parentId string) (bool, error) {
+		assert.Equal(t, "test", parentId)
+		assert.Equal(t, "triage", dep.OutputKey)
+		checked++
+		return needsTriage, nil
+	}
+	assert.Equal(t, JOB_STATUS_SUCCESS, j1.DeriveStatusWithOutputs(checker))
+	assert.Equal(t, 1, checked)
+
+	// Without a checker, output dependencies are assumed to be met.
+	assert.Equal(t, JOB_STATUS_IN_PROGRESS, j1.DeriveStatus())
+
+	needsTriage = true
+	assert.Equal(t, JOB_STATUS_IN_PROGRESS, j1.DeriveStatusWithOutputs(checker))
+	j1.Tasks["triage"] = []*TaskSummary{&TaskSummary{Id: "triage", Status: TASK_STATUS_FAILURE}}
+	assert.Equal(t, JOB_STATUS_IN_PROGRESS, j1.DeriveStatusWithOutputs(checker))
+	j1.Tasks["triage"] = append(j1.Tasks["triage"], &TaskSummary{Id: "triage2", Status: TASK_STATUS_FAILURE})
+	assert.Equal(t, JOB_STATUS_FAILURE, j1.DeriveStatusWithOutputs(checker))
+
+	// If the build fails, none of the other tasks run.
+	j1.Tasks = map[string][]*TaskSummary{
+		"build": []*TaskSummary{&TaskSummary{Id: "build", Status: TASK_STATUS_FAILURE}, &TaskSummary{Id: "build2", Status: TASK_STATUS_FAILURE}, &TaskSummary{Id: "build3", Status: TASK_STATUS_FAILURE}},
+	}
+	assert.Equal(t, JOB_STATUS_FAILURE, j1.DeriveStatusWithOutputs(checker))
+}
@@ -659,3 +659,11 @@ func TestLocalDBCommentDB(t *testing.T) {
 	defer testutils.AssertCloses(t, d)
 	db.TestCommentDB(t, d)
 }
+
+func TestLocalDBCommentDBModified(t *testing.T) {
+	testutils.MediumTest(t)
+	d, tmpdir := makeDB(t, "TestLocalDBCommentDBModified")
+	defer util.RemoveAll(tmpdir)
+	defer testutils.AssertCloses(t, d)
+	db.TestCommentDBModified(t, d)
+}
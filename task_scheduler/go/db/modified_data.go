@@ -3,6 +3,7 @@ package db
 import (
 	"bytes"
 	"encoding/gob"
+	"fmt"
 	"sort"
 	"sync"
 	"time"
@@ -212,3 +213,83 @@ func (m *ModifiedJobs) StartTrackingModifiedJobs() (string, error) {
 func (m *ModifiedJobs) StopTrackingModifiedJobs(id string) {
 	m.m.StopTrackingModifiedEntries(id)
 }
+
+// commentEntry is used to store any of the comment types in modifiedData.
+// Exactly one field is set.
+type commentEntry struct {
+	TaskComment     *TaskComment
+	TaskSpecComment *TaskSpecComment
+	CommitComment   *CommitComment
+}
+
+type ModifiedComments struct {
+	m modifiedData
+}
+
+// See docs for CommentDB interface.
+func (m *ModifiedComments) GetModifiedComments(id string) ([]*TaskComment, []*TaskSpecComment, []*CommitComment, error) {
+	entries, err := m.m.GetModifiedEntries(id)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	tcs := []*TaskComment{}
+	scs := []*TaskSpecComment{}
+	ccs := []*CommitComment{}
+	for _, g := range entries {
+		var e commentEntry
+		if err := gob.NewDecoder(bytes.NewReader(g)).Decode(&e); err != nil {
+			return nil, nil, nil, err
+		}
+		if e.TaskComment != nil {
+			tcs = append(tcs, e.TaskComment)
+		} else if e.TaskSpecComment != nil {
+			scs = append(scs, e.TaskSpecComment)
+		} else if e.CommitComment != nil {
+			ccs = append(ccs, e.CommitComment)
+		}
+	}
+	sort.Sort(taskCommentSlice(tcs))
+	sort.Sort(taskSpecCommentSlice(scs))
+	sort.Sort(commitCommentSlice(ccs))
+	return tcs, scs, ccs, nil
+}
+
+// trackModifiedComment GOB-encodes e and tracks it with the given entry id.
+func (m *ModifiedComments) trackModifiedComment(id string, e *commentEntry) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(e); err != nil {
+		glog.Fatal(err)
+	}
+	m.m.TrackModifiedEntries(map[string][]byte{id: buf.Bytes()})
+}
+
+// TrackModifiedTaskComment indicates the given TaskComment should be returned
+// from the next call to GetModifiedComments from each subscriber.
+func (m *ModifiedComments) TrackModifiedTaskComment(c *TaskComment) {
+	id := fmt.Sprintf("task|%s|%s|%s|%d", c.Repo, c.Revision, c.Name, c.Timestamp.UnixNano())
+	m.trackModifiedComment(id, &commentEntry{TaskComment: c.Copy()})
+}
+
+// TrackModifiedTaskSpecComment indicates the given TaskSpecComment should be
+// returned from the next call to GetModifiedComments from each subscriber.
+func (m *ModifiedComments) TrackModifiedTaskSpecComment(c *TaskSpecComment) {
+	id := fmt.Sprintf("taskspec|%s|%s|%d", c.Repo, c.Name, c.Timestamp.UnixNano())
+	m.trackModifiedComment(id, &commentEntry{TaskSpecComment: c.Copy()})
+}
+
+// TrackModifiedCommitComment indicates the given CommitComment should be
+// returned from the next call to GetModifiedComments from each subscriber.
+func (m *ModifiedComments) TrackModifiedCommitComment(c *CommitComment) {
+	id := fmt.Sprintf("commit|%s|%s|%d", c.Repo, c.Revision, c.Timestamp.UnixNano())
+	m.trackModifiedComment(id, &commentEntry{CommitComment: c.Copy()})
+}
+
+// See docs for CommentDB interface.
+func (m *ModifiedComments) StartTrackingModifiedComments() (string, error) {
+	return m.m.StartTrackingModifiedEntries()
+}
+
+// See docs for CommentDB interface.
+func (m *ModifiedComments) StopTrackingModifiedComments(id string) {
+	m.m.StopTrackingModifiedEntries(id)
+}
@@ -0,0 +1,414 @@
+package remote_db
+
+import (
+	"encoding/gob"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/skia-dev/glog"
+	"golang.org/x/net/context"
+
+	"go.skia.org/infra/go/httputils"
+	"go.skia.org/infra/go/util"
+	"go.skia.org/infra/task_scheduler/go/db"
+)
+
+const (
+	// CHANGE_FEED_POLL_PERIOD is how often the server checks the DB for
+	// changes to send to change feed clients.
+	CHANGE_FEED_POLL_PERIOD = time.Second
+
+	// CHANGE_FEED_RETENTION is how long the server keeps changes in memory
+	// so that clients can resume the change feed after disconnecting.
+	CHANGE_FEED_RETENTION = time.Hour
+
+	// CHANGE_FEED_HEARTBEAT_PERIOD is the maximum time between writes to a
+	// change feed stream. If there are no changes in this period, an empty
+	// Change is sent to keep the connection alive.
+	CHANGE_FEED_HEARTBEAT_PERIOD = 30 * time.Second
+)
+
+// Change is an entry in the change feed. Exactly one of Task, Job,
+// TaskComment, TaskSpecComment, and CommitComment is set, except for
+// heartbeats, for which none are set.
+type Change struct {
+	// Modified is the DbModified timestamp for Tasks and Jobs. Comments have
+	// no DbModified, so for comments this is the time at which the server
+	// observed the change. A client which disconnects can resume the change
+	// feed from the Modified timestamp of the last Change it received.
+	Modified        time.Time
+	Task            *db.Task
+	Job             *db.Job
+	TaskComment     *db.TaskComment
+	TaskSpecComment *db.TaskSpecComment
+	CommitComment   *db.CommitComment
+}
+
+// IsHeartbeat returns true iff the Change doesn't contain any data.
+func (c *Change) IsHeartbeat() bool {
+	return c.Task == nil && c.Job == nil && c.TaskComment == nil && c.TaskSpecComment == nil && c.CommitComment == nil
+}
+
+// changeSlice implements sort.Interface, sorting by Modified.
+type changeSlice []*Change
+
+func (s changeSlice) Len() int           { return len(s) }
+func (s changeSlice) Less(i, j int) bool { return s[i].Modified.Before(s[j].Modified) }
+func (s changeSlice) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+// changeFeed tracks modified tasks, jobs, and comments in a db.RemoteDB and
+// fans them out to any number of change feed streams. Only one set of
+// modified data IDs is used regardless of the number of streams, so the
+// streams don't count against db.MAX_MODIFIED_DATA_USERS.
+type changeFeed struct {
+	d db.RemoteDB
+
+	// pollMtx serializes calls to poll.
+	pollMtx sync.Mutex
+	// Modified data IDs. Only modified by start, before polling begins, and
+	// by poll.
+	taskId    string
+	jobId     string
+	commentId string
+
+	// mtx protects all of the following fields.
+	mtx sync.Mutex
+	// started indicates whether start has been called successfully.
+	started bool
+	// changes contains recent changes, in the order they were observed.
+	changes []*Change
+	// first is the sequence number of changes[0]. Sequence numbers increase
+	// by one for each Change and are never reused.
+	first int64
+	// since is the time from which changes is complete. Clients can't resume
+	// from an earlier time.
+	since time.Time
+	// subscribers are notified whenever changes are added.
+	subscribers map[chan struct{}]bool
+}
+
+// newChangeFeed returns a changeFeed for the given DB. Tracking of modified
+// data doesn't begin until the first stream subscribes.
+func newChangeFeed(d db.RemoteDB) *changeFeed {
+	return &changeFeed{
+		d:           d,
+		subscribers: map[chan struct{}]bool{},
+	}
+}
+
+// startTracking obtains modified data IDs from the DB for tasks, jobs, and
+// comments.
+func (f *changeFeed) startTracking() error {
+	taskId, err := f.d.StartTrackingModifiedTasks()
+	if err != nil {
+		return err
+	}
+	jobId, err := f.d.StartTrackingModifiedJobs()
+	if err != nil {
+		f.d.StopTrackingModifiedTasks(taskId)
+		return err
+	}
+	commentId, err := f.d.StartTrackingModifiedComments()
+	if err != nil {
+		f.d.StopTrackingModifiedTasks(taskId)
+		f.d.StopTrackingModifiedJobs(jobId)
+		return err
+	}
+	f.taskId = taskId
+	f.jobId = jobId
+	f.commentId = commentId
+	return nil
+}
+
+// start begins tracking modified data and starts a goroutine to poll for
+// changes. Assumes f.mtx is locked.
+func (f *changeFeed) start() error {
+	if err := f.startTracking(); err != nil {
+		return err
+	}
+	f.started = true
+	f.since = time.Now()
+	go func() {
+		for _ = range time.Tick(CHANGE_FEED_POLL_PERIOD) {
+			if err := f.poll(time.Now()); err != nil {
+				glog.Errorf("Failed to update change feed: %s", err)
+			}
+		}
+	}()
+	return nil
+}
+
+// poll retrieves modified data from the DB and adds it to f.changes, notifying
+// subscribers. If any of the modified data IDs have expired, all changes are
+// discarded and tracking restarts, since there may be changes we didn't see.
+func (f *changeFeed) poll(now time.Time) error {
+	f.pollMtx.Lock()
+	defer f.pollMtx.Unlock()
+	tasks, err := f.d.GetModifiedTasks(f.taskId)
+	if db.IsUnknownId(err) {
+		return f.reset(now)
+	} else if err != nil {
+		return err
+	}
+	jobs, err := f.d.GetModifiedJobs(f.jobId)
+	if db.IsUnknownId(err) {
+		return f.reset(now)
+	} else if err != nil {
+		return err
+	}
+	tcs, scs, ccs, err := f.d.GetModifiedComments(f.commentId)
+	if db.IsUnknownId(err) {
+		return f.reset(now)
+	} else if err != nil {
+		return err
+	}
+
+	changes := make([]*Change, 0, len(tasks)+len(jobs)+len(tcs)+len(scs)+len(ccs))
+	for _, t := range tasks {
+		changes = append(changes, &Change{Modified: t.DbModified, Task: t})
+	}
+	for _, j := range jobs {
+		changes = append(changes, &Change{Modified: j.DbModified, Job: j})
+	}
+	for _, c := range tcs {
+		changes = append(changes, &Change{Modified: now, TaskComment: c})
+	}
+	for _, c := range scs {
+		changes = append(changes, &Change{Modified: now, TaskSpecComment: c})
+	}
+	for _, c := range ccs {
+		changes = append(changes, &Change{Modified: now, CommitComment: c})
+	}
+	sort.Stable(changeSlice(changes))
+
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	f.changes = append(f.changes, changes...)
+
+	// Discard changes which are older than CHANGE_FEED_RETENTION.
+	cutoff := now.Add(-CHANGE_FEED_RETENTION)
+	if f.since.Before(cutoff) {
+		f.since = cutoff
+	}
+	i := 0
+	for i < len(f.changes) && f.changes[i].Modified.Before(cutoff) {
+		i++
+	}
+	f.changes = f.changes[i:]
+	f.first += int64(i)
+
+	if len(changes) > 0 {
+		f.notify()
+	}
+	return nil
+}
+
+// reset restarts tracking of modified data and discards all changes, which
+// causes existing streams to end.
+func (f *changeFeed) reset(now time.Time) error {
+	glog.Warningf("Change feed modified data IDs expired; restarting.")
+	f.d.StopTrackingModifiedTasks(f.taskId)
+	f.d.StopTrackingModifiedJobs(f.jobId)
+	f.d.StopTrackingModifiedComments(f.commentId)
+	if err := f.startTracking(); err != nil {
+		return err
+	}
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	f.first += int64(len(f.changes))
+	f.changes = nil
+	f.since = now
+	f.notify()
+	return nil
+}
+
+// notify wakes up all subscribers. Assumes f.mtx is locked.
+func (f *changeFeed) notify() {
+	for ch := range f.subscribers {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// subscribe registers a new stream. Returns a channel which receives a value
+// whenever new changes are available and the sequence number to pass to the
+// first call to read. If since is zero, only changes observed after this call
+// will be returned from read. Otherwise, read will first return any changes
+// with Modified at or after since; returns db.ErrUnknownId if changes from
+// that time are no longer available.
+func (f *changeFeed) subscribe(since time.Time) (chan struct{}, int64, error) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	if !f.started {
+		if err := f.start(); err != nil {
+			return nil, 0, err
+		}
+	}
+	next := f.first + int64(len(f.changes))
+	if !util.TimeIsZero(since) {
+		if since.Before(f.since) {
+			return nil, 0, db.ErrUnknownId
+		}
+		next = f.first
+	}
+	ch := make(chan struct{}, 1)
+	f.subscribers[ch] = true
+	return ch, next, nil
+}
+
+// unsubscribe removes a stream registered with subscribe.
+func (f *changeFeed) unsubscribe(ch chan struct{}) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	delete(f.subscribers, ch)
+}
+
+// read returns changes starting at sequence number next which have Modified at
+// or after since, along with the sequence number to pass to the next call to
+// read. Returns db.ErrUnknownId if the changes starting at next have been
+// discarded.
+func (f *changeFeed) read(next int64, since time.Time) ([]*Change, int64, error) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	if next < f.first {
+		return nil, 0, db.ErrUnknownId
+	}
+	rv := []*Change{}
+	for _, c := range f.changes[next-f.first:] {
+		if !c.Modified.Before(since) {
+			rv = append(rv, c)
+		}
+	}
+	return rv, f.first + int64(len(f.changes)), nil
+}
+
+// GetChangesHandler streams changes to tasks, jobs, and comments as they are
+// committed to the DB.
+//   - format: must be "gob"; default "gob"
+//   - since (optional): nanoseconds since the Unix epoch. (base-10 string) If
+//     specified, changes with Modified at or after this time are sent first.
+//     If they are no longer available, responds with ERR_UNKNOWN_ID_CODE.
+// Response is an unbounded GOB stream of Changes, including heartbeats. The
+// stream may end at any time, in which case the client should reconnect and
+// resume.
+func (s *server) GetChangesHandler(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "gob" {
+		httputils.ReportError(w, r, nil, fmt.Sprintf("Unsupported format %q", format))
+		return
+	}
+	since := time.Time{}
+	if sinceStr := r.URL.Query().Get("since"); sinceStr != "" {
+		sinceInt, err := strconv.ParseInt(sinceStr, 10, 64)
+		if err != nil {
+			httputils.ReportError(w, r, err, fmt.Sprintf("Invalid since param %q", sinceStr))
+			return
+		}
+		since = time.Unix(0, sinceInt)
+	}
+	notify, next, err := s.feed.subscribe(since)
+	if err != nil {
+		reportDBError(w, r, err, "Unable to start change feed")
+		return
+	}
+	defer s.feed.unsubscribe(notify)
+
+	var closed <-chan bool
+	if cn, ok := w.(http.CloseNotifier); ok {
+		closed = cn.CloseNotify()
+	}
+	heartbeat := time.NewTicker(CHANGE_FEED_HEARTBEAT_PERIOD)
+	defer heartbeat.Stop()
+
+	w.Header().Set("Content-Type", "application/gob")
+	w.WriteHeader(http.StatusOK)
+	flush(w)
+	enc := gob.NewEncoder(w)
+	for {
+		var changes []*Change
+		changes, next, err = s.feed.read(next, since)
+		if err != nil {
+			// Ending the stream causes the client to reconnect, at
+			// which point it will find out that it can't resume.
+			glog.Warningf("Change feed client fell behind: %s", err)
+			return
+		}
+		// since only applies to the changes which were already
+		// available when the client connected.
+		since = time.Time{}
+		for _, c := range changes {
+			if err := enc.Encode(c); err != nil {
+				glog.Warningf("Unable to encode Change: %s", err)
+				return
+			}
+		}
+		if len(changes) > 0 {
+			flush(w)
+		}
+		select {
+		case <-notify:
+		case <-heartbeat.C:
+			if err := enc.Encode(&Change{}); err != nil {
+				glog.Warningf("Unable to encode heartbeat: %s", err)
+				return
+			}
+			flush(w)
+		case <-closed:
+			return
+		}
+	}
+}
+
+// StreamChanges connects to the change feed of the server at serverRoot, which
+// should end with a slash, and calls fn for each Change other than heartbeats.
+// Blocks until ctx is canceled, fn returns an error, or the stream ends, which
+// may happen at any time; in that case the caller should call StreamChanges
+// again with since set to the Modified timestamp of the last Change received.
+// If since is zero, only changes made after connecting are received. Changes
+// may be received more than once. Returns db.ErrUnknownId if changes since the
+// given time are no longer available, in which case the caller should reload
+// all data and resume from the current time.
+func StreamChanges(ctx context.Context, serverRoot string, since time.Time, fn func(*Change) error) error {
+	params := url.Values{}
+	params.Set("format", "gob")
+	if !util.TimeIsZero(since) {
+		params.Set("since", strconv.FormatInt(since.UnixNano(), 10))
+	}
+	req, err := http.NewRequest(http.MethodGet, serverRoot+CHANGES_PATH+"?"+params.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	req.Cancel = ctx.Done()
+	// Don't use httputils.NewTimeoutClient, since the stream is unbounded.
+	r, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer util.Close(r.Body)
+	if err := interpretStatusCode(r); err != nil {
+		return err
+	}
+	dec := gob.NewDecoder(r.Body)
+	for {
+		var c Change
+		if err := dec.Decode(&c); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+		if c.IsHeartbeat() {
+			continue
+		}
+		if err := fn(&c); err != nil {
+			return err
+		}
+	}
+}
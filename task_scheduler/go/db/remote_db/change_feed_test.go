@@ -0,0 +1,154 @@
+package remote_db
+
+import (
+	"encoding/gob"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"go.skia.org/infra/go/testutils"
+	"go.skia.org/infra/go/util"
+	"go.skia.org/infra/task_scheduler/go/db"
+	"golang.org/x/net/context"
+)
+
+func makeFeedTask() *db.Task {
+	return &db.Task{
+		Created: time.Now(),
+		TaskKey: db.TaskKey{
+			RepoState: db.RepoState{
+				Repo:     "r1",
+				Revision: "c1",
+			},
+			Name: "Test-Task",
+		},
+		Commits: []string{"c1"},
+	}
+}
+
+func TestChangeFeed(t *testing.T) {
+	testutils.MediumTest(t)
+
+	baseDB := db.NewInMemoryDB()
+	r := mux.NewRouter()
+	assert.NoError(t, RegisterServer(baseDB, r.PathPrefix("/db").Subrouter()))
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+	serverRoot := ts.URL + "/db/"
+
+	// Connect to the feed. The server subscribes before sending the
+	// response headers, so all changes after this point are streamed.
+	resp, err := http.Get(serverRoot + CHANGES_PATH)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	dec := gob.NewDecoder(resp.Body)
+	next := func() *Change {
+		var c Change
+		assert.NoError(t, dec.Decode(&c))
+		return &c
+	}
+
+	task := makeFeedTask()
+	assert.NoError(t, baseDB.PutTask(task))
+	c := next()
+	testutils.AssertDeepEqual(t, task, c.Task)
+	assert.True(t, task.DbModified.Equal(c.Modified))
+	resumeFrom := c.Modified
+
+	job := &db.Job{
+		Created:      time.Now(),
+		Dependencies: map[string][]string{},
+		Name:         "Test-Job",
+		Tasks:        map[string][]*db.TaskSummary{},
+	}
+	assert.NoError(t, baseDB.PutJob(job))
+	comment := &db.CommitComment{
+		Repo:      "r1",
+		Revision:  "c1",
+		Timestamp: time.Now(),
+		User:      "me",
+		Message:   "hello",
+	}
+	assert.NoError(t, baseDB.PutCommitComment(comment))
+	c = next()
+	testutils.AssertDeepEqual(t, job, c.Job)
+	c = next()
+	testutils.AssertDeepEqual(t, comment, c.CommitComment)
+	assert.NoError(t, baseDB.DeleteCommitComment(comment))
+	c = next()
+	assert.Equal(t, comment.Message, c.CommitComment.Message)
+	assert.True(t, c.CommitComment.Deleted)
+	util.Close(resp.Body)
+
+	// Resume from the first change. Changes are sent again starting with
+	// the task.
+	ctx, cancel := context.WithCancel(context.Background())
+	changes := make(chan *Change, 10)
+	done := make(chan error)
+	go func() {
+		done <- StreamChanges(ctx, serverRoot, resumeFrom, func(c *Change) error {
+			changes <- c
+			return nil
+		})
+	}()
+	assert.Equal(t, task.Id, (<-changes).Task.Id)
+	assert.Equal(t, job.Id, (<-changes).Job.Id)
+	assert.False(t, (<-changes).CommitComment.Deleted)
+	assert.True(t, (<-changes).CommitComment.Deleted)
+
+	// The stream continues with new changes.
+	task.Status = db.TASK_STATUS_SUCCESS
+	assert.NoError(t, baseDB.PutTask(task))
+	c = <-changes
+	assert.Equal(t, db.TASK_STATUS_SUCCESS, c.Task.Status)
+	cancel()
+	assert.Equal(t, context.Canceled, <-done)
+
+	// Changes from before the feed started are not available.
+	err = StreamChanges(context.Background(), serverRoot, resumeFrom.Add(-time.Hour), func(c *Change) error {
+		assert.FailNow(t, "Unexpected change")
+		return nil
+	})
+	assert.True(t, db.IsUnknownId(err))
+}
+
+func TestChangeFeedRetention(t *testing.T) {
+	testutils.MediumTest(t)
+
+	d := db.NewInMemoryDB()
+	f := newChangeFeed(d)
+	notify, next, err := f.subscribe(time.Time{})
+	assert.NoError(t, err)
+	defer f.unsubscribe(notify)
+
+	// The feed only uses one modified data ID for each type, regardless of
+	// the number of subscribers.
+	for i := 0; i < db.MAX_MODIFIED_DATA_USERS; i++ {
+		other, _, err := f.subscribe(time.Time{})
+		assert.NoError(t, err)
+		defer f.unsubscribe(other)
+	}
+	id, err := d.StartTrackingModifiedTasks()
+	assert.NoError(t, err)
+	d.StopTrackingModifiedTasks(id)
+
+	task := makeFeedTask()
+	assert.NoError(t, d.PutTask(task))
+	assert.NoError(t, f.poll(time.Now()))
+	<-notify
+	changes, _, err := f.read(next, time.Time{})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(changes))
+	assert.Equal(t, task.Id, changes[0].Task.Id)
+
+	// Once the change is older than CHANGE_FEED_RETENTION, it is discarded
+	// and clients can no longer resume from before it.
+	assert.NoError(t, f.poll(task.DbModified.Add(CHANGE_FEED_RETENTION+time.Second)))
+	_, _, err = f.read(next, time.Time{})
+	assert.True(t, db.IsUnknownId(err))
+	_, _, err = f.subscribe(task.DbModified)
+	assert.True(t, db.IsUnknownId(err))
+}
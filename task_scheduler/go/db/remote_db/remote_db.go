@@ -28,9 +28,11 @@ const (
 	MODIFIED_JOBS_PATH      = "modified-jobs"
 	JOBS_PATH               = "jobs"
 	COMMENTS_PATH           = "comments"
+	MODIFIED_COMMENTS_PATH  = "modified-comments"
 	TASK_COMMENTS_PATH      = "comments/task-comments"
 	TASK_SPEC_COMMENTS_PATH = "comments/task-spec-comments"
 	COMMIT_COMMENTS_PATH    = "comments/commit-comments"
+	CHANGES_PATH            = "changes"
 
 	// HTTP error codes used for defined DB errors. See reportDBError and
 	// interpretStatusCode for detail.
@@ -44,7 +46,8 @@ const (
 
 // server translates HTTP requests to method calls on d.
 type server struct {
-	d db.RemoteDB
+	d    db.RemoteDB
+	feed *changeFeed
 }
 
 // RegisterServer adds handlers to r that handle requests from a client created
@@ -54,7 +57,8 @@ type server struct {
 // public port.
 func RegisterServer(d db.RemoteDB, r *mux.Router) error {
 	s := &server{
-		d: d,
+		d:    d,
+		feed: newChangeFeed(d),
 	}
 	s.registerHandlers(r)
 	return nil
@@ -77,6 +81,10 @@ func (s *server) registerHandlers(r *mux.Router) {
 	r.HandleFunc("/"+TASK_SPEC_COMMENTS_PATH, s.DeleteTaskSpecCommentsHandler).Methods(http.MethodDelete)
 	r.HandleFunc("/"+COMMIT_COMMENTS_PATH, s.PostCommitCommentsHandler).Methods(http.MethodPost)
 	r.HandleFunc("/"+COMMIT_COMMENTS_PATH, s.DeleteCommitCommentsHandler).Methods(http.MethodDelete)
+	r.HandleFunc("/"+MODIFIED_COMMENTS_PATH, s.PostModifiedCommentsHandler).Methods(http.MethodPost)
+	r.HandleFunc("/"+MODIFIED_COMMENTS_PATH, s.DeleteModifiedCommentsHandler).Methods(http.MethodDelete)
+	r.HandleFunc("/"+MODIFIED_COMMENTS_PATH, s.GetModifiedCommentsHandler).Methods(http.MethodGet)
+	r.HandleFunc("/"+CHANGES_PATH, s.GetChangesHandler).Methods(http.MethodGet)
 }
 
 // client translates db.RemoteDB method calls to HTTP requests.
@@ -271,6 +279,14 @@ func (s *server) PostModifiedJobsHandler(w http.ResponseWriter, r *http.Request)
 	postModifiedDataHandler(w, r, "jobs", s.d.StartTrackingModifiedJobs, s.d.StopTrackingModifiedJobs)
 }
 
+// PostModifiedCommentsHandler translates a POST request with empty body to
+// StartTrackingModifiedComments.
+//   - format: must be "gob"; default "gob"
+// Response is GOB of string id.
+func (s *server) PostModifiedCommentsHandler(w http.ResponseWriter, r *http.Request) {
+	postModifiedDataHandler(w, r, "comments", s.d.StartTrackingModifiedComments, s.d.StopTrackingModifiedComments)
+}
+
 // doStartTrackingModifiedDataRequest implements the client side of
 // StartTrackingModified(Tasks|Jobs). Sends an HTTP request to the given path
 // and returns the ID from the response body.
@@ -305,6 +321,11 @@ func (c *client) StartTrackingModifiedJobs() (string, error) {
 	return c.doStartTrackingModifiedDataRequest(MODIFIED_JOBS_PATH)
 }
 
+// See documentation for db.CommentDB.
+func (c *client) StartTrackingModifiedComments() (string, error) {
+	return c.doStartTrackingModifiedDataRequest(MODIFIED_COMMENTS_PATH)
+}
+
 // deleteModifiedDataHandler processes a DELETE request with empty body by
 // calling stopFn, which is StopTrackingModified(Tasks|Jobs).
 //   - id: id returned from postModifiedDataHandler
@@ -335,6 +356,14 @@ func (s *server) DeleteModifiedJobsHandler(w http.ResponseWriter, r *http.Reques
 	deleteModifiedDataHandler(w, r, s.d.StopTrackingModifiedJobs)
 }
 
+// DeleteModifiedCommentsHandler translates a DELETE request with empty body to
+// StopTrackingModifiedComments.
+//   - id: id returned from PostModifiedCommentsHandler
+// No response body.
+func (s *server) DeleteModifiedCommentsHandler(w http.ResponseWriter, r *http.Request) {
+	deleteModifiedDataHandler(w, r, s.d.StopTrackingModifiedComments)
+}
+
 // doStopTrackingModifiedDataRequest implements the client side of
 // StopTrackingModified(Tasks|Jobs). Sends an HTTP request to the given path
 // with the given id param.
@@ -368,6 +397,11 @@ func (c *client) StopTrackingModifiedJobs(id string) {
 	c.doStopTrackingModifiedDataRequest(MODIFIED_JOBS_PATH, id)
 }
 
+// See documentation for db.CommentDB.
+func (c *client) StopTrackingModifiedComments(id string) {
+	c.doStopTrackingModifiedDataRequest(MODIFIED_COMMENTS_PATH, id)
+}
+
 // GetModifiedTasksHandler translates a GET request to GetModifiedTasks.
 //   - format: must be "gob"; default "gob"
 //   - id: id returned from PostModifiedTasksHandler
@@ -683,6 +717,76 @@ func (c *client) GetCommentsForRepos(repos []string, from time.Time) ([]*db.Repo
 	return rv, nil
 }
 
+// modifiedComments is the response body for GetModifiedCommentsHandler.
+type modifiedComments struct {
+	TaskComments     []*db.TaskComment
+	TaskSpecComments []*db.TaskSpecComment
+	CommitComments   []*db.CommitComment
+}
+
+// GetModifiedCommentsHandler translates a GET request to GetModifiedComments.
+//   - format: must be "gob"; default "gob"
+//   - id: id returned from PostModifiedCommentsHandler
+// Response is GOB of modifiedComments.
+// Warning: not RESTful: the same URI will return different results each time.
+func (s *server) GetModifiedCommentsHandler(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "gob" {
+		httputils.ReportError(w, r, nil, fmt.Sprintf("Unsupported format %q", format))
+		return
+	}
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		httputils.ReportError(w, r, nil, "Missing id param")
+		return
+	}
+	tcs, scs, ccs, err := s.d.GetModifiedComments(id)
+	if err != nil {
+		reportDBError(w, r, err, "Unable to retrieve comments")
+		return
+	}
+	w.Header().Set("Content-Type", "application/gob")
+	if err := gob.NewEncoder(w).Encode(&modifiedComments{
+		TaskComments:     tcs,
+		TaskSpecComments: scs,
+		CommitComments:   ccs,
+	}); err != nil {
+		s.d.StopTrackingModifiedComments(id)
+		httputils.ReportError(w, r, err, "Unable to encode comments")
+		return
+	}
+}
+
+// See documentation for db.CommentDB.
+func (c *client) GetModifiedComments(id string) ([]*db.TaskComment, []*db.TaskSpecComment, []*db.CommitComment, error) {
+	params := url.Values{}
+	params.Set("format", "gob")
+	params.Set("id", id)
+	r, err := c.client.Get(c.serverRoot + MODIFIED_COMMENTS_PATH + "?" + params.Encode())
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	defer util.Close(r.Body)
+	if err := interpretStatusCode(r); err != nil {
+		return nil, nil, nil, err
+	}
+	var rv modifiedComments
+	if err := gob.NewDecoder(r.Body).Decode(&rv); err != nil {
+		return nil, nil, nil, err
+	}
+	// GOB doesn't distinguish between nil and empty slices.
+	if rv.TaskComments == nil {
+		rv.TaskComments = []*db.TaskComment{}
+	}
+	if rv.TaskSpecComments == nil {
+		rv.TaskSpecComments = []*db.TaskSpecComment{}
+	}
+	if rv.CommitComments == nil {
+		rv.CommitComments = []*db.CommitComment{}
+	}
+	return rv.TaskComments, rv.TaskSpecComments, rv.CommitComments, nil
+}
+
 // sharedTaskCommentsHandler translates a POST or DELETE request where the body
 // is a GOB-encoded db.TaskComment to PutTaskComment or DeleteTaskComment.
 //   - format: must be "gob"; default "gob"
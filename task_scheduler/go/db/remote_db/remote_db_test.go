@@ -122,3 +122,10 @@ func TestRemoteDBCommentDB(t *testing.T) {
 	defer testutils.AssertCloses(t, d)
 	db.TestCommentDB(t, d)
 }
+
+func TestRemoteDBCommentDBModified(t *testing.T) {
+	testutils.SmallTest(t)
+	d := makeDB(t)
+	defer testutils.AssertCloses(t, d)
+	db.TestCommentDBModified(t, d)
+}
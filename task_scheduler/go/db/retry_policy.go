@@ -0,0 +1,82 @@
+package db
+
+import (
+	"fmt"
+)
+
+const (
+	// RETRY_ON_MISHAP indicates that only Tasks which end in
+	// TASK_STATUS_MISHAP should be retried.
+	RETRY_ON_MISHAP = "mishap"
+
+	// RETRY_ON_FAILURE indicates that only Tasks which end in
+	// TASK_STATUS_FAILURE should be retried.
+	RETRY_ON_FAILURE = "failure"
+
+	// RETRY_ON_BOTH indicates that Tasks which end in either
+	// TASK_STATUS_MISHAP or TASK_STATUS_FAILURE should be retried.
+	RETRY_ON_BOTH = "both"
+)
+
+var (
+	// DEFAULT_RETRY_POLICY is the RetryPolicy used for TaskSpecs which do
+	// not specify one.
+	DEFAULT_RETRY_POLICY = &RetryPolicy{
+		MaxAttempts: MAX_TASK_ATTEMPTS,
+		RetryOn:     RETRY_ON_BOTH,
+	}
+)
+
+// RetryPolicy describes how and when failed Tasks should be retried.
+//
+// RetryPolicy is stored as part of a Job, which is stored as a GOB, so changes
+// must maintain backwards compatibility.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of Tasks, including the original,
+	// which may be run for a TaskSpec at a given TaskKey.
+	MaxAttempts int `json:"max_attempts"`
+
+	// RetryOn indicates which kinds of unsuccessful Tasks should be
+	// retried. One of RETRY_ON_MISHAP, RETRY_ON_FAILURE, or RETRY_ON_BOTH.
+	RetryOn string `json:"retry_on"`
+}
+
+// Validate returns an error if the RetryPolicy is not valid.
+func (p *RetryPolicy) Validate() error {
+	if p.MaxAttempts < 1 {
+		return fmt.Errorf("Retry policy must allow at least one attempt; got %d.", p.MaxAttempts)
+	}
+	switch p.RetryOn {
+	case RETRY_ON_MISHAP, RETRY_ON_FAILURE, RETRY_ON_BOTH:
+		return nil
+	default:
+		return fmt.Errorf("Invalid retry_on value %q; must be one of %q, %q, or %q.", p.RetryOn, RETRY_ON_MISHAP, RETRY_ON_FAILURE, RETRY_ON_BOTH)
+	}
+}
+
+// Copy returns a copy of the RetryPolicy.
+func (p *RetryPolicy) Copy() *RetryPolicy {
+	return &RetryPolicy{
+		MaxAttempts: p.MaxAttempts,
+		RetryOn:     p.RetryOn,
+	}
+}
+
+// RetriesStatus returns true iff the RetryPolicy allows Tasks which ended with
+// the given status to be retried, ignoring the number of attempts.
+func (p *RetryPolicy) RetriesStatus(s TaskStatus) bool {
+	switch s {
+	case TASK_STATUS_MISHAP:
+		return p.RetryOn == RETRY_ON_MISHAP || p.RetryOn == RETRY_ON_BOTH
+	case TASK_STATUS_FAILURE:
+		return p.RetryOn == RETRY_ON_FAILURE || p.RetryOn == RETRY_ON_BOTH
+	}
+	return false
+}
+
+// ShouldRetry returns true iff a Task which ended with the given status should
+// be retried, given that the indicated number of attempts have already been
+// made.
+func (p *RetryPolicy) ShouldRetry(s TaskStatus, attempts int) bool {
+	return attempts < p.MaxAttempts && p.RetriesStatus(s)
+}
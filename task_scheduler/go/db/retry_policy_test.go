@@ -0,0 +1,56 @@
+package db
+
+import (
+	"testing"
+
+	assert "github.com/stretchr/testify/require"
+
+	"go.skia.org/infra/go/testutils"
+)
+
+func TestCopyRetryPolicy(t *testing.T) {
+	testutils.SmallTest(t)
+	v := &RetryPolicy{
+		MaxAttempts: 5,
+		RetryOn:     RETRY_ON_FAILURE,
+	}
+	testutils.AssertCopy(t, v, v.Copy())
+}
+
+func TestRetryPolicyValidate(t *testing.T) {
+	testutils.SmallTest(t)
+	assert.NoError(t, DEFAULT_RETRY_POLICY.Validate())
+	assert.NoError(t, (&RetryPolicy{MaxAttempts: 1, RetryOn: RETRY_ON_MISHAP}).Validate())
+	assert.EqualError(t, (&RetryPolicy{MaxAttempts: 0, RetryOn: RETRY_ON_MISHAP}).Validate(), "Retry policy must allow at least one attempt; got 0.")
+	assert.EqualError(t, (&RetryPolicy{MaxAttempts: 2, RetryOn: "always"}).Validate(), "Invalid retry_on value \"always\"; must be one of \"mishap\", \"failure\", or \"both\".")
+}
+
+func TestRetryPolicyShouldRetry(t *testing.T) {
+	testutils.SmallTest(t)
+	test := func(p *RetryPolicy, s TaskStatus, attempts int, expect bool) {
+		assert.Equal(t, expect, p.ShouldRetry(s, attempts))
+	}
+	mishap := &RetryPolicy{MaxAttempts: 3, RetryOn: RETRY_ON_MISHAP}
+	failure := &RetryPolicy{MaxAttempts: 3, RetryOn: RETRY_ON_FAILURE}
+	both := &RetryPolicy{MaxAttempts: 3, RetryOn: RETRY_ON_BOTH}
+
+	// Never retry successful or unfinished tasks.
+	for _, p := range []*RetryPolicy{mishap, failure, both} {
+		test(p, TASK_STATUS_SUCCESS, 1, false)
+		test(p, TASK_STATUS_PENDING, 1, false)
+		test(p, TASK_STATUS_RUNNING, 1, false)
+	}
+
+	test(mishap, TASK_STATUS_MISHAP, 1, true)
+	test(mishap, TASK_STATUS_FAILURE, 1, false)
+	test(failure, TASK_STATUS_MISHAP, 1, false)
+	test(failure, TASK_STATUS_FAILURE, 1, true)
+	test(both, TASK_STATUS_MISHAP, 1, true)
+	test(both, TASK_STATUS_FAILURE, 1, true)
+
+	// Respect MaxAttempts.
+	test(both, TASK_STATUS_FAILURE, 2, true)
+	test(both, TASK_STATUS_FAILURE, 3, false)
+	test(DEFAULT_RETRY_POLICY, TASK_STATUS_FAILURE, 1, true)
+	test(DEFAULT_RETRY_POLICY, TASK_STATUS_FAILURE, 2, false)
+}
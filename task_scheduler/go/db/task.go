@@ -116,6 +116,12 @@ type Task struct {
 	// of the associated Swarming task.
 	DbModified time.Time
 
+	// DedupedFrom is the ID of the Task whose results were reused for this
+	// Task because the two had identical inputs. If set, this Task was not
+	// actually run; its status, outputs, and Swarming information were
+	// copied from the original Task.
+	DedupedFrom string
+
 	// Finished is the time the task stopped running or expired from the queue, or
 	//  zero if the task is pending or running.
 	Finished time.Time
@@ -134,6 +140,13 @@ type Task struct {
 	// ParentTaskIds are IDs of tasks which satisfied this task's dependencies.
 	ParentTaskIds []string
 
+	// PropertiesHash is a hash of the properties of the Swarming task
+	// request for this Task, including the isolated input hash, dimensions,
+	// command-line arguments, environment, and CIPD packages, but not the
+	// bot on which the task was run. Tasks with equal PropertiesHash are
+	// expected to produce identical results.
+	PropertiesHash string
+
 	// RetryOf is the ID of the task which this task is a retry of, if any.
 	RetryOf string
 
@@ -359,10 +372,12 @@ func (t *Task) Copy() *Task {
 		Commits:        commits,
 		Created:        t.Created,
 		DbModified:     t.DbModified,
+		DedupedFrom:    t.DedupedFrom,
 		Finished:       t.Finished,
 		Id:             t.Id,
 		IsolatedOutput: t.IsolatedOutput,
 		ParentTaskIds:  parentTaskIds,
+		PropertiesHash: t.PropertiesHash,
 		RetryOf:        t.RetryOf,
 		Started:        t.Started,
 		Status:         t.Status,
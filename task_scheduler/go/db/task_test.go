@@ -649,10 +649,12 @@ func TestCopyTask(t *testing.T) {
 		Commits:        []string{"a", "b"},
 		Created:        now.Add(time.Nanosecond),
 		DbModified:     now.Add(time.Millisecond),
+		DedupedFrom:    "37",
 		Finished:       now.Add(time.Second),
 		Id:             "42",
 		IsolatedOutput: "lonely-result",
 		ParentTaskIds:  []string{"38", "39", "40"},
+		PropertiesHash: "deadbeef",
 		RetryOf:        "41",
 		Started:        now.Add(time.Minute),
 		Status:         TASK_STATUS_MISHAP,
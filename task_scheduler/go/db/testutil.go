@@ -1401,3 +1401,61 @@ func TestCommentDB(t *testing.T, db CommentDB) {
 func DummyGetRevisionTimestamp(ts time.Time) GetRevisionTimestamp {
 	return func(string, string) (time.Time, error) { return ts, nil }
 }
+
+// TestCommentDBModified validates that db correctly implements the modified
+// comment tracking methods of the CommentDB interface.
+func TestCommentDBModified(t *testing.T, db CommentDB) {
+	now := time.Now()
+
+	_, _, _, err := db.GetModifiedComments("dummy-id")
+	assert.True(t, IsUnknownId(err))
+
+	id, err := db.StartTrackingModifiedComments()
+	assert.NoError(t, err)
+
+	tcs, scs, ccs, err := db.GetModifiedComments(id)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(tcs))
+	assert.Equal(t, 0, len(scs))
+	assert.Equal(t, 0, len(ccs))
+
+	// Add some comments.
+	tc1 := makeTaskComment(1, 1, 1, 1, now)
+	tc2 := makeTaskComment(2, 1, 1, 1, now.Add(time.Second))
+	sc1 := makeTaskSpecComment(1, 1, 1, now)
+	cc1 := makeCommitComment(1, 1, 1, now)
+	assert.NoError(t, db.PutTaskComment(tc2))
+	assert.NoError(t, db.PutTaskComment(tc1))
+	assert.NoError(t, db.PutTaskSpecComment(sc1))
+	assert.NoError(t, db.PutCommitComment(cc1))
+
+	tcs, scs, ccs, err = db.GetModifiedComments(id)
+	assert.NoError(t, err)
+	testutils.AssertDeepEqual(t, []*TaskComment{tc1, tc2}, tcs)
+	testutils.AssertDeepEqual(t, []*TaskSpecComment{sc1}, scs)
+	testutils.AssertDeepEqual(t, []*CommitComment{cc1}, ccs)
+
+	// Nothing new.
+	tcs, scs, ccs, err = db.GetModifiedComments(id)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(tcs)+len(scs)+len(ccs))
+
+	// Deleted comments are returned with Deleted set. Deleting nonexistent
+	// comments has no effect.
+	assert.NoError(t, db.DeleteTaskComment(tc1))
+	assert.NoError(t, db.DeleteTaskSpecComment(sc1))
+	assert.NoError(t, db.DeleteCommitComment(cc1))
+	assert.NoError(t, db.DeleteCommitComment(makeCommitComment(99, 1, 1, now.Add(99*time.Second))))
+	tcs, scs, ccs, err = db.GetModifiedComments(id)
+	assert.NoError(t, err)
+	tc1.Deleted = true
+	sc1.Deleted = true
+	cc1.Deleted = true
+	testutils.AssertDeepEqual(t, []*TaskComment{tc1}, tcs)
+	testutils.AssertDeepEqual(t, []*TaskSpecComment{sc1}, scs)
+	testutils.AssertDeepEqual(t, []*CommitComment{cc1}, ccs)
+
+	db.StopTrackingModifiedComments(id)
+	_, _, _, err = db.GetModifiedComments(id)
+	assert.True(t, IsUnknownId(err))
+}
@@ -0,0 +1,145 @@
+package main
+
+/*
+	Export tasks, jobs, and comments from a task scheduler DB as line-delimited
+	JSON, or import them into a DB.
+
+	Export from a running task scheduler:
+	  db_tool --mode=export --remote_db=http://localhost:8008/db/ --from=2016-10-01T00:00:00Z > export.json
+
+	Import into a local DB file:
+	  db_tool --mode=import --local_db=/tmp/task_scheduler.bdb --file=export.json
+*/
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/skia-dev/glog"
+	"go.skia.org/infra/go/common"
+	"go.skia.org/infra/go/util"
+	"go.skia.org/infra/task_scheduler/go/db"
+	"go.skia.org/infra/task_scheduler/go/db/local_db"
+	"go.skia.org/infra/task_scheduler/go/db/remote_db"
+)
+
+const (
+	MODE_EXPORT = "export"
+	MODE_IMPORT = "import"
+)
+
+var (
+	mode     = flag.String("mode", "", "Either \"export\" or \"import\".")
+	localDb  = flag.String("local_db", "", "Path to a local DB file. Either --local_db or --remote_db is required.")
+	remoteDb = flag.String("remote_db", "", "URL of a remote DB server, eg. http://localhost:8008/db/. Only supported with --mode=export.")
+	file     = flag.String("file", "", "File to export to or import from. Defaults to stdout or stdin.")
+	from     = flag.String("from", "", "Export tasks, jobs, and comments created at or after this time, in RFC3339 format. Required for --mode=export.")
+	to       = flag.String("to", "", "Export tasks, jobs, and comments created before this time, in RFC3339 format. Defaults to now.")
+	repos    = common.NewMultiStringFlag("repo", nil, "Export comments for these repos, in addition to the repos of the exported tasks and jobs.")
+)
+
+// export writes the tasks, jobs, and comments in the requested range of the
+// DB to the requested file.
+func export() error {
+	if *from == "" {
+		return fmt.Errorf("--from is required.")
+	}
+	fromTime, err := time.Parse(time.RFC3339, *from)
+	if err != nil {
+		return fmt.Errorf("Invalid --from: %s", err)
+	}
+	toTime := time.Now()
+	if *to != "" {
+		toTime, err = time.Parse(time.RFC3339, *to)
+		if err != nil {
+			return fmt.Errorf("Invalid --to: %s", err)
+		}
+	}
+
+	var d db.RemoteDB
+	if *localDb != "" {
+		ld, err := local_db.NewDB("db_tool", *localDb)
+		if err != nil {
+			return err
+		}
+		defer util.Close(ld)
+		d = ld
+	} else {
+		d, err = remote_db.NewClient(*remoteDb)
+		if err != nil {
+			return err
+		}
+	}
+
+	var w io.Writer = os.Stdout
+	if *file != "" {
+		f, err := os.Create(*file)
+		if err != nil {
+			return err
+		}
+		defer util.Close(f)
+		w = f
+	}
+	counts, err := db.Export(d, w, fromTime, toTime, *repos)
+	if err != nil {
+		return err
+	}
+	glog.Infof("Exported %d tasks, %d jobs, and %d comments.", counts.Tasks, counts.Jobs, counts.Comments)
+	return nil
+}
+
+// importFile reads tasks, jobs, and comments from the requested file and
+// inserts them into the local DB.
+func importFile() error {
+	if *localDb == "" {
+		return fmt.Errorf("--mode=import requires --local_db.")
+	}
+	d, err := local_db.NewDB("db_tool", *localDb)
+	if err != nil {
+		return err
+	}
+	defer util.Close(d)
+
+	var r io.Reader = os.Stdin
+	if *file != "" {
+		f, err := os.Open(*file)
+		if err != nil {
+			return err
+		}
+		defer util.Close(f)
+		r = f
+	}
+	counts, err := db.Import(d, r)
+	if err != nil {
+		return err
+	}
+	glog.Infof("Imported %d tasks, %d jobs, and %d comments.", counts.Tasks, counts.Jobs, counts.Comments)
+	return nil
+}
+
+func main() {
+	common.Init()
+	defer common.LogPanic()
+
+	if *mode != MODE_EXPORT && *mode != MODE_IMPORT {
+		glog.Fatalf("--mode must be %q or %q.", MODE_EXPORT, MODE_IMPORT)
+	}
+	if (*localDb == "") == (*remoteDb == "") {
+		glog.Fatal("Exactly one of --local_db or --remote_db is required.")
+	}
+
+	// Exit only after export or importFile have returned, so that the DB
+	// and file are closed first.
+	var err error
+	if *mode == MODE_EXPORT {
+		err = export()
+	} else {
+		err = importFile()
+	}
+	if err != nil {
+		glog.Fatal(err)
+	}
+}
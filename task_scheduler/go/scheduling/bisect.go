@@ -0,0 +1,304 @@
+package scheduling
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/skia-dev/glog"
+	"go.skia.org/infra/go/git/repograph"
+	"go.skia.org/infra/go/timer"
+	"go.skia.org/infra/go/util"
+	"go.skia.org/infra/task_scheduler/go/db"
+)
+
+const (
+	// BISECT_COMMENT_USER is the User for TaskComments which record the
+	// culprit commit found by bisecting a failure.
+	BISECT_COMMENT_USER = "task-scheduler-bisect"
+)
+
+// bisectFailures finds newly-failing tasks for TaskSpecs which have Bisect
+// enabled, ie. failed tasks for which the tasks covering the commits
+// immediately before the blamelist succeeded. If the blamelist of such a task
+// contains more than one commit, a forced Job is added at the middle commit.
+// Forced Jobs are scored above normal candidates, and the resulting task
+// steals the older half of the blamelist. Depending on whether that task
+// fails or succeeds, either it or the original task is the newly-failing task
+// in the next round. Once a newly-failing task has a single commit in its
+// blamelist, that commit is recorded as the culprit in a TaskComment.
+func (s *TaskScheduler) bisectFailures(now time.Time) error {
+	defer timer.New("TaskScheduler.bisectFailures").Stop()
+
+	tasks, err := s.tCache.GetTasksFromDateRange(now.Add(-s.period), now)
+	if err != nil {
+		return err
+	}
+	unfinishedJobs, err := s.jCache.UnfinishedJobs()
+	if err != nil {
+		return err
+	}
+	newJobs := []*db.Job{}
+	// Only remember the culprits of tasks in the current window, so that
+	// the set doesn't grow without bound.
+	culprits := util.StringSet{}
+	defer func() {
+		s.culprits = culprits
+	}()
+	for _, t := range tasks {
+		if t.Status != db.TASK_STATUS_FAILURE || t.IsTryJob() || len(t.Commits) == 0 {
+			continue
+		}
+		spec, err := s.taskCfgCache.GetTaskSpec(t.RepoState, t.Name)
+		if err != nil {
+			return err
+		}
+		if !spec.Bisect {
+			continue
+		}
+
+		// Wait for any retries to finish.
+		latest, err := s.tCache.GetTaskForCommit(t.Repo, t.Revision, t.Name)
+		if err != nil {
+			return err
+		}
+		if latest == nil || latest.Id != t.Id {
+			continue
+		}
+		prevTasks, err := s.tCache.GetTasksByKey(&t.TaskKey)
+		if err != nil {
+			return err
+		}
+		if spec.GetRetryPolicy().ShouldRetry(t.Status, len(prevTasks)) {
+			continue
+		}
+
+		repo, ok := s.repos[t.Repo]
+		if !ok {
+			return fmt.Errorf("No such repo: %s", t.Repo)
+		}
+		isNew, err := s.isNewFailure(repo, t)
+		if err != nil {
+			return err
+		}
+		if !isNew {
+			continue
+		}
+
+		if len(t.Commits) == 1 {
+			if !s.culprits[t.Id] {
+				if err := s.recordCulprit(t, now); err != nil {
+					return err
+				}
+			}
+			culprits[t.Id] = true
+			continue
+		}
+
+		// Don't start another bisection step for this blamelist until
+		// the previous one has produced a task.
+		if bisectInProgress(unfinishedJobs, t) {
+			continue
+		}
+		mid, err := bisectMidpoint(repo, t.Commits)
+		if err != nil {
+			return err
+		}
+		j, err := s.makeBisectJob(db.RepoState{
+			Repo:     t.Repo,
+			Revision: mid,
+		}, t.Name)
+		if err != nil {
+			return err
+		}
+		glog.Infof("Bisecting failure of %s (%d commits); adding Job at %s", t.Id, len(t.Commits), mid)
+		newJobs = append(newJobs, j)
+	}
+
+	if len(newJobs) == 0 {
+		return nil
+	}
+	if err := s.db.PutJobs(newJobs); err != nil {
+		return err
+	}
+	return s.jCache.Update()
+}
+
+// isNewFailure returns true iff all of the tasks which cover the parents of
+// the oldest commits in the given task's blamelist succeeded, ie. the failure
+// was introduced within the blamelist.
+func (s *TaskScheduler) isNewFailure(repo *repograph.Graph, t *db.Task) (bool, error) {
+	blamelist := util.NewStringSet(t.Commits)
+	found := false
+	for _, hash := range t.Commits {
+		c := repo.Get(hash)
+		if c == nil {
+			return false, fmt.Errorf("No such commit %s in %s.", hash, t.Repo)
+		}
+		for _, p := range c.GetParents() {
+			if blamelist[p.Hash] {
+				continue
+			}
+			prev, err := s.tCache.GetTaskForCommit(t.Repo, p.Hash, t.Name)
+			if err != nil {
+				return false, err
+			}
+			if prev == nil || !prev.Success() {
+				return false, nil
+			}
+			found = true
+		}
+	}
+	return found, nil
+}
+
+// bisectInProgress returns true iff any of the given Jobs is a forced Job for
+// the given task's TaskSpec at a commit in the task's blamelist.
+func bisectInProgress(jobs []*db.Job, t *db.Task) bool {
+	for _, j := range jobs {
+		if !j.IsForce || j.Repo != t.Repo {
+			continue
+		}
+		if _, ok := j.Dependencies[t.Name]; ok && util.In(j.Revision, t.Commits) {
+			return true
+		}
+	}
+	return false
+}
+
+// bisectMidpoint returns the commit at which to run the next task when
+// bisecting the given blamelist. Running a task at the returned commit splits
+// the blamelist in half, with the new task taking the older half.
+func bisectMidpoint(repo *repograph.Graph, commits []string) (string, error) {
+	// Order the commits newest first by counting the number of commits in
+	// the blamelist which are ancestors of each commit. Commit timestamps
+	// aren't reliable for this, since several commits may share one.
+	blamelist := util.NewStringSet(commits)
+	ancestors := make(map[string]int, len(commits))
+	for _, hash := range commits {
+		c := repo.Get(hash)
+		if c == nil {
+			return "", fmt.Errorf("No such commit: %s", hash)
+		}
+		n := 0
+		if err := c.Recurse(func(a *repograph.Commit) (bool, error) {
+			if !blamelist[a.Hash] {
+				return false, nil
+			}
+			n++
+			return true, nil
+		}); err != nil {
+			return "", err
+		}
+		ancestors[hash] = n
+	}
+	sorted := util.CopyStringSlice(commits)
+	sort.Sort(commitsByAncestors{sorted, ancestors})
+	return sorted[len(sorted)/2], nil
+}
+
+// commitsByAncestors is used for sorting commit hashes newest first, given the
+// number of ancestors of each commit.
+type commitsByAncestors struct {
+	hashes    []string
+	ancestors map[string]int
+}
+
+func (s commitsByAncestors) Len() int { return len(s.hashes) }
+func (s commitsByAncestors) Less(i, j int) bool {
+	a, b := s.ancestors[s.hashes[i]], s.ancestors[s.hashes[j]]
+	if a != b {
+		return a > b
+	}
+	return s.hashes[i] < s.hashes[j]
+}
+func (s commitsByAncestors) Swap(i, j int) { s.hashes[i], s.hashes[j] = s.hashes[j], s.hashes[i] }
+
+// makeBisectJob returns a forced Job at the given RepoState which runs only
+// the given TaskSpec and its dependencies. The Job is created from a JobSpec
+// which includes the TaskSpec, preferring a JobSpec with the same name.
+func (s *TaskScheduler) makeBisectJob(rs db.RepoState, taskName string) (*db.Job, error) {
+	cfg, err := s.taskCfgCache.ReadTasksCfg(rs)
+	if err != nil {
+		return nil, err
+	}
+	jobNames := make([]string, 0, len(cfg.Jobs)+1)
+	if _, ok := cfg.Jobs[taskName]; ok {
+		jobNames = append(jobNames, taskName)
+	}
+	others := make([]string, 0, len(cfg.Jobs))
+	for name := range cfg.Jobs {
+		if name != taskName {
+			others = append(others, name)
+		}
+	}
+	sort.Strings(others)
+	jobNames = append(jobNames, others...)
+	for _, name := range jobNames {
+		deps, err := cfg.Jobs[name].GetTaskSpecDAG(cfg)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := deps[taskName]; !ok {
+			continue
+		}
+		j, err := s.taskCfgCache.MakeJob(rs, name)
+		if err != nil {
+			return nil, err
+		}
+		// Trim the Job down to the TaskSpec we're bisecting and the
+		// TaskSpecs it depends on.
+		keep := map[string][]string{}
+		toVisit := []string{taskName}
+		for len(toVisit) > 0 {
+			n := toVisit[0]
+			toVisit = toVisit[1:]
+			if _, ok := keep[n]; ok {
+				continue
+			}
+			keep[n] = j.Dependencies[n]
+			toVisit = append(toVisit, j.Dependencies[n]...)
+		}
+		j.Dependencies = keep
+		for n := range j.RetryPolicies {
+			if _, ok := keep[n]; !ok {
+				delete(j.RetryPolicies, n)
+			}
+		}
+		for n := range j.ConditionalDependencies {
+			if _, ok := keep[n]; !ok {
+				delete(j.ConditionalDependencies, n)
+			}
+		}
+		j.IsForce = true
+		return j, nil
+	}
+	return nil, fmt.Errorf("No JobSpec at %s includes TaskSpec %s", rs.Revision, taskName)
+}
+
+// recordCulprit adds a TaskComment to the given task naming its only
+// blamelist commit as the culprit, unless one already exists. Since this queries
+// the DB, bisectFailures only calls it once per task.
+func (s *TaskScheduler) recordCulprit(t *db.Task, now time.Time) error {
+	comments, err := s.db.GetCommentsForRepos([]string{t.Repo}, t.Created)
+	if err != nil {
+		return err
+	}
+	for _, rc := range comments {
+		for _, c := range rc.TaskComments[t.Revision][t.Name] {
+			if c.TaskId == t.Id && c.User == BISECT_COMMENT_USER {
+				return nil
+			}
+		}
+	}
+	glog.Infof("Bisection found culprit %s for %s", t.Commits[0], t.Name)
+	return s.db.PutTaskComment(&db.TaskComment{
+		Repo:      t.Repo,
+		Revision:  t.Revision,
+		Name:      t.Name,
+		Timestamp: now,
+		TaskId:    t.Id,
+		User:      BISECT_COMMENT_USER,
+		Message:   fmt.Sprintf("Culprit commit %s found by automatic bisection.", t.Commits[0]),
+	})
+}
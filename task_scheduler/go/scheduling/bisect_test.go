@@ -0,0 +1,248 @@
+package scheduling
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path"
+	"sort"
+	"testing"
+	"time"
+
+	swarming_api "github.com/luci/luci-go/common/api/swarming/swarming/v1"
+	assert "github.com/stretchr/testify/require"
+	"go.skia.org/infra/go/exec"
+	exec_testutils "go.skia.org/infra/go/exec/testutils"
+	"go.skia.org/infra/go/git/repograph"
+	"go.skia.org/infra/go/isolate"
+	"go.skia.org/infra/go/mockhttpclient"
+	"go.skia.org/infra/go/swarming"
+	"go.skia.org/infra/go/testutils"
+	"go.skia.org/infra/go/util"
+	"go.skia.org/infra/task_scheduler/go/db"
+	"go.skia.org/infra/task_scheduler/go/specs"
+	"go.skia.org/infra/task_scheduler/go/tryjobs"
+)
+
+func TestBisectFailures(t *testing.T) {
+	testutils.MediumTest(t)
+	testutils.SkipIfShort(t)
+
+	workdir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer testutils.RemoveAll(t, workdir)
+	assert.NoError(t, os.Mkdir(path.Join(workdir, TRIGGER_DIRNAME), os.ModePerm))
+
+	run := func(dir string, cmd ...string) {
+		_, err := exec.RunCwd(dir, cmd...)
+		assert.NoError(t, err)
+	}
+
+	addFile := func(repoDir, subPath, contents string) {
+		assert.NoError(t, ioutil.WriteFile(path.Join(repoDir, subPath), []byte(contents), os.ModePerm))
+		run(repoDir, "git", "add", subPath)
+	}
+
+	repoDir := path.Join(workdir, repoName)
+	assert.NoError(t, ioutil.WriteFile(path.Join(workdir, ".gclient"), []byte("dummy"), os.ModePerm))
+	assert.NoError(t, os.Mkdir(repoDir, os.ModePerm))
+	run(repoDir, "git", "init")
+	run(repoDir, "git", "remote", "add", "origin", ".")
+
+	infraBotsSubDir := path.Join("infra", "bots")
+	assert.NoError(t, os.MkdirAll(path.Join(repoDir, infraBotsSubDir), os.ModePerm))
+	addFile(repoDir, "somefile.txt", "dummy3")
+	addFile(repoDir, path.Join(infraBotsSubDir, "dummy.isolate"), `{
+  'variables': {
+    'command': [
+      'python', 'recipes.py', 'run',
+    ],
+    'files': [
+      '../../somefile.txt',
+    ],
+  },
+}`)
+
+	// Create a single task which opts in to bisection and isn't retried,
+	// and a Job with a different name which also runs it.
+	taskName := "dummytask"
+	cfg := &specs.TasksCfg{
+		Tasks: map[string]*specs.TaskSpec{
+			taskName: &specs.TaskSpec{
+				Bisect:     true,
+				Dimensions: []string{"pool:Skia"},
+				Isolate:    "dummy.isolate",
+				Priority:   1.0,
+				RetryPolicy: &db.RetryPolicy{
+					MaxAttempts: 1,
+					RetryOn:     db.RETRY_ON_BOTH,
+				},
+			},
+		},
+		Jobs: map[string]*specs.JobSpec{
+			"j1": &specs.JobSpec{
+				TaskSpecs: []string{taskName},
+			},
+			taskName: &specs.JobSpec{
+				TaskSpecs: []string{taskName},
+			},
+		},
+	}
+	f, err := os.Create(path.Join(repoDir, specs.TASKS_CFG_FILE))
+	assert.NoError(t, err)
+	assert.NoError(t, json.NewEncoder(f).Encode(&cfg))
+	assert.NoError(t, f.Close())
+	run(repoDir, "git", "add", specs.TASKS_CFG_FILE)
+	run(repoDir, "git", "commit", "-m", "Add a task")
+	run(repoDir, "git", "push", "origin", "master")
+	run(repoDir, "git", "branch", "-u", "origin/master")
+
+	// Setup the scheduler.
+	d := db.NewInMemoryDB()
+	isolateClient, err := isolate.NewClient(workdir)
+	assert.NoError(t, err)
+	isolateClient.ServerUrl = isolate.FAKE_SERVER_URL
+	swarmingClient := swarming.NewTestClient()
+	repo, err := repograph.NewGraph(repoName, workdir)
+	assert.NoError(t, err)
+	repos := repograph.Map{
+		repoName: repo,
+	}
+	s, err := NewTaskScheduler(d, time.Duration(math.MaxInt64), workdir, repos, isolateClient, swarmingClient, mockhttpclient.NewURLMock().Client(), 1.0, &defaultScorer{}, tryjobs.API_URL_TESTING, tryjobs.BUCKET_TESTING, projectRepoMapping)
+	assert.NoError(t, err)
+
+	// Only one bot, so that we can see which candidate is chosen.
+	swarmingClient.MockBots([]*swarming_api.SwarmingRpcsBotInfo{
+		makeBot("bot1", map[string]string{"pool": "Skia"}),
+	})
+	mockTasks := []*swarming_api.SwarmingRpcsTaskRequestMetadata{}
+	finish := func(task *db.Task, status db.TaskStatus) {
+		task.Status = status
+		task.Finished = time.Now()
+		mockTasks = append(mockTasks, makeSwarmingRpcsTaskRequestMetadata(t, task))
+		swarmingClient.MockTasks(mockTasks)
+	}
+
+	// Cycle once and return the single task which was triggered.
+	cycle := func() *db.Task {
+		assert.NoError(t, s.MainLoop())
+		assert.NoError(t, s.tCache.Update())
+		tasks, err := s.tCache.UnfinishedTasks()
+		assert.NoError(t, err)
+		assert.Equal(t, 1, len(tasks))
+		sort.Strings(tasks[0].Commits)
+		return tasks[0]
+	}
+	sorted := func(commits []string) []string {
+		rv := make([]string, len(commits))
+		copy(rv, commits)
+		sort.Strings(rv)
+		return rv
+	}
+
+	// Run the task at the first commit and have it succeed.
+	t0 := cycle()
+	head := t0.Revision
+	finish(t0, db.TASK_STATUS_SUCCESS)
+
+	// Add some commits. The next task covers all of them and fails.
+	exec_testutils.Run(t, repoDir, "git", "checkout", "master")
+	makeDummyCommits(t, repoDir, 8, "master")
+	assert.NoError(t, s.repos[repoName].Repo().Update())
+	commits, err := s.repos[repoName].Repo().RevList(fmt.Sprintf("%s..HEAD", head))
+	assert.NoError(t, err)
+	assert.Equal(t, 8, len(commits))
+	t1 := cycle()
+	assert.Equal(t, commits[0], t1.Revision)
+	assert.Equal(t, "", t1.ForcedJobId)
+	testutils.AssertDeepEqual(t, sorted(commits), t1.Commits)
+	finish(t1, db.TASK_STATUS_FAILURE)
+
+	// The failure is new, so we bisect. The bisection task takes the older
+	// half of the blamelist.
+	b1 := cycle()
+	assert.Equal(t, commits[4], b1.Revision)
+	assert.NotEqual(t, "", b1.ForcedJobId)
+	testutils.AssertDeepEqual(t, sorted(commits[4:]), b1.Commits)
+	j, err := s.jCache.GetJob(b1.ForcedJobId)
+	assert.NoError(t, err)
+	assert.Equal(t, taskName, j.Name)
+	assert.True(t, j.IsForce)
+	finish(b1, db.TASK_STATUS_SUCCESS)
+
+	// The first half passed, so we continue to bisect the original task.
+	b2 := cycle()
+	assert.Equal(t, commits[2], b2.Revision)
+	testutils.AssertDeepEqual(t, sorted(commits[2:4]), b2.Commits)
+	finish(b2, db.TASK_STATUS_FAILURE)
+
+	// b2 failed, so the original task's failure is no longer new, and we
+	// bisect b2 instead.
+	b3 := cycle()
+	assert.Equal(t, commits[3], b3.Revision)
+	testutils.AssertDeepEqual(t, []string{commits[3]}, b3.Commits)
+	finish(b3, db.TASK_STATUS_SUCCESS)
+
+	// b2 now has a single commit in its blamelist, which is the culprit.
+	assertCulprit := func() {
+		comments, err := d.GetCommentsForRepos([]string{repoName}, time.Time{})
+		assert.NoError(t, err)
+		assert.Equal(t, 1, len(comments))
+		found := 0
+		for _, byName := range comments[0].TaskComments {
+			for _, cs := range byName {
+				for _, c := range cs {
+					assert.Equal(t, BISECT_COMMENT_USER, c.User)
+					assert.Equal(t, b2.Id, c.TaskId)
+					assert.Equal(t, commits[2], c.Revision)
+					assert.Equal(t, taskName, c.Name)
+					found++
+				}
+			}
+		}
+		assert.Equal(t, 1, found)
+	}
+	assert.NoError(t, s.MainLoop())
+	assert.NoError(t, s.tCache.Update())
+	assertCulprit()
+	assert.True(t, s.culprits[b2.Id])
+
+	// We don't add the comment twice, and we don't look for it again.
+	assert.NoError(t, s.MainLoop())
+	assertCulprit()
+	assert.True(t, s.culprits[b2.Id])
+
+	// After a restart, the existing comment is found in the DB.
+	s.culprits = util.StringSet{}
+	assert.NoError(t, s.MainLoop())
+	assertCulprit()
+	assert.True(t, s.culprits[b2.Id])
+}
+
+func TestBisectInProgress(t *testing.T) {
+	testutils.SmallTest(t)
+	task := makeTask("task", repoName, c2)
+	task.Commits = []string{c1, c2}
+	job := &db.Job{
+		Dependencies: map[string][]string{"task": {}},
+		IsForce:      true,
+		RepoState:    rs1,
+	}
+	assert.True(t, bisectInProgress([]*db.Job{job}, task))
+
+	// Jobs which aren't forced don't count.
+	job.IsForce = false
+	assert.False(t, bisectInProgress([]*db.Job{job}, task))
+
+	// Jobs which don't run the TaskSpec don't count.
+	job.IsForce = true
+	job.Dependencies = map[string][]string{"other": {}}
+	assert.False(t, bisectInProgress([]*db.Job{job}, task))
+
+	// Jobs outside of the blamelist don't count.
+	job.Dependencies = map[string][]string{"task": {}}
+	task.Commits = []string{c2}
+	assert.False(t, bisectInProgress([]*db.Job{job}, task))
+}
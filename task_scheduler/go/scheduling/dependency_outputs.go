@@ -0,0 +1,98 @@
+package scheduling
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/skia-dev/glog"
+	"go.skia.org/infra/go/isolate"
+	"go.skia.org/infra/go/util"
+	"go.skia.org/infra/task_scheduler/go/db"
+)
+
+const (
+	// MAX_DEPENDENCY_OUTPUT_CACHE_SIZE is the maximum number of decoded
+	// output files kept by a dependencyOutputCache.
+	MAX_DEPENDENCY_OUTPUT_CACHE_SIZE = 1000
+)
+
+// dependencyOutputCache checks conditional dependencies on the isolated output
+// of parent tasks. Outputs are immutable once a task has finished, so decoded
+// output files are cached by isolated hash.
+type dependencyOutputCache struct {
+	// download downloads the given isolated hash into the given directory.
+	download func(string, string) error
+	tCache   db.TaskCache
+	workdir  string
+
+	// values maps isolated hash and file path to the decoded contents of
+	// the file, or nil if the file does not exist or is not a JSON object.
+	values map[string]map[string]interface{}
+	mtx    sync.Mutex
+}
+
+// newDependencyOutputCache returns a dependencyOutputCache instance.
+func newDependencyOutputCache(isolateClient *isolate.Client, tCache db.TaskCache, workdir string) *dependencyOutputCache {
+	return &dependencyOutputCache{
+		download: isolateClient.DownloadIsolated,
+		tCache:   tCache,
+		workdir:  workdir,
+		values:   map[string]map[string]interface{}{},
+	}
+}
+
+// check implements db.DependencyOutputChecker.
+func (c *dependencyOutputCache) check(dep *db.TaskDependency, parentId string) (bool, error) {
+	t, err := c.tCache.GetTask(parentId)
+	if err != nil {
+		return false, err
+	}
+	if t.IsolatedOutput == "" {
+		return false, nil
+	}
+	values, err := c.getValues(t.IsolatedOutput, dep.OutputFile)
+	if err != nil {
+		return false, err
+	}
+	return dep.OutputMet(values), nil
+}
+
+// getValues returns the decoded contents of the given file in the given
+// isolated output, downloading it if necessary.
+func (c *dependencyOutputCache) getValues(hash, file string) (map[string]interface{}, error) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	key := fmt.Sprintf("%s/%s", hash, file)
+	if values, ok := c.values[key]; ok {
+		return values, nil
+	}
+
+	tmp, err := ioutil.TempDir(c.workdir, "dependency_output")
+	if err != nil {
+		return nil, err
+	}
+	defer util.RemoveAll(tmp)
+	if err := c.download(hash, tmp); err != nil {
+		return nil, err
+	}
+	var values map[string]interface{}
+	b, err := ioutil.ReadFile(filepath.Join(tmp, filepath.FromSlash(file)))
+	if os.IsNotExist(err) {
+		glog.Warningf("Isolated output %s does not contain %s.", hash, file)
+	} else if err != nil {
+		return nil, err
+	} else if err := json.Unmarshal(b, &values); err != nil {
+		glog.Warningf("Failed to decode %s from isolated output %s: %s", file, hash, err)
+		values = nil
+	}
+
+	if len(c.values) >= MAX_DEPENDENCY_OUTPUT_CACHE_SIZE {
+		c.values = map[string]map[string]interface{}{}
+	}
+	c.values[key] = values
+	return values, nil
+}
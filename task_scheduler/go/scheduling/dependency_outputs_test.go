@@ -0,0 +1,76 @@
+package scheduling
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	assert "github.com/stretchr/testify/require"
+	"go.skia.org/infra/go/testutils"
+	"go.skia.org/infra/go/util"
+	"go.skia.org/infra/task_scheduler/go/db"
+)
+
+func TestDependencyOutputCache(t *testing.T) {
+	testutils.SmallTest(t)
+	workdir, err := ioutil.TempDir("", "dependency_outputs")
+	assert.NoError(t, err)
+	defer util.RemoveAll(workdir)
+
+	d := db.NewInMemoryDB()
+	tCache, err := db.NewTaskCache(d, time.Hour)
+	assert.NoError(t, err)
+	noOutput := makeTask("test", "repo", "abc123")
+	withOutput := makeTask("test", "repo", "abc123")
+	withOutput.IsolatedOutput = "good-output"
+	badOutput := makeTask("test", "repo", "abc123")
+	badOutput.IsolatedOutput = "bad-output"
+	assert.NoError(t, d.PutTasks([]*db.Task{noOutput, withOutput, badOutput}))
+	assert.NoError(t, tCache.Update())
+
+	downloads := 0
+	c := &dependencyOutputCache{
+		download: func(hash, dir string) error {
+			downloads++
+			assert.NoError(t, os.MkdirAll(path.Join(dir, "out"), os.ModePerm))
+			contents := `{"needs_triage": true, "count": 2}`
+			if hash == "bad-output" {
+				contents = "not JSON"
+			}
+			return ioutil.WriteFile(path.Join(dir, "out", "results.json"), []byte(contents), os.ModePerm)
+		},
+		tCache:  tCache,
+		workdir: workdir,
+		values:  map[string]map[string]interface{}{},
+	}
+	dep := &db.TaskDependency{Task: "test", On: db.DEPENDENCY_ON_OUTPUT, OutputFile: "out/results.json", OutputKey: "needs_triage"}
+	check := func(dep *db.TaskDependency, id string, expect bool) {
+		met, err := c.check(dep, id)
+		assert.NoError(t, err)
+		assert.Equal(t, expect, met)
+	}
+
+	check(dep, withOutput.Id, true)
+	assert.Equal(t, 1, downloads)
+	check(&db.TaskDependency{Task: "test", On: db.DEPENDENCY_ON_OUTPUT, OutputFile: "out/results.json", OutputKey: "count", OutputValue: "3"}, withOutput.Id, false)
+	assert.Equal(t, 1, downloads)
+
+	// Missing files and invalid JSON don't satisfy the dependency.
+	check(&db.TaskDependency{Task: "test", On: db.DEPENDENCY_ON_OUTPUT, OutputFile: "missing.json", OutputKey: "needs_triage"}, withOutput.Id, false)
+	assert.Equal(t, 2, downloads)
+	check(dep, badOutput.Id, false)
+	assert.Equal(t, 3, downloads)
+	check(dep, noOutput.Id, false)
+	assert.Equal(t, 3, downloads)
+
+	// Download failures are returned.
+	c.values = map[string]map[string]interface{}{}
+	c.download = func(string, string) error {
+		return fmt.Errorf("No such isolated")
+	}
+	_, err = c.check(dep, withOutput.Id)
+	assert.EqualError(t, err, "No such isolated")
+}
@@ -270,7 +270,9 @@ func main() {
 	assertNoError(err)
 	isolateClient.ServerUrl = isolate.FAKE_SERVER_URL
 	swarmingClient := swarming.NewTestClient()
-	s, err := scheduling.NewTaskScheduler(d, time.Duration(math.MaxInt64), workdir, repograph.Map{repoName: repo}, isolateClient, swarmingClient, http.DefaultClient, 0.9, tryjobs.API_URL_TESTING, tryjobs.BUCKET_TESTING, map[string]string{"skia": repoName})
+	scorer, err := scheduling.NewScorer(scheduling.SCORER_DEFAULT, nil, 1.0)
+	assertNoError(err)
+	s, err := scheduling.NewTaskScheduler(d, time.Duration(math.MaxInt64), workdir, repograph.Map{repoName: repo}, isolateClient, swarmingClient, http.DefaultClient, 0.9, scorer, tryjobs.API_URL_TESTING, tryjobs.BUCKET_TESTING, map[string]string{"skia": repoName})
 	assertNoError(err)
 
 	runTasks := func(bots []*swarming_api.SwarmingRpcsBotInfo) {
@@ -0,0 +1,241 @@
+package scheduling
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// SCORER_DEFAULT scores task candidates by the increase in testedness
+	// provided by running them, scaled by time decay.
+	SCORER_DEFAULT = "default"
+
+	// SCORER_REPO_WEIGHTS scales the testedness-based default score by a
+	// per-repo weight.
+	SCORER_REPO_WEIGHTS = "repo_weights"
+
+	// SCORER_JOB_PRIORITY scales the testedness-based default score by the
+	// highest priority of any Job which requires the task candidate.
+	SCORER_JOB_PRIORITY = "job_priority"
+
+	// SCORER_FAIR_SHARE uses the default score but limits the share of
+	// free bots which may be given to any one TaskSpec.
+	SCORER_FAIR_SHARE = "fair_share"
+
+	// Names of score components.
+	SCORE_COMPONENT_FORCE_RUN           = "force_run"
+	SCORE_COMPONENT_HOURS_WAITING       = "hours_waiting"
+	SCORE_COMPONENT_JOB_PRIORITY        = "job_priority"
+	SCORE_COMPONENT_REPO_WEIGHT         = "repo_weight"
+	SCORE_COMPONENT_RETRY               = "retry"
+	SCORE_COMPONENT_TESTEDNESS_INCREASE = "testedness_increase"
+	SCORE_COMPONENT_TIME_DECAY          = "time_decay"
+	SCORE_COMPONENT_TRY_JOB             = "try_job"
+)
+
+var (
+	// SCORERS lists the names of all valid Scorers.
+	SCORERS = []string{SCORER_DEFAULT, SCORER_REPO_WEIGHTS, SCORER_JOB_PRIORITY, SCORER_FAIR_SHARE}
+)
+
+// ScoreComponent is one of the factors which contributed to the score of a
+// taskCandidate. It is used to explain why a candidate is or isn't running.
+type ScoreComponent struct {
+	Name  string  `json:"name"`
+	Value float64 `json:"value"`
+}
+
+// scoreInputs contains information about a taskCandidate which has already
+// been computed by the TaskScheduler and which Scorers may use.
+type scoreInputs struct {
+	// Now is the current time.
+	Now time.Time
+
+	// TestednessIncrease is the increase in testedness provided by running
+	// the candidate. Not set for try jobs.
+	TestednessIncrease float64
+
+	// TimeDecay is the time decay factor for the candidate's commit. Not
+	// set for try jobs.
+	TimeDecay float64
+}
+
+// Scorer is used for prioritizing task candidates.
+type Scorer interface {
+	// Name returns the name of the scoring strategy.
+	Name() string
+
+	// Score returns the score for the given taskCandidate, along with the
+	// components which were used to compute the score. The candidate's
+	// blamelist has already been computed.
+	Score(*taskCandidate, *scoreInputs) (float64, []ScoreComponent)
+
+	// MaxBotShare returns the maximum fraction of the free bots which may
+	// be assigned to candidates for any one TaskSpec in a single
+	// scheduling round. A value of 1.0 imposes no limit.
+	MaxBotShare() float64
+}
+
+// NewScorer returns a Scorer with the given name. repoWeights is only used by
+// SCORER_REPO_WEIGHTS and maxBotShare is only used by SCORER_FAIR_SHARE.
+func NewScorer(name string, repoWeights map[string]float64, maxBotShare float64) (Scorer, error) {
+	switch name {
+	case SCORER_DEFAULT:
+		return &defaultScorer{}, nil
+	case SCORER_REPO_WEIGHTS:
+		for repo, w := range repoWeights {
+			if w < 0.0 {
+				return nil, fmt.Errorf("Weight for repo %s must be non-negative; got %f", repo, w)
+			}
+		}
+		return &repoWeightsScorer{weights: repoWeights}, nil
+	case SCORER_JOB_PRIORITY:
+		return &jobPriorityScorer{}, nil
+	case SCORER_FAIR_SHARE:
+		if maxBotShare <= 0.0 || maxBotShare > 1.0 {
+			return nil, fmt.Errorf("Max bot share must be in (0, 1]; got %f", maxBotShare)
+		}
+		return &fairShareScorer{maxBotShare: maxBotShare}, nil
+	default:
+		return nil, fmt.Errorf("Unknown scorer %q; must be one of %v", name, SCORERS)
+	}
+}
+
+// ParseRepoWeights parses a comma-separated list of repo=weight pairs.
+func ParseRepoWeights(s string) (map[string]float64, error) {
+	rv := map[string]float64{}
+	if s == "" {
+		return rv, nil
+	}
+	for _, pair := range strings.Split(s, ",") {
+		idx := strings.LastIndex(pair, "=")
+		if idx < 1 {
+			return nil, fmt.Errorf("Invalid repo weight %q; expected repo=weight", pair)
+		}
+		w, err := strconv.ParseFloat(pair[idx+1:], 64)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid repo weight %q: %s", pair, err)
+		}
+		rv[pair[:idx]] = w
+	}
+	return rv, nil
+}
+
+// defaultScorer is a Scorer which gives high, fixed priority to try jobs,
+// forced jobs, and retries, and otherwise scores candidates according to the
+// increase in testedness they provide, scaled by time decay.
+type defaultScorer struct{}
+
+// See documentation for Scorer interface.
+func (s *defaultScorer) Name() string {
+	return SCORER_DEFAULT
+}
+
+// See documentation for Scorer interface.
+func (s *defaultScorer) Score(c *taskCandidate, in *scoreInputs) (float64, []ScoreComponent) {
+	return s.scaledScore(c, in, nil)
+}
+
+// scaledScore computes the default score for the given taskCandidate. If the
+// score is based on the increase in testedness, it is multiplied by the value
+// of the given ScoreComponent, if any, which is then included in the returned
+// components. The fixed scores given to try jobs, forced jobs, and retries are
+// never scaled, so that they keep their precedence over other candidates.
+func (s *defaultScorer) scaledScore(c *taskCandidate, in *scoreInputs, scale *ScoreComponent) (float64, []ScoreComponent) {
+	hours := ScoreComponent{SCORE_COMPONENT_HOURS_WAITING, in.Now.Sub(c.JobCreated).Hours()}
+	if c.IsTryJob() {
+		score := CANDIDATE_SCORE_TRY_JOB + hours.Value
+		components := []ScoreComponent{{SCORE_COMPONENT_TRY_JOB, CANDIDATE_SCORE_TRY_JOB}, hours}
+		if c.RetryOf != "" {
+			score = math.Min(score+CANDIDATE_SCORE_RETRY, MAX_CANDIDATE_SCORE_RETRY)
+			components = append(components, ScoreComponent{SCORE_COMPONENT_RETRY, CANDIDATE_SCORE_RETRY})
+		}
+		return score, components
+	}
+	if c.IsForceRun() {
+		return CANDIDATE_SCORE_FORCE_RUN + hours.Value, []ScoreComponent{{SCORE_COMPONENT_FORCE_RUN, CANDIDATE_SCORE_FORCE_RUN}, hours}
+	}
+	// Retries take precedence over new candidates.
+	if c.RetryOf != "" {
+		return math.Min(CANDIDATE_SCORE_RETRY+hours.Value, MAX_CANDIDATE_SCORE_RETRY), []ScoreComponent{{SCORE_COMPONENT_RETRY, CANDIDATE_SCORE_RETRY}, hours}
+	}
+	// The score for a candidate is based on the "testedness" increase
+	// provided by running the task, scaled by time decay.
+	score := in.TestednessIncrease * in.TimeDecay
+	components := []ScoreComponent{
+		{SCORE_COMPONENT_TESTEDNESS_INCREASE, in.TestednessIncrease},
+		{SCORE_COMPONENT_TIME_DECAY, in.TimeDecay},
+	}
+	if scale != nil {
+		score *= scale.Value
+		components = append(components, *scale)
+	}
+	return score, components
+}
+
+// See documentation for Scorer interface.
+func (s *defaultScorer) MaxBotShare() float64 {
+	return 1.0
+}
+
+// repoWeightsScorer is a Scorer which scales the testedness-based default score
+// by a per-repo weight. Repos without a weight have a weight of 1.0.
+type repoWeightsScorer struct {
+	defaultScorer
+	weights map[string]float64
+}
+
+// See documentation for Scorer interface.
+func (s *repoWeightsScorer) Name() string {
+	return SCORER_REPO_WEIGHTS
+}
+
+// See documentation for Scorer interface.
+func (s *repoWeightsScorer) Score(c *taskCandidate, in *scoreInputs) (float64, []ScoreComponent) {
+	w, ok := s.weights[c.Repo]
+	if !ok {
+		w = 1.0
+	}
+	return s.scaledScore(c, in, &ScoreComponent{SCORE_COMPONENT_REPO_WEIGHT, w})
+}
+
+// jobPriorityScorer is a Scorer which scales the testedness-based default score
+// by the highest priority of any Job which requires the candidate. Jobs which do not specify
+// a priority are treated as having a priority of 1.0.
+type jobPriorityScorer struct {
+	defaultScorer
+}
+
+// See documentation for Scorer interface.
+func (s *jobPriorityScorer) Name() string {
+	return SCORER_JOB_PRIORITY
+}
+
+// See documentation for Scorer interface.
+func (s *jobPriorityScorer) Score(c *taskCandidate, in *scoreInputs) (float64, []ScoreComponent) {
+	p := c.JobPriority
+	if p <= 0.0 {
+		p = 1.0
+	}
+	return s.scaledScore(c, in, &ScoreComponent{SCORE_COMPONENT_JOB_PRIORITY, p})
+}
+
+// fairShareScorer is a Scorer which uses the default score but prevents any
+// one TaskSpec from taking more than a given share of the free bots.
+type fairShareScorer struct {
+	defaultScorer
+	maxBotShare float64
+}
+
+// See documentation for Scorer interface.
+func (s *fairShareScorer) Name() string {
+	return SCORER_FAIR_SHARE
+}
+
+// See documentation for Scorer interface.
+func (s *fairShareScorer) MaxBotShare() float64 {
+	return s.maxBotShare
+}
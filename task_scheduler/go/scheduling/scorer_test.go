@@ -0,0 +1,197 @@
+package scheduling
+
+import (
+	"testing"
+	"time"
+
+	assert "github.com/stretchr/testify/require"
+	"go.skia.org/infra/go/testutils"
+	"go.skia.org/infra/task_scheduler/go/db"
+)
+
+func TestNewScorer(t *testing.T) {
+	testutils.SmallTest(t)
+	for _, name := range SCORERS {
+		s, err := NewScorer(name, map[string]float64{"a.git": 2.0}, 0.5)
+		assert.NoError(t, err)
+		assert.Equal(t, name, s.Name())
+	}
+
+	_, err := NewScorer("bogus", nil, 1.0)
+	assert.EqualError(t, err, "Unknown scorer \"bogus\"; must be one of [default repo_weights job_priority fair_share]")
+	_, err = NewScorer(SCORER_REPO_WEIGHTS, map[string]float64{"a.git": -1.0}, 1.0)
+	assert.Error(t, err)
+	_, err = NewScorer(SCORER_FAIR_SHARE, nil, 0.0)
+	assert.Error(t, err)
+	_, err = NewScorer(SCORER_FAIR_SHARE, nil, 1.5)
+	assert.Error(t, err)
+
+	s, err := NewScorer(SCORER_DEFAULT, nil, 0.5)
+	assert.NoError(t, err)
+	assert.Equal(t, 1.0, s.MaxBotShare())
+	s, err = NewScorer(SCORER_FAIR_SHARE, nil, 0.5)
+	assert.NoError(t, err)
+	assert.Equal(t, 0.5, s.MaxBotShare())
+}
+
+func TestParseRepoWeights(t *testing.T) {
+	testutils.SmallTest(t)
+	w, err := ParseRepoWeights("")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(w))
+
+	w, err = ParseRepoWeights("https://skia.googlesource.com/skia.git=2.5,infra.git=0.5")
+	assert.NoError(t, err)
+	testutils.AssertDeepEqual(t, map[string]float64{
+		"https://skia.googlesource.com/skia.git": 2.5,
+		"infra.git":                              0.5,
+	}, w)
+
+	_, err = ParseRepoWeights("skia.git")
+	assert.Error(t, err)
+	_, err = ParseRepoWeights("skia.git=heavy")
+	assert.Error(t, err)
+}
+
+func TestScorers(t *testing.T) {
+	testutils.SmallTest(t)
+	now := time.Now()
+	in := &scoreInputs{
+		Now:                now,
+		TestednessIncrease: 2.0,
+		TimeDecay:          0.5,
+	}
+	c := &taskCandidate{
+		JobCreated:  now.Add(-2 * time.Hour),
+		JobPriority: 0.5,
+		TaskKey: db.TaskKey{
+			RepoState: db.RepoState{
+				Repo:     "a.git",
+				Revision: "abc123",
+			},
+			Name: "Build",
+		},
+	}
+
+	// Default scorer.
+	s := &defaultScorer{}
+	score, components := s.Score(c, in)
+	assert.Equal(t, 1.0, score)
+	testutils.AssertDeepEqual(t, []ScoreComponent{
+		{SCORE_COMPONENT_TESTEDNESS_INCREASE, 2.0},
+		{SCORE_COMPONENT_TIME_DECAY, 0.5},
+	}, components)
+
+	// Retries.
+	c.RetryOf = "def456"
+	score, components = s.Score(c, in)
+	assert.Equal(t, CANDIDATE_SCORE_RETRY+2.0, score)
+	testutils.AssertDeepEqual(t, []ScoreComponent{
+		{SCORE_COMPONENT_RETRY, CANDIDATE_SCORE_RETRY},
+		{SCORE_COMPONENT_HOURS_WAITING, 2.0},
+	}, components)
+	c.RetryOf = ""
+
+	// Repo weights.
+	rw := &repoWeightsScorer{weights: map[string]float64{"a.git": 3.0}}
+	score, components = rw.Score(c, in)
+	assert.Equal(t, 3.0, score)
+	assert.Equal(t, ScoreComponent{SCORE_COMPONENT_REPO_WEIGHT, 3.0}, components[len(components)-1])
+	c.Repo = "b.git"
+	score, _ = rw.Score(c, in)
+	assert.Equal(t, 1.0, score)
+
+	// Job priority.
+	jp := &jobPriorityScorer{}
+	score, components = jp.Score(c, in)
+	assert.Equal(t, 0.5, score)
+	assert.Equal(t, ScoreComponent{SCORE_COMPONENT_JOB_PRIORITY, 0.5}, components[len(components)-1])
+	c.JobPriority = 0.0
+	score, _ = jp.Score(c, in)
+	assert.Equal(t, 1.0, score)
+
+	// Fair share uses the default score.
+	fs := &fairShareScorer{maxBotShare: 0.1}
+	score, _ = fs.Score(c, in)
+	assert.Equal(t, 1.0, score)
+}
+
+func TestScorersKeepFixedPrecedence(t *testing.T) {
+	testutils.SmallTest(t)
+	now := time.Now()
+	in := &scoreInputs{
+		Now:                now,
+		TestednessIncrease: 2.0,
+		TimeDecay:          1.0,
+	}
+	candidate := func(repo string, priority float64) *taskCandidate {
+		return &taskCandidate{
+			JobCreated:  now,
+			JobPriority: priority,
+			TaskKey: db.TaskKey{
+				RepoState: db.RepoState{
+					Repo:     repo,
+					Revision: "abc123",
+				},
+				Name: "Build",
+			},
+		}
+	}
+
+	// Forced tasks outrank retries, which outrank new candidates,
+	// regardless of weights or priorities.
+	check := func(s Scorer, low, high *taskCandidate) {
+		low.ForcedJobId = "forced"
+		forced, _ := s.Score(low, in)
+		low.ForcedJobId = ""
+		high.RetryOf = "def456"
+		retry, _ := s.Score(high, in)
+		high.RetryOf = ""
+		plain, _ := s.Score(high, in)
+		assert.True(t, forced > retry, "%s: %f <= %f", s.Name(), forced, retry)
+		assert.True(t, retry > plain, "%s: %f <= %f", s.Name(), retry, plain)
+	}
+	rw := &repoWeightsScorer{weights: map[string]float64{"a.git": 0.01, "b.git": 10.0}}
+	check(rw, candidate("a.git", 1.0), candidate("b.git", 1.0))
+	jp := &jobPriorityScorer{}
+	check(jp, candidate("a.git", 0.01), candidate("a.git", 10.0))
+}
+
+func TestRetryScoreBelowForceRun(t *testing.T) {
+	testutils.SmallTest(t)
+	now := time.Now()
+	in := &scoreInputs{Now: now}
+	s := &defaultScorer{}
+
+	forced := &taskCandidate{
+		ForcedJobId: "forced",
+		JobCreated:  now,
+	}
+	forcedScore, _ := s.Score(forced, in)
+
+	// Retries which have been waiting for a long time still don't outrank
+	// a forced task which was just created.
+	retry := &taskCandidate{
+		JobCreated: now.Add(-1000 * time.Hour),
+		RetryOf:    "def456",
+	}
+	score, _ := s.Score(retry, in)
+	assert.Equal(t, MAX_CANDIDATE_SCORE_RETRY, score)
+	assert.True(t, forcedScore > score)
+
+	retry.Server = "https://codereview.chromium.org"
+	retry.Issue = "10001"
+	retry.Patchset = "1"
+	assert.True(t, retry.IsTryJob())
+	score, _ = s.Score(retry, in)
+	assert.Equal(t, MAX_CANDIDATE_SCORE_RETRY, score)
+	assert.True(t, forcedScore > score)
+
+	// Retries which haven't waited long are not affected.
+	retry = &taskCandidate{
+		JobCreated: now.Add(-2 * time.Hour),
+		RetryOf:    "def456",
+	}
+	score, _ = s.Score(retry, in)
+	assert.Equal(t, CANDIDATE_SCORE_RETRY+2.0, score)
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"go.skia.org/infra/task_scheduler/go/specs"
+)
+
+// History is a recorded window of commits, bot availability, and task
+// durations which is replayed through the TaskScheduler.
+type History struct {
+	// Start and End delimit the recorded window.
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+
+	// TasksCfg is the tasks.json used at every commit in the window.
+	TasksCfg *specs.TasksCfg `json:"tasks_cfg"`
+
+	// Commits which landed during the window, in chronological order. The
+	// first commit adds TasksCfg to the repo.
+	Commits []*HistoryCommit `json:"commits"`
+
+	// Bots which were connected to Swarming during the window.
+	Bots []*HistoryBot `json:"bots"`
+
+	// TaskDurationsSecs maps TaskSpec names to the recorded durations of
+	// their tasks, in seconds. Simulated tasks take these durations in
+	// turn, wrapping around when the list is exhausted.
+	TaskDurationsSecs map[string][]float64 `json:"task_durations_secs"`
+}
+
+// HistoryCommit is a commit which landed during the recorded window.
+type HistoryCommit struct {
+	Timestamp time.Time `json:"timestamp"`
+	Author    string    `json:"author,omitempty"`
+	Message   string    `json:"message,omitempty"`
+}
+
+// HistoryBot is a Swarming bot which was connected during the recorded window.
+type HistoryBot struct {
+	Id         string            `json:"id"`
+	Dimensions map[string]string `json:"dimensions"`
+
+	// Available lists the periods during which the bot was available. If
+	// empty, the bot is available for the whole window.
+	Available []*Window `json:"available,omitempty"`
+}
+
+// Window is a period of time.
+type Window struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+// ReadHistory reads a History from the given JSON file.
+func ReadHistory(file string) (*History, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+	var h History
+	if err := json.NewDecoder(f).Decode(&h); err != nil {
+		return nil, fmt.Errorf("Failed to decode history from %s: %s", file, err)
+	}
+	if err := h.Validate(); err != nil {
+		return nil, fmt.Errorf("Invalid history in %s: %s", file, err)
+	}
+	return &h, nil
+}
+
+// Validate returns an error if the History is not valid.
+func (h *History) Validate() error {
+	if !h.Start.Before(h.End) {
+		return fmt.Errorf("Start (%s) must be before end (%s).", h.Start, h.End)
+	}
+	if h.TasksCfg == nil {
+		return fmt.Errorf("tasks_cfg is required.")
+	}
+	if err := h.TasksCfg.Validate(); err != nil {
+		return err
+	}
+	if len(h.Commits) == 0 {
+		return fmt.Errorf("At least one commit is required.")
+	}
+	prev := h.Start
+	for i, c := range h.Commits {
+		if c.Timestamp.Before(prev) {
+			return fmt.Errorf("Commit %d at %s is out of order or before the start of the window.", i, c.Timestamp)
+		}
+		if c.Timestamp.After(h.End) {
+			return fmt.Errorf("Commit %d at %s is after the end of the window.", i, c.Timestamp)
+		}
+		prev = c.Timestamp
+	}
+	if len(h.Bots) == 0 {
+		return fmt.Errorf("At least one bot is required.")
+	}
+	ids := map[string]bool{}
+	for _, b := range h.Bots {
+		if b.Id == "" {
+			return fmt.Errorf("Bots must have an ID.")
+		}
+		if ids[b.Id] {
+			return fmt.Errorf("Duplicate bot ID %q.", b.Id)
+		}
+		ids[b.Id] = true
+		for _, w := range b.Available {
+			if !w.Start.Before(w.End) {
+				return fmt.Errorf("Invalid availability window for bot %s: %s - %s", b.Id, w.Start, w.End)
+			}
+		}
+	}
+	for name, durations := range h.TaskDurationsSecs {
+		if _, ok := h.TasksCfg.Tasks[name]; !ok {
+			return fmt.Errorf("Durations given for unknown task %q.", name)
+		}
+		for _, d := range durations {
+			if d < 0 {
+				return fmt.Errorf("Durations for task %q must be non-negative.", name)
+			}
+		}
+	}
+	return nil
+}
+
+// Shift moves all timestamps in the History by the given amount.
+func (h *History) Shift(d time.Duration) {
+	h.Start = h.Start.Add(d)
+	h.End = h.End.Add(d)
+	for _, c := range h.Commits {
+		c.Timestamp = c.Timestamp.Add(d)
+	}
+	for _, b := range h.Bots {
+		for _, w := range b.Available {
+			w.Start = w.Start.Add(d)
+			w.End = w.End.Add(d)
+		}
+	}
+}
+
+// AvailableAt returns true iff the bot was available at the given time.
+func (b *HistoryBot) AvailableAt(ts time.Time) bool {
+	if len(b.Available) == 0 {
+		return true
+	}
+	for _, w := range b.Available {
+		if !ts.Before(w.Start) && ts.Before(w.End) {
+			return true
+		}
+	}
+	return false
+}
+
+// AvailableWindows returns the periods during which the bot was available,
+// clipped to the given window.
+func (b *HistoryBot) AvailableWindows(start, end time.Time) []*Window {
+	if len(b.Available) == 0 {
+		return []*Window{{start, end}}
+	}
+	rv := make([]*Window, 0, len(b.Available))
+	for _, w := range b.Available {
+		if o := overlap(w, &Window{start, end}); o != nil {
+			rv = append(rv, o)
+		}
+	}
+	return rv
+}
+
+// overlap returns the intersection of the two Windows, or nil if they do not
+// intersect.
+func overlap(a, b *Window) *Window {
+	start := a.Start
+	if b.Start.After(start) {
+		start = b.Start
+	}
+	end := a.End
+	if b.End.Before(end) {
+		end = b.End
+	}
+	if !start.Before(end) {
+		return nil
+	}
+	return &Window{start, end}
+}
+
+// taskDurations hands out the recorded durations for each TaskSpec in turn.
+type taskDurations struct {
+	durations map[string][]float64
+	next      map[string]int
+	def       time.Duration
+}
+
+// newTaskDurations returns a taskDurations instance which uses the given
+// durations, falling back to def for TaskSpecs with no recorded durations.
+func newTaskDurations(durations map[string][]float64, def time.Duration) *taskDurations {
+	return &taskDurations{
+		durations: durations,
+		next:      map[string]int{},
+		def:       def,
+	}
+}
+
+// Next returns the duration of the next task for the given TaskSpec.
+func (d *taskDurations) Next(name string) time.Duration {
+	durations := d.durations[name]
+	if len(durations) == 0 {
+		return d.def
+	}
+	idx := d.next[name]
+	d.next[name] = (idx + 1) % len(durations)
+	return time.Duration(durations[idx] * float64(time.Second))
+}
@@ -0,0 +1,428 @@
+package main
+
+/*
+	Simulator for TaskScheduler.
+
+	Replays a recorded window of commits, bot availability, and task
+	durations through TaskScheduler.MainLoop, using an in-memory DB and a
+	fake Swarming client, and reports queue latency, bot utilization, and
+	time from commit to first test. This allows changes to the scheduling
+	algorithm to be evaluated against real-world load.
+
+	The recorded window is shifted so that it ends at the time the simulator
+	starts. Simulated time advances by --tick between iterations of
+	MainLoop, but the TaskScheduler itself still uses wall-clock time, so
+	time decay is computed relative to the end of the window.
+*/
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	swarming_api "github.com/luci/luci-go/common/api/swarming/swarming/v1"
+	"github.com/skia-dev/glog"
+	"go.skia.org/infra/go/common"
+	"go.skia.org/infra/go/exec"
+	"go.skia.org/infra/go/git/repograph"
+	"go.skia.org/infra/go/isolate"
+	"go.skia.org/infra/go/swarming"
+	"go.skia.org/infra/task_scheduler/go/db"
+	"go.skia.org/infra/task_scheduler/go/scheduling"
+	"go.skia.org/infra/task_scheduler/go/specs"
+	"go.skia.org/infra/task_scheduler/go/tryjobs"
+)
+
+const (
+	// Name of the simulated repo.
+	REPO_NAME = "skia.git"
+
+	// Isolated output hash given to all simulated tasks.
+	FAKE_ISOLATED_OUTPUT = "abc123"
+)
+
+var (
+	// Flags.
+	historyFile         = flag.String("history", "", "JSON file containing the recorded history to replay. Required.")
+	tick                = flag.Duration("tick", time.Minute, "Amount of simulated time between iterations of the scheduling loop.")
+	defaultTaskDuration = flag.Duration("default_task_duration", 10*time.Minute, "Duration of tasks whose TaskSpec has no recorded durations.")
+	testTaskRegex       = flag.String("test_task_regex", "^Test-", "Regular expression matching the names of test tasks, used to compute the time from commit to first test.")
+	output              = flag.String("output", "", "If set, write the report as JSON to this file.")
+	scoreDecay24Hr      = flag.Float64("scoreDecay24Hr", 0.9, "Task candidate scores are penalized using linear time decay. This is the desired value after 24 hours. Setting it to 1.0 causes commits not to be prioritized according to commit time.")
+	scorer              = flag.String("scorer", scheduling.SCORER_DEFAULT, fmt.Sprintf("Strategy used to score task candidates. One of %v.", scheduling.SCORERS))
+	repoWeights         = flag.String("repo_weights", "", "Comma-separated list of repo=weight pairs used by the \"repo_weights\" scorer. Repos which are not listed have a weight of 1.0.")
+	maxBotShare         = flag.Float64("max_bot_share", 0.25, "Maximum fraction of the free bots which any one TaskSpec may take in a scheduling round, used by the \"fair_share\" scorer.")
+)
+
+// runningTask is a simulated Swarming task which is occupying a bot.
+type runningTask struct {
+	bot    string
+	finish time.Time
+	record *taskRecord
+}
+
+// simulator drives a fake Swarming using the recorded History.
+type simulator struct {
+	history   *History
+	swarming  *swarming.TestClient
+	durations *taskDurations
+
+	// records contains all tasks run by the simulator, keyed by db.Task ID.
+	records map[string]*taskRecord
+
+	// running contains the tasks which are currently running, keyed by
+	// Swarming task ID.
+	running map[string]*runningTask
+
+	// busy maps bot IDs to the Swarming task ID each bot is running.
+	busy map[string]string
+}
+
+// newSimulator returns a simulator instance.
+func newSimulator(h *History, swarmingClient *swarming.TestClient) *simulator {
+	return &simulator{
+		history:   h,
+		swarming:  swarmingClient,
+		durations: newTaskDurations(h.TaskDurationsSecs, *defaultTaskDuration),
+		records:   map[string]*taskRecord{},
+		running:   map[string]*runningTask{},
+		busy:      map[string]string{},
+	}
+}
+
+// formatTs formats the given time as a Swarming timestamp.
+func formatTs(ts time.Time) string {
+	return ts.UTC().Format(swarming.TIMESTAMP_FORMAT)
+}
+
+// finishTasks marks all running tasks which finish at or before now as
+// completed, freeing their bots.
+func (s *simulator) finishTasks(now time.Time) {
+	s.swarming.DoMockTasks(func(t *swarming_api.SwarmingRpcsTaskRequestMetadata) {
+		r, ok := s.running[t.TaskId]
+		if !ok || r.finish.After(now) {
+			return
+		}
+		t.TaskResult.State = db.SWARMING_STATE_COMPLETED
+		t.TaskResult.CompletedTs = formatTs(r.finish)
+		t.TaskResult.OutputsRef = &swarming_api.SwarmingRpcsFilesRef{
+			Isolated: FAKE_ISOLATED_OUTPUT,
+		}
+		r.record.Finished = r.finish
+		delete(s.running, t.TaskId)
+		delete(s.busy, r.bot)
+	})
+}
+
+// startTasks starts all pending tasks on the bots they were assigned to.
+func (s *simulator) startTasks(now time.Time) error {
+	var err error
+	s.swarming.DoMockTasks(func(t *swarming_api.SwarmingRpcsTaskRequestMetadata) {
+		if err != nil || t.TaskResult.State != db.SWARMING_STATE_PENDING {
+			return
+		}
+		bot := ""
+		for _, d := range t.Request.Properties.Dimensions {
+			if d.Key == "id" {
+				bot = d.Value
+			}
+		}
+		if bot == "" {
+			err = fmt.Errorf("Task %s was not assigned to a bot.", t.TaskId)
+			return
+		}
+		if other, ok := s.busy[bot]; ok {
+			err = fmt.Errorf("Task %s was assigned to bot %s, which is already running task %s.", t.TaskId, bot, other)
+			return
+		}
+		id, e := swarming.GetTagValue(t.TaskResult, db.SWARMING_TAG_ID)
+		if e != nil {
+			err = e
+			return
+		}
+		name, e := swarming.GetTagValue(t.TaskResult, db.SWARMING_TAG_NAME)
+		if e != nil {
+			err = e
+			return
+		}
+		t.TaskResult.State = db.SWARMING_STATE_RUNNING
+		t.TaskResult.StartedTs = formatTs(now)
+		t.TaskResult.BotId = bot
+		rec := &taskRecord{
+			Id:      id,
+			Bot:     bot,
+			Started: now,
+		}
+		s.records[id] = rec
+		s.running[t.TaskId] = &runningTask{
+			bot:    bot,
+			finish: now.Add(s.durations.Next(name)),
+			record: rec,
+		}
+		s.busy[bot] = t.TaskId
+	})
+	return err
+}
+
+// mockBots sets the bots which are available at the given time.
+func (s *simulator) mockBots(now time.Time) {
+	bots := make([]*swarming_api.SwarmingRpcsBotInfo, 0, len(s.history.Bots))
+	for _, b := range s.history.Bots {
+		taskId, busy := s.busy[b.Id]
+		if !busy && !b.AvailableAt(now) {
+			continue
+		}
+		dims := make([]*swarming_api.SwarmingRpcsStringListPair, 0, len(b.Dimensions)+2)
+		dims = append(dims, &swarming_api.SwarmingRpcsStringListPair{
+			Key:   "id",
+			Value: []string{b.Id},
+		})
+		if _, ok := b.Dimensions[swarming.DIMENSION_POOL_KEY]; !ok {
+			dims = append(dims, &swarming_api.SwarmingRpcsStringListPair{
+				Key:   swarming.DIMENSION_POOL_KEY,
+				Value: []string{swarming.DIMENSION_POOL_VALUE_SKIA},
+			})
+		}
+		for k, v := range b.Dimensions {
+			dims = append(dims, &swarming_api.SwarmingRpcsStringListPair{
+				Key:   k,
+				Value: []string{v},
+			})
+		}
+		bots = append(bots, &swarming_api.SwarmingRpcsBotInfo{
+			BotId:      b.Id,
+			Dimensions: dims,
+			TaskId:     taskId,
+		})
+	}
+	s.swarming.MockBots(bots)
+}
+
+// report computes the results of the simulation.
+func (s *simulator) report(tasks []*db.Task, landed map[string]time.Time, testRe *regexp.Regexp) *Report {
+	latencies := queueLatencies(tasks, s.records, landed)
+	firstTest, untested := commitToFirstTest(tasks, s.records, landed, testRe)
+	util, utilByDims := botUtilization(s.history.Bots, s.records, s.history.Start, s.history.End)
+	return &Report{
+		TasksTriggered:       len(s.records),
+		QueueLatency:         makeDurationStats(latencies),
+		CommitToFirstTest:    makeDurationStats(firstTest),
+		UntestedCommits:      untested,
+		BotUtilization:       util,
+		BotUtilizationByDims: utilByDims,
+	}
+}
+
+func run(dir string, cmd ...string) {
+	if _, err := exec.RunCwd(dir, cmd...); err != nil {
+		glog.Fatal(err)
+	}
+}
+
+func writeFile(repoDir, subPath, contents string) {
+	if err := ioutil.WriteFile(path.Join(repoDir, subPath), []byte(contents), os.ModePerm); err != nil {
+		glog.Fatal(err)
+	}
+	run(repoDir, "git", "add", subPath)
+}
+
+// setupRepo adds the tasks cfg and the isolate files it refers to to the repo.
+func setupRepo(workdir, repoDir string, cfg *specs.TasksCfg) {
+	if err := ioutil.WriteFile(path.Join(workdir, ".gclient"), []byte("dummy"), os.ModePerm); err != nil {
+		glog.Fatal(err)
+	}
+	infraBotsSubDir := path.Join("infra", "bots")
+	if err := os.MkdirAll(path.Join(repoDir, infraBotsSubDir), os.ModePerm); err != nil {
+		glog.Fatal(err)
+	}
+	writeFile(repoDir, "somefile.txt", "dummy")
+	writeFile(repoDir, path.Join(infraBotsSubDir, "swarm_recipe.isolate"), `{
+  'variables': {
+    'command': [
+      'python', 'recipes.py', 'run',
+    ],
+    'files': [
+      '../../somefile.txt',
+    ],
+  },
+}`)
+	for _, t := range cfg.Tasks {
+		writeFile(repoDir, path.Join(infraBotsSubDir, t.Isolate), `{
+  'includes': [
+    'swarm_recipe.isolate',
+  ],
+  'variables': {
+    'files': [
+      '../../../.gclient',
+    ],
+  },
+}`)
+	}
+	b, err := json.Marshal(cfg)
+	if err != nil {
+		glog.Fatal(err)
+	}
+	writeFile(repoDir, specs.TASKS_CFG_FILE, string(b))
+}
+
+// commit lands the given commit in the repo and returns its hash.
+func commit(repoDir string, idx int, c *HistoryCommit) string {
+	msg := c.Message
+	if msg == "" {
+		msg = fmt.Sprintf("Commit #%d", idx)
+	}
+	writeFile(repoDir, "dummyfile.txt", fmt.Sprintf("%d", idx))
+	args := []string{"commit", "-m", msg}
+	if c.Author != "" {
+		author := c.Author
+		if !strings.Contains(author, "<") {
+			author = fmt.Sprintf("%s <%s>", author, author)
+		}
+		args = append(args, fmt.Sprintf("--author=%s", author))
+	}
+	ts := fmt.Sprintf("%d +0000", c.Timestamp.Unix())
+	if err := exec.Run(&exec.Command{
+		Name:       "git",
+		Args:       args,
+		Env:        []string{fmt.Sprintf("GIT_AUTHOR_DATE=%s", ts), fmt.Sprintf("GIT_COMMITTER_DATE=%s", ts)},
+		InheritEnv: true,
+		Dir:        repoDir,
+		Quiet:      true,
+	}); err != nil {
+		glog.Fatal(err)
+	}
+	run(repoDir, "git", "push", "origin", "master")
+	if idx == 0 {
+		run(repoDir, "git", "branch", "-u", "origin/master")
+	}
+	hash, err := exec.RunCwd(repoDir, "git", "rev-parse", "HEAD")
+	if err != nil {
+		glog.Fatal(err)
+	}
+	return strings.TrimSpace(hash)
+}
+
+func main() {
+	common.Init()
+	defer common.LogPanic()
+
+	if *historyFile == "" {
+		glog.Fatal("--history is required.")
+	}
+	if *tick <= 0 {
+		glog.Fatal("--tick must be positive.")
+	}
+	testRe, err := regexp.Compile(*testTaskRegex)
+	if err != nil {
+		glog.Fatal(err)
+	}
+	h, err := ReadHistory(*historyFile)
+	if err != nil {
+		glog.Fatal(err)
+	}
+	h.Shift(time.Now().Sub(h.End))
+
+	weights, err := scheduling.ParseRepoWeights(*repoWeights)
+	if err != nil {
+		glog.Fatal(err)
+	}
+	sc, err := scheduling.NewScorer(*scorer, weights, *maxBotShare)
+	if err != nil {
+		glog.Fatal(err)
+	}
+
+	// Create the repo.
+	workdir, err := ioutil.TempDir("", "")
+	if err != nil {
+		glog.Fatal(err)
+	}
+	defer func() {
+		if err := os.RemoveAll(workdir); err != nil {
+			glog.Fatal(err)
+		}
+	}()
+	repoDir := path.Join(workdir, REPO_NAME)
+	if err := os.Mkdir(repoDir, os.ModePerm); err != nil {
+		glog.Fatal(err)
+	}
+	run(repoDir, "git", "init")
+	run(repoDir, "git", "remote", "add", "origin", ".")
+	setupRepo(workdir, repoDir, h.TasksCfg)
+	if err := os.Mkdir(path.Join(workdir, scheduling.TRIGGER_DIRNAME), os.ModePerm); err != nil {
+		glog.Fatal(err)
+	}
+
+	d := db.NewInMemoryDB()
+	isolateClient, err := isolate.NewClient(workdir)
+	if err != nil {
+		glog.Fatal(err)
+	}
+	isolateClient.ServerUrl = isolate.FAKE_SERVER_URL
+	swarmingClient := swarming.NewTestClient()
+	sim := newSimulator(h, swarmingClient)
+
+	// Run the simulation. The TaskScheduler is created once the first
+	// commit has landed.
+	var s *scheduling.TaskScheduler
+	landed := map[string]time.Time{}
+	nextCommit := 0
+	for now := h.Start; !now.After(h.End); now = now.Add(*tick) {
+		for nextCommit < len(h.Commits) && !h.Commits[nextCommit].Timestamp.After(now) {
+			c := h.Commits[nextCommit]
+			landed[commit(repoDir, nextCommit, c)] = c.Timestamp
+			nextCommit++
+		}
+		if nextCommit == 0 {
+			continue
+		}
+		if s == nil {
+			repo, err := repograph.NewGraph(REPO_NAME, workdir)
+			if err != nil {
+				glog.Fatal(err)
+			}
+			s, err = scheduling.NewTaskScheduler(d, time.Duration(math.MaxInt64), workdir, repograph.Map{REPO_NAME: repo}, isolateClient, swarmingClient, http.DefaultClient, *scoreDecay24Hr, sc, tryjobs.API_URL_TESTING, tryjobs.BUCKET_TESTING, map[string]string{"skia": REPO_NAME})
+			if err != nil {
+				glog.Fatal(err)
+			}
+		}
+		sim.finishTasks(now)
+		sim.mockBots(now)
+		if err := s.MainLoop(); err != nil {
+			glog.Fatal(err)
+		}
+		if err := sim.startTasks(now); err != nil {
+			glog.Fatal(err)
+		}
+		glog.Infof("Simulated %s of %s; %d tasks triggered, %d running, queue length %d.", now.Sub(h.Start), h.End.Sub(h.Start), len(sim.records), len(sim.running), s.QueueLen())
+	}
+
+	// Compute and report the results.
+	tasks, err := d.GetTasksFromDateRange(time.Time{}, time.Now().Add(time.Hour))
+	if err != nil {
+		glog.Fatal(err)
+	}
+	report := sim.report(tasks, landed, testRe)
+	if err := report.Write(os.Stdout); err != nil {
+		glog.Fatal(err)
+	}
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			glog.Fatal(err)
+		}
+		if err := json.NewEncoder(f).Encode(report); err != nil {
+			glog.Fatal(err)
+		}
+		if err := f.Close(); err != nil {
+			glog.Fatal(err)
+		}
+	}
+}
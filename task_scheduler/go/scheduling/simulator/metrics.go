@@ -0,0 +1,241 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"go.skia.org/infra/task_scheduler/go/db"
+)
+
+// taskRecord tracks the simulated execution of a single Swarming task.
+type taskRecord struct {
+	// Id is the ID of the db.Task.
+	Id       string
+	Bot      string
+	Started  time.Time
+	Finished time.Time
+}
+
+// durationStats summarizes a set of durations.
+type durationStats struct {
+	Count  int           `json:"count"`
+	Mean   time.Duration `json:"mean"`
+	Median time.Duration `json:"median"`
+	P90    time.Duration `json:"p90"`
+	Max    time.Duration `json:"max"`
+}
+
+// makeDurationStats returns a durationStats summarizing the given durations.
+func makeDurationStats(durations []time.Duration) *durationStats {
+	rv := &durationStats{
+		Count: len(durations),
+	}
+	if len(durations) == 0 {
+		return rv
+	}
+	sorted := make([]time.Duration, len(durations))
+	copy(sorted, durations)
+	sort.Sort(durationSlice(sorted))
+	var total time.Duration
+	for _, d := range sorted {
+		total += d
+	}
+	rv.Mean = total / time.Duration(len(sorted))
+	rv.Median = sorted[len(sorted)/2]
+	rv.P90 = sorted[(len(sorted)*9)/10]
+	rv.Max = sorted[len(sorted)-1]
+	return rv
+}
+
+// String returns a human-readable summary of the durationStats.
+func (s *durationStats) String() string {
+	if s.Count == 0 {
+		return "no data"
+	}
+	return fmt.Sprintf("count %d, mean %s, median %s, p90 %s, max %s", s.Count, s.Mean, s.Median, s.P90, s.Max)
+}
+
+// durationSlice implements sort.Interface.
+type durationSlice []time.Duration
+
+func (s durationSlice) Len() int           { return len(s) }
+func (s durationSlice) Less(i, j int) bool { return s[i] < s[j] }
+func (s durationSlice) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+// Report contains the results of a simulation.
+type Report struct {
+	// TasksTriggered is the number of tasks which were triggered on
+	// Swarming during the simulation.
+	TasksTriggered int `json:"tasks_triggered"`
+
+	// QueueLatency measures the time between a task becoming runnable,
+	// ie. its commit landed and its dependencies finished, and the task
+	// starting.
+	QueueLatency *durationStats `json:"queue_latency"`
+
+	// CommitToFirstTest measures the time between a commit landing and
+	// the first test task which covers it finishing.
+	CommitToFirstTest *durationStats `json:"commit_to_first_test"`
+
+	// UntestedCommits is the number of commits which were not covered by
+	// any finished test task by the end of the simulation.
+	UntestedCommits int `json:"untested_commits"`
+
+	// BotUtilization is the fraction of available bot time spent running
+	// tasks, overall and grouped by bot dimensions.
+	BotUtilization       float64            `json:"bot_utilization"`
+	BotUtilizationByDims map[string]float64 `json:"bot_utilization_by_dims"`
+}
+
+// Write writes a human-readable version of the Report to w.
+func (r *Report) Write(w io.Writer) error {
+	if _, err := fmt.Fprintf(w, "Tasks triggered:         %d\n", r.TasksTriggered); err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(w, "Queue latency:           %s\n", r.QueueLatency); err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(w, "Commit to first test:    %s\n", r.CommitToFirstTest); err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(w, "Untested commits:        %d\n", r.UntestedCommits); err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(w, "Bot utilization:         %2.1f%%\n", r.BotUtilization*100.0); err != nil {
+		return err
+	}
+	dims := make([]string, 0, len(r.BotUtilizationByDims))
+	for d := range r.BotUtilizationByDims {
+		dims = append(dims, d)
+	}
+	sort.Strings(dims)
+	for _, d := range dims {
+		if _, err := fmt.Fprintf(w, "  %s: %2.1f%%\n", d, r.BotUtilizationByDims[d]*100.0); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// queueLatencies returns the queue latency of each of the given tasks which
+// was run by the simulator. A task becomes runnable when its revision lands
+// and all of its parent tasks have finished.
+func queueLatencies(tasks []*db.Task, records map[string]*taskRecord, landed map[string]time.Time) []time.Duration {
+	rv := make([]time.Duration, 0, len(tasks))
+	for _, t := range tasks {
+		rec, ok := records[t.Id]
+		if !ok {
+			continue
+		}
+		runnable, ok := landed[t.Revision]
+		if !ok {
+			continue
+		}
+		for _, p := range t.ParentTaskIds {
+			if parent, ok := records[p]; ok && parent.Finished.After(runnable) {
+				runnable = parent.Finished
+			}
+		}
+		latency := rec.Started.Sub(runnable)
+		if latency < 0 {
+			latency = 0
+		}
+		rv = append(rv, latency)
+	}
+	return rv
+}
+
+// commitToFirstTest returns the time between each landed commit and the first
+// finished task whose name matches testRe and whose blamelist includes the
+// commit, along with the number of commits which were never covered.
+func commitToFirstTest(tasks []*db.Task, records map[string]*taskRecord, landed map[string]time.Time, testRe *regexp.Regexp) ([]time.Duration, int) {
+	first := map[string]time.Time{}
+	for _, t := range tasks {
+		if !testRe.MatchString(t.Name) {
+			continue
+		}
+		finished := t.Finished
+		if rec, ok := records[t.Id]; ok {
+			finished = rec.Finished
+		}
+		if !t.Done() || finished.IsZero() {
+			continue
+		}
+		for _, c := range t.Commits {
+			if prev, ok := first[c]; !ok || finished.Before(prev) {
+				first[c] = finished
+			}
+		}
+	}
+	rv := make([]time.Duration, 0, len(landed))
+	untested := 0
+	for hash, ts := range landed {
+		if f, ok := first[hash]; ok {
+			rv = append(rv, f.Sub(ts))
+		} else {
+			untested++
+		}
+	}
+	return rv, untested
+}
+
+// dimsKey returns a string describing the given bot dimensions, excluding the
+// bot ID.
+func dimsKey(dims map[string]string) string {
+	parts := make([]string, 0, len(dims))
+	for k, v := range dims {
+		if k == "id" {
+			continue
+		}
+		parts = append(parts, fmt.Sprintf("%s:%s", k, v))
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, " ")
+}
+
+// botUtilization returns the fraction of available bot time between start and
+// end which was spent running tasks, overall and grouped by bot dimensions.
+// Tasks which have not finished are considered to run until end.
+func botUtilization(bots []*HistoryBot, records map[string]*taskRecord, start, end time.Time) (float64, map[string]float64) {
+	busyByBot := map[string][]*Window{}
+	for _, rec := range records {
+		finished := rec.Finished
+		if finished.IsZero() || finished.After(end) {
+			finished = end
+		}
+		busyByBot[rec.Bot] = append(busyByBot[rec.Bot], &Window{rec.Started, finished})
+	}
+	var totalAvailable, totalBusy time.Duration
+	availableByDims := map[string]time.Duration{}
+	busyByDims := map[string]time.Duration{}
+	for _, b := range bots {
+		key := dimsKey(b.Dimensions)
+		for _, avail := range b.AvailableWindows(start, end) {
+			a := avail.End.Sub(avail.Start)
+			totalAvailable += a
+			availableByDims[key] += a
+			for _, busy := range busyByBot[b.Id] {
+				if o := overlap(avail, busy); o != nil {
+					d := o.End.Sub(o.Start)
+					totalBusy += d
+					busyByDims[key] += d
+				}
+			}
+		}
+	}
+	byDims := make(map[string]float64, len(availableByDims))
+	for key, a := range availableByDims {
+		if a > 0 {
+			byDims[key] = float64(busyByDims[key]) / float64(a)
+		}
+	}
+	overall := 0.0
+	if totalAvailable > 0 {
+		overall = float64(totalBusy) / float64(totalAvailable)
+	}
+	return overall, byDims
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	assert "github.com/stretchr/testify/require"
+
+	"go.skia.org/infra/go/testutils"
+	"go.skia.org/infra/task_scheduler/go/db"
+	"go.skia.org/infra/task_scheduler/go/specs"
+)
+
+func TestHistoryValidate(t *testing.T) {
+	testutils.SmallTest(t)
+	start := time.Unix(1472647568, 0).UTC()
+	makeHistory := func() *History {
+		return &History{
+			Start: start,
+			End:   start.Add(time.Hour),
+			TasksCfg: &specs.TasksCfg{
+				Tasks: map[string]*specs.TaskSpec{
+					"Build": {
+						Dimensions: []string{"os:Ubuntu"},
+						Isolate:    "compile_skia.isolate",
+					},
+				},
+				Jobs: map[string]*specs.JobSpec{
+					"Build": {TaskSpecs: []string{"Build"}},
+				},
+			},
+			Commits: []*HistoryCommit{
+				{Timestamp: start},
+				{Timestamp: start.Add(10 * time.Minute)},
+			},
+			Bots: []*HistoryBot{
+				{Id: "bot1", Dimensions: map[string]string{"os": "Ubuntu"}},
+			},
+			TaskDurationsSecs: map[string][]float64{
+				"Build": {60, 120},
+			},
+		}
+	}
+	assert.NoError(t, makeHistory().Validate())
+
+	h := makeHistory()
+	h.End = h.Start
+	assert.Error(t, h.Validate())
+
+	h = makeHistory()
+	h.Commits[0].Timestamp = start.Add(time.Hour)
+	assert.Error(t, h.Validate())
+
+	h = makeHistory()
+	h.Commits[1].Timestamp = start.Add(2 * time.Hour)
+	assert.Error(t, h.Validate())
+
+	h = makeHistory()
+	h.Bots = append(h.Bots, &HistoryBot{Id: "bot1"})
+	assert.Error(t, h.Validate())
+
+	h = makeHistory()
+	h.Bots[0].Available = []*Window{{start.Add(time.Minute), start}}
+	assert.Error(t, h.Validate())
+
+	h = makeHistory()
+	h.TaskDurationsSecs["Bogus"] = []float64{1}
+	assert.Error(t, h.Validate())
+
+	// Shift moves everything.
+	h = makeHistory()
+	h.Bots[0].Available = []*Window{{start, start.Add(time.Minute)}}
+	h.Shift(time.Hour)
+	assert.Equal(t, start.Add(time.Hour), h.Start)
+	assert.Equal(t, start.Add(2*time.Hour), h.End)
+	assert.Equal(t, start.Add(70*time.Minute), h.Commits[1].Timestamp)
+	assert.Equal(t, start.Add(61*time.Minute), h.Bots[0].Available[0].End)
+}
+
+func TestBotAvailability(t *testing.T) {
+	testutils.SmallTest(t)
+	start := time.Unix(1472647568, 0).UTC()
+	end := start.Add(time.Hour)
+
+	// No windows means available the whole time.
+	b := &HistoryBot{Id: "bot1"}
+	assert.True(t, b.AvailableAt(start))
+	testutils.AssertDeepEqual(t, []*Window{{start, end}}, b.AvailableWindows(start, end))
+
+	b.Available = []*Window{
+		{start.Add(-time.Minute), start.Add(10 * time.Minute)},
+		{start.Add(50 * time.Minute), start.Add(2 * time.Hour)},
+	}
+	assert.True(t, b.AvailableAt(start))
+	assert.False(t, b.AvailableAt(start.Add(10*time.Minute)))
+	assert.True(t, b.AvailableAt(start.Add(50*time.Minute)))
+	testutils.AssertDeepEqual(t, []*Window{
+		{start, start.Add(10 * time.Minute)},
+		{start.Add(50 * time.Minute), end},
+	}, b.AvailableWindows(start, end))
+}
+
+func TestTaskDurations(t *testing.T) {
+	testutils.SmallTest(t)
+	d := newTaskDurations(map[string][]float64{"a": {1, 2}}, time.Minute)
+	assert.Equal(t, time.Second, d.Next("a"))
+	assert.Equal(t, 2*time.Second, d.Next("a"))
+	assert.Equal(t, time.Second, d.Next("a"))
+	assert.Equal(t, time.Minute, d.Next("b"))
+}
+
+func TestMakeDurationStats(t *testing.T) {
+	testutils.SmallTest(t)
+	assert.Equal(t, 0, makeDurationStats(nil).Count)
+	durations := []time.Duration{}
+	for i := 10; i > 0; i-- {
+		durations = append(durations, time.Duration(i)*time.Second)
+	}
+	testutils.AssertDeepEqual(t, &durationStats{
+		Count:  10,
+		Mean:   5500 * time.Millisecond,
+		Median: 6 * time.Second,
+		P90:    10 * time.Second,
+		Max:    10 * time.Second,
+	}, makeDurationStats(durations))
+}
+
+func TestMetrics(t *testing.T) {
+	testutils.SmallTest(t)
+	start := time.Unix(1472647568, 0).UTC()
+	end := start.Add(time.Hour)
+	landed := map[string]time.Time{
+		"c1": start,
+		"c2": start.Add(10 * time.Minute),
+		"c3": start.Add(20 * time.Minute),
+	}
+	tasks := []*db.Task{
+		{
+			Id:       "build1",
+			Name:     "Build",
+			Commits:  []string{"c1"},
+			Revision: "c1",
+			Status:   db.TASK_STATUS_SUCCESS,
+		},
+		{
+			Id:            "test1",
+			Name:          "Test",
+			Commits:       []string{"c1"},
+			ParentTaskIds: []string{"build1"},
+			Revision:      "c1",
+			Status:        db.TASK_STATUS_SUCCESS,
+		},
+		{
+			Id:       "build2",
+			Name:     "Build",
+			Commits:  []string{"c2", "c3"},
+			Revision: "c3",
+			Status:   db.TASK_STATUS_RUNNING,
+		},
+	}
+	records := map[string]*taskRecord{
+		"build1": {
+			Id:       "build1",
+			Bot:      "bot1",
+			Started:  start.Add(time.Minute),
+			Finished: start.Add(11 * time.Minute),
+		},
+		"test1": {
+			Id:       "test1",
+			Bot:      "bot2",
+			Started:  start.Add(15 * time.Minute),
+			Finished: start.Add(25 * time.Minute),
+		},
+		"build2": {
+			Id:      "build2",
+			Bot:     "bot1",
+			Started: start.Add(30 * time.Minute),
+		},
+	}
+
+	// Queue latency.
+	testutils.AssertDeepEqual(t, []time.Duration{time.Minute, 4 * time.Minute, 10 * time.Minute}, queueLatencies(tasks, records, landed))
+
+	// Commit to first test. Only c1 has been tested.
+	firstTest, untested := commitToFirstTest(tasks, records, landed, regexp.MustCompile("^Test"))
+	testutils.AssertDeepEqual(t, []time.Duration{25 * time.Minute}, firstTest)
+	assert.Equal(t, 2, untested)
+
+	// Bot utilization. bot1 is busy for 10 + 30 minutes, bot2 is busy for
+	// 10 minutes but is only available for half an hour.
+	bots := []*HistoryBot{
+		{
+			Id:         "bot1",
+			Dimensions: map[string]string{"os": "Ubuntu", "pool": "Skia"},
+		},
+		{
+			Id:         "bot2",
+			Dimensions: map[string]string{"os": "Android", "pool": "Skia"},
+			Available:  []*Window{{start.Add(20 * time.Minute), start.Add(50 * time.Minute)}},
+		},
+	}
+	util, byDims := botUtilization(bots, records, start, end)
+	assert.InDelta(t, 45.0/90.0, util, 0.0001)
+	assert.Equal(t, 2, len(byDims))
+	assert.InDelta(t, 40.0/60.0, byDims["os:Ubuntu pool:Skia"], 0.0001)
+	assert.InDelta(t, 5.0/30.0, byDims["os:Android pool:Skia"], 0.0001)
+}
@@ -0,0 +1,178 @@
+package scheduling
+
+import (
+	"sort"
+	"time"
+
+	swarming_api "github.com/luci/luci-go/common/api/swarming/swarming/v1"
+	"github.com/skia-dev/glog"
+	"go.skia.org/infra/go/metrics2"
+	"go.skia.org/infra/go/util"
+)
+
+const (
+	// MEASUREMENT_STARVED_S is the measurement name for the number of
+	// seconds for which a TaskSpec has been starved.
+	MEASUREMENT_STARVED_S = "task-spec-starved-s"
+
+	// MEASUREMENT_UNSCHEDULABLE is the measurement name for whether a
+	// TaskSpec is unschedulable, ie. no bot in the pool matches its
+	// dimensions. The value is 1 if unschedulable and 0 otherwise.
+	MEASUREMENT_UNSCHEDULABLE = "task-spec-unschedulable"
+)
+
+// StarvedTaskSpec describes a TaskSpec which has task candidates but for which
+// no matching free bot was found.
+type StarvedTaskSpec struct {
+	Repo       string   `json:"repo"`
+	Name       string   `json:"name"`
+	Dimensions []string `json:"dimensions"`
+
+	// Since is the time of the first consecutive scheduling round in which
+	// the TaskSpec was starved.
+	Since time.Time `json:"since"`
+
+	// Unschedulable indicates that no bot in the pool, busy or not,
+	// matches the TaskSpec's dimensions, so waiting will not help.
+	Unschedulable bool `json:"unschedulable"`
+}
+
+// Copy returns a copy of the StarvedTaskSpec.
+func (s *StarvedTaskSpec) Copy() *StarvedTaskSpec {
+	return &StarvedTaskSpec{
+		Repo:          s.Repo,
+		Name:          s.Name,
+		Dimensions:    util.CopyStringSlice(s.Dimensions),
+		Since:         s.Since,
+		Unschedulable: s.Unschedulable,
+	}
+}
+
+// starvedTaskSpecSlice is used for sorting StarvedTaskSpecs, longest-starved
+// first.
+type starvedTaskSpecSlice []*StarvedTaskSpec
+
+func (s starvedTaskSpecSlice) Len() int { return len(s) }
+func (s starvedTaskSpecSlice) Less(i, j int) bool {
+	if !s[i].Since.Equal(s[j].Since) {
+		return s[i].Since.Before(s[j].Since)
+	}
+	if s[i].Repo != s[j].Repo {
+		return s[i].Repo < s[j].Repo
+	}
+	return s[i].Name < s[j].Name
+}
+func (s starvedTaskSpecSlice) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+
+// starvationTracker keeps track of TaskSpecs which have task candidates but
+// for which no matching free bot was found, and reports them as metrics.
+type starvationTracker struct {
+	// starved maps repo names to TaskSpec names to StarvedTaskSpecs.
+	starved map[string]map[string]*StarvedTaskSpec
+}
+
+// newStarvationTracker returns a starvationTracker instance.
+func newStarvationTracker() *starvationTracker {
+	return &starvationTracker{
+		starved: map[string]map[string]*StarvedTaskSpec{},
+	}
+}
+
+// starvationMetricTags returns the tags used for metrics about the given
+// TaskSpec.
+func starvationMetricTags(repo, name string) map[string]string {
+	return map[string]string{
+		"repo":      repo,
+		"task_spec": name,
+	}
+}
+
+// update records the results of a scheduling round. queue contains all task
+// candidates, schedule contains the candidates which were matched with a free
+// bot, and bots contains all of the bots in the pool, busy or not. A TaskSpec
+// is starved if it has candidates with a positive score but none of them were
+// matched with a bot.
+func (t *starvationTracker) update(now time.Time, queue, schedule []*taskCandidate, bots []*swarming_api.SwarmingRpcsBotInfo) {
+	scheduled := map[string]map[string]bool{}
+	for _, c := range schedule {
+		if _, ok := scheduled[c.Repo]; !ok {
+			scheduled[c.Repo] = map[string]bool{}
+		}
+		scheduled[c.Repo][c.Name] = true
+	}
+
+	liveBots := make([]*swarming_api.SwarmingRpcsBotInfo, 0, len(bots))
+	for _, b := range bots {
+		if !b.IsDead && !b.Quarantined {
+			liveBots = append(liveBots, b)
+		}
+	}
+	botsByDim := botsByDimension(liveBots)
+
+	starved := map[string]map[string]*StarvedTaskSpec{}
+	for _, c := range queue {
+		if c.Score <= 0.0 || scheduled[c.Repo][c.Name] {
+			continue
+		}
+		if _, ok := starved[c.Repo][c.Name]; ok {
+			continue
+		}
+		s, ok := t.starved[c.Repo][c.Name]
+		if !ok {
+			s = &StarvedTaskSpec{
+				Repo:  c.Repo,
+				Name:  c.Name,
+				Since: now,
+			}
+		}
+		s.Dimensions = util.CopyStringSlice(c.TaskSpec.Dimensions)
+		s.Unschedulable = len(matchingBots(botsByDim, s.Dimensions)) == 0
+		if _, ok := starved[c.Repo]; !ok {
+			starved[c.Repo] = map[string]*StarvedTaskSpec{}
+		}
+		starved[c.Repo][c.Name] = s
+	}
+
+	// Remove the metrics for TaskSpecs which are no longer starved.
+	for repo, byName := range t.starved {
+		for name := range byName {
+			if _, ok := starved[repo][name]; ok {
+				continue
+			}
+			tags := starvationMetricTags(repo, name)
+			if err := metrics2.GetInt64Metric(MEASUREMENT_STARVED_S, tags).Delete(); err != nil {
+				glog.Errorf("Failed to delete starvation metric for %s: %s", name, err)
+			}
+			if err := metrics2.GetInt64Metric(MEASUREMENT_UNSCHEDULABLE, tags).Delete(); err != nil {
+				glog.Errorf("Failed to delete unschedulable metric for %s: %s", name, err)
+			}
+		}
+	}
+
+	// Report the current state.
+	for repo, byName := range starved {
+		for name, s := range byName {
+			tags := starvationMetricTags(repo, name)
+			metrics2.GetInt64Metric(MEASUREMENT_STARVED_S, tags).Update(int64(now.Sub(s.Since).Seconds()))
+			unschedulable := int64(0)
+			if s.Unschedulable {
+				unschedulable = 1
+				glog.Warningf("No bot in the pool matches the dimensions of %s (%s): %v", name, repo, s.Dimensions)
+			}
+			metrics2.GetInt64Metric(MEASUREMENT_UNSCHEDULABLE, tags).Update(unschedulable)
+		}
+	}
+	t.starved = starved
+}
+
+// list returns copies of the StarvedTaskSpecs, longest-starved first.
+func (t *starvationTracker) list() []*StarvedTaskSpec {
+	rv := []*StarvedTaskSpec{}
+	for _, byName := range t.starved {
+		for _, s := range byName {
+			rv = append(rv, s.Copy())
+		}
+	}
+	sort.Sort(starvedTaskSpecSlice(rv))
+	return rv
+}
@@ -0,0 +1,107 @@
+package scheduling
+
+import (
+	"testing"
+	"time"
+
+	swarming_api "github.com/luci/luci-go/common/api/swarming/swarming/v1"
+	assert "github.com/stretchr/testify/require"
+	"go.skia.org/infra/go/metrics2"
+	"go.skia.org/infra/go/testutils"
+)
+
+func TestStarvationTracker(t *testing.T) {
+	testutils.SmallTest(t)
+
+	linux := []string{"os:Linux", "pool:Skia"}
+	android := []string{"os:Android", "pool:Skia"}
+	mac := []string{"os:Mac", "pool:Skia"}
+
+	build := makeTaskCandidate("Build", linux)
+	build.Repo = repoName
+	test := makeTaskCandidate("Test", android)
+	test.Repo = repoName
+	perf := makeTaskCandidate("Perf", mac)
+	perf.Repo = repoName
+	backfill := makeTaskCandidate("Backfill", mac)
+	backfill.Repo = repoName
+	backfill.Score = 0.0
+	queue := []*taskCandidate{build, test, perf, backfill}
+
+	// The Android bot is busy and the only Mac bot is dead.
+	busy := makeSwarmingBot("bot-android", android)
+	busy.TaskId = "fake-task"
+	dead := makeSwarmingBot("bot-mac", mac)
+	dead.IsDead = true
+	bots := []*swarming_api.SwarmingRpcsBotInfo{
+		makeSwarmingBot("bot-linux", linux),
+		busy,
+		dead,
+	}
+
+	getMetric := func(measurement, name string) int64 {
+		return metrics2.GetInt64Metric(measurement, starvationMetricTags(repoName, name)).Get()
+	}
+
+	// Build is scheduled; Test and Perf are starved, and Perf can't be
+	// scheduled at all. Backfill has a zero score, so it doesn't count.
+	tr := newStarvationTracker()
+	t0 := time.Unix(1472647568, 0).UTC()
+	tr.update(t0, queue, []*taskCandidate{build}, bots)
+	testutils.AssertDeepEqual(t, []*StarvedTaskSpec{
+		{
+			Repo:          repoName,
+			Name:          "Perf",
+			Dimensions:    mac,
+			Since:         t0,
+			Unschedulable: true,
+		},
+		{
+			Repo:          repoName,
+			Name:          "Test",
+			Dimensions:    android,
+			Since:         t0,
+			Unschedulable: false,
+		},
+	}, tr.list())
+	assert.Equal(t, int64(1), getMetric(MEASUREMENT_UNSCHEDULABLE, "Perf"))
+	assert.Equal(t, int64(0), getMetric(MEASUREMENT_UNSCHEDULABLE, "Test"))
+	assert.Equal(t, int64(0), getMetric(MEASUREMENT_STARVED_S, "Test"))
+
+	// The Mac bot comes back but is busy. Since is preserved for both.
+	dead.IsDead = false
+	dead.TaskId = "fake-task-2"
+	t1 := t0.Add(10 * time.Minute)
+	tr.update(t1, queue, []*taskCandidate{build}, bots)
+	list := tr.list()
+	assert.Equal(t, 2, len(list))
+	assert.Equal(t, "Perf", list[0].Name)
+	assert.Equal(t, t0, list[0].Since)
+	assert.False(t, list[0].Unschedulable)
+	assert.Equal(t, "Test", list[1].Name)
+	assert.Equal(t, t0, list[1].Since)
+	assert.Equal(t, int64(0), getMetric(MEASUREMENT_UNSCHEDULABLE, "Perf"))
+	assert.Equal(t, int64(600), getMetric(MEASUREMENT_STARVED_S, "Perf"))
+	assert.Equal(t, int64(600), getMetric(MEASUREMENT_STARVED_S, "Test"))
+
+	// Test is scheduled and is no longer starved.
+	t2 := t1.Add(10 * time.Minute)
+	tr.update(t2, queue, []*taskCandidate{build, test}, bots)
+	list = tr.list()
+	assert.Equal(t, 1, len(list))
+	assert.Equal(t, "Perf", list[0].Name)
+	assert.Equal(t, int64(1200), getMetric(MEASUREMENT_STARVED_S, "Perf"))
+
+	// Test starts again from scratch if it becomes starved again.
+	t3 := t2.Add(10 * time.Minute)
+	tr.update(t3, queue, []*taskCandidate{build}, bots)
+	list = tr.list()
+	assert.Equal(t, 2, len(list))
+	assert.Equal(t, "Perf", list[0].Name)
+	assert.Equal(t, "Test", list[1].Name)
+	assert.Equal(t, t3, list[1].Since)
+
+	// No candidates, nothing starved.
+	tr.update(t3, []*taskCandidate{}, []*taskCandidate{}, bots)
+	assert.Equal(t, 0, len(tr.list()))
+}
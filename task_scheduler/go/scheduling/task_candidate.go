@@ -2,10 +2,13 @@ package scheduling
 
 import (
 	"bytes"
+	"crypto/sha256"
 	"encoding/base64"
 	"encoding/gob"
+	"encoding/json"
 	"fmt"
 	"path"
+	"sort"
 	"strings"
 	"time"
 
@@ -23,9 +26,11 @@ type taskCandidate struct {
 	IsolatedInput  string
 	IsolatedHashes []string
 	JobCreated     time.Time
+	JobPriority    float64
 	ParentTaskIds  []string
 	RetryOf        string
 	Score          float64
+	ScoreBreakdown []ScoreComponent
 	StealingFromId string
 	db.TaskKey
 	TaskSpec *specs.TaskSpec
@@ -33,14 +38,21 @@ type taskCandidate struct {
 
 // Copy returns a copy of the taskCandidate.
 func (c *taskCandidate) Copy() *taskCandidate {
+	var scoreBreakdown []ScoreComponent
+	if c.ScoreBreakdown != nil {
+		scoreBreakdown = make([]ScoreComponent, len(c.ScoreBreakdown))
+		copy(scoreBreakdown, c.ScoreBreakdown)
+	}
 	return &taskCandidate{
 		Commits:        util.CopyStringSlice(c.Commits),
 		IsolatedInput:  c.IsolatedInput,
 		IsolatedHashes: util.CopyStringSlice(c.IsolatedHashes),
 		JobCreated:     c.JobCreated,
+		JobPriority:    c.JobPriority,
 		ParentTaskIds:  util.CopyStringSlice(c.ParentTaskIds),
 		RetryOf:        c.RetryOf,
 		Score:          c.Score,
+		ScoreBreakdown: scoreBreakdown,
 		StealingFromId: c.StealingFromId,
 		TaskKey:        c.TaskKey.Copy(),
 		TaskSpec:       c.TaskSpec.Copy(),
@@ -224,11 +236,58 @@ func (c *taskCandidate) MakeTaskRequest(id string) *swarming_api.SwarmingRpcsNew
 	}
 }
 
+// stringPairSlice is an alias used for sorting a slice of
+// SwarmingRpcsStringPairs.
+type stringPairSlice []*swarming_api.SwarmingRpcsStringPair
+
+func (s stringPairSlice) Len() int { return len(s) }
+func (s stringPairSlice) Less(i, j int) bool {
+	if s[i].Key == s[j].Key {
+		return s[i].Value < s[j].Value
+	}
+	return s[i].Key < s[j].Key
+}
+func (s stringPairSlice) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+
+// MakePropertiesHash returns a hash of the properties of the Swarming task
+// request for the taskCandidate, excluding the bot ID dimension which is used
+// to force the task to run on a particular bot. Candidates with the same
+// properties hash are duplicates of one another. The taskCandidate must have
+// already been isolated.
+func (c *taskCandidate) MakePropertiesHash() (string, error) {
+	if c.IsolatedInput == "" {
+		return "", fmt.Errorf("Cannot compute properties hash for %s @ %s; not yet isolated.", c.Name, c.Revision)
+	}
+	props := c.MakeTaskRequest("").Properties
+	dims := make([]*swarming_api.SwarmingRpcsStringPair, 0, len(props.Dimensions))
+	for _, d := range props.Dimensions {
+		if d.Key != "id" {
+			dims = append(dims, d)
+		}
+	}
+	sort.Sort(stringPairSlice(dims))
+	props.Dimensions = dims
+	sort.Sort(stringPairSlice(props.Env))
+	b, err := json.Marshal(props)
+	if err != nil {
+		return "", fmt.Errorf("Failed to encode task properties: %s", err)
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(b)), nil
+}
+
+// taskSpecGetter returns the TaskSpec with the given name at the given
+// RepoState.
+type taskSpecGetter func(rs db.RepoState, name string) (*specs.TaskSpec, error)
+
 // allDepsMet determines whether all dependencies for the given task candidate
 // have been satisfied, and if so, returns a map of whose keys are task IDs and
-// values are their isolated outputs.
-func (c *taskCandidate) allDepsMet(cache db.TaskCache) (bool, map[string]string, error) {
-	rv := make(map[string]string, len(c.TaskSpec.Dependencies))
+// values are their isolated outputs. Conditional dependencies on the output of
+// a parent task are checked using the given DependencyOutputChecker. Parent
+// tasks which have no isolated output map to the empty string. The given
+// taskSpecGetter is used to find the RetryPolicy of conditional parents, which
+// are not considered finished while they may still be retried.
+func (c *taskCandidate) allDepsMet(cache db.TaskCache, checker db.DependencyOutputChecker, getSpec taskSpecGetter) (bool, map[string]string, error) {
+	rv := make(map[string]string, len(c.TaskSpec.Dependencies)+len(c.TaskSpec.ConditionalDependencies))
 	for _, depName := range c.TaskSpec.Dependencies {
 		key := c.TaskKey.Copy()
 		key.Name = depName
@@ -248,6 +307,48 @@ func (c *taskCandidate) allDepsMet(cache db.TaskCache) (bool, map[string]string,
 			return false, nil, nil
 		}
 	}
+	for _, dep := range c.TaskSpec.ConditionalDependencies {
+		key := c.TaskKey.Copy()
+		key.Name = dep.Task
+		byKey, err := cache.GetTasksByKey(&key)
+		if err != nil {
+			return false, nil, err
+		}
+		// The parent is finished if any attempt succeeded, or if the most
+		// recent attempt failed and the RetryPolicy won't allow another.
+		var parent *db.Task
+		for _, t := range byKey {
+			if t.Done() && t.Success() {
+				parent = t
+				break
+			}
+		}
+		if parent == nil && len(byKey) > 0 {
+			latest := byKey[len(byKey)-1]
+			if latest.Done() {
+				spec, err := getSpec(key.RepoState, dep.Task)
+				if err != nil {
+					return false, nil, err
+				}
+				if !spec.GetRetryPolicy().ShouldRetry(latest.Status, len(byKey)) {
+					parent = latest
+				}
+			}
+		}
+		if parent == nil || !dep.MetByStatus(db.JobStatusFromTaskStatus(parent.Status)) {
+			return false, nil, nil
+		}
+		if dep.On == db.DEPENDENCY_ON_OUTPUT {
+			met, err := checker(dep, parent.Id)
+			if err != nil {
+				return false, nil, err
+			}
+			if !met {
+				return false, nil, nil
+			}
+		}
+		rv[parent.Id] = parent.IsolatedOutput
+	}
 	return true, rv, nil
 }
 
@@ -18,9 +18,11 @@ func TestCopyTaskCandidate(t *testing.T) {
 		IsolatedInput:  "lonely-parameter",
 		IsolatedHashes: []string{"browns"},
 		JobCreated:     time.Now(),
+		JobPriority:    0.8,
 		ParentTaskIds:  []string{"38", "39", "40"},
 		RetryOf:        "41",
 		Score:          99,
+		ScoreBreakdown: []ScoreComponent{{SCORE_COMPONENT_TRY_JOB, 99}},
 		StealingFromId: "rich",
 		TaskKey: db.TaskKey{
 			RepoState: db.RepoState{
@@ -88,3 +90,155 @@ func TestReplaceVar(t *testing.T) {
 	assert.Equal(t, "<(REVISION", replaceVars(c, "<(REVISION"))
 	assert.Equal(t, "my-repo_my-task_abc123", replaceVars(c, "<(REPO)_<(TASK_NAME)_<(REVISION)"))
 }
+
+func TestAllDepsMetConditional(t *testing.T) {
+	testutils.SmallTest(t)
+	d := db.NewInMemoryDB()
+	cache, err := db.NewTaskCache(d, time.Hour)
+	assert.NoError(t, err)
+
+	build := makeTask("build", "repo", "abc123")
+	build.Status = db.TASK_STATUS_SUCCESS
+	build.IsolatedOutput = "build-output"
+	test := makeTask("test", "repo", "abc123")
+	test.Status = db.TASK_STATUS_RUNNING
+	assert.NoError(t, d.PutTasks([]*db.Task{build, test}))
+	assert.NoError(t, cache.Update())
+
+	c := &taskCandidate{
+		TaskKey: db.TaskKey{
+			RepoState: build.RepoState,
+			Name:      "upload",
+		},
+		TaskSpec: &specs.TaskSpec{
+			ConditionalDependencies: []*db.TaskDependency{
+				&db.TaskDependency{Task: "test", On: db.DEPENDENCY_ON_FAILURE},
+			},
+			Dependencies: []string{"build"},
+		},
+	}
+	outputMet := false
+	checker := func(dep *db.TaskDependency, parentId string) (bool, error) {
+		assert.Equal(t, test.Id, parentId)
+		return outputMet, nil
+	}
+	testSpec := &specs.TaskSpec{}
+	getSpec := func(rs db.RepoState, name string) (*specs.TaskSpec, error) {
+		assert.Equal(t, "test", name)
+		return testSpec, nil
+	}
+	check := func(expectMet bool, expectIds map[string]string) {
+		met, ids, err := c.allDepsMet(cache, checker, getSpec)
+		assert.NoError(t, err)
+		assert.Equal(t, expectMet, met)
+		if expectMet {
+			testutils.AssertDeepEqual(t, expectIds, ids)
+		}
+	}
+
+	// The test task hasn't finished.
+	check(false, nil)
+
+	// The test task failed, without isolated output.
+	test.Status = db.TASK_STATUS_FAILURE
+	assert.NoError(t, d.PutTask(test))
+	assert.NoError(t, cache.Update())
+
+	// The default RetryPolicy allows the test task to be retried, so it
+	// isn't finished yet.
+	check(false, nil)
+
+	// No retries are allowed.
+	testSpec.RetryPolicy = &db.RetryPolicy{
+		MaxAttempts: 1,
+		RetryOn:     db.RETRY_ON_BOTH,
+	}
+	check(true, map[string]string{build.Id: "build-output", test.Id: ""})
+
+	// A retry of the test task succeeded.
+	retry := makeTask("test", "repo", "abc123")
+	retry.Status = db.TASK_STATUS_SUCCESS
+	retry.IsolatedOutput = "test-output"
+	assert.NoError(t, d.PutTask(retry))
+	assert.NoError(t, cache.Update())
+	check(false, nil)
+
+	c.TaskSpec.ConditionalDependencies[0].On = db.DEPENDENCY_ON_ANY
+	check(true, map[string]string{build.Id: "build-output", retry.Id: "test-output"})
+
+	// Dependency on the output of the test task.
+	c.TaskSpec.ConditionalDependencies[0] = &db.TaskDependency{Task: "test", On: db.DEPENDENCY_ON_OUTPUT, OutputFile: "results.json", OutputKey: "k"}
+	test = retry
+	check(false, nil)
+	outputMet = true
+	check(true, map[string]string{build.Id: "build-output", retry.Id: "test-output"})
+}
+
+func TestAllDepsMetConditionalRetry(t *testing.T) {
+	testutils.SmallTest(t)
+	d := db.NewInMemoryDB()
+	cache, err := db.NewTaskCache(d, time.Hour)
+	assert.NoError(t, err)
+
+	test := makeTask("test", "repo", "abc123")
+	test.Status = db.TASK_STATUS_FAILURE
+	assert.NoError(t, d.PutTask(test))
+	assert.NoError(t, cache.Update())
+
+	onFailure := &taskCandidate{
+		TaskKey: db.TaskKey{
+			RepoState: test.RepoState,
+			Name:      "on-failure",
+		},
+		TaskSpec: &specs.TaskSpec{
+			ConditionalDependencies: []*db.TaskDependency{
+				&db.TaskDependency{Task: "test", On: db.DEPENDENCY_ON_FAILURE},
+			},
+		},
+	}
+	onAny := onFailure.Copy()
+	onAny.Name = "on-any"
+	onAny.TaskSpec.ConditionalDependencies[0].On = db.DEPENDENCY_ON_ANY
+	checker := func(dep *db.TaskDependency, parentId string) (bool, error) {
+		assert.FailNow(t, "Unexpected output check.")
+		return false, nil
+	}
+	// The test task uses the default RetryPolicy.
+	getSpec := func(rs db.RepoState, name string) (*specs.TaskSpec, error) {
+		return &specs.TaskSpec{}, nil
+	}
+	check := func(c *taskCandidate, expectMet bool, expectIds map[string]string) {
+		met, ids, err := c.allDepsMet(cache, checker, getSpec)
+		assert.NoError(t, err)
+		assert.Equal(t, expectMet, met)
+		if expectMet {
+			testutils.AssertDeepEqual(t, expectIds, ids)
+		}
+	}
+
+	// The first attempt failed, but it will be retried.
+	check(onFailure, false, nil)
+	check(onAny, false, nil)
+
+	// The retry is running.
+	retry := makeTask("test", "repo", "abc123")
+	retry.Status = db.TASK_STATUS_RUNNING
+	assert.NoError(t, d.PutTask(retry))
+	assert.NoError(t, cache.Update())
+	check(onFailure, false, nil)
+	check(onAny, false, nil)
+
+	// The retry succeeded; the on-failure dependent never runs.
+	retry.Status = db.TASK_STATUS_SUCCESS
+	assert.NoError(t, d.PutTask(retry))
+	assert.NoError(t, cache.Update())
+	check(onFailure, false, nil)
+	check(onAny, true, map[string]string{retry.Id: ""})
+
+	// If the retry had also failed, no more attempts would be allowed.
+	retry.Status = db.TASK_STATUS_FAILURE
+	assert.NoError(t, d.PutTask(retry))
+	assert.NoError(t, cache.Update())
+	check(onFailure, true, map[string]string{retry.Id: ""})
+	check(onAny, true, map[string]string{retry.Id: ""})
+}
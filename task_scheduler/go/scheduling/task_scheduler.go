@@ -36,6 +36,14 @@ const (
 	// 5 commits behind.
 	CANDIDATE_SCORE_TRY_JOB = 10.0
 
+	// Retries of failed tasks are scheduled before new candidates, but
+	// after manually-forced jobs.
+	CANDIDATE_SCORE_RETRY = 50.0
+
+	// Retries never reach the score of manually-forced jobs, no matter how
+	// long they have been waiting.
+	MAX_CANDIDATE_SCORE_RETRY = CANDIDATE_SCORE_FORCE_RUN - 1.0
+
 	NUM_TOP_CANDIDATES = 50
 )
 
@@ -46,14 +54,18 @@ var (
 // TaskScheduler is a struct used for scheduling tasks on bots.
 type TaskScheduler struct {
 	bl               *blacklist.Blacklist
+	culprits         util.StringSet // IDs of tasks whose culprit has been recorded.
 	db               db.DB
 	isolate          *isolate.Client
 	jCache           db.JobCache
 	lastScheduled    time.Time // protected by queueMtx.
+	outputChecker    db.DependencyOutputChecker
 	period           time.Duration
 	queue            []*taskCandidate // protected by queueMtx.
 	queueMtx         sync.RWMutex
 	repos            repograph.Map
+	scorer           Scorer
+	starvation       *starvationTracker // protected by queueMtx.
 	swarming         swarming.ApiClient
 	taskCfgCache     *specs.TaskCfgCache
 	tCache           db.TaskCache
@@ -62,7 +74,7 @@ type TaskScheduler struct {
 	workdir          string
 }
 
-func NewTaskScheduler(d db.DB, period time.Duration, workdir string, repos repograph.Map, isolateClient *isolate.Client, swarmingClient swarming.ApiClient, c *http.Client, timeDecayAmt24Hr float64, buildbucketApiUrl, trybotBucket string, projectRepoMapping map[string]string) (*TaskScheduler, error) {
+func NewTaskScheduler(d db.DB, period time.Duration, workdir string, repos repograph.Map, isolateClient *isolate.Client, swarmingClient swarming.ApiClient, c *http.Client, timeDecayAmt24Hr float64, scorer Scorer, buildbucketApiUrl, trybotBucket string, projectRepoMapping map[string]string) (*TaskScheduler, error) {
 	bl, err := blacklist.FromFile(path.Join(workdir, "blacklist.json"))
 	if err != nil {
 		return nil, err
@@ -87,13 +99,17 @@ func NewTaskScheduler(d db.DB, period time.Duration, workdir string, repos repog
 
 	s := &TaskScheduler{
 		bl:               bl,
+		culprits:         util.StringSet{},
 		db:               d,
 		isolate:          isolateClient,
 		jCache:           jCache,
+		outputChecker:    newDependencyOutputCache(isolateClient, tCache, workdir).check,
 		period:           period,
 		queue:            []*taskCandidate{},
 		queueMtx:         sync.RWMutex{},
 		repos:            repos,
+		scorer:           scorer,
+		starvation:       newStarvationTracker(),
 		swarming:         swarmingClient,
 		taskCfgCache:     taskCfgCache,
 		tCache:           tCache,
@@ -122,8 +138,10 @@ func (s *TaskScheduler) Start(ctx context.Context, beforeMainLoop func()) {
 // TaskSchedulerStatus is a struct which provides status information about the
 // TaskScheduler.
 type TaskSchedulerStatus struct {
-	LastScheduled time.Time        `json:"last_scheduled"`
-	TopCandidates []*taskCandidate `json:"top_candidates"`
+	LastScheduled time.Time          `json:"last_scheduled"`
+	Scorer        string             `json:"scorer"`
+	StarvedSpecs  []*StarvedTaskSpec `json:"starved_specs"`
+	TopCandidates []*taskCandidate   `json:"top_candidates"`
 }
 
 // Status returns the current status of the TaskScheduler.
@@ -140,6 +158,8 @@ func (s *TaskScheduler) Status() *TaskSchedulerStatus {
 	}
 	return &TaskSchedulerStatus{
 		LastScheduled: s.lastScheduled,
+		Scorer:        s.scorer.Name(),
+		StarvedSpecs:  s.starvation.list(),
 		TopCandidates: candidates,
 	}
 }
@@ -286,7 +306,7 @@ func ComputeBlamelist(cache db.TaskCache, repo *repograph.Graph, taskName, repoN
 					return false, ERR_BLAMELIST_DONE
 				}
 			}
-			if stealFrom == nil || prev != stealFrom {
+			if stealFrom == nil || prev.Id != stealFrom.Id {
 				// If we've hit a commit belonging to a different task,
 				// we're done.
 				return false, nil
@@ -325,9 +345,15 @@ func (s *TaskScheduler) findTaskCandidatesForJobs(unfinishedJobs []*db.Job) (map
 				return nil, err
 			}
 			c := &taskCandidate{
-				JobCreated: j.Created,
-				TaskKey:    key,
-				TaskSpec:   spec,
+				JobCreated:  j.Created,
+				JobPriority: j.Priority,
+				TaskKey:     key,
+				TaskSpec:    spec,
+			}
+			// Use the highest priority of any Job which needs
+			// this candidate.
+			if prev, ok := candidates[key]; ok && prev.JobPriority > c.JobPriority {
+				c.JobPriority = prev.JobPriority
 			}
 			candidates[key] = c
 		}
@@ -368,15 +394,16 @@ func (s *TaskScheduler) filterTaskCandidates(preFilterCandidates map[db.TaskKey]
 			if previous.Success() {
 				continue
 			}
-			// Only retry a task once.
-			if previous.RetryOf != "" {
+			// Only retry a task if the TaskSpec's RetryPolicy
+			// allows it.
+			if !c.TaskSpec.GetRetryPolicy().ShouldRetry(previous.Status, len(prevTasks)) {
 				continue
 			}
 			c.RetryOf = previous.Id
 		}
 
 		// Don't consider candidates whose dependencies are not met.
-		depsMet, idsToHashes, err := c.allDepsMet(s.tCache)
+		depsMet, idsToHashes, err := c.allDepsMet(s.tCache, s.outputChecker, s.taskCfgCache.GetTaskSpec)
 		if err != nil {
 			return nil, err
 		}
@@ -386,7 +413,9 @@ func (s *TaskScheduler) filterTaskCandidates(preFilterCandidates map[db.TaskKey]
 		hashes := make([]string, 0, len(idsToHashes))
 		parentTaskIds := make([]string, 0, len(idsToHashes))
 		for id, hash := range idsToHashes {
-			hashes = append(hashes, hash)
+			if hash != "" {
+				hashes = append(hashes, hash)
+			}
 			parentTaskIds = append(parentTaskIds, id)
 		}
 		c.IsolatedHashes = hashes
@@ -408,8 +437,11 @@ func (s *TaskScheduler) filterTaskCandidates(preFilterCandidates map[db.TaskKey]
 // processTaskCandidate computes the remaining information about the task
 // candidate, eg. blamelists and scoring.
 func (s *TaskScheduler) processTaskCandidate(c *taskCandidate, now time.Time, cache *cacheWrapper, commitsBuf []*repograph.Commit) error {
+	in := &scoreInputs{
+		Now: now,
+	}
 	if c.IsTryJob() {
-		c.Score = CANDIDATE_SCORE_TRY_JOB + now.Sub(c.JobCreated).Hours()
+		c.Score, c.ScoreBreakdown = s.scorer.Score(c, in)
 		return nil
 	}
 
@@ -433,36 +465,26 @@ func (s *TaskScheduler) processTaskCandidate(c *taskCandidate, now time.Time, ca
 	if len(c.Commits) > 0 && !util.In(c.Revision, c.Commits) {
 		glog.Errorf("task candidate %s @ %s doesn't have its own revision in its blamelist: %v", c.Name, c.Revision, c.Commits)
 	}
-
-	if c.IsForceRun() {
-		c.Score = CANDIDATE_SCORE_FORCE_RUN + now.Sub(c.JobCreated).Hours()
-		return nil
+	if c.RetryOf != "" && !c.IsForceRun() && stealingFrom != nil && stealingFrom.Id != c.RetryOf {
+		glog.Errorf("Candidate %v is a retry of %s but is stealing commits from %s!", c.TaskKey, c.RetryOf, stealingFrom.Id)
 	}
 
-	// Score the candidate.
-	// The score for a candidate is based on the "testedness" increase
-	// provided by running the task.
+	// The "testedness" increase provided by running the task.
 	stoleFromCommits := 0
 	if stealingFrom != nil {
-		// Treat retries as if they're new; don't use stealingFrom.Commits.
-		if c.RetryOf != "" {
-			if stealingFrom.Id != c.RetryOf {
-				glog.Errorf("Candidate %v is a retry of %s but is stealing commits from %s!", c.TaskKey, c.RetryOf, stealingFrom.Id)
-			}
-		} else {
-			stoleFromCommits = len(stealingFrom.Commits)
-		}
+		stoleFromCommits = len(stealingFrom.Commits)
 	}
-	score := testednessIncrease(len(c.Commits), stoleFromCommits)
+	in.TestednessIncrease = testednessIncrease(len(c.Commits), stoleFromCommits)
 
-	// Scale the score by other factors, eg. time decay.
+	// Time decay.
 	decay, err := s.timeDecayForCommit(now, revision)
 	if err != nil {
 		return err
 	}
-	score *= decay
+	in.TimeDecay = decay
 
-	c.Score = score
+	// Score the candidate.
+	c.Score, c.ScoreBreakdown = s.scorer.Score(c, in)
 	return nil
 }
 
@@ -596,27 +618,38 @@ func (s *TaskScheduler) regenerateTaskQueue() error {
 
 // getCandidatesToSchedule matches the list of free Swarming bots to task
 // candidates in the queue and returns the candidates which should be run.
-// Assumes that the tasks are sorted in decreasing order by score.
-func getCandidatesToSchedule(bots []*swarming_api.SwarmingRpcsBotInfo, tasks []*taskCandidate) []*taskCandidate {
+// Assumes that the tasks are sorted in decreasing order by score. No TaskSpec
+// is given more than maxBotShare of the free bots, with a minimum of one bot.
+func getCandidatesToSchedule(bots []*swarming_api.SwarmingRpcsBotInfo, tasks []*taskCandidate, maxBotShare float64) []*taskCandidate {
+	// The filter never fails, so neither can we.
+	rv, _ := getFilteredCandidatesToSchedule(bots, tasks, maxBotShare, nil)
+	return rv
+}
+
+// candidateFilter is called for a task candidate which is about to be assigned
+// a bot, and returns false if the candidate should not be run, in which case
+// the bot remains available for the following candidates.
+type candidateFilter func(c *taskCandidate) (bool, error)
+
+// getFilteredCandidatesToSchedule is the same as getCandidatesToSchedule, but
+// each candidate which would be assigned a bot is first passed to the given
+// candidateFilter, if it is non-nil.
+func getFilteredCandidatesToSchedule(bots []*swarming_api.SwarmingRpcsBotInfo, tasks []*taskCandidate, maxBotShare float64, filter candidateFilter) ([]*taskCandidate, error) {
 	defer timer.New("scheduling.getCandidatesToSchedule").Stop()
 	// Create a bots-by-swarming-dimension mapping.
-	botsByDim := map[string]util.StringSet{}
-	for _, b := range bots {
-		for _, dim := range b.Dimensions {
-			for _, val := range dim.Value {
-				d := fmt.Sprintf("%s:%s", dim.Key, val)
-				if _, ok := botsByDim[d]; !ok {
-					botsByDim[d] = util.StringSet{}
-				}
-				botsByDim[d][b.BotId] = true
-			}
-		}
-	}
+	botsByDim := botsByDimension(bots)
 
 	// Match bots to tasks.
 	// TODO(borenet): Some tasks require a more specialized bot. We should
 	// match so that less-specialized tasks don't "steal" more-specialized
 	// bots which they don't actually need.
+	maxBotsPerSpec := int(math.Ceil(maxBotShare * float64(len(bots))))
+	if maxBotsPerSpec < 1 {
+		maxBotsPerSpec = 1
+	}
+	// map[repo][task_spec_name]number of bots assigned.
+	botsPerSpec := map[string]map[string]int{}
+
 	rv := make([]*taskCandidate, 0, len(bots))
 	for _, c := range tasks {
 		// TODO(borenet): Make this threshold configurable.
@@ -625,13 +658,26 @@ func getCandidatesToSchedule(bots []*swarming_api.SwarmingRpcsBotInfo, tasks []*
 			continue
 		}
 
+		// Don't let any one TaskSpec take more than its share of the
+		// bots.
+		bySpec, ok := botsPerSpec[c.Repo]
+		if !ok {
+			bySpec = map[string]int{}
+			botsPerSpec[c.Repo] = bySpec
+		}
+		if bySpec[c.Name] >= maxBotsPerSpec {
+			continue
+		}
+
 		// For each dimension of the task, find the set of bots which matches.
-		matches := util.StringSet{}
-		for i, d := range c.TaskSpec.Dimensions {
-			if i == 0 {
-				matches = matches.Union(botsByDim[d])
-			} else {
-				matches = matches.Intersect(botsByDim[d])
+		matches := matchingBots(botsByDim, c.TaskSpec.Dimensions)
+		if len(matches) > 0 && filter != nil {
+			run, err := filter(c)
+			if err != nil {
+				return nil, err
+			}
+			if !run {
+				continue
 			}
 		}
 		if len(matches) > 0 {
@@ -657,6 +703,7 @@ func getCandidatesToSchedule(bots []*swarming_api.SwarmingRpcsBotInfo, tasks []*
 
 			// Add the task to the scheduling list.
 			rv = append(rv, c)
+			bySpec[c.Name]++
 
 			// If we've exhausted the bot list, stop here.
 			if len(botsByDim) == 0 {
@@ -665,9 +712,41 @@ func getCandidatesToSchedule(bots []*swarming_api.SwarmingRpcsBotInfo, tasks []*
 		}
 	}
 	sort.Sort(taskCandidateSlice(rv))
+	return rv, nil
+}
+
+// botsByDimension returns a mapping of "key:value" Swarming dimensions to the
+// IDs of the given bots which have that dimension.
+func botsByDimension(bots []*swarming_api.SwarmingRpcsBotInfo) map[string]util.StringSet {
+	rv := map[string]util.StringSet{}
+	for _, b := range bots {
+		for _, dim := range b.Dimensions {
+			for _, val := range dim.Value {
+				d := fmt.Sprintf("%s:%s", dim.Key, val)
+				if _, ok := rv[d]; !ok {
+					rv[d] = util.StringSet{}
+				}
+				rv[d][b.BotId] = true
+			}
+		}
+	}
 	return rv
 }
 
+// matchingBots returns the IDs of the bots in botsByDim which have all of the
+// given dimensions.
+func matchingBots(botsByDim map[string]util.StringSet, dimensions []string) util.StringSet {
+	matches := util.StringSet{}
+	for i, d := range dimensions {
+		if i == 0 {
+			matches = matches.Union(botsByDim[d])
+		} else {
+			matches = matches.Intersect(botsByDim[d])
+		}
+	}
+	return matches
+}
+
 // isolateTasks sets up the given RepoState and isolates the given
 // taskCandidates.
 func (s *TaskScheduler) isolateTasks(rs db.RepoState, candidates []*taskCandidate) error {
@@ -707,19 +786,97 @@ func (s *TaskScheduler) isolateTasks(rs db.RepoState, candidates []*taskCandidat
 func (s *TaskScheduler) scheduleTasks() error {
 	defer timer.New("TaskScheduler.scheduleTasks").Stop()
 	// Find free bots, match them with tasks.
-	bots, err := getFreeSwarmingBots(s.swarming)
+	allBots, err := s.swarming.ListSkiaBots()
 	if err != nil {
 		return err
 	}
+	bots := getFreeSwarmingBots(allBots)
 	s.queueMtx.Lock()
 	defer s.queueMtx.Unlock()
-	schedule := getCandidatesToSchedule(bots, s.queue)
+
+	// Idempotent tasks may reuse the results of a previous task with
+	// identical inputs, unless they were explicitly forced. Find those
+	// duplicates before assigning bots, so that candidates which don't
+	// need to run leave their bots to the following candidates.
+	//
+	// Idempotent candidates must be isolated to compute their properties
+	// hashes. Isolate all of those at a RepoState together, when the
+	// first of them is considered.
+	idempotentByRepoState := map[db.RepoState][]*taskCandidate{}
+	for _, c := range s.queue {
+		if c.TaskSpec.Idempotent {
+			idempotentByRepoState[c.RepoState] = append(idempotentByRepoState[c.RepoState], c)
+		}
+	}
+	isolated := map[db.RepoState]bool{}
+	// Properties hashes of idempotent candidates.
+	hashes := map[*taskCandidate]string{}
+	// Candidates which reuse the results of a finished duplicate task.
+	reuse := map[*taskCandidate]*db.Task{}
+	// Candidates which were not triggered because a duplicate task is
+	// still pending or running.
+	waiting := map[string]bool{}
+	// Properties hashes of the idempotent candidates which will be
+	// triggered.
+	triggering := map[string]*taskCandidate{}
+	filter := func(c *taskCandidate) (bool, error) {
+		// If we're stealing commits from a candidate which we didn't
+		// trigger, our blamelist is no longer correct.
+		if waiting[c.StealingFromId] {
+			waiting[c.MakeId()] = true
+			return false, nil
+		}
+		if !c.TaskSpec.Idempotent {
+			return true, nil
+		}
+		if !isolated[c.RepoState] {
+			if err := s.isolateTasks(c.RepoState, idempotentByRepoState[c.RepoState]); err != nil {
+				return false, err
+			}
+			isolated[c.RepoState] = true
+		}
+		hash, err := c.MakePropertiesHash()
+		if err != nil {
+			return false, err
+		}
+		hashes[c] = hash
+		if c.IsForceRun() {
+			return true, nil
+		}
+		if other, ok := triggering[hash]; ok {
+			glog.Infof("Not triggering %s @ %s; waiting for duplicate candidate %s @ %s.", c.Name, c.Revision, other.Name, other.Revision)
+			waiting[c.MakeId()] = true
+			return false, nil
+		}
+		dup, err := s.findDuplicateTask(hash)
+		if err != nil {
+			return false, err
+		}
+		if dup == nil {
+			triggering[hash] = c
+			return true, nil
+		}
+		if !dup.Done() {
+			glog.Infof("Not triggering %s @ %s; waiting for duplicate task %s.", c.Name, c.Revision, dup.Id)
+			waiting[c.MakeId()] = true
+			return false, nil
+		}
+		reuse[c] = dup
+		return false, nil
+	}
+	schedule, err := getFilteredCandidatesToSchedule(bots, s.queue, s.scorer.MaxBotShare(), filter)
+	if err != nil {
+		return err
+	}
 
 	// First, group by commit hash since we have to isolate the code at
-	// a particular revision for each task.
+	// a particular revision for each task. Idempotent candidates have
+	// already been isolated.
 	byRepoState := map[db.RepoState][]*taskCandidate{}
 	for _, c := range schedule {
-		byRepoState[c.RepoState] = append(byRepoState[c.RepoState], c)
+		if _, ok := hashes[c]; !ok {
+			byRepoState[c.RepoState] = append(byRepoState[c.RepoState], c)
+		}
 	}
 
 	// Isolate the tasks by commit.
@@ -729,25 +886,63 @@ func (s *TaskScheduler) scheduleTasks() error {
 		}
 	}
 
+	// Candidates which reuse results are processed along with the
+	// candidates which run on bots, so that blamelists are adjusted in the
+	// correct order.
+	for c, _ := range reuse {
+		schedule = append(schedule, c)
+	}
+	sort.Sort(taskCandidateSlice(schedule))
+
+	// Keep track of TaskSpecs which have candidates but no free bots.
+	// Candidates which wait for a duplicate task were matched with a bot,
+	// so they don't count as starved either.
+	matched := make([]*taskCandidate, 0, len(schedule)+len(waiting))
+	matched = append(matched, schedule...)
+	for _, c := range s.queue {
+		if waiting[c.MakeId()] {
+			matched = append(matched, c)
+		}
+	}
+	s.starvation.update(time.Now(), s.queue, matched, allBots)
+
 	// Trigger tasks.
 	byCandidateId := make(map[string]*db.Task, len(schedule))
 	tasksToInsert := make(map[string]*db.Task, len(schedule)*2)
 	for _, candidate := range schedule {
 		t := candidate.MakeTask()
+		t.PropertiesHash = hashes[candidate]
 		if err := s.db.AssignId(t); err != nil {
 			return err
 		}
-		req := candidate.MakeTaskRequest(t.Id)
-		resp, err := s.swarming.TriggerTask(req)
-		if err != nil {
-			return err
-		}
-		created, err := swarming.ParseTimestamp(resp.Request.CreatedTs)
-		if err != nil {
-			return fmt.Errorf("Failed to parse timestamp of created task: %s", err)
+		if dup, ok := reuse[candidate]; ok {
+			// Reuse the results of the duplicate task rather than
+			// running the same thing again.
+			glog.Infof("Reusing results of task %s for %s @ %s.", dup.Id, candidate.Name, candidate.Revision)
+			t.Created = dup.Created
+			t.DedupedFrom = dup.Id
+			if dup.DedupedFrom != "" {
+				t.DedupedFrom = dup.DedupedFrom
+			}
+			t.Finished = dup.Finished
+			t.IsolatedOutput = dup.IsolatedOutput
+			t.Started = dup.Started
+			t.Status = dup.Status
+			t.SwarmingBotId = dup.SwarmingBotId
+			t.SwarmingTaskId = dup.SwarmingTaskId
+		} else {
+			req := candidate.MakeTaskRequest(t.Id)
+			resp, err := s.swarming.TriggerTask(req)
+			if err != nil {
+				return err
+			}
+			created, err := swarming.ParseTimestamp(resp.Request.CreatedTs)
+			if err != nil {
+				return fmt.Errorf("Failed to parse timestamp of created task: %s", err)
+			}
+			t.Created = created
+			t.SwarmingTaskId = resp.TaskId
 		}
-		t.Created = created
-		t.SwarmingTaskId = resp.TaskId
 		byCandidateId[candidate.MakeId()] = t
 		tasksToInsert[t.Id] = t
 		// If we're stealing commits from another task, find it and adjust
@@ -811,10 +1006,29 @@ func (s *TaskScheduler) scheduleTasks() error {
 	// loop which updates those candidates to use the IDs of the newly-
 	// inserted Tasks in the database rather than the candidate ID.
 
-	glog.Infof("Triggered %d tasks on %d bots.", len(schedule), len(bots))
+	glog.Infof("Triggered %d tasks on %d bots; reused results for %d and deferred %d duplicate tasks.", len(schedule)-len(reuse), len(bots), len(reuse), len(waiting))
 	return nil
 }
 
+// findDuplicateTask returns a Task from the cache with the given properties
+// hash whose results may be reused, or which is still pending or running.
+// Successful tasks are preferred. Returns nil if there is no such Task.
+func (s *TaskScheduler) findDuplicateTask(hash string) (*db.Task, error) {
+	tasks, err := s.tCache.GetTasksByPropertiesHash(hash)
+	if err != nil {
+		return nil, err
+	}
+	var rv *db.Task
+	for _, t := range tasks {
+		if t.Success() {
+			return t, nil
+		} else if !t.Done() && rv == nil {
+			rv = t
+		}
+	}
+	return rv, nil
+}
+
 // gatherNewJobs finds and inserts Jobs for all new commits.
 func (s *TaskScheduler) gatherNewJobs() error {
 	defer timer.New("TaskScheduler.gatherNewJobs").Stop()
@@ -932,6 +1146,11 @@ func (s *TaskScheduler) MainLoop() error {
 		return err
 	}
 
+	// Add Jobs to bisect new failures.
+	if err := s.bisectFailures(time.Now()); err != nil {
+		return err
+	}
+
 	// Add Jobs for new commits.
 	if err := s.gatherNewJobs(); err != nil {
 		return err
@@ -1050,13 +1269,10 @@ func testednessIncrease(blamelistLength, stoleFromBlamelistLength int) float64 {
 	}
 }
 
-// getFreeSwarmingBots returns a slice of free swarming bots.
-func getFreeSwarmingBots(s swarming.ApiClient) ([]*swarming_api.SwarmingRpcsBotInfo, error) {
+// getFreeSwarmingBots returns the free bots from the given slice of swarming
+// bots.
+func getFreeSwarmingBots(bots []*swarming_api.SwarmingRpcsBotInfo) []*swarming_api.SwarmingRpcsBotInfo {
 	defer timer.New("getFreeSwarmingBots").Stop()
-	bots, err := s.ListSkiaBots()
-	if err != nil {
-		return nil, err
-	}
 	rv := make([]*swarming_api.SwarmingRpcsBotInfo, 0, len(bots))
 	for _, bot := range bots {
 		if bot.IsDead {
@@ -1070,7 +1286,7 @@ func getFreeSwarmingBots(s swarming.ApiClient) ([]*swarming_api.SwarmingRpcsBotI
 		}
 		rv = append(rv, bot)
 	}
-	return rv, nil
+	return rv
 }
 
 // updateUnfinishedTasks queries Swarming for all unfinished tasks and updates
@@ -1137,7 +1353,9 @@ func (s *TaskScheduler) updateUnfinishedJobs() error {
 		return err
 	}
 
+	now := time.Now()
 	modified := make([]*db.Job, 0, len(jobs))
+	timedOut := map[*db.Job]map[string][]*db.Task{}
 	errs := []error{}
 	for _, j := range jobs {
 		tasks, err := s.getTasksForJob(j)
@@ -1152,9 +1370,25 @@ func (s *TaskScheduler) updateUnfinishedJobs() error {
 			}
 			summaries[k] = cpy
 		}
+		changed := false
 		if !reflect.DeepEqual(summaries, j.Tasks) {
 			j.Tasks = summaries
-			j.Status = j.DeriveStatus()
+			changed = true
+		}
+		// Derive the status even if the tasks haven't changed, since
+		// checking the outputs of tasks for conditional dependencies
+		// may have failed previously.
+		if status := j.DeriveStatusWithOutputs(s.outputChecker); status != j.Status {
+			j.Status = status
+			changed = true
+		}
+		if j.TimedOut(now) {
+			glog.Warningf("Job %s (%s @ %s) did not finish within %s; marking it as timed out.", j.Id, j.Name, j.Revision, j.MaxDuration)
+			j.Status = db.JOB_STATUS_TIMED_OUT
+			timedOut[j] = tasks
+			changed = true
+		}
+		if changed {
 			if j.Done() {
 				if err := s.jobFinished(j); err != nil {
 					errs = append(errs, err)
@@ -1164,6 +1398,11 @@ func (s *TaskScheduler) updateUnfinishedJobs() error {
 			modified = append(modified, j)
 		}
 	}
+	if len(timedOut) > 0 {
+		if err := s.cancelPendingTasks(timedOut, jobs); err != nil {
+			errs = append(errs, err)
+		}
+	}
 	if len(modified) > 0 {
 		if err := s.db.PutJobs(modified); err != nil {
 			errs = append(errs, err)
@@ -1177,6 +1416,44 @@ func (s *TaskScheduler) updateUnfinishedJobs() error {
 	return nil
 }
 
+// cancelPendingTasks cancels the pending Swarming tasks for the given timed-out
+// Jobs, except for those which are still needed by another unfinished Job.
+// timedOut maps each Job to its Tasks, keyed by TaskSpec name.
+func (s *TaskScheduler) cancelPendingTasks(timedOut map[*db.Job]map[string][]*db.Task, jobs []*db.Job) error {
+	needed := map[db.TaskKey]bool{}
+	for _, j := range jobs {
+		if j.Done() {
+			continue
+		}
+		for name, _ := range j.Dependencies {
+			needed[j.MakeTaskKey(name)] = true
+		}
+	}
+	canceled := map[string]bool{}
+	errs := []error{}
+	for j, tasks := range timedOut {
+		for name, ts := range tasks {
+			if needed[j.MakeTaskKey(name)] {
+				continue
+			}
+			for _, t := range ts {
+				if t.Status != db.TASK_STATUS_PENDING || t.SwarmingTaskId == "" || canceled[t.SwarmingTaskId] {
+					continue
+				}
+				canceled[t.SwarmingTaskId] = true
+				glog.Infof("Canceling pending task %s (Swarming task %s) for timed-out Job %s", t.Id, t.SwarmingTaskId, j.Id)
+				if err := s.swarming.CancelTask(t.SwarmingTaskId); err != nil {
+					errs = append(errs, fmt.Errorf("Failed to cancel Swarming task %s: %s", t.SwarmingTaskId, err))
+				}
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("Got errors canceling pending tasks: %v", errs)
+	}
+	return nil
+}
+
 // getTasksForJob finds all Tasks for the given Job. It returns the Tasks
 // in a map keyed by name.
 func (s *TaskScheduler) getTasksForJob(j *db.Job) (map[string][]*db.Task, error) {
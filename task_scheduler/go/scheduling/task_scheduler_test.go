@@ -155,7 +155,7 @@ func setup(t *testing.T) (*util.TempRepo, db.DB, *swarming.TestClient, *TaskSche
 	repos := repograph.Map{
 		repoName: repo,
 	}
-	s, err := NewTaskScheduler(d, time.Duration(math.MaxInt64), tr.Dir, repos, isolateClient, swarmingClient, urlMock.Client(), 1.0, tryjobs.API_URL_TESTING, tryjobs.BUCKET_TESTING, projectRepoMapping)
+	s, err := NewTaskScheduler(d, time.Duration(math.MaxInt64), tr.Dir, repos, isolateClient, swarmingClient, urlMock.Client(), 1.0, &defaultScorer{}, tryjobs.API_URL_TESTING, tryjobs.BUCKET_TESTING, projectRepoMapping)
 	assert.NoError(t, err)
 	return tr, d, swarmingClient, s, urlMock
 }
@@ -245,6 +245,7 @@ func TestFindTaskCandidatesForJobs(t *testing.T) {
 		RepoState:    rs1.Copy(),
 	}
 	tc1 := &taskCandidate{
+		JobPriority: 0.5,
 		TaskKey: db.TaskKey{
 			RepoState: rs1.Copy(),
 			Name:      buildTask,
@@ -252,6 +253,7 @@ func TestFindTaskCandidatesForJobs(t *testing.T) {
 		TaskSpec: ts[rs1][buildTask].Copy(),
 	}
 	tc2 := &taskCandidate{
+		JobPriority: 0.5,
 		TaskKey: db.TaskKey{
 			RepoState: rs1.Copy(),
 			Name:      testTask,
@@ -265,7 +267,7 @@ func TestFindTaskCandidatesForJobs(t *testing.T) {
 	})
 
 	// Add a job, ensure that its dependencies are added and that the right
-	// dependencies are de-duplicated.
+	// dependencies are de-duplicated, using the highest Job priority.
 	j2 := &db.Job{
 		Name:         "j2",
 		Dependencies: map[string][]string{testTask: []string{buildTask}, buildTask: []string{}},
@@ -275,10 +277,11 @@ func TestFindTaskCandidatesForJobs(t *testing.T) {
 	j3 := &db.Job{
 		Name:         "j3",
 		Dependencies: map[string][]string{perfTask: []string{buildTask}, buildTask: []string{}},
-		Priority:     0.6,
+		Priority:     0.7,
 		RepoState:    rs2,
 	}
 	tc3 := &taskCandidate{
+		JobPriority: 0.7,
 		TaskKey: db.TaskKey{
 			RepoState: rs2.Copy(),
 			Name:      buildTask,
@@ -286,6 +289,7 @@ func TestFindTaskCandidatesForJobs(t *testing.T) {
 		TaskSpec: ts[rs2][buildTask].Copy(),
 	}
 	tc4 := &taskCandidate{
+		JobPriority: 0.6,
 		TaskKey: db.TaskKey{
 			RepoState: rs2.Copy(),
 			Name:      testTask,
@@ -293,6 +297,7 @@ func TestFindTaskCandidatesForJobs(t *testing.T) {
 		TaskSpec: ts[rs2][testTask].Copy(),
 	}
 	tc5 := &taskCandidate{
+		JobPriority: 0.7,
 		TaskKey: db.TaskKey{
 			RepoState: rs2.Copy(),
 			Name:      perfTask,
@@ -310,6 +315,7 @@ func TestFindTaskCandidatesForJobs(t *testing.T) {
 
 	// Finish j3, ensure that its task specs no longer show up.
 	delete(allCandidates, j3.MakeTaskKey(perfTask))
+	tc3.JobPriority = 0.6
 	test([]*db.Job{j1, j2}, allCandidates)
 }
 
@@ -513,6 +519,81 @@ func TestFilterTaskCandidates(t *testing.T) {
 	}
 }
 
+func TestFilterTaskCandidatesRetryPolicy(t *testing.T) {
+	tr, d, _, s, _ := setup(t)
+	defer tr.Cleanup()
+
+	// Only retry mishaps, up to three total attempts.
+	k1 := db.TaskKey{
+		RepoState: rs1,
+		Name:      buildTask,
+	}
+	candidates := map[db.TaskKey]*taskCandidate{
+		k1: &taskCandidate{
+			TaskKey: k1,
+			TaskSpec: &specs.TaskSpec{
+				RetryPolicy: &db.RetryPolicy{
+					MaxAttempts: 3,
+					RetryOn:     db.RETRY_ON_MISHAP,
+				},
+			},
+		},
+	}
+
+	// Helper function which returns the single remaining candidate, if
+	// any.
+	filter := func() *taskCandidate {
+		c, err := s.filterTaskCandidates(candidates)
+		assert.NoError(t, err)
+		var rv *taskCandidate
+		for _, byRepo := range c {
+			for _, byName := range byRepo {
+				for _, candidate := range byName {
+					assert.Nil(t, rv)
+					rv = candidate
+				}
+			}
+		}
+		return rv
+	}
+	c := filter()
+	assert.NotNil(t, c)
+	assert.Equal(t, "", c.RetryOf)
+
+	// The first attempt failed. Failures are not retried.
+	t1 := makeTask(buildTask, repoName, c1)
+	t1.Status = db.TASK_STATUS_FAILURE
+	assert.NoError(t, d.PutTask(t1))
+	assert.NoError(t, s.tCache.Update())
+	assert.Nil(t, filter())
+
+	// The first attempt had a mishap. Retry it.
+	t1.Status = db.TASK_STATUS_MISHAP
+	assert.NoError(t, d.PutTask(t1))
+	assert.NoError(t, s.tCache.Update())
+	c = filter()
+	assert.NotNil(t, c)
+	assert.Equal(t, t1.Id, c.RetryOf)
+
+	// The retry had a mishap as well. We have one more attempt.
+	t2 := makeTask(buildTask, repoName, c1)
+	t2.RetryOf = t1.Id
+	t2.Status = db.TASK_STATUS_MISHAP
+	assert.NoError(t, d.PutTask(t2))
+	assert.NoError(t, s.tCache.Update())
+	c = filter()
+	assert.NotNil(t, c)
+	assert.Equal(t, t2.Id, c.RetryOf)
+
+	// The third attempt had a mishap. Don't retry again.
+	t3 := makeTask(buildTask, repoName, c1)
+	t3.RetryOf = t2.Id
+	t3.Status = db.TASK_STATUS_MISHAP
+	assert.NoError(t, d.PutTask(t3))
+	assert.NoError(t, s.tCache.Update())
+	assert.Nil(t, filter())
+}
+
 func TestProcessTaskCandidate(t *testing.T) {
 	tr, _, _, s, _ := setup(t)
 	defer tr.Cleanup()
@@ -567,6 +648,26 @@ func TestProcessTaskCandidate(t *testing.T) {
 	assert.NoError(t, s.processTaskCandidate(c, now, cache, commitsBuf))
 	assert.True(t, c.Score > 0)
 	assert.Equal(t, 1, len(c.Commits))
+	assert.Equal(t, 2, len(c.ScoreBreakdown))
+	assert.Equal(t, SCORE_COMPONENT_TESTEDNESS_INCREASE, c.ScoreBreakdown[0].Name)
+	assert.Equal(t, SCORE_COMPONENT_TIME_DECAY, c.ScoreBreakdown[1].Name)
+	assert.Equal(t, c.ScoreBreakdown[0].Value*c.ScoreBreakdown[1].Value, c.Score)
+
+	// Retries have a blamelist and a specific score, higher than that of
+	// any normal candidate.
+	c = &taskCandidate{
+		JobCreated: now.Add(-3 * time.Hour),
+		RetryOf:    "my-task",
+		TaskKey: db.TaskKey{
+			RepoState: db.RepoState{
+				Repo:     repoName,
+				Revision: c2,
+			},
+		},
+	}
+	assert.NoError(t, s.processTaskCandidate(c, now, cache, commitsBuf))
+	assert.Equal(t, CANDIDATE_SCORE_RETRY+3.0, c.Score)
+	assert.Equal(t, 1, len(c.Commits))
 }
 
 func TestProcessTaskCandidates(t *testing.T) {
@@ -1283,44 +1384,44 @@ func makeSwarmingBot(id string, dims []string) *swarming_api.SwarmingRpcsBotInfo
 func TestGetCandidatesToSchedule(t *testing.T) {
 	testutils.MediumTest(t)
 	// Empty lists.
-	rv := getCandidatesToSchedule([]*swarming_api.SwarmingRpcsBotInfo{}, []*taskCandidate{})
+	rv := getCandidatesToSchedule([]*swarming_api.SwarmingRpcsBotInfo{}, []*taskCandidate{}, 1.0)
 	assert.Equal(t, 0, len(rv))
 
 	t1 := makeTaskCandidate("task1", []string{"k:v"})
-	rv = getCandidatesToSchedule([]*swarming_api.SwarmingRpcsBotInfo{}, []*taskCandidate{t1})
+	rv = getCandidatesToSchedule([]*swarming_api.SwarmingRpcsBotInfo{}, []*taskCandidate{t1}, 1.0)
 	assert.Equal(t, 0, len(rv))
 
 	b1 := makeSwarmingBot("bot1", []string{"k:v"})
-	rv = getCandidatesToSchedule([]*swarming_api.SwarmingRpcsBotInfo{b1}, []*taskCandidate{})
+	rv = getCandidatesToSchedule([]*swarming_api.SwarmingRpcsBotInfo{b1}, []*taskCandidate{}, 1.0)
 	assert.Equal(t, 0, len(rv))
 
 	// Single match.
-	rv = getCandidatesToSchedule([]*swarming_api.SwarmingRpcsBotInfo{b1}, []*taskCandidate{t1})
+	rv = getCandidatesToSchedule([]*swarming_api.SwarmingRpcsBotInfo{b1}, []*taskCandidate{t1}, 1.0)
 	testutils.AssertDeepEqual(t, []*taskCandidate{t1}, rv)
 
 	// No match.
 	t1.TaskSpec.Dimensions[0] = "k:v2"
-	rv = getCandidatesToSchedule([]*swarming_api.SwarmingRpcsBotInfo{b1}, []*taskCandidate{t1})
+	rv = getCandidatesToSchedule([]*swarming_api.SwarmingRpcsBotInfo{b1}, []*taskCandidate{t1}, 1.0)
 	assert.Equal(t, 0, len(rv))
 
 	// Add a task candidate to match b1.
 	t1 = makeTaskCandidate("task1", []string{"k:v2"})
 	t2 := makeTaskCandidate("task2", []string{"k:v"})
-	rv = getCandidatesToSchedule([]*swarming_api.SwarmingRpcsBotInfo{b1}, []*taskCandidate{t1, t2})
+	rv = getCandidatesToSchedule([]*swarming_api.SwarmingRpcsBotInfo{b1}, []*taskCandidate{t1, t2}, 1.0)
 	testutils.AssertDeepEqual(t, []*taskCandidate{t2}, rv)
 
 	// Switch the task order.
 	t1 = makeTaskCandidate("task1", []string{"k:v2"})
 	t2 = makeTaskCandidate("task2", []string{"k:v"})
-	rv = getCandidatesToSchedule([]*swarming_api.SwarmingRpcsBotInfo{b1}, []*taskCandidate{t2, t1})
+	rv = getCandidatesToSchedule([]*swarming_api.SwarmingRpcsBotInfo{b1}, []*taskCandidate{t2, t1}, 1.0)
 	testutils.AssertDeepEqual(t, []*taskCandidate{t2}, rv)
 
 	// Make both tasks match the bot, ensure that we pick the first one.
 	t1 = makeTaskCandidate("task1", []string{"k:v"})
 	t2 = makeTaskCandidate("task2", []string{"k:v"})
-	rv = getCandidatesToSchedule([]*swarming_api.SwarmingRpcsBotInfo{b1}, []*taskCandidate{t1, t2})
+	rv = getCandidatesToSchedule([]*swarming_api.SwarmingRpcsBotInfo{b1}, []*taskCandidate{t1, t2}, 1.0)
 	testutils.AssertDeepEqual(t, []*taskCandidate{t1}, rv)
-	rv = getCandidatesToSchedule([]*swarming_api.SwarmingRpcsBotInfo{b1}, []*taskCandidate{t2, t1})
+	rv = getCandidatesToSchedule([]*swarming_api.SwarmingRpcsBotInfo{b1}, []*taskCandidate{t2, t1}, 1.0)
 	testutils.AssertDeepEqual(t, []*taskCandidate{t2}, rv)
 
 	// Multiple dimensions. Ensure that different permutations of the bots
@@ -1335,21 +1436,21 @@ func TestGetCandidatesToSchedule(t *testing.T) {
 	// is first in sorted order. The second task does not get scheduled
 	// because there is no bot available which can run it.
 	// TODO(borenet): Use a more optimal solution to avoid this case.
-	rv = getCandidatesToSchedule([]*swarming_api.SwarmingRpcsBotInfo{b1, b2}, []*taskCandidate{t1, t2})
+	rv = getCandidatesToSchedule([]*swarming_api.SwarmingRpcsBotInfo{b1, b2}, []*taskCandidate{t1, t2}, 1.0)
 	testutils.AssertDeepEqual(t, []*taskCandidate{t1}, rv)
 	t1 = makeTaskCandidate("task1", []string{"k:v"})
 	t2 = makeTaskCandidate("task2", dims)
-	rv = getCandidatesToSchedule([]*swarming_api.SwarmingRpcsBotInfo{b2, b1}, []*taskCandidate{t1, t2})
+	rv = getCandidatesToSchedule([]*swarming_api.SwarmingRpcsBotInfo{b2, b1}, []*taskCandidate{t1, t2}, 1.0)
 	testutils.AssertDeepEqual(t, []*taskCandidate{t1}, rv)
 	// In these two cases, the task with more dimensions has the higher
 	// priority. Both tasks get scheduled.
 	t1 = makeTaskCandidate("task1", []string{"k:v"})
 	t2 = makeTaskCandidate("task2", dims)
-	rv = getCandidatesToSchedule([]*swarming_api.SwarmingRpcsBotInfo{b1, b2}, []*taskCandidate{t2, t1})
+	rv = getCandidatesToSchedule([]*swarming_api.SwarmingRpcsBotInfo{b1, b2}, []*taskCandidate{t2, t1}, 1.0)
 	testutils.AssertDeepEqual(t, []*taskCandidate{t2, t1}, rv)
 	t1 = makeTaskCandidate("task1", []string{"k:v"})
 	t2 = makeTaskCandidate("task2", dims)
-	rv = getCandidatesToSchedule([]*swarming_api.SwarmingRpcsBotInfo{b2, b1}, []*taskCandidate{t2, t1})
+	rv = getCandidatesToSchedule([]*swarming_api.SwarmingRpcsBotInfo{b2, b1}, []*taskCandidate{t2, t1}, 1.0)
 	testutils.AssertDeepEqual(t, []*taskCandidate{t2, t1}, rv)
 
 	// Matching dimensions. More bots than tasks.
@@ -1358,17 +1459,82 @@ func TestGetCandidatesToSchedule(t *testing.T) {
 	t1 = makeTaskCandidate("task1", dims)
 	t2 = makeTaskCandidate("task2", dims)
 	t3 := makeTaskCandidate("task3", dims)
-	rv = getCandidatesToSchedule([]*swarming_api.SwarmingRpcsBotInfo{b1, b2, b3}, []*taskCandidate{t1, t2})
+	rv = getCandidatesToSchedule([]*swarming_api.SwarmingRpcsBotInfo{b1, b2, b3}, []*taskCandidate{t1, t2}, 1.0)
 	testutils.AssertDeepEqual(t, []*taskCandidate{t1, t2}, rv)
 
 	// More tasks than bots.
 	t1 = makeTaskCandidate("task1", dims)
 	t2 = makeTaskCandidate("task2", dims)
 	t3 = makeTaskCandidate("task3", dims)
-	rv = getCandidatesToSchedule([]*swarming_api.SwarmingRpcsBotInfo{b1, b2}, []*taskCandidate{t1, t2, t3})
+	rv = getCandidatesToSchedule([]*swarming_api.SwarmingRpcsBotInfo{b1, b2}, []*taskCandidate{t1, t2, t3}, 1.0)
 	testutils.AssertDeepEqual(t, []*taskCandidate{t1, t2}, rv)
 }
 
+func TestGetFilteredCandidatesToSchedule(t *testing.T) {
+	testutils.SmallTest(t)
+	dims := []string{"k:v"}
+	b1 := makeSwarmingBot("bot1", dims)
+	b2 := makeSwarmingBot("bot2", dims)
+	t1 := makeTaskCandidate("task1", dims)
+	t2 := makeTaskCandidate("task2", dims)
+	t3 := makeTaskCandidate("task3", dims)
+
+	// A candidate which is filtered out doesn't use up a bot; it goes to
+	// the next candidate instead.
+	filtered := []*taskCandidate{}
+	filter := func(c *taskCandidate) (bool, error) {
+		filtered = append(filtered, c)
+		return c != t1, nil
+	}
+	rv, err := getFilteredCandidatesToSchedule([]*swarming_api.SwarmingRpcsBotInfo{b1, b2}, []*taskCandidate{t1, t2, t3}, 1.0, filter)
+	assert.NoError(t, err)
+	testutils.AssertDeepEqual(t, []*taskCandidate{t2, t3}, rv)
+	testutils.AssertDeepEqual(t, []*taskCandidate{t1, t2, t3}, filtered)
+
+	// Errors from the filter are returned.
+	t1 = makeTaskCandidate("task1", dims)
+	_, err = getFilteredCandidatesToSchedule([]*swarming_api.SwarmingRpcsBotInfo{b1}, []*taskCandidate{t1}, 1.0, func(c *taskCandidate) (bool, error) {
+		return false, fmt.Errorf("Failed")
+	})
+	assert.Error(t, err)
+}
+
+func TestGetCandidatesToScheduleMaxBotShare(t *testing.T) {
+	testutils.SmallTest(t)
+	dims := []string{"k:v"}
+	bots := []*swarming_api.SwarmingRpcsBotInfo{
+		makeSwarmingBot("bot1", dims),
+		makeSwarmingBot("bot2", dims),
+		makeSwarmingBot("bot3", dims),
+		makeSwarmingBot("bot4", dims),
+	}
+	mk := func() []*taskCandidate {
+		t1 := makeTaskCandidate("task1", dims)
+		t1.Revision = "a"
+		t2 := makeTaskCandidate("task1", dims)
+		t2.Revision = "b"
+		t3 := makeTaskCandidate("task1", dims)
+		t3.Revision = "c"
+		t4 := makeTaskCandidate("task2", dims)
+		return []*taskCandidate{t1, t2, t3, t4}
+	}
+
+	// No limit; the first TaskSpec takes three of the bots.
+	c := mk()
+	rv := getCandidatesToSchedule(bots, c, 1.0)
+	testutils.AssertDeepEqual(t, c, rv)
+
+	// Each TaskSpec may take half of the bots.
+	c = mk()
+	rv = getCandidatesToSchedule(bots, c, 0.5)
+	testutils.AssertDeepEqual(t, []*taskCandidate{c[0], c[1], c[3]}, rv)
+
+	// Each TaskSpec always gets at least one bot.
+	c = mk()
+	rv = getCandidatesToSchedule(bots, c, 0.01)
+	testutils.AssertDeepEqual(t, []*taskCandidate{c[0], c[3]}, rv)
+}
+
 func makeBot(id string, dims map[string]string) *swarming_api.SwarmingRpcsBotInfo {
 	dimensions := make([]*swarming_api.SwarmingRpcsStringListPair, 0, len(dims))
 	for k, v := range dims {
@@ -1779,7 +1945,7 @@ func TestMultipleCandidatesBackfillingEachOther(t *testing.T) {
 	repos := repograph.Map{
 		repoName: repo,
 	}
-	s, err := NewTaskScheduler(d, time.Duration(math.MaxInt64), workdir, repos, isolateClient, swarmingClient, mockhttpclient.NewURLMock().Client(), 1.0, tryjobs.API_URL_TESTING, tryjobs.BUCKET_TESTING, projectRepoMapping)
+	s, err := NewTaskScheduler(d, time.Duration(math.MaxInt64), workdir, repos, isolateClient, swarmingClient, mockhttpclient.NewURLMock().Client(), 1.0, &defaultScorer{}, tryjobs.API_URL_TESTING, tryjobs.BUCKET_TESTING, projectRepoMapping)
 	assert.NoError(t, err)
 
 	mockTasks := []*swarming_api.SwarmingRpcsTaskRequestMetadata{}
@@ -1892,6 +2058,171 @@ func TestMultipleCandidatesBackfillingEachOther(t *testing.T) {
 	}
 }
 
+func TestIdempotentTaskDedup(t *testing.T) {
+	testutils.MediumTest(t)
+	testutils.SkipIfShort(t)
+
+	workdir, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer testutils.RemoveAll(t, workdir)
+	assert.NoError(t, os.Mkdir(path.Join(workdir, TRIGGER_DIRNAME), os.ModePerm))
+
+	run := func(dir string, cmd ...string) {
+		_, err := exec.RunCwd(dir, cmd...)
+		assert.NoError(t, err)
+	}
+
+	addFile := func(repoDir, subPath, contents string) {
+		assert.NoError(t, ioutil.WriteFile(path.Join(repoDir, subPath), []byte(contents), os.ModePerm))
+		run(repoDir, "git", "add", subPath)
+	}
+
+	repoName := "skia.git"
+	repoDir := path.Join(workdir, repoName)
+
+	assert.NoError(t, ioutil.WriteFile(path.Join(workdir, ".gclient"), []byte("dummy"), os.ModePerm))
+
+	assert.NoError(t, os.Mkdir(path.Join(workdir, repoName), os.ModePerm))
+	run(repoDir, "git", "init")
+	run(repoDir, "git", "remote", "add", "origin", ".")
+
+	infraBotsSubDir := path.Join("infra", "bots")
+	infraBotsDir := path.Join(repoDir, infraBotsSubDir)
+	assert.NoError(t, os.MkdirAll(infraBotsDir, os.ModePerm))
+
+	addFile(repoDir, "somefile.txt", "dummy3")
+	addFile(repoDir, path.Join(infraBotsSubDir, "dummy.isolate"), `{
+  'variables': {
+    'command': [
+      'python', 'recipes.py', 'run',
+    ],
+    'files': [
+      '../../somefile.txt',
+    ],
+  },
+}`)
+
+	// Create a single idempotent task in the config.
+	taskName := "dummytask"
+	cfg := &specs.TasksCfg{
+		Tasks: map[string]*specs.TaskSpec{
+			taskName: &specs.TaskSpec{
+				CipdPackages: []*specs.CipdPackage{},
+				Dependencies: []string{},
+				Dimensions:   []string{"pool:Skia"},
+				Idempotent:   true,
+				Isolate:      "dummy.isolate",
+				Priority:     1.0,
+			},
+		},
+		Jobs: map[string]*specs.JobSpec{
+			"j1": &specs.JobSpec{
+				TaskSpecs: []string{taskName},
+			},
+		},
+	}
+	f, err := os.Create(path.Join(repoDir, specs.TASKS_CFG_FILE))
+	assert.NoError(t, err)
+	assert.NoError(t, json.NewEncoder(f).Encode(&cfg))
+	assert.NoError(t, f.Close())
+	run(repoDir, "git", "add", specs.TASKS_CFG_FILE)
+	run(repoDir, "git", "commit", "-m", "Add more tasks!")
+	run(repoDir, "git", "push", "origin", "master")
+	run(repoDir, "git", "branch", "-u", "origin/master")
+
+	// Setup the scheduler.
+	d := db.NewInMemoryDB()
+	isolateClient, err := isolate.NewClient(workdir)
+	assert.NoError(t, err)
+	isolateClient.ServerUrl = isolate.FAKE_SERVER_URL
+	swarmingClient := swarming.NewTestClient()
+	repo, err := repograph.NewGraph(repoName, workdir)
+	assert.NoError(t, err)
+	repos := repograph.Map{
+		repoName: repo,
+	}
+	s, err := NewTaskScheduler(d, time.Duration(math.MaxInt64), workdir, repos, isolateClient, swarmingClient, mockhttpclient.NewURLMock().Client(), 1.0, &defaultScorer{}, tryjobs.API_URL_TESTING, tryjobs.BUCKET_TESTING, projectRepoMapping)
+	assert.NoError(t, err)
+
+	// Cycle once. We should trigger a task at the first commit.
+	bot1 := makeBot("bot1", map[string]string{"pool": "Skia"})
+	swarmingClient.MockBots([]*swarming_api.SwarmingRpcsBotInfo{bot1})
+	assert.NoError(t, s.MainLoop())
+	assert.NoError(t, s.tCache.Update())
+	head, err := s.repos[repoName].Repo().RevParse("HEAD")
+	assert.NoError(t, err)
+	tasks, err := s.tCache.GetTasksForCommits(repoName, []string{head})
+	assert.NoError(t, err)
+	t1 := tasks[head][taskName]
+	assert.NotNil(t, t1)
+	assert.NotEqual(t, "", t1.PropertiesHash)
+	assert.Equal(t, "", t1.DedupedFrom)
+
+	// Add a commit which does not change the inputs of the task.
+	exec_testutils.Run(t, repoDir, "git", "checkout", "master")
+	makeDummyCommits(t, repoDir, 1, "master")
+	assert.NoError(t, s.repos[repoName].Repo().Update())
+	head2, err := s.repos[repoName].Repo().RevParse("HEAD")
+	assert.NoError(t, err)
+
+	// The first task is still pending, so we shouldn't trigger a duplicate.
+	assert.NoError(t, s.MainLoop())
+	assert.NoError(t, s.tCache.Update())
+	tasks, err = s.tCache.GetTasksForCommits(repoName, []string{head2})
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(tasks[head2]))
+	unfinished, err := s.tCache.UnfinishedTasks()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(unfinished))
+	// The deferred candidate was matched with a bot, so it isn't starved.
+	assert.Equal(t, 0, len(s.starvation.list()))
+
+	// The first task succeeded. Its results should be reused at the second
+	// commit, without triggering another Swarming task.
+	t1.Status = db.TASK_STATUS_SUCCESS
+	t1.Started = time.Now()
+	t1.Finished = time.Now()
+	t1.IsolatedOutput = "abc123"
+	swarmingClient.MockTasks([]*swarming_api.SwarmingRpcsTaskRequestMetadata{makeSwarmingRpcsTaskRequestMetadata(t, t1)})
+	assert.NoError(t, s.MainLoop())
+	assert.NoError(t, s.tCache.Update())
+	tasks, err = s.tCache.GetTasksForCommits(repoName, []string{head2})
+	assert.NoError(t, err)
+	t2 := tasks[head2][taskName]
+	assert.NotNil(t, t2)
+	assert.Equal(t, t1.Id, t2.DedupedFrom)
+	assert.Equal(t, t1.PropertiesHash, t2.PropertiesHash)
+	assert.Equal(t, t1.SwarmingTaskId, t2.SwarmingTaskId)
+	assert.Equal(t, t1.IsolatedOutput, t2.IsolatedOutput)
+	assert.Equal(t, db.TASK_STATUS_SUCCESS, t2.Status)
+	testutils.AssertDeepEqual(t, []string{head2}, t2.Commits)
+	assert.True(t, t1.Created.Equal(t2.Created))
+	assert.False(t, t2.Started.Before(t2.Created))
+	assert.False(t, t2.Finished.Before(t2.Started))
+	unfinished, err = s.tCache.UnfinishedTasks()
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(unfinished))
+	swarmingTasks, err := swarmingClient.ListTasks(time.Time{}, time.Now(), []string{}, "")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(swarmingTasks))
+
+	// Both Jobs should be finished, each recording its own Task.
+	assert.NoError(t, s.MainLoop())
+	jobs, err := d.GetJobsFromDateRange(time.Time{}, time.Now())
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(jobs))
+	for _, j := range jobs {
+		assert.Equal(t, db.JOB_STATUS_SUCCESS, j.Status)
+		expect := t1.Id
+		if j.Revision == head2 {
+			expect = t2.Id
+		}
+		assert.Equal(t, 1, len(j.Tasks[taskName]))
+		assert.Equal(t, expect, j.Tasks[taskName][0].Id)
+		assert.Equal(t, t1.SwarmingTaskId, j.Tasks[taskName][0].SwarmingTaskId)
+	}
+}
+
 func TestSchedulingRetry(t *testing.T) {
 	tr, d, swarmingClient, s, _ := setup(t)
 	defer tr.Cleanup()
@@ -2382,6 +2713,90 @@ func TestTaskTimeouts(t *testing.T) {
 	assert.Equal(t, int64(2*60*60), swarmingTask.Request.ExpirationSecs)
 }
 
+// cancelTrackingSwarmingClient is a swarming.ApiClient which records the IDs of
+// the tasks it is asked to cancel.
+type cancelTrackingSwarmingClient struct {
+	*swarming.TestClient
+	canceled []string
+}
+
+func (c *cancelTrackingSwarmingClient) CancelTask(id string) error {
+	c.canceled = append(c.canceled, id)
+	return c.TestClient.CancelTask(id)
+}
+
+func TestJobTimeouts(t *testing.T) {
+	tr, d, swarmingClient, s, _ := setup(t)
+	defer tr.Cleanup()
+	cancelClient := &cancelTrackingSwarmingClient{
+		TestClient: swarmingClient,
+		canceled:   []string{},
+	}
+	s.swarming = cancelClient
+
+	// Trigger the build task at c2, which is needed by all three Jobs at
+	// c2.
+	bot1 := makeBot("bot1", map[string]string{"pool": "Skia", "os": "Ubuntu"})
+	swarmingClient.MockBots([]*swarming_api.SwarmingRpcsBotInfo{bot1})
+	assert.NoError(t, s.MainLoop())
+	assert.NoError(t, s.tCache.Update())
+	unfinished, err := s.tCache.UnfinishedTasks()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(unfinished))
+	t1 := unfinished[0]
+	assert.Equal(t, c2, t1.Revision)
+	assert.Equal(t, db.TASK_STATUS_PENDING, t1.Status)
+
+	jobs, err := s.jCache.UnfinishedJobs()
+	assert.NoError(t, err)
+	assert.Equal(t, 5, len(jobs))
+	c2Jobs := map[string]*db.Job{}
+	for _, j := range jobs {
+		if j.Revision == c2 {
+			c2Jobs[j.Name] = j
+		}
+	}
+	assert.Equal(t, 3, len(c2Jobs))
+
+	// timeOut makes the given Jobs exceed their max duration.
+	timeOut := func(names ...string) {
+		for _, name := range names {
+			j, err := s.jCache.GetJob(c2Jobs[name].Id)
+			assert.NoError(t, err)
+			j.Created = time.Now().Add(-2 * time.Hour)
+			j.MaxDuration = time.Hour
+			assert.NoError(t, d.PutJob(j))
+		}
+		assert.NoError(t, s.jCache.Update())
+		assert.NoError(t, s.updateUnfinishedJobs())
+		for _, name := range names {
+			j, err := s.jCache.GetJob(c2Jobs[name].Id)
+			assert.NoError(t, err)
+			assert.Equal(t, db.JOB_STATUS_TIMED_OUT, j.Status)
+			assert.False(t, util.TimeIsZero(j.Finished))
+		}
+	}
+
+	// Time out the build Job. The pending build task is still needed by
+	// the other Jobs, so it should not be canceled.
+	timeOut(buildTask)
+	assert.Equal(t, []string{}, cancelClient.canceled)
+	jobs, err = s.jCache.UnfinishedJobs()
+	assert.NoError(t, err)
+	assert.Equal(t, 4, len(jobs))
+
+	// Time out the remaining Jobs at c2. Now the pending build task
+	// should be canceled.
+	timeOut(testTask, perfTask)
+	assert.Equal(t, []string{t1.SwarmingTaskId}, cancelClient.canceled)
+	jobs, err = s.jCache.UnfinishedJobs()
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(jobs))
+	for _, j := range jobs {
+		assert.Equal(t, c1, j.Revision)
+	}
+}
+
 func TestPeriodicJobs(t *testing.T) {
 	tr, _, _, s, _ := setup(t)
 	defer tr.Cleanup()
@@ -89,6 +89,12 @@ func (c *TasksCfg) Validate() error {
 		}
 	}
 
+	for _, j := range c.Jobs {
+		if err := j.Validate(); err != nil {
+			return err
+		}
+	}
+
 	if err := findCycles(c.Tasks, c.Jobs); err != nil {
 		return err
 	}
@@ -99,11 +105,26 @@ func (c *TasksCfg) Validate() error {
 // TaskSpec is a struct which describes a Swarming task to run.
 // Be sure to add any new fields to the Copy() method.
 type TaskSpec struct {
+	// Bisect indicates that the scheduler should automatically bisect the
+	// blamelist of a newly-failing task for this TaskSpec by running
+	// additional tasks at high priority, and record the culprit commit as
+	// a comment on the failing task.
+	Bisect bool `json:"bisect,omitempty"`
+
 	// CipdPackages are CIPD packages which should be installed for the task.
 	CipdPackages []*CipdPackage `json:"cipd_packages,omitempty"`
 
+	// ConditionalDependencies are other TaskSpecs whose tasks need to
+	// finish before this task, along with the results of those tasks which
+	// trigger this task, eg. to upload results when a test fails or to run
+	// cleanup regardless of the outcome. If a parent task finishes with a
+	// result which does not trigger this task, this task is skipped, and
+	// it does not affect the status of the Job. A TaskSpec may not appear
+	// in both Dependencies and ConditionalDependencies.
+	ConditionalDependencies []*db.TaskDependency `json:"conditional_dependencies,omitempty"`
+
 	// Dependencies are names of other TaskSpecs for tasks which need to run
-	// before this task.
+	// successfully before this task.
 	Dependencies []string `json:"dependencies,omitempty"`
 
 	// Dimensions are Swarming bot dimensions which describe the type of bot
@@ -124,6 +145,13 @@ type TaskSpec struct {
 	// ExtraArgs are extra command-line arguments to pass to the task.
 	ExtraArgs []string `json:"extra_args,omitempty"`
 
+	// Idempotent indicates that tasks for this TaskSpec produce the same
+	// results given the same inputs. If true, the scheduler may reuse the
+	// results of a previous task whose Swarming inputs, including the
+	// isolated input hash and dimensions, are identical, rather than
+	// triggering a new task.
+	Idempotent bool `json:"idempotent,omitempty"`
+
 	// IoTimeout is the maximum amount of time which the task may take to
 	// communicate with the server.
 	IoTimeout time.Duration `json:"io_timeout_ns,omitempty"`
@@ -133,6 +161,10 @@ type TaskSpec struct {
 
 	// Priority indicates the relative priority of the task, with 0 < p <= 1
 	Priority float64 `json:"priority"`
+
+	// RetryPolicy describes when failed tasks for this TaskSpec should be
+	// retried. If not specified, db.DEFAULT_RETRY_POLICY is used.
+	RetryPolicy *db.RetryPolicy `json:"retry_policy,omitempty"`
 }
 
 // Validate ensures that the TaskSpec is defined properly.
@@ -157,9 +189,49 @@ func (t *TaskSpec) Validate(cfg *TasksCfg) error {
 		return fmt.Errorf("Isolate file is required.")
 	}
 
+	// Ensure that the retry policy is valid.
+	if t.RetryPolicy != nil {
+		if err := t.RetryPolicy.Validate(); err != nil {
+			return err
+		}
+	}
+
+	// Ensure that the conditional dependencies are valid and don't
+	// duplicate the unconditional dependencies.
+	seen := util.NewStringSet(t.Dependencies)
+	for _, d := range t.ConditionalDependencies {
+		if err := d.Validate(); err != nil {
+			return err
+		}
+		if seen[d.Task] {
+			return fmt.Errorf("Task %q is listed more than once as a dependency.", d.Task)
+		}
+		seen[d.Task] = true
+	}
+
 	return nil
 }
 
+// GetAllDependencies returns the names of all TaskSpecs upon which this TaskSpec
+// depends, both unconditionally and conditionally.
+func (t *TaskSpec) GetAllDependencies() []string {
+	rv := make([]string, 0, len(t.Dependencies)+len(t.ConditionalDependencies))
+	rv = append(rv, t.Dependencies...)
+	for _, d := range t.ConditionalDependencies {
+		rv = append(rv, d.Task)
+	}
+	return rv
+}
+
+// GetRetryPolicy returns the RetryPolicy of the TaskSpec, or
+// db.DEFAULT_RETRY_POLICY if it doesn't specify one.
+func (t *TaskSpec) GetRetryPolicy() *db.RetryPolicy {
+	if t.RetryPolicy != nil {
+		return t.RetryPolicy
+	}
+	return db.DEFAULT_RETRY_POLICY
+}
+
 // Copy returns a copy of the TaskSpec.
 func (t *TaskSpec) Copy() *TaskSpec {
 	var cipdPackages []*CipdPackage
@@ -171,21 +243,36 @@ func (t *TaskSpec) Copy() *TaskSpec {
 			cipdPackages = append(cipdPackages, &pkgs[i])
 		}
 	}
+	var condDeps []*db.TaskDependency
+	if t.ConditionalDependencies != nil {
+		condDeps = make([]*db.TaskDependency, 0, len(t.ConditionalDependencies))
+		for _, d := range t.ConditionalDependencies {
+			condDeps = append(condDeps, d.Copy())
+		}
+	}
 	deps := util.CopyStringSlice(t.Dependencies)
 	dims := util.CopyStringSlice(t.Dimensions)
 	environment := util.CopyStringMap(t.Environment)
 	extraArgs := util.CopyStringSlice(t.ExtraArgs)
+	var retryPolicy *db.RetryPolicy
+	if t.RetryPolicy != nil {
+		retryPolicy = t.RetryPolicy.Copy()
+	}
 	return &TaskSpec{
-		CipdPackages:     cipdPackages,
-		Dependencies:     deps,
-		Dimensions:       dims,
-		Environment:      environment,
-		ExecutionTimeout: t.ExecutionTimeout,
-		Expiration:       t.Expiration,
-		ExtraArgs:        extraArgs,
-		IoTimeout:        t.IoTimeout,
-		Isolate:          t.Isolate,
-		Priority:         t.Priority,
+		Bisect:                  t.Bisect,
+		CipdPackages:            cipdPackages,
+		ConditionalDependencies: condDeps,
+		Dependencies:            deps,
+		Dimensions:              dims,
+		Environment:             environment,
+		ExecutionTimeout:        t.ExecutionTimeout,
+		Expiration:              t.Expiration,
+		ExtraArgs:               extraArgs,
+		Idempotent:              t.Idempotent,
+		IoTimeout:               t.IoTimeout,
+		Isolate:                 t.Isolate,
+		Priority:                t.Priority,
+		RetryPolicy:             retryPolicy,
 	}
 }
 
@@ -200,9 +287,13 @@ type CipdPackage struct {
 // JobSpec is a struct which describes a set of TaskSpecs to run as part of a
 // larger effort.
 type JobSpec struct {
-	Priority  float64  `json:"priority"`
-	TaskSpecs []string `json:"tasks"`
-	Trigger   string   `json:"trigger,omitempty"`
+	// MaxDuration is the amount of time a Job may remain in progress
+	// before it is marked as timed out and its pending tasks are canceled.
+	// Zero indicates no limit.
+	MaxDuration time.Duration `json:"max_duration_ns,omitempty"`
+	Priority    float64       `json:"priority"`
+	TaskSpecs   []string      `json:"tasks"`
+	Trigger     string        `json:"trigger,omitempty"`
 }
 
 // Copy returns a copy of the JobSpec.
@@ -213,15 +304,24 @@ func (j *JobSpec) Copy() *JobSpec {
 		copy(taskSpecs, j.TaskSpecs)
 	}
 	return &JobSpec{
-		Priority:  j.Priority,
-		TaskSpecs: taskSpecs,
-		Trigger:   j.Trigger,
+		MaxDuration: j.MaxDuration,
+		Priority:    j.Priority,
+		TaskSpecs:   taskSpecs,
+		Trigger:     j.Trigger,
 	}
 }
 
+// Validate returns an error if the JobSpec is not valid.
+func (j *JobSpec) Validate() error {
+	if j.MaxDuration < 0 {
+		return fmt.Errorf("Job max duration must be non-negative; got %s.", j.MaxDuration)
+	}
+	return nil
+}
+
 // GetTaskSpecDAG returns a map describing all of the dependencies of the
 // JobSpec. Its keys are TaskSpec names and values are TaskSpec names upon
-// which the keys depend.
+// which the keys depend, either unconditionally or conditionally.
 func (j *JobSpec) GetTaskSpecDAG(cfg *TasksCfg) (map[string][]string, error) {
 	rv := map[string][]string{}
 	var visit func(string) error
@@ -233,10 +333,7 @@ func (j *JobSpec) GetTaskSpecDAG(cfg *TasksCfg) (map[string][]string, error) {
 		if !ok {
 			return fmt.Errorf("No such task: %s", name)
 		}
-		deps := util.CopyStringSlice(spec.Dependencies)
-		if deps == nil {
-			deps = []string{}
-		}
+		deps := spec.GetAllDependencies()
 		rv[name] = deps
 		for _, t := range deps {
 			if err := visit(t); err != nil {
@@ -419,14 +516,27 @@ func (c *TaskCfgCache) MakeJob(rs db.RepoState, name string) (*db.Job, error) {
 	if err != nil {
 		return nil, err
 	}
+	retryPolicies := map[string]*db.RetryPolicy{}
+	condDeps := map[string][]*db.TaskDependency{}
+	for taskName, _ := range deps {
+		if p := cfg.Tasks[taskName].RetryPolicy; p != nil {
+			retryPolicies[taskName] = p.Copy()
+		}
+		for _, d := range cfg.Tasks[taskName].ConditionalDependencies {
+			condDeps[taskName] = append(condDeps[taskName], d.Copy())
+		}
+	}
 
 	return &db.Job{
-		Created:      time.Now(),
-		Dependencies: deps,
-		Name:         name,
-		Priority:     spec.Priority,
-		RepoState:    rs,
-		Tasks:        map[string][]*db.TaskSummary{},
+		ConditionalDependencies: condDeps,
+		Created:                 time.Now(),
+		Dependencies:            deps,
+		MaxDuration:             spec.MaxDuration,
+		Name:                    name,
+		Priority:                spec.Priority,
+		RepoState:               rs,
+		RetryPolicies:           retryPolicies,
+		Tasks:                   map[string][]*db.TaskSummary{},
 	}, nil
 }
 
@@ -510,7 +620,7 @@ func findCycles(tasks map[string]*TaskSpec, jobs map[string]*JobSpec) error {
 	visit = func(v *vertex) error {
 		v.active = true
 		v.visited = true
-		for _, dep := range v.ts.Dependencies {
+		for _, dep := range v.ts.GetAllDependencies() {
 			e := vertices[dep]
 			if e == nil {
 				return fmt.Errorf("Task %q has unknown task %q as a dependency.", v.name, dep)
@@ -41,6 +41,7 @@ const (
 func TestCopyTaskSpec(t *testing.T) {
 	testutils.SmallTest(t)
 	v := &TaskSpec{
+		Bisect: true,
 		CipdPackages: []*CipdPackage{
 			&CipdPackage{
 				Name:    "pkg",
@@ -48,6 +49,12 @@ func TestCopyTaskSpec(t *testing.T) {
 				Version: "23",
 			},
 		},
+		ConditionalDependencies: []*db.TaskDependency{
+			&db.TaskDependency{
+				Task: "cream",
+				On:   db.DEPENDENCY_ON_FAILURE,
+			},
+		},
 		Dependencies: []string{"coffee", "chocolate"},
 		Dimensions:   []string{"width:13", "height:17"},
 		Environment: map[string]string{
@@ -56,9 +63,14 @@ func TestCopyTaskSpec(t *testing.T) {
 		ExecutionTimeout: 60 * time.Minute,
 		Expiration:       90 * time.Minute,
 		ExtraArgs:        []string{"--do-really-awesome-stuff"},
+		Idempotent:       true,
 		IoTimeout:        10 * time.Minute,
 		Isolate:          "abc123",
 		Priority:         19.0,
+		RetryPolicy: &db.RetryPolicy{
+			MaxAttempts: 3,
+			RetryOn:     db.RETRY_ON_MISHAP,
+		},
 	}
 	testutils.AssertCopy(t, v, v.Copy())
 }
@@ -66,13 +78,26 @@ func TestCopyTaskSpec(t *testing.T) {
 func TestCopyJobSpec(t *testing.T) {
 	testutils.SmallTest(t)
 	v := &JobSpec{
-		TaskSpecs: []string{"Build", "Test"},
-		Trigger:   "trigger-name",
-		Priority:  753,
+		MaxDuration: 2 * time.Hour,
+		TaskSpecs:   []string{"Build", "Test"},
+		Trigger:     "trigger-name",
+		Priority:    753,
 	}
 	testutils.AssertCopy(t, v, v.Copy())
 }
 
+func TestJobSpecValidate(t *testing.T) {
+	testutils.SmallTest(t)
+	j := &JobSpec{
+		TaskSpecs: []string{"Build"},
+	}
+	assert.NoError(t, j.Validate())
+	j.MaxDuration = time.Hour
+	assert.NoError(t, j.Validate())
+	j.MaxDuration = -time.Hour
+	assert.EqualError(t, j.Validate(), "Job max duration must be non-negative; got -1h0m0s.")
+}
+
 func TestTaskSpecs(t *testing.T) {
 	testutils.MediumTest(t)
 	testutils.SkipIfShort(t)
@@ -288,6 +313,83 @@ func TestTasksCircularDependency(t *testing.T) {
 	assert.EqualError(t, err, "Job \"j\" has unknown task \"q\" as a dependency.")
 }
 
+func TestConditionalDependencies(t *testing.T) {
+	testutils.SmallTest(t)
+	makeCfg := func(condDeps map[string][]*db.TaskDependency) (*TasksCfg, error) {
+		var cfg TasksCfg
+		assert.NoError(t, json.Unmarshal([]byte(makeTasksCfg(t, map[string][]string{
+			"build":   []string{},
+			"test":    []string{"build"},
+			"upload":  []string{},
+			"cleanup": []string{},
+		}, map[string][]string{
+			"j": []string{"upload", "cleanup"},
+		})), &cfg))
+		for name, deps := range condDeps {
+			cfg.Tasks[name].ConditionalDependencies = deps
+		}
+		b, err := json.Marshal(&cfg)
+		assert.NoError(t, err)
+		return ParseTasksCfg(string(b))
+	}
+
+	// Valid conditional dependencies are included in the DAG.
+	cfg, err := makeCfg(map[string][]*db.TaskDependency{
+		"upload": []*db.TaskDependency{
+			&db.TaskDependency{Task: "test", On: db.DEPENDENCY_ON_OUTPUT, OutputFile: "results.json", OutputKey: "failed_tests"},
+		},
+		"cleanup": []*db.TaskDependency{
+			&db.TaskDependency{Task: "test", On: db.DEPENDENCY_ON_ANY},
+			&db.TaskDependency{Task: "upload", On: db.DEPENDENCY_ON_FAILURE},
+		},
+	})
+	assert.NoError(t, err)
+	dag, err := cfg.Jobs["j"].GetTaskSpecDAG(cfg)
+	assert.NoError(t, err)
+	testutils.AssertDeepEqual(t, map[string][]string{
+		"build":   []string{},
+		"test":    []string{"build"},
+		"upload":  []string{"test"},
+		"cleanup": []string{"test", "upload"},
+	}, dag)
+
+	// Invalid conditional dependency.
+	_, err = makeCfg(map[string][]*db.TaskDependency{
+		"upload": []*db.TaskDependency{
+			&db.TaskDependency{Task: "test", On: db.DEPENDENCY_ON_OUTPUT},
+		},
+	})
+	assert.EqualError(t, err, "Conditional dependency on \"test\": output_file and output_key are required with on=\"output\".")
+
+	// Duplicate dependency.
+	_, err = makeCfg(map[string][]*db.TaskDependency{
+		"test": []*db.TaskDependency{
+			&db.TaskDependency{Task: "build", On: db.DEPENDENCY_ON_ANY},
+		},
+	})
+	assert.EqualError(t, err, "Task \"build\" is listed more than once as a dependency.")
+
+	// Unknown task.
+	_, err = makeCfg(map[string][]*db.TaskDependency{
+		"upload": []*db.TaskDependency{
+			&db.TaskDependency{Task: "bogus", On: db.DEPENDENCY_ON_ANY},
+		},
+	})
+	assert.EqualError(t, err, "Task \"upload\" has unknown task \"bogus\" as a dependency.")
+
+	// Cycle through a conditional dependency.
+	_, err = makeCfg(map[string][]*db.TaskDependency{
+		"build": []*db.TaskDependency{
+			&db.TaskDependency{Task: "test", On: db.DEPENDENCY_ON_FAILURE},
+		},
+		"upload": []*db.TaskDependency{
+			&db.TaskDependency{Task: "test", On: db.DEPENDENCY_ON_FAILURE},
+		},
+	})
+	assert.Error(t, err)
+	assert.True(t, strings.HasPrefix(err.Error(), "Found a circular dependency"), err.Error())
+}
+
 func tempGitRepoSetup(t *testing.T) (*git_testutils.GitBuilder, string, string) {
 	testutils.SkipIfShort(t)
 
@@ -80,6 +80,9 @@ var (
 	local          = flag.Bool("local", false, "Whether we're running on a dev machine vs in production.")
 	resourcesDir   = flag.String("resources_dir", "", "The directory to find templates, JS, and CSS files. If blank, assumes you're running inside a checkout and will attempt to find the resources relative to this source file.")
 	scoreDecay24Hr = flag.Float64("scoreDecay24Hr", 0.9, "Task candidate scores are penalized using linear time decay. This is the desired value after 24 hours. Setting it to 1.0 causes commits not to be prioritized according to commit time.")
+	scorer         = flag.String("scorer", scheduling.SCORER_DEFAULT, fmt.Sprintf("Strategy used to score task candidates. One of %v.", scheduling.SCORERS))
+	repoWeights    = flag.String("repo_weights", "", "Comma-separated list of repo=weight pairs used by the \"repo_weights\" scorer. Repos which are not listed have a weight of 1.0.")
+	maxBotShare    = flag.Float64("max_bot_share", 0.25, "Maximum fraction of the free bots which any one TaskSpec may take in a scheduling round, used by the \"fair_share\" scorer.")
 	timePeriod     = flag.String("timePeriod", "4d", "Time period to use.")
 	gsBucket       = flag.String("gsBucket", "skia-task-scheduler", "Name of Google Cloud Storage bucket to use for backups and recovery.")
 	workdir        = flag.String("workdir", "workdir", "Working directory to use.")
@@ -473,7 +476,15 @@ func main() {
 
 	// Create and start the task scheduler.
 	glog.Infof("Creating task scheduler.")
-	ts, err = scheduling.NewTaskScheduler(d, period, wdAbs, repos, isolateClient, swarm, httpClient, *scoreDecay24Hr, tryjobs.API_URL_PROD, tryjobs.BUCKET_PRIMARY, PROJECT_REPO_MAPPING)
+	weights, err := scheduling.ParseRepoWeights(*repoWeights)
+	if err != nil {
+		glog.Fatal(err)
+	}
+	sc, err := scheduling.NewScorer(*scorer, weights, *maxBotShare)
+	if err != nil {
+		glog.Fatal(err)
+	}
+	ts, err = scheduling.NewTaskScheduler(d, period, wdAbs, repos, isolateClient, swarm, httpClient, *scoreDecay24Hr, sc, tryjobs.API_URL_PROD, tryjobs.BUCKET_PRIMARY, PROJECT_REPO_MAPPING)
 	if err != nil {
 		glog.Fatal(err)
 	}
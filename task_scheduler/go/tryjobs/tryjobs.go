@@ -418,7 +418,7 @@ func (t *TryJobIntegrator) JobFinished(j *db.Job) error {
 		}
 	} else {
 		failureReason := "BUILD_FAILURE"
-		if j.Status == db.JOB_STATUS_MISHAP {
+		if j.Status == db.JOB_STATUS_MISHAP || j.Status == db.JOB_STATUS_TIMED_OUT {
 			failureReason = "INFRA_FAILURE"
 		}
 		resp, err := t.bb.Fail(j.BuildbucketBuildId, &buildbucket_api.ApiFailRequestBodyMessage{
@@ -244,6 +244,14 @@ func TestJobFinished(t *testing.T) {
 	MockJobMishap(mock, j, now, err)
 	assert.EqualError(t, trybots.JobFinished(j), err.Error())
 	assert.True(t, mock.Empty())
+
+	// Timed out jobs are reported as infra failures.
+	j.Status = db.JOB_STATUS_TIMED_OUT
+	assert.NoError(t, trybots.db.PutJobs([]*db.Job{j}))
+	assert.NoError(t, trybots.jCache.Update())
+	MockJobMishap(mock, j, now, nil)
+	assert.NoError(t, trybots.JobFinished(j))
+	assert.True(t, mock.Empty())
 }
 
 func TestGetJobToSchedule(t *testing.T) {